@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/brendanjerwin/simple_wiki/server"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// clientFlags are the flags every client subcommand takes to reach a running
+// server.
+var clientFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:   "server",
+		Value:  "http://localhost:8050",
+		EnvVar: envName("server"),
+		Usage:  "The running wiki to talk to",
+	},
+	cli.StringFlag{
+		Name:   "token",
+		EnvVar: envName("api-token"),
+		Usage:  "API token to authenticate with (made at /tokens/create); not needed through tailscale serve without an access code",
+	},
+}
+
+// wikiClient talks to a running server's HTTP API.
+type wikiClient struct {
+	server string
+	token  string
+	http   *http.Client
+}
+
+func newWikiClient(c *cli.Context) *wikiClient {
+	return &wikiClient{
+		server: strings.TrimSuffix(c.String("server"), "/"),
+		token:  c.String("token"),
+		http:   &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+func (w *wikiClient) do(method, route string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, w.server+route, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if w.token != "" {
+		req.Header.Set("X-API-Token", w.token)
+	}
+	resp, err := w.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		message, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s %s: %s %s", method, route, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// get returns the body of a GET.
+func (w *wikiClient) get(route string) ([]byte, error) {
+	resp, err := w.do(http.MethodGet, route, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// post sends request as JSON and decodes the JSON answer into response,
+// failing when the server says it didn't succeed.
+func (w *wikiClient) post(route string, request, response interface{}) error {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	resp, err := w.do(http.MethodPost, route, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("POST %s: %v", route, err)
+	}
+	if !result.Success {
+		return fmt.Errorf("POST %s: %s", route, result.Message)
+	}
+	if response == nil {
+		return nil
+	}
+	return json.Unmarshal(body, response)
+}
+
+// postRaw sends request as JSON and returns the answer as is, for routes
+// that don't answer with JSON when they succeed.
+func (w *wikiClient) postRaw(route string, request interface{}) ([]byte, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := w.do(http.MethodPost, route, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var result struct {
+			Success bool   `json:"success"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &result) == nil && !result.Success {
+			return nil, fmt.Errorf("POST %s: %s", route, result.Message)
+		}
+	}
+	return body, nil
+}
+
+// readInput reads the file named, or stdin for "" or "-".
+func readInput(name string) ([]byte, error) {
+	if name == "" || name == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(name)
+}
+
+func clientAction(action func(*cli.Context, *wikiClient) error) func(*cli.Context) error {
+	return func(c *cli.Context) error {
+		if err := action(c, newWikiClient(c)); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
+	}
+}
+
+func withClientFlags(flags ...cli.Flag) []cli.Flag {
+	return append(append([]cli.Flag{}, clientFlags...), flags...)
+}
+
+// clientCommands are the subcommands that script a running server instead
+// of being one.
+var clientCommands = []cli.Command{
+	{
+		Name:  "page",
+		Usage: "Read and write pages",
+		Subcommands: []cli.Command{
+			{
+				Name:      "get",
+				Usage:     "Print a page's markdown, frontmatter and all",
+				ArgsUsage: "IDENTIFIER",
+				Flags:     withClientFlags(),
+				Action: clientAction(func(c *cli.Context, w *wikiClient) error {
+					if c.NArg() != 1 {
+						return fmt.Errorf("give the page's identifier")
+					}
+					text, err := w.get("/" + strings.Trim(c.Args().First(), "/") + ".md")
+					if err != nil {
+						return err
+					}
+					_, err = os.Stdout.Write(text)
+					return err
+				}),
+			},
+			{
+				Name:      "put",
+				Usage:     "Replace a page's markdown with a file's, or stdin's",
+				ArgsUsage: "IDENTIFIER [FILE]",
+				Flags:     withClientFlags(),
+				Action: clientAction(func(c *cli.Context, w *wikiClient) error {
+					if c.NArg() < 1 || c.NArg() > 2 {
+						return fmt.Errorf("give the page's identifier, and the file to put unless it's on stdin")
+					}
+					text, err := readInput(c.Args().Get(1))
+					if err != nil {
+						return err
+					}
+					return w.post("/update", map[string]interface{}{"page": c.Args().First(), "new_text": string(text)}, nil)
+				}),
+			},
+		},
+	},
+	{
+		Name:      "search",
+		Usage:     "Print the pages best matching the words, one identifier and title a line",
+		ArgsUsage: "WORDS...",
+		Flags: withClientFlags(cli.IntFlag{
+			Name:  "limit",
+			Value: 20,
+			Usage: "Most pages to print",
+		}),
+		Action: clientAction(func(c *cli.Context, w *wikiClient) error {
+			var response struct {
+				Results []struct {
+					Identifier string `json:"identifier"`
+					Title      string `json:"title"`
+				} `json:"results"`
+			}
+			err := w.post("/search", map[string]interface{}{"query": strings.Join(c.Args(), " "), "limit": c.Int("limit")}, &response)
+			if err != nil {
+				return err
+			}
+			for _, result := range response.Results {
+				fmt.Printf("%s\t%s\n", result.Identifier, result.Title)
+			}
+			return nil
+		}),
+	},
+	{
+		Name:  "import",
+		Usage: "Import into the wiki",
+		Subcommands: []cli.Command{
+			{
+				Name:      "csv",
+				Usage:     "Import a CSV of page frontmatter, as the importer on the web does without a mapping; prints the job's id",
+				ArgsUsage: "[FILE]",
+				Flags:     withClientFlags(),
+				Action: clientAction(func(c *cli.Context, w *wikiClient) error {
+					data, err := readInput(c.Args().First())
+					if err != nil {
+						return err
+					}
+					var response struct {
+						JobID string `json:"job_id"`
+					}
+					if err := w.post("/import/csv", map[string]interface{}{"csv": string(data)}, &response); err != nil {
+						return err
+					}
+					fmt.Println(response.JobID)
+					return nil
+				}),
+			},
+		},
+	},
+	{
+		Name:  "export",
+		Usage: "Export from the wiki",
+		Subcommands: []cli.Command{
+			{
+				Name:      "csv",
+				Usage:     "Print the frontmatter of the pages as CSV",
+				ArgsUsage: "[KEY...]",
+				Flags: withClientFlags(cli.StringSliceFlag{
+					Name:  "include",
+					Usage: "Only pages whose frontmatter key has the value, as key=value; repeat for each",
+				}, cli.StringSliceFlag{
+					Name:  "exclude",
+					Usage: "Leave out pages whose frontmatter key has the value, as key=value; repeat for each",
+				}),
+				Action: clientAction(func(c *cli.Context, w *wikiClient) error {
+					include, err := parseFilter(c.StringSlice("include"))
+					if err != nil {
+						return err
+					}
+					exclude, err := parseFilter(c.StringSlice("exclude"))
+					if err != nil {
+						return err
+					}
+					data, err := w.postRaw("/export/csv", map[string]interface{}{"include": include, "exclude": exclude, "keys": []string(c.Args())})
+					if err != nil {
+						return err
+					}
+					_, err = os.Stdout.Write(data)
+					return err
+				}),
+			},
+			{
+				Name:      "static",
+				Usage:     "Have the server render the wiki to HTML in a directory, or a .zip, on the server; prints the job's id",
+				ArgsUsage: "TARGET",
+				Flags:     withClientFlags(),
+				Action: clientAction(func(c *cli.Context, w *wikiClient) error {
+					if c.NArg() != 1 {
+						return fmt.Errorf("give the directory or .zip on the server to export to")
+					}
+					var response struct {
+						JobID string `json:"job_id"`
+					}
+					if err := w.post("/export/static", map[string]interface{}{"target": c.Args().First()}, &response); err != nil {
+						return err
+					}
+					fmt.Println(response.JobID)
+					return nil
+				}),
+			},
+		},
+	},
+}
+
+// parseFilter reads key=value pairs into a frontmatter filter.
+func parseFilter(pairs []string) (server.FrontmatterFilter, error) {
+	filter := server.FrontmatterFilter{}
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%q should be key=value", pair)
+		}
+		filter[parts[0]] = parts[1]
+	}
+	return filter, nil
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/brendanjerwin/simple_wiki/server"
+	yaml "gopkg.in/yaml.v2"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// envPrefix starts the environment variable for every flag, e.g.
+// SIMPLE_WIKI_MAX_UPLOAD_MB for --max-upload-mb.
+const envPrefix = "SIMPLE_WIKI_"
+
+// configOverrides are the flags given on the command line or in the
+// environment, which the config file can't change.
+var configOverrides = map[string]bool{}
+
+func flagName(f cli.Flag) string {
+	return strings.TrimSpace(strings.Split(f.GetName(), ",")[0])
+}
+
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(flag, "-", "_", -1))
+}
+
+// readConfigFile reads a TOML or YAML config file, chosen by its extension,
+// whose keys are flag names, e.g.
+//
+//	port = "8050"
+//	max-upload-mb = 20
+//	job-queue = ["user:10:2", "imports:5:1"]
+func readConfigFile(path string) (map[string]interface{}, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(content, &config)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &config)
+	default:
+		return nil, fmt.Errorf("config file %s should end in .toml, .yaml or .yml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %v", path, err)
+	}
+	return config, nil
+}
+
+func configValue(config map[string]interface{}, name string) (interface{}, bool) {
+	if v, ok := config[name]; ok {
+		return v, true
+	}
+	v, ok := config[strings.Replace(name, "-", "_", -1)]
+	return v, ok
+}
+
+func configValues(v interface{}) []string {
+	switch val := v.(type) {
+	case []interface{}:
+		values := []string{}
+		for _, element := range val {
+			values = append(values, fmt.Sprint(element))
+		}
+		return values
+	case []string:
+		return val
+	}
+	return []string{fmt.Sprint(v)}
+}
+
+// loadConfig fills in the flags that weren't given on the command line, from
+// SIMPLE_WIKI_* environment variables first and then from the --config file.
+func loadConfig(c *cli.Context) error {
+	config := map[string]interface{}{}
+	if path := c.GlobalString("config"); path != "" {
+		var err error
+		if config, err = readConfigFile(path); err != nil {
+			return err
+		}
+	}
+
+	flags := map[string]bool{}
+	fromCommandLine := map[string]bool{}
+	for _, f := range c.App.Flags {
+		name := flagName(f)
+		flags[name] = true
+		fromCommandLine[name] = c.GlobalIsSet(name)
+		configOverrides[name] = fromCommandLine[name]
+	}
+	for key := range config {
+		if !flags[strings.Replace(key, "_", "-", -1)] || key == "config" {
+			return fmt.Errorf("config file has an unknown setting %q; the settings are the flags listed by --help", key)
+		}
+	}
+
+	for _, f := range c.App.Flags {
+		name := flagName(f)
+		if fromCommandLine[name] || name == "config" || name == "help" || name == "version" {
+			continue
+		}
+		var values []string
+		if env, ok := os.LookupEnv(envName(name)); ok {
+			configOverrides[name] = true
+			values = strings.Split(env, ",")
+			if _, ok := f.(cli.StringSliceFlag); !ok {
+				values = []string{env}
+			}
+		} else if v, ok := configValue(config, name); ok {
+			values = configValues(v)
+		}
+		for _, value := range values {
+			if err := c.GlobalSet(name, value); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateConfig checks the settings before the server starts, returning a
+// problem and how to fix it for each one that is wrong.
+func ValidateConfig(c *cli.Context) []error {
+	problems := []error{}
+	problem := func(format string, v ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, v...))
+	}
+
+	if port, err := strconv.Atoi(c.GlobalString("port")); err != nil || port < 1 || port > 65535 {
+		problem("port %q should be a number from 1 to 65535", c.GlobalString("port"))
+	}
+	if css := c.GlobalString("css"); css != "" && !exists(css) {
+		problem("css file %s doesn't exist; check the path or leave css unset", css)
+	}
+	if c.GlobalInt("debounce") < 0 {
+		problem("debounce should be 0 or more milliseconds")
+	}
+	if c.GlobalUint("max-document-length") == 0 {
+		problem("max-document-length should be more than 0, or no page could be saved")
+	}
+	if c.GlobalDuration("trash-retention") < 0 {
+		problem("trash-retention should be 0 (keep forever) or more, e.g. 720h")
+	}
+	if smtp := c.GlobalString("smtp"); smtp != "" {
+		if err := server.CheckSMTPURL(smtp); err != nil {
+			problem("%v", err)
+		}
+	}
+	if c.GlobalString("email-listen") != "" && !strings.Contains(c.GlobalString("email-address"), "@") {
+		problem("email-listen needs an email-address to take mail for, e.g. wiki@home.example")
+	}
+	if provider := c.GlobalString("barcode-provider"); provider != "" {
+		if err := server.CheckBarcodeProvider(provider); err != nil {
+			problem("%v", err)
+		}
+	}
+	if ocr := c.GlobalString("ocr"); ocr != "" {
+		if _, err := server.NewOCREngine(ocr); err != nil {
+			problem("%v", err)
+		}
+	}
+	if diagrams := c.GlobalString("diagrams"); diagrams != "" {
+		if _, err := server.NewDiagramRenderer(diagrams); err != nil {
+			problem("%v", err)
+		}
+	}
+	if err := server.CheckMath(c.GlobalString("math")); err != nil {
+		problem("%v", err)
+	}
+	if _, err := server.NewPageStore(c.GlobalString("storage"), c.GlobalString("data")); err != nil {
+		problem("%v", err)
+	}
+	if err := server.CheckCompression(c.GlobalString("compress-pages")); err != nil {
+		problem("%v", err)
+	}
+	if _, err := tlsOptions(c).Config(); err != nil {
+		problem("%v", err)
+	}
+	if err := server.CheckListen(c.GlobalString("listen")); err != nil {
+		problem("%v", err)
+	}
+	if _, err := server.CleanBasePath(c.GlobalString("base-path")); err != nil {
+		problem("%v", err)
+	}
+	if _, err := server.ParseTrustedProxies(c.GlobalStringSlice("trusted-proxy")); err != nil {
+		problem("%v", err)
+	}
+	if _, err := server.NewIPFilter(c.GlobalStringSlice("allow-ip"), c.GlobalStringSlice("deny-ip")); err != nil {
+		problem("%v", err)
+	}
+	if port := c.GlobalString("tailscale-https-port"); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			problem("tailscale-https-port %q should be a number from 1 to 65535", port)
+		}
+	} else if c.GlobalBool("tailscale-redirect") {
+		problem("tailscale-redirect needs tailscale-https-port to redirect to")
+	}
+	for _, origin := range c.GlobalStringSlice("cors-origin") {
+		if _, err := server.ParseCORSOrigin(origin); err != nil {
+			problem("%v", err)
+		}
+	}
+	for _, role := range c.GlobalStringSlice("role") {
+		if _, err := server.ParseRoleMapping(role); err != nil {
+			problem("%v", err)
+		}
+	}
+	if err := server.CheckHTMLPolicy(c.GlobalString("html-policy"), c.GlobalStringSlice("iframe-host")); err != nil {
+		problem("%v", err)
+	}
+	if llm := c.GlobalString("llm"); llm != "" {
+		if _, err := server.NewLLMProvider(llm); err != nil {
+			problem("%v", err)
+		}
+	}
+	if c.GlobalInt("max-job-attempts") < 1 {
+		problem("max-job-attempts should be at least 1")
+	}
+	if c.GlobalInt("max-job-workers") < 0 {
+		problem("max-job-workers should be 0 (no limit) or more")
+	}
+	for _, spec := range c.GlobalStringSlice("job-queue") {
+		if _, err := server.ParseQueueConfig(spec); err != nil {
+			problem("%v", err)
+		}
+	}
+	for _, spec := range c.GlobalStringSlice("rate-limit") {
+		if _, err := server.ParseRateLimit(spec); err != nil {
+			problem("%v", err)
+		}
+	}
+	if _, ok := server.IdentifierProfiles[c.GlobalString("identifier-profile")]; !ok {
+		names := []string{}
+		for name := range server.IdentifierProfiles {
+			names = append(names, name)
+		}
+		problem("identifier-profile %q isn't one of %s", c.GlobalString("identifier-profile"), strings.Join(names, ", "))
+	}
+	folders := map[string]string{filepath.Clean(c.GlobalString("data")): "the main wiki"}
+	for _, spec := range c.GlobalStringSlice("space") {
+		space, err := server.ParseSpace(spec)
+		if err != nil {
+			problem("%v", err)
+			continue
+		}
+		folder := filepath.Clean(space.PathToData)
+		if other, ok := folders[folder]; ok {
+			problem("space %s uses the same data folder as %s; give each its own", space.Name, other)
+		}
+		folders[folder] = "space " + space.Name
+	}
+	warning, quota := c.GlobalUint("disk-warning-mb"), c.GlobalUint("disk-quota-mb")
+	if warning > 0 && quota > 0 && warning >= quota {
+		problem("disk-warning-mb (%d) should be less than disk-quota-mb (%d), or the warning never shows before uploads are refused", warning, quota)
+	}
+	return problems
+}
+
+// reloadableSettings reads the settings that can change while running from
+// the flags the server was started with.
+func reloadableSettings(c *cli.Context) server.ReloadableSettings {
+	settings := server.ReloadableSettings{
+		Debounce:        c.GlobalInt("debounce"),
+		MaxUploadSize:   c.GlobalUint("max-upload-mb"),
+		MaxDocumentSize: c.GlobalUint("max-document-length"),
+		LogLevel:        logLevel(c.GlobalBool("debug")),
+	}
+	for _, spec := range c.GlobalStringSlice("rate-limit") {
+		if limit, err := server.ParseRateLimit(spec); err == nil {
+			settings.RateLimits = append(settings.RateLimits, limit)
+		}
+	}
+	return settings
+}
+
+// tlsOptions reads how to answer HTTPS from the flags.
+func tlsOptions(c *cli.Context) server.TLSOptions {
+	return server.TLSOptions{
+		CertFile:     c.GlobalString("tls-cert"),
+		KeyFile:      c.GlobalString("tls-key"),
+		MinVersion:   c.GlobalString("tls-min-version"),
+		CipherSuites: c.GlobalStringSlice("tls-cipher"),
+		NoHTTP2:      c.GlobalBool("no-http2"),
+		ClientCAFile: c.GlobalString("tls-client-ca"),
+	}
+}
+
+// reloadConfig works out the settings from a changed config file, starting
+// from the current ones. Settings given on the command line or in the
+// environment stay as they are; settings taken out of the file keep their
+// last value until a restart.
+func reloadConfig(path string, current server.ReloadableSettings) (server.ReloadableSettings, error) {
+	config, err := readConfigFile(path)
+	if err != nil {
+		return current, err
+	}
+	next := current
+	setting := func(name string, parse func(string) error) error {
+		v, ok := configValue(config, name)
+		if !ok || configOverrides[name] {
+			return nil
+		}
+		if err := parse(fmt.Sprint(v)); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		return nil
+	}
+	parseUint := func(to *uint) func(string) error {
+		return func(value string) error {
+			n, err := strconv.ParseUint(value, 10, 0)
+			*to = uint(n)
+			return err
+		}
+	}
+	problems := []error{
+		setting("debounce", func(value string) (err error) {
+			next.Debounce, err = strconv.Atoi(value)
+			return err
+		}),
+		setting("max-upload-mb", parseUint(&next.MaxUploadSize)),
+		setting("max-document-length", parseUint(&next.MaxDocumentSize)),
+		setting("debug", func(value string) error {
+			debug, err := strconv.ParseBool(value)
+			next.LogLevel = logLevel(debug)
+			return err
+		}),
+	}
+	if v, ok := configValue(config, "rate-limit"); ok && !configOverrides["rate-limit"] {
+		next.RateLimits = []server.RateLimit{}
+		for _, spec := range configValues(v) {
+			limit, err := server.ParseRateLimit(spec)
+			problems = append(problems, err)
+			next.RateLimits = append(next.RateLimits, limit)
+		}
+	}
+	for _, problem := range problems {
+		if problem != nil {
+			return current, problem
+		}
+	}
+	return next, nil
+}
+
+// watchConfig checks the config file for changes every interval and sends
+// the settings in it that can be applied without a restart.
+func watchConfig(path string, current server.ReloadableSettings, interval time.Duration) <-chan server.ReloadableSettings {
+	settings := make(chan server.ReloadableSettings)
+	modified := func() time.Time {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+	go func() {
+		last := modified()
+		for range time.Tick(interval) {
+			if m := modified(); !m.Equal(last) {
+				last = m
+				next, err := reloadConfig(path, current)
+				if err != nil {
+					fmt.Printf("Not reloading %s: %v\n", path, err)
+					continue
+				}
+				current = next
+				settings <- next
+			}
+		}
+	}()
+	return settings
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// loadTestConfig runs an app with a few of the wiki's flags, loading the
+// config as the wiki does, and returns the context it ran with.
+func loadTestConfig(args ...string) (*cli.Context, error) {
+	configOverrides = map[string]bool{}
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "config"},
+		cli.StringFlag{Name: "port", Value: "8050"},
+		cli.IntFlag{Name: "debounce", Value: 500},
+		cli.UintFlag{Name: "max-upload-mb", Value: 100},
+		cli.StringSliceFlag{Name: "rate-limit"},
+	}
+	var loaded *cli.Context
+	app.Before = loadConfig
+	app.Action = func(c *cli.Context) error {
+		loaded = c
+		return nil
+	}
+	err := app.Run(append([]string{"simple_wiki"}, args...))
+	return loaded, err
+}
+
+func writeTestConfig(t *testing.T, path, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wiki.toml")
+	writeTestConfig(t, path, "port = \"1111\"\ndebounce = 100\nmax_upload_mb = 5\nrate-limit = [\"/update:10/m\"]\n")
+	os.Setenv("SIMPLE_WIKI_PORT", "2222")
+	os.Setenv("SIMPLE_WIKI_DEBOUNCE", "200")
+	defer os.Unsetenv("SIMPLE_WIKI_PORT")
+	defer os.Unsetenv("SIMPLE_WIKI_DEBOUNCE")
+
+	c, err := loadTestConfig("--config", path, "--port", "3333")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port := c.GlobalString("port"); port != "3333" {
+		t.Errorf("Expected the command line over the environment, got port %s", port)
+	}
+	if debounce := c.GlobalInt("debounce"); debounce != 200 {
+		t.Errorf("Expected the environment over the file, got debounce %d", debounce)
+	}
+	if size := c.GlobalUint("max-upload-mb"); size != 5 {
+		t.Errorf("Expected the file over the default, got max-upload-mb %d", size)
+	}
+	if limits := c.GlobalStringSlice("rate-limit"); len(limits) != 1 || limits[0] != "/update:10/m" {
+		t.Errorf("Expected the file's list, got %v", limits)
+	}
+}
+
+func TestLoadConfigRefusesUnknownSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wiki.yaml")
+	writeTestConfig(t, path, "port: \"1111\"\ncolour: blue\n")
+	if _, err := loadTestConfig("--config", path); err == nil || !strings.Contains(err.Error(), `"colour"`) {
+		t.Errorf("Expected the unknown setting to be refused, got %v", err)
+	}
+	path = filepath.Join(t.TempDir(), "wiki.ini")
+	writeTestConfig(t, path, "port = 1111\n")
+	if _, err := loadTestConfig("--config", path); err == nil {
+		t.Error("Expected a config file that isn't TOML or YAML to be refused")
+	}
+}
+
+func TestReloadConfigKeepsCommandLineSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wiki.toml")
+	writeTestConfig(t, path, "debounce = 100\nmax-upload-mb = 5\n")
+	c, err := loadTestConfig("--config", path, "--debounce", "700")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := reloadableSettings(c)
+
+	writeTestConfig(t, path, "debounce = 50\nmax-upload-mb = 9\n")
+	next, err := reloadConfig(path, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Debounce != 700 {
+		t.Errorf("Expected debounce, given on the command line, to stay 700, got %d", next.Debounce)
+	}
+	if next.MaxUploadSize != 9 {
+		t.Errorf("Expected max-upload-mb to be reloaded from the file, got %d", next.MaxUploadSize)
+	}
+
+	writeTestConfig(t, path, "max-upload-mb = \"lots\"\n")
+	if kept, err := reloadConfig(path, next); err == nil || kept.MaxUploadSize != 9 {
+		t.Errorf("Expected a bad value to be refused and the settings kept, got %+v %v", kept, err)
+	}
+}
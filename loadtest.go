@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// loadtestOperations are what the load test does, in the order they are
+// reported.
+var loadtestOperations = []string{"read", "write", "search"}
+
+// loadtestWords are what the load test's pages are written with and
+// searched for.
+var loadtestWords = strings.Fields("drill hammer screws washers shelf garage drawer bolts pliers saw ladder paint glue tape wrench")
+
+// parseLoadtestMix reads a mix like read=80,write=10,search=10 into the
+// weight of each operation.
+func parseLoadtestMix(spec string) (map[string]int, error) {
+	mix := map[string]int{}
+	total := 0
+	for _, part := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%q should be operation=weight", part)
+		}
+		weight, err := strconv.Atoi(parts[1])
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("%q should be a weight of 0 or more", part)
+		}
+		known := false
+		for _, operation := range loadtestOperations {
+			known = known || operation == parts[0]
+		}
+		if !known {
+			return nil, fmt.Errorf("%q should be one of %s", parts[0], strings.Join(loadtestOperations, ", "))
+		}
+		mix[parts[0]] = weight
+		total += weight
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("mix %q has nothing to do", spec)
+	}
+	return mix, nil
+}
+
+// pickLoadtestOperation picks an operation at random, as often as its
+// weight in the mix says.
+func pickLoadtestOperation(mix map[string]int, r *rand.Rand) string {
+	total := 0
+	for _, weight := range mix {
+		total += weight
+	}
+	n := r.Intn(total)
+	for _, operation := range loadtestOperations {
+		if n < mix[operation] {
+			return operation
+		}
+		n -= mix[operation]
+	}
+	return loadtestOperations[0]
+}
+
+func loadtestText(r *rand.Rand) string {
+	words := make([]string, 40)
+	for i := range words {
+		words[i] = loadtestWords[r.Intn(len(loadtestWords))]
+	}
+	return "# Load test\n\n" + strings.Join(words, " ") + "\n"
+}
+
+// loadtestStats are how long each of an operation's requests took.
+type loadtestStats struct {
+	latencies []time.Duration
+	errors    int
+}
+
+// percentile is the latency p (0 to 1) of the requests were at or under;
+// latencies must be sorted.
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	i := int(p*float64(len(latencies))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(latencies) {
+		i = len(latencies) - 1
+	}
+	return latencies[i]
+}
+
+// runLoadtest has workers make requests in the mix against the pages until
+// the duration is up.
+func runLoadtest(w *wikiClient, mix map[string]int, pages []string, workers int, duration time.Duration) map[string]*loadtestStats {
+	stats := map[string]*loadtestStats{}
+	for _, operation := range loadtestOperations {
+		stats[operation] = &loadtestStats{}
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	deadline := time.Now().Add(duration)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for time.Now().Before(deadline) {
+				operation := pickLoadtestOperation(mix, r)
+				page := pages[r.Intn(len(pages))]
+				started := time.Now()
+				var err error
+				switch operation {
+				case "read":
+					var resp *http.Response
+					if resp, err = w.do(http.MethodGet, "/"+page+"/view", nil); err == nil {
+						io.Copy(ioutil.Discard, resp.Body)
+						resp.Body.Close()
+					}
+				case "write":
+					err = w.post("/update", map[string]interface{}{"page": page, "new_text": loadtestText(r)}, nil)
+				case "search":
+					query := loadtestWords[r.Intn(len(loadtestWords))] + " " + loadtestWords[r.Intn(len(loadtestWords))]
+					err = w.post("/search", map[string]interface{}{"query": query, "limit": 20}, nil)
+				}
+				took := time.Since(started)
+				mu.Lock()
+				if err != nil {
+					stats[operation].errors++
+				} else {
+					stats[operation].latencies = append(stats[operation].latencies, took)
+				}
+				mu.Unlock()
+			}
+		}(time.Now().UnixNano() + int64(i))
+	}
+	wg.Wait()
+	return stats
+}
+
+// loadtestCommand drives a running server with reads, writes and searches
+// to see how it copes, before trusting it with a big wiki.
+var loadtestCommand = cli.Command{
+	Name:  "loadtest",
+	Usage: "Drive a running server with a mix of page reads, writes and searches, and print the latency percentiles of each",
+	Flags: withClientFlags(
+		cli.StringFlag{
+			Name:  "mix",
+			Value: "read=80,write=10,search=10",
+			Usage: "How often to do each of read, write and search, as operation=weight",
+		},
+		cli.IntFlag{
+			Name:  "concurrency",
+			Value: 8,
+			Usage: "How many requests to have in flight at once",
+		},
+		cli.DurationFlag{
+			Name:  "duration",
+			Value: 30 * time.Second,
+			Usage: "How long to keep it up",
+		},
+		cli.IntFlag{
+			Name:  "pages",
+			Value: 100,
+			Usage: "How many pages to read and write; they're written first, named after --prefix",
+		},
+		cli.StringFlag{
+			Name:  "prefix",
+			Value: "loadtest_",
+			Usage: "What the load test's pages are named, followed by a number; pages by these names are overwritten",
+		},
+	),
+	Action: clientAction(func(c *cli.Context, w *wikiClient) error {
+		mix, err := parseLoadtestMix(c.String("mix"))
+		if err != nil {
+			return err
+		}
+		if c.Int("pages") < 1 || c.Int("concurrency") < 1 {
+			return fmt.Errorf("give at least one page and a concurrency of at least one")
+		}
+		w.http.Timeout = 30 * time.Second
+		w.http.Transport = &http.Transport{MaxIdleConnsPerHost: c.Int("concurrency")}
+
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+		pages := []string{}
+		for i := 0; i < c.Int("pages"); i++ {
+			page := fmt.Sprintf("%s%d", c.String("prefix"), i)
+			if err := w.post("/update", map[string]interface{}{"page": page, "new_text": loadtestText(r)}, nil); err != nil {
+				return err
+			}
+			pages = append(pages, page)
+		}
+		fmt.Printf("Wrote %d pages; running %s with %d at once\n", len(pages), c.Duration("duration"), c.Int("concurrency"))
+
+		stats := runLoadtest(w, mix, pages, c.Int("concurrency"), c.Duration("duration"))
+		fmt.Printf("%-8s %8s %8s %8s %10s %10s %10s %10s\n", "", "requests", "errors", "per sec", "p50", "p90", "p99", "max")
+		for _, operation := range loadtestOperations {
+			s := stats[operation]
+			if len(s.latencies) == 0 && s.errors == 0 {
+				continue
+			}
+			sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+			fmt.Printf("%-8s %8d %8d %8.1f %10v %10v %10v %10v\n", operation, len(s.latencies), s.errors,
+				float64(len(s.latencies))/c.Duration("duration").Seconds(),
+				percentile(s.latencies, .5).Round(time.Microsecond), percentile(s.latencies, .9).Round(time.Microsecond),
+				percentile(s.latencies, .99).Round(time.Microsecond), percentile(s.latencies, 1).Round(time.Microsecond))
+		}
+		return nil
+	}),
+}
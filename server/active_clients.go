@@ -0,0 +1,123 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// activeClientWindow is how long a client is remembered after its last
+// request.
+const activeClientWindow = 24 * time.Hour
+
+// maxActiveClients is how many clients are remembered at once; the ones
+// seen longest ago are forgotten first.
+const maxActiveClients = 1000
+
+// ActiveClient is someone who has used the wiki recently: a user, by the
+// identity the identity middleware worked out, or an anonymous client, by
+// its address. Node names aren't known to the wiki; the address is where
+// the last request came from.
+type ActiveClient struct {
+	Identity  string    `json:"identity,omitempty"`
+	Address   string    `json:"address"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Requests  int       `json:"requests"`
+	Errors    int       `json:"errors"`
+}
+
+// seeClient records a request from a client, as it finished.
+func (s *Site) seeClient(identity, address, userAgent string, failed bool, now time.Time) {
+	key := identity
+	if key == "" {
+		key = "@" + address
+	}
+	s.clientsMut.Lock()
+	defer s.clientsMut.Unlock()
+	if s.clients == nil {
+		s.clients = map[string]*ActiveClient{}
+	}
+	client, ok := s.clients[key]
+	if !ok {
+		if len(s.clients) >= maxActiveClients {
+			s.forgetClients(now)
+		}
+		client = &ActiveClient{Identity: identity, FirstSeen: now}
+		s.clients[key] = client
+	}
+	client.Address = address
+	client.UserAgent = userAgent
+	client.LastSeen = now
+	client.Requests++
+	if failed {
+		client.Errors++
+	}
+}
+
+// forgetClients drops the clients not seen within activeClientWindow, and
+// then the longest unseen until there's room for another.
+func (s *Site) forgetClients(now time.Time) {
+	for key, client := range s.clients {
+		if now.Sub(client.LastSeen) > activeClientWindow {
+			delete(s.clients, key)
+		}
+	}
+	for len(s.clients) >= maxActiveClients {
+		oldest := ""
+		for key, client := range s.clients {
+			if oldest == "" || client.LastSeen.Before(s.clients[oldest].LastSeen) {
+				oldest = key
+			}
+		}
+		delete(s.clients, oldest)
+	}
+}
+
+// ListActiveClients returns the clients seen since the time, most recently
+// seen first.
+func (s *Site) ListActiveClients(since time.Time) []ActiveClient {
+	s.clientsMut.Lock()
+	defer s.clientsMut.Unlock()
+	clients := []ActiveClient{}
+	for _, client := range s.clients {
+		if !client.LastSeen.Before(since) {
+			clients = append(clients, *client)
+		}
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].LastSeen.After(clients[j].LastSeen) })
+	return clients
+}
+
+// trackClients records each request against the client that made it, once
+// it's been handled; it runs after identifyUser.
+func (s *Site) trackClients(c *gin.Context) {
+	c.Next()
+	s.seeClient(requestIdentity(c), c.ClientIP(), c.Request.UserAgent(), c.Writer.Status() >= http.StatusInternalServerError, time.Now())
+}
+
+func (s *Site) handleListActiveClients(c *gin.Context) {
+	type QueryJSON struct {
+		// Since is how far back to look, like 1h; empty for
+		// activeClientWindow.
+		Since string `json:"since"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	window := activeClientWindow
+	if json.Since != "" {
+		if window, err = time.ParseDuration(json.Since); err != nil || window <= 0 {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": "since should be a duration like 1h"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "clients": s.ListActiveClients(time.Now().Add(-window))})
+}
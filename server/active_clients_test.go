@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/jcelliott/lumber"
+)
+
+func TestActiveClients(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), SessionStore: cookie.NewStore([]byte("secret")), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	newTestPage(s, "notes", "some notes")
+	router := s.Router()
+	send := func(method, url, body, identity, remoteAddr string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("User-Agent", "test")
+		if identity != "" {
+			req.Header.Set(defaultIdentityHeader, identity)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+	send("GET", "/notes/view", "", "alice@example.com", "100.64.0.1:5000")
+	send("GET", "/notes/raw", "", "alice@example.com", "100.64.0.2:5000")
+	send("GET", "/notes/view", "", "", "192.168.1.20:5000")
+
+	w := send("POST", "/system/clients", `{}`, "bob@example.com", "100.64.0.3:5000")
+	var response struct {
+		Success bool
+		Clients []ActiveClient
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || !response.Success {
+		t.Fatalf("Expected the clients, got %s", w.Body.String())
+	}
+	if len(response.Clients) != 2 {
+		t.Fatalf("Expected alice and the anonymous client, got %+v", response.Clients)
+	}
+	alice := response.Clients[1]
+	if response.Clients[0].Identity != "" || response.Clients[0].Address != "192.168.1.20" {
+		t.Errorf("Expected the anonymous client seen last first, got %+v", response.Clients[0])
+	}
+	if alice.Identity != "alice@example.com" || alice.Requests != 2 || alice.Address != "100.64.0.2" || alice.UserAgent != "test" {
+		t.Errorf("Expected alice's two requests, from where she was last, got %+v", alice)
+	}
+
+	// bob's listing counts once it's done
+	if clients := s.ListActiveClients(time.Now().Add(-time.Hour)); len(clients) != 3 || clients[0].Identity != "bob@example.com" {
+		t.Errorf("Expected bob seen last, got %+v", clients)
+	}
+	if clients := s.ListActiveClients(time.Now().Add(time.Minute)); len(clients) != 0 {
+		t.Errorf("Expected no one seen in the future, got %+v", clients)
+	}
+}
+
+func TestForgetClients(t *testing.T) {
+	s := &Site{}
+	now := time.Now()
+	s.seeClient("old@example.com", "100.64.0.1", "", false, now.Add(-2*activeClientWindow))
+	for i := 0; i < maxActiveClients; i++ {
+		s.seeClient("", fmt.Sprintf("192.168.%d.%d", i/256, i%256), "", false, now.Add(time.Duration(i)*time.Millisecond))
+	}
+	if len(s.clients) != maxActiveClients {
+		t.Errorf("Expected no more than %d clients, got %d", maxActiveClients, len(s.clients))
+	}
+	if _, ok := s.clients["old@example.com"]; ok {
+		t.Errorf("Expected a client not seen for two days forgotten")
+	}
+	s.seeClient("new@example.com", "100.64.0.2", "", true, now.Add(time.Second))
+	if _, ok := s.clients["@192.168.0.0"]; ok || len(s.clients) != maxActiveClients {
+		t.Errorf("Expected the client seen longest ago forgotten to make room")
+	}
+	if s.clients["new@example.com"].Errors != 1 {
+		t.Errorf("Expected the failed request counted")
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// pageAliases reads the `aliases` a page declares in its frontmatter.
+func pageAliases(matter map[string]interface{}) []string {
+	aliases := []string{}
+	for _, alias := range frontmatterStrings(matter["aliases"]) {
+		if alias = strings.ToLower(strings.TrimSpace(alias)); alias != "" {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases
+}
+
+// aliasIndex returns the alias to identifier index, reading every page's
+// frontmatter the first time. s.aliasesMut must be held.
+func (s *Site) aliasIndex() map[string]string {
+	if s.aliases == nil {
+		started := time.Now()
+		s.aliases = map[string]string{}
+		s.EachFrontmatter(func(identifier string, matter map[string]interface{}) {
+			for _, alias := range pageAliases(matter) {
+				s.aliases[alias] = strings.ToLower(identifier)
+			}
+		})
+		s.aliasesBuilt, s.aliasesBuildTook = time.Now(), time.Since(started)
+		s.metrics().Observe("wiki_index_rebuild_duration_seconds", s.aliasesBuildTook, "index", "aliases")
+	}
+	return s.aliases
+}
+
+// Alias returns the page that declares identifier as one of its aliases. A
+// page with that identifier always wins over an alias.
+func (s *Site) Alias(identifier string) (string, bool) {
+	identifier = strings.ToLower(identifier)
+	if s.hasPageFile(identifier, ".json") {
+		return "", false
+	}
+	s.aliasesMut.Lock()
+	defer s.aliasesMut.Unlock()
+	target, ok := s.aliasIndex()[identifier]
+	return target, ok
+}
+
+// lookupIdentifier finds the page a missing identifier stands for, through
+// the redirect table or an alias.
+func (s *Site) lookupIdentifier(identifier string) (string, bool) {
+	if target, ok := s.Redirect(identifier); ok {
+		return target, true
+	}
+	return s.Alias(identifier)
+}
+
+// checkAliases refuses aliases that are already another page's identifier or
+// alias.
+func (s *Site) checkAliases(identifier string, aliases []string) error {
+	identifier = strings.ToLower(identifier)
+	s.aliasesMut.Lock()
+	defer s.aliasesMut.Unlock()
+	index := s.aliasIndex()
+	for _, alias := range aliases {
+		if alias == identifier {
+			continue
+		}
+		if s.hasPageFile(alias, ".json") {
+			return fmt.Errorf("alias %q is already the identifier of a page", alias)
+		}
+		if owner, ok := index[alias]; ok && owner != identifier {
+			return fmt.Errorf("alias %q is already an alias of %q", alias, owner)
+		}
+	}
+	return nil
+}
+
+// indexAliases replaces the aliases recorded for identifier.
+func (s *Site) indexAliases(identifier string, aliases []string) {
+	identifier = strings.ToLower(identifier)
+	s.aliasesMut.Lock()
+	defer s.aliasesMut.Unlock()
+	if s.aliases == nil {
+		return // built from the files when first needed
+	}
+	for alias, owner := range s.aliases {
+		if owner == identifier {
+			delete(s.aliases, alias)
+		}
+	}
+	for _, alias := range aliases {
+		if alias != identifier {
+			s.aliases[alias] = identifier
+		}
+	}
+}
+
+// aliases reads the aliases from the page's rendered frontmatter.
+func (p *Page) aliases() []string {
+	matter := map[string]interface{}{}
+	if len(p.FrontmatterJson) == 0 || json.Unmarshal(p.FrontmatterJson, &matter) != nil {
+		return []string{}
+	}
+	return pageAliases(matter)
+}
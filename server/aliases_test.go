@@ -0,0 +1,49 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAliasesResolveToThePage(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "cordless_drill", "+++\ntitle = \"Drill\"\naliases = [\"Drill\", \"makita\"]\n+++\n")
+
+	if target, ok := s.Alias("drill"); !ok || target != "cordless_drill" {
+		t.Errorf("Expected drill to be an alias of cordless_drill, got %q", target)
+	}
+	if p := s.Open("makita"); p.Identifier != "cordless_drill" {
+		t.Errorf("Expected Open to follow the alias, got %q", p.Identifier)
+	}
+	if matter, err := s.ReadFrontMatter("makita"); err != nil || matter["title"] != "Drill" {
+		t.Errorf("Expected the frontmatter through the alias: %v %v", matter, err)
+	}
+
+	p := s.Open("cordless_drill")
+	if err := p.Update("+++\naliases = [\"dewalt\"]\n+++\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Alias("makita"); ok {
+		t.Error("Expected a removed alias to stop resolving")
+	}
+	if target, _ := s.Alias("dewalt"); target != "cordless_drill" {
+		t.Errorf("Expected the new alias to resolve, got %q", target)
+	}
+}
+
+func TestAliasCollisionsAreRefused(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "hammer", "# Hammer")
+	newTestPage(s, "cordless_drill", "+++\naliases = [\"drill\"]\n+++\n")
+
+	p := s.Open("impact_driver")
+	if err := p.Update("+++\naliases = [\"hammer\"]\n+++\n"); err == nil || !strings.Contains(err.Error(), "identifier") {
+		t.Errorf("Expected an alias that is a page's identifier to be refused, got %v", err)
+	}
+	if err := p.Update("+++\naliases = [\"drill\"]\n+++\n"); err == nil || !strings.Contains(err.Error(), "cordless_drill") {
+		t.Errorf("Expected an alias of another page to be refused, got %v", err)
+	}
+	if !p.IsNew() {
+		t.Error("Expected the refused page not to be written")
+	}
+}
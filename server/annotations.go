@@ -0,0 +1,275 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// annotationContext is how much text either side of an annotated range is
+// kept to find it again after the page changes.
+const annotationContext = 32
+
+// TextAnchor pins an annotation to Start:End, byte offsets into the page's
+// markdown, which held Quote between Prefix and Suffix when it was made.
+type TextAnchor struct {
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Quote  string `json:"quote"`
+	Prefix string `json:"prefix"`
+	Suffix string `json:"suffix"`
+}
+
+// Annotation is a comment on part of a page.
+type Annotation struct {
+	ID        string     `json:"id"`
+	Author    string     `json:"author"`
+	Comment   string     `json:"comment"`
+	Anchor    TextAnchor `json:"anchor"`
+	CreatedAt time.Time  `json:"created_at"`
+	// Orphaned is set when the annotated text has been edited away; the
+	// annotation is kept so it isn't lost.
+	Orphaned bool `json:"orphaned,omitempty"`
+}
+
+func newTextAnchor(text string, start, end int) (TextAnchor, error) {
+	if start < 0 || end > len(text) || start >= end {
+		return TextAnchor{}, fmt.Errorf("range %d:%d isn't in the page", start, end)
+	}
+	return TextAnchor{
+		Start:  start,
+		End:    end,
+		Quote:  text[start:end],
+		Prefix: text[maxInt(0, start-annotationContext):start],
+		Suffix: text[end:minInt(len(text), end+annotationContext)],
+	}, nil
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// commonSuffix and commonPrefix measure how much of the context around a
+// candidate still matches.
+func commonSuffix(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[len(a)-1-n] == b[len(b)-1-n] {
+		n++
+	}
+	return n
+}
+
+func commonPrefix(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// reanchor finds the anchor's quote in the changed text: where it was if it
+// is still there, otherwise the occurrence whose surrounding text matches
+// best, nearest the old position on a tie. It returns false when the quote
+// is gone.
+func (a TextAnchor) reanchor(text string) (TextAnchor, bool) {
+	if a.End <= len(text) && text[a.Start:a.End] == a.Quote {
+		moved, _ := newTextAnchor(text, a.Start, a.End)
+		return moved, true
+	}
+	best, bestScore, bestDistance := -1, -1, 0
+	for from := 0; from <= len(text)-len(a.Quote); {
+		i := strings.Index(text[from:], a.Quote)
+		if i < 0 {
+			break
+		}
+		start := from + i
+		end := start + len(a.Quote)
+		score := commonSuffix(text[maxInt(0, start-annotationContext):start], a.Prefix) +
+			commonPrefix(text[end:minInt(len(text), end+annotationContext)], a.Suffix)
+		distance := start - a.Start
+		if distance < 0 {
+			distance = -distance
+		}
+		if score > bestScore || (score == bestScore && distance < bestDistance) {
+			best, bestScore, bestDistance = start, score, distance
+		}
+		from = start + 1
+	}
+	if best < 0 {
+		return a, false
+	}
+	moved, _ := newTextAnchor(text, best, best+len(a.Quote))
+	return moved, true
+}
+
+// Annotations returns a page's annotations, oldest first.
+func (s *Site) Annotations(page string) ([]Annotation, error) {
+	annotations := []Annotation{}
+	data, err := s.store().Get(pageKey(page, ".annotations"))
+	if os.IsNotExist(err) {
+		return annotations, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &annotations)
+	return annotations, err
+}
+
+func (s *Site) saveAnnotations(page string, annotations []Annotation) error {
+	if len(annotations) == 0 {
+		return s.store().Delete(pageKey(page, ".annotations"))
+	}
+	data, err := json.MarshalIndent(annotations, "", " ")
+	if err != nil {
+		return err
+	}
+	return s.store().Put(pageKey(page, ".annotations"), data)
+}
+
+func (s *Site) updateAnnotations(page string, fn func([]Annotation) ([]Annotation, error)) error {
+	s.annotationsMut.Lock()
+	defer s.annotationsMut.Unlock()
+	annotations, err := s.Annotations(page)
+	if err != nil {
+		return err
+	}
+	if annotations, err = fn(annotations); err != nil {
+		return err
+	}
+	return s.saveAnnotations(page, annotations)
+}
+
+// Annotate adds a comment on the start:end byte range of the page's current
+// markdown.
+func (s *Site) Annotate(page, author, comment string, start, end int) (Annotation, error) {
+	page = strings.ToLower(strings.TrimSpace(page))
+	if strings.TrimSpace(comment) == "" {
+		return Annotation{}, errors.New("need a comment")
+	}
+	if !s.hasPageFile(page, ".json") {
+		return Annotation{}, fmt.Errorf("there is no page %q", page)
+	}
+	anchor, err := newTextAnchor(s.Open(page).Text.GetCurrent(), start, end)
+	if err != nil {
+		return Annotation{}, err
+	}
+	annotation := Annotation{
+		ID:        RandStringBytesMaskImprSrc(10),
+		Author:    author,
+		Comment:   comment,
+		Anchor:    anchor,
+		CreatedAt: time.Now(),
+	}
+	err = s.updateAnnotations(page, func(annotations []Annotation) ([]Annotation, error) {
+		return append(annotations, annotation), nil
+	})
+	return annotation, err
+}
+
+func (s *Site) DeleteAnnotation(page, id string) error {
+	page = strings.ToLower(strings.TrimSpace(page))
+	return s.updateAnnotations(page, func(annotations []Annotation) ([]Annotation, error) {
+		for i, annotation := range annotations {
+			if annotation.ID == id {
+				return append(annotations[:i], annotations[i+1:]...), nil
+			}
+		}
+		return nil, fmt.Errorf("no annotation %q on %s", id, page)
+	})
+}
+
+// reanchorAnnotations moves a page's annotations to follow their text after
+// it is saved, and marks those whose text is gone as orphaned.
+func (s *Site) reanchorAnnotations(page, text string) error {
+	if !s.hasPageFile(page, ".annotations") {
+		return nil
+	}
+	return s.updateAnnotations(page, func(annotations []Annotation) ([]Annotation, error) {
+		for i, annotation := range annotations {
+			if annotation.Orphaned {
+				continue
+			}
+			anchor, ok := annotation.Anchor.reanchor(text)
+			annotations[i].Anchor, annotations[i].Orphaned = anchor, !ok
+		}
+		return annotations, nil
+	})
+}
+
+func (s *Site) handleAnnotate(c *gin.Context) {
+	type QueryJSON struct {
+		Page    string `json:"page"`
+		Author  string `json:"author"`
+		Comment string `json:"comment"`
+		Start   int    `json:"start"`
+		End     int    `json:"end"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	annotation, err := s.Annotate(json.Page, json.Author, json.Comment, json.Start, json.End)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "annotation": annotation})
+}
+
+func (s *Site) handleListAnnotations(c *gin.Context) {
+	type QueryJSON struct {
+		Page string `json:"page"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	annotations, err := s.Annotations(strings.ToLower(json.Page))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "annotations": annotations})
+}
+
+func (s *Site) handleDeleteAnnotation(c *gin.Context) {
+	type QueryJSON struct {
+		Page string `json:"page"`
+		ID   string `json:"id"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	if err := s.DeleteAnnotation(json.Page, json.ID); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Deleted"})
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTextAnchorReanchor(t *testing.T) {
+	text := "Check the oil. Then check the oil filter. Then check the tires."
+	start := strings.Index(text, "the oil filter") + len("the ")
+	anchor, err := newTextAnchor(text, start, start+len("oil"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// text inserted before the quote moves it along
+	moved, ok := anchor.reanchor("First, park. " + text)
+	if !ok || moved.Start != start+len("First, park. ") {
+		t.Errorf("Expected the anchor to move with its text, got %+v", moved)
+	}
+
+	// of the two "oil"s, the one followed by " filter" is still the one
+	edited := strings.Replace(text, "Check the oil.", "Check the oil level.", 1)
+	moved, ok = anchor.reanchor(edited)
+	if !ok || edited[moved.End:moved.End+len(" filter")] != " filter" {
+		t.Errorf("Expected the anchor to find its context, got %+v", moved)
+	}
+
+	if _, ok := anchor.reanchor("Check the tires."); ok {
+		t.Error("Expected the anchor to be orphaned when its text is gone")
+	}
+}
+
+func TestAnnotationsFollowEdits(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	p := newTestPage(s, "car", "# Car\n\nChange the oil every 5000 miles.")
+
+	start := strings.Index(p.Text.GetCurrent(), "5000")
+	annotation, err := s.Annotate("car", "sam", "The manual says 7500 now", start, start+4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if annotation.Anchor.Quote != "5000" {
+		t.Errorf("Expected the quote to be kept, got %+v", annotation.Anchor)
+	}
+	if _, err := s.Annotate("car", "sam", "out of range", 0, 1000); err == nil {
+		t.Error("Expected a range past the end of the page to be rejected")
+	}
+
+	p.Update("# Car\n\nIt's a good car.\n\nChange the oil every 5000 miles.")
+	annotations, _ := s.Annotations("car")
+	if len(annotations) != 1 || annotations[0].Orphaned || p.Text.GetCurrent()[annotations[0].Anchor.Start:annotations[0].Anchor.End] != "5000" {
+		t.Fatalf("Expected the annotation to follow its text, got %+v", annotations)
+	}
+
+	p.Update("# Car\n\nChange the oil every 7500 miles.")
+	if annotations, _ = s.Annotations("car"); !annotations[0].Orphaned {
+		t.Errorf("Expected the annotation to be orphaned, got %+v", annotations)
+	}
+
+	if err := s.RenamePage("car", "old_car"); err != nil {
+		t.Fatal(err)
+	}
+	if annotations, _ = s.Annotations("old_car"); len(annotations) != 1 {
+		t.Errorf("Expected the annotations to move with the page, got %+v", annotations)
+	}
+	if err := s.DeleteAnnotation("old_car", annotation.ID); err != nil {
+		t.Fatal(err)
+	}
+	if exists(s.pageFile("old_car", ".annotations")) {
+		t.Error("Expected the annotations file to go with the last annotation")
+	}
+}
@@ -0,0 +1,301 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiTokensFile holds the API tokens, hashed, as JSON.
+const apiTokensFile = "api_tokens.table"
+
+// apiTokenPrefix starts every API token, so a bearer token meant for
+// something else (such as /api/inbox) is left alone.
+const apiTokenPrefix = "swk_"
+
+// apiTokenKey is where the token a request was authenticated with is kept
+// in the gin context.
+const apiTokenKey = "api_token"
+
+// The scopes an API token can have. Each request needs exactly one of them;
+// see requiredScope.
+const (
+	ScopeRead   = "read"
+	ScopeWrite  = "write"
+	ScopeImport = "import"
+	ScopeExport = "export"
+	ScopeAdmin  = "admin"
+)
+
+var apiTokenScopes = []string{ScopeRead, ScopeWrite, ScopeImport, ScopeExport, ScopeAdmin}
+
+// readOnlyRoutes are the POST routes that only read, so a read token can use
+// them.
+var readOnlyRoutes = map[string]bool{
+	"/uploads/search":               true,
+	"/exists":                       true,
+	"/annotations/list":             true,
+	"/watches":                      true,
+	"/related":                      true,
+	"/archive/list":                 true,
+	"/search":                       true,
+	"/search/live":                  true,
+	"/search/live/revise":           true,
+	"/checklist/get":                true,
+	"/pages/list":                   true,
+	"/pages/popular":                true,
+	"/namespaces/list":              true,
+	"/pins/list":                    true,
+	"/recently_viewed":              true,
+	"/themes/get":                   true,
+	"/render":                       true,
+	"/trash/list":                   true,
+	"/inventory/low_stock":          true,
+	"/inventory/overdue_loans":      true,
+	"/inventory/container_summary":  true,
+	"/inventory/maintenance_report": true,
+	"/inventory/lookup_barcode":     true,
+	"/calendar/upcoming":            true,
+	"/reminders/pending":            true,
+	"/metrics/summary":              true,
+	"/index/health":                 true,
+	"/system/status":                true,
+	"/jobs/status":                  true,
+	"/jobs/details":                 true,
+	"/api/routes":                   true,
+}
+
+// APIToken lets a script outside the tailnet use the wiki without logging
+// in. Only a hash of the token is kept; it is shown once, when created.
+type APIToken struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Hash    string    `json:"hash,omitempty"`
+	Scopes  []string  `json:"scopes"`
+	Created time.Time `json:"created"`
+}
+
+// HasScope is whether the token may make requests needing scope.
+func (t APIToken) HasScope(scope string) bool {
+	return stringInSlice(scope, t.Scopes)
+}
+
+// hashAPIToken hashes a token for storage. Tokens are long and random, so
+// unlike passphrases they don't need a slow hash.
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// APITokens returns the tokens, oldest first, with their hashes.
+func (s *Site) APITokens() ([]APIToken, error) {
+	tokens := []APIToken{}
+	data, err := ioutil.ReadFile(path.Join(s.PathToData, apiTokensFile))
+	if os.IsNotExist(err) {
+		return tokens, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &tokens)
+	return tokens, err
+}
+
+func (s *Site) saveAPITokens(tokens []APIToken) error {
+	data, err := json.MarshalIndent(tokens, "", " ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(s.PathToData, apiTokensFile), data, 0600)
+}
+
+// CreateAPIToken makes a token with the scopes, returning it and the token
+// itself, which can't be had again.
+func (s *Site) CreateAPIToken(name string, scopes []string) (APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return APIToken{}, "", fmt.Errorf("a token needs a name")
+	}
+	if len(scopes) == 0 {
+		return APIToken{}, "", fmt.Errorf("a token needs at least one scope of %s", strings.Join(apiTokenScopes, ", "))
+	}
+	for _, scope := range scopes {
+		if !stringInSlice(scope, apiTokenScopes) {
+			return APIToken{}, "", fmt.Errorf("no scope %q; scopes are %s", scope, strings.Join(apiTokenScopes, ", "))
+		}
+	}
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return APIToken{}, "", err
+	}
+	token := apiTokenPrefix + hex.EncodeToString(secret)
+	created := APIToken{ID: newTraceID()[:12], Name: name, Hash: hashAPIToken(token), Scopes: scopes, Created: time.Now()}
+
+	s.apiTokensMut.Lock()
+	defer s.apiTokensMut.Unlock()
+	tokens, err := s.APITokens()
+	if err != nil {
+		return APIToken{}, "", err
+	}
+	if err := s.saveAPITokens(append(tokens, created)); err != nil {
+		return APIToken{}, "", err
+	}
+	if err := s.Audit("api_token_created", map[string]interface{}{"id": created.ID, "name": name, "scopes": scopes}); err != nil {
+		s.Logger.Error("Could not record the new API token: %v", err)
+	}
+	created.Hash = ""
+	return created, token, nil
+}
+
+// RevokeToken deletes the token with the id; requests using it are refused
+// from then on.
+func (s *Site) RevokeToken(id string) error {
+	s.apiTokensMut.Lock()
+	defer s.apiTokensMut.Unlock()
+	tokens, err := s.APITokens()
+	if err != nil {
+		return err
+	}
+	for i, token := range tokens {
+		if token.ID == id {
+			if err := s.saveAPITokens(append(tokens[:i], tokens[i+1:]...)); err != nil {
+				return err
+			}
+			if err := s.Audit("api_token_revoked", map[string]interface{}{"id": id, "name": token.Name}); err != nil {
+				s.Logger.Error("Could not record revoking the API token: %v", err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no token %s", id)
+}
+
+// authenticateAPIToken finds the token, false if it isn't one of ours.
+func (s *Site) authenticateAPIToken(token string) (APIToken, bool) {
+	tokens, err := s.APITokens()
+	if err != nil {
+		return APIToken{}, false
+	}
+	hash := []byte(hashAPIToken(token))
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(t.Hash)) == 1 {
+			return t, true
+		}
+	}
+	return APIToken{}, false
+}
+
+// requestAPIToken is the API token the request carries in its X-API-Token
+// header, or as its bearer token, "" if none. As with inbox tokens, the
+// access code check slows every request with an Authorization header, so
+// X-API-Token is better.
+func requestAPIToken(c *gin.Context) string {
+	if token := c.GetHeader("X-API-Token"); token != "" {
+		return token
+	}
+	if token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "); strings.HasPrefix(token, apiTokenPrefix) {
+		return token
+	}
+	return ""
+}
+
+// requiredScope is the scope a token needs to make the request.
+func requiredScope(c *gin.Context) string {
+	route := c.Request.URL.Path
+	switch {
+	case strings.HasPrefix(route, "/tokens/") || route == "/system/settings" || route == "/system/audit_log" || route == "/system/integrity" || route == "/system/clients" || route == "/system/webhook_secret":
+		return ScopeAdmin
+	case strings.HasPrefix(route, "/import/"):
+		return ScopeImport
+	case strings.HasPrefix(route, "/export/"):
+		return ScopeExport
+	case c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || readOnlyRoutes[route]:
+		return ScopeRead
+	}
+	return ScopeWrite
+}
+
+// authenticateAPITokens lets requests with a valid API token past the access
+// code, as long as the token has the scope the request needs. Requests with
+// a token that isn't valid are refused rather than treated as anonymous.
+func (s *Site) authenticateAPITokens(c *gin.Context) {
+	presented := requestAPIToken(c)
+	if presented == "" {
+		c.Next()
+		return
+	}
+	token, ok := s.authenticateAPIToken(presented)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Unknown or revoked API token"})
+		return
+	}
+	if scope := requiredScope(c); !token.HasScope(scope) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"success": false, "message": fmt.Sprintf("The API token %s doesn't have the %s scope", token.Name, scope)})
+		return
+	}
+	c.Set(apiTokenKey, token)
+	c.Next()
+}
+
+func (s *Site) handleCreateAPIToken(c *gin.Context) {
+	type QueryJSON struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	created, token, err := s.CreateAPIToken(json.Name, json.Scopes)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Created; the token won't be shown again", "token": token, "api_token": created})
+}
+
+func (s *Site) handleRevokeAPIToken(c *gin.Context) {
+	type QueryJSON struct {
+		ID string `json:"id"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	if err := s.RevokeToken(json.ID); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Revoked"})
+}
+
+func (s *Site) handleListAPITokens(c *gin.Context) {
+	tokens, err := s.APITokens()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	sort.SliceStable(tokens, func(i, j int) bool { return tokens[i].Created.Before(tokens[j].Created) })
+	for i := range tokens {
+		tokens[i].Hash = ""
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "tokens": tokens})
+}
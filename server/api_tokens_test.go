@@ -0,0 +1,85 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/jcelliott/lumber"
+)
+
+func TestAPITokens(t *testing.T) {
+	s := &Site{
+		PathToData:   t.TempDir(),
+		SecretCode:   "letmein",
+		SessionStore: cookie.NewStore([]byte("secret")),
+		Logger:       lumber.NewConsoleLogger(lumber.WARN),
+	}
+	newTestPage(s, "tomatoes", "# Tomatoes").Save()
+
+	if _, _, err := s.CreateAPIToken("backup", []string{"everything"}); err == nil {
+		t.Error("Expected an unknown scope to be refused")
+	}
+	reader, readToken, err := s.CreateAPIToken("backup", []string{ScopeRead, ScopeExport})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(readToken, apiTokenPrefix) || reader.Hash != "" {
+		t.Errorf("Unexpected token %s %+v", readToken, reader)
+	}
+	if tokens, _ := s.APITokens(); len(tokens) != 1 || tokens[0].Hash == "" || strings.Contains(tokens[0].Hash, readToken) {
+		t.Errorf("Expected the token stored hashed, got %+v", tokens)
+	}
+
+	router := s.Router()
+	request := func(method, url, token, body string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		if token != "" {
+			req.Header.Set("X-API-Token", token)
+		}
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := request("GET", "/tomatoes.md", "", ""); code != http.StatusTemporaryRedirect {
+		t.Errorf("Expected a login redirect without a token, got %d", code)
+	}
+	if code := request("GET", "/tomatoes.md", readToken, ""); code != http.StatusOK {
+		t.Errorf("Expected a read token to read, got %d", code)
+	}
+	if code := request("POST", "/pages/list", readToken, "{}"); code != http.StatusOK {
+		t.Errorf("Expected a read token to list pages, got %d", code)
+	}
+	if code := request("POST", "/update", readToken, `{"page": "tomatoes", "new_text": "# Gone"}`); code != http.StatusForbidden {
+		t.Errorf("Expected a read token to be refused edits, got %d", code)
+	}
+	if code := request("POST", "/erase", readToken, `{"page": "tomatoes"}`); code != http.StatusForbidden {
+		t.Errorf("Expected a read token to be refused erasing, got %d", code)
+	}
+	if code := request("GET", "/tomatoes/erase", readToken, ""); code != http.StatusFound || s.Open("tomatoes").IsNew() {
+		t.Errorf("Expected GET /tomatoes/erase to leave the page alone, got %d", code)
+	}
+	if code := request("POST", "/tokens/create", readToken, `{"name": "more", "scopes": ["admin"]}`); code != http.StatusForbidden {
+		t.Errorf("Expected a read token to be refused making tokens, got %d", code)
+	}
+	if code := request("GET", "/tomatoes.md", apiTokenPrefix+"nope", ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected an unknown token to be refused, got %d", code)
+	}
+
+	if err := s.RevokeToken(reader.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := request("GET", "/tomatoes.md", readToken, ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected a revoked token to be refused, got %d", code)
+	}
+	if err := s.RevokeToken(reader.ID); err == nil {
+		t.Error("Expected revoking twice to fail")
+	}
+	if events, _ := s.AuditLog(10); len(events) != 2 || events[1].Event != "api_token_revoked" {
+		t.Errorf("Expected the tokens in the audit log, got %+v", events)
+	}
+}
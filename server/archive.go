@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// archiveFile holds the archived pages, identifier to when, as JSON.
+const archiveFile = "archive.table"
+
+// ArchivedPage is a page taken out of the page list without deleting it. It
+// can still be read at its URL.
+type ArchivedPage struct {
+	Identifier string    `json:"identifier"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+func (s *Site) archive() (map[string]time.Time, error) {
+	archived := map[string]time.Time{}
+	data, err := ioutil.ReadFile(path.Join(s.PathToData, archiveFile))
+	if os.IsNotExist(err) {
+		return archived, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &archived)
+	return archived, err
+}
+
+func (s *Site) saveArchive(archived map[string]time.Time) error {
+	data, err := json.MarshalIndent(archived, "", " ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(s.PathToData, archiveFile), data, 0644)
+}
+
+func (s *Site) updateArchive(fn func(archived map[string]time.Time) error) error {
+	s.archiveMut.Lock()
+	defer s.archiveMut.Unlock()
+	archived, err := s.archive()
+	if err != nil {
+		return err
+	}
+	if err := fn(archived); err != nil {
+		return err
+	}
+	return s.saveArchive(archived)
+}
+
+// ArchivedAt says when the page was archived, if it is.
+func (s *Site) ArchivedAt(identifier string) (time.Time, bool) {
+	archived, err := s.archive()
+	if err != nil {
+		return time.Time{}, false
+	}
+	at, ok := archived[strings.ToLower(identifier)]
+	return at, ok
+}
+
+// ArchivePage takes a page out of the page list. It can still be read, and
+// UnarchivePage puts it back.
+func (s *Site) ArchivePage(identifier string) error {
+	identifier = strings.ToLower(strings.TrimSpace(identifier))
+	if !s.hasPageFile(identifier, ".json") {
+		return fmt.Errorf("there is no page %q", identifier)
+	}
+	return s.updateArchive(func(archived map[string]time.Time) error {
+		if _, ok := archived[identifier]; ok {
+			return errors.New("page is already archived")
+		}
+		archived[identifier] = time.Now()
+		return nil
+	})
+}
+
+func (s *Site) UnarchivePage(identifier string) error {
+	identifier = strings.ToLower(strings.TrimSpace(identifier))
+	return s.updateArchive(func(archived map[string]time.Time) error {
+		if _, ok := archived[identifier]; !ok {
+			return errors.New("page isn't archived")
+		}
+		delete(archived, identifier)
+		return nil
+	})
+}
+
+// ArchivedPages lists the archived pages, most recently archived first.
+func (s *Site) ArchivedPages() ([]ArchivedPage, error) {
+	archived, err := s.archive()
+	if err != nil {
+		return nil, err
+	}
+	pages := []ArchivedPage{}
+	for identifier, at := range archived {
+		pages = append(pages, ArchivedPage{Identifier: identifier, ArchivedAt: at})
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].ArchivedAt.After(pages[j].ArchivedAt) })
+	return pages, nil
+}
+
+// moveArchived keeps a page archived when it is renamed, and forgets it when
+// it is erased (to is empty).
+func (s *Site) moveArchived(from, to string) error {
+	if _, ok := s.ArchivedAt(from); !ok {
+		return nil
+	}
+	return s.updateArchive(func(archived map[string]time.Time) error {
+		if to != "" {
+			archived[to] = archived[from]
+		}
+		delete(archived, from)
+		return nil
+	})
+}
+
+func (s *Site) handleArchivePage(c *gin.Context) {
+	type QueryJSON struct {
+		Page string `json:"page"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	if err := s.ArchivePage(json.Page); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Archived"})
+}
+
+func (s *Site) handleUnarchivePage(c *gin.Context) {
+	type QueryJSON struct {
+		Page string `json:"page"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	if err := s.UnarchivePage(json.Page); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Unarchived"})
+}
+
+func (s *Site) handleListArchivedPages(c *gin.Context) {
+	pages, err := s.ArchivedPages()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "pages": pages})
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+)
+
+func TestArchivePage(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), SessionStore: cookie.NewStore([]byte("secret"))}
+	newTestPage(s, "old_drill", "# Old drill")
+	newTestPage(s, "new_drill", "# New drill")
+
+	if err := s.ArchivePage("old_drill"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ArchivePage("old_drill"); err == nil {
+		t.Error("Expected archiving twice to fail")
+	}
+	if err := s.ArchivePage("nope"); err == nil {
+		t.Error("Expected archiving a missing page to fail")
+	}
+	for _, entry := range s.DirectoryList() {
+		if entry.Name() == "old_drill" {
+			t.Error("Expected the archived page to be left out of the list")
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/old_drill/view", nil)
+	s.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "archived-banner") {
+		t.Errorf("Expected the archived page to be readable with a banner, got %d", w.Code)
+	}
+
+	if err := s.RenamePage("old_drill", "older_drill"); err != nil {
+		t.Fatal(err)
+	}
+	if pages, _ := s.ArchivedPages(); len(pages) != 1 || pages[0].Identifier != "older_drill" {
+		t.Errorf("Expected the page to stay archived when renamed, got %v", pages)
+	}
+
+	if err := s.UnarchivePage("older_drill"); err != nil {
+		t.Fatal(err)
+	}
+	if pages, _ := s.ArchivedPages(); len(pages) != 0 {
+		t.Errorf("Expected no archived pages, got %v", pages)
+	}
+}
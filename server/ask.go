@@ -0,0 +1,149 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// askSources is how many pages a question is answered from.
+const askSources = 5
+
+// maxAskSourceLength keeps the prompt a manageable size; each page is cut
+// off after this many bytes.
+const maxAskSourceLength = 4000
+
+// AskSource is a page an answer was drawn from; Cited says whether the
+// answer referred to it.
+type AskSource struct {
+	Identifier string `json:"identifier"`
+	Title      string `json:"title"`
+	Cited      bool   `json:"cited"`
+}
+
+// AskAnswer is the LLM's answer to a question about the wiki and the pages
+// it was given.
+type AskAnswer struct {
+	Question string      `json:"question"`
+	Answer   string      `json:"answer"`
+	Sources  []AskSource `json:"sources"`
+}
+
+func askPrompt(question string, pages []PageSearchResult) string {
+	prompt := "Answer the question using only the wiki pages below. After each fact, cite the page it came from by its identifier in square brackets, e.g. [furnace]. If the pages don't say, answer that the wiki doesn't say.\n\n"
+	for _, page := range pages {
+		body := page.body
+		if len(body) > maxAskSourceLength {
+			body = strings.ToValidUTF8(body[:maxAskSourceLength], "") + "\n..."
+		}
+		prompt += "### [" + page.Identifier + "] " + page.Title + "\n\n" + strings.TrimSpace(body) + "\n\n"
+	}
+	return prompt + "Question: " + question + "\n"
+}
+
+func askSourcesOf(pages []PageSearchResult, answer string) []AskSource {
+	sources := []AskSource{}
+	for _, page := range pages {
+		sources = append(sources, AskSource{
+			Identifier: page.Identifier,
+			Title:      page.Title,
+			Cited:      strings.Contains(answer, "["+page.Identifier+"]"),
+		})
+	}
+	return sources
+}
+
+// AnswerFrom asks the LLM to answer the question from the pages, handing
+// the answer to emit as it is written when the provider can stream.
+func (s *Site) AnswerFrom(question string, pages []PageSearchResult, emit func(chunk string) error) (AskAnswer, error) {
+	answer := AskAnswer{Question: question}
+	provider := s.llm()
+	if provider == nil {
+		return answer, errors.New("asking the wiki needs it to be started with --llm")
+	}
+	if len(pages) == 0 {
+		answer.Answer = "Nothing in the wiki seems to be about that."
+		answer.Sources = []AskSource{}
+		if emit != nil {
+			return answer, emit(answer.Answer)
+		}
+		return answer, nil
+	}
+
+	prompt := askPrompt(question, pages)
+	var err error
+	if streamer, ok := provider.(LLMStreamer); ok && emit != nil {
+		var text strings.Builder
+		err = streamer.Stream(prompt, func(chunk string) error {
+			text.WriteString(chunk)
+			return emit(chunk)
+		})
+		answer.Answer = text.String()
+	} else {
+		answer.Answer, err = provider.Complete(prompt)
+		if err == nil && emit != nil {
+			err = emit(answer.Answer)
+		}
+	}
+	answer.Answer = strings.TrimSpace(answer.Answer)
+	answer.Sources = askSourcesOf(pages, answer.Answer)
+	return answer, err
+}
+
+// AskWiki answers a question from the pages that best match it, citing them.
+func (s *Site) AskWiki(question string) (AskAnswer, error) {
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return AskAnswer{}, errors.New("must ask a question")
+	}
+	return s.AnswerFrom(question, s.SearchPages(question, askSources), nil)
+}
+
+// handleAskWiki answers with JSON, or with stream as server-sent events: the
+// sources, then answer chunks, then done with the whole answer and which
+// sources it cited.
+func (s *Site) handleAskWiki(c *gin.Context) {
+	type QueryJSON struct {
+		Question string `json:"question"`
+		Stream   bool   `json:"stream"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	question := strings.TrimSpace(json.Question)
+	if question == "" {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Must specify `question`"})
+		return
+	}
+	if !json.Stream {
+		answer, err := s.AskWiki(question)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true, "answer": answer})
+		return
+	}
+
+	pages := s.SearchPages(question, askSources)
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.SSEvent("sources", askSourcesOf(pages, ""))
+	c.Writer.Flush()
+	answer, err := s.AnswerFrom(question, pages, func(chunk string) error {
+		c.SSEvent("answer", chunk)
+		c.Writer.Flush()
+		return c.Request.Context().Err()
+	})
+	if err != nil {
+		c.SSEvent("error", err.Error())
+		return
+	}
+	c.SSEvent("done", answer)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/jcelliott/lumber"
+)
+
+type streamingLLM struct {
+	prompt string
+}
+
+func (l *streamingLLM) Complete(prompt string) (string, error) {
+	l.prompt = prompt
+	return "Every month [furnace].", nil
+}
+
+func (l *streamingLLM) Stream(prompt string, emit func(chunk string) error) error {
+	l.prompt = prompt
+	for _, chunk := range []string{"Every ", "month ", "[furnace]."} {
+		if err := emit(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func askTestSite(t *testing.T) (*Site, *streamingLLM) {
+	llm := &streamingLLM{}
+	s := &Site{PathToData: t.TempDir(), LLM: llm, SessionStore: cookie.NewStore([]byte("secret")), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	for _, p := range []*Page{
+		newTestPage(s, "furnace", "+++\ntitle = \"Furnace\"\n+++\n\nChange the furnace filter every month.\n"),
+		newTestPage(s, "garden", "# Garden\n\nWater the tomatoes every morning.\n"),
+		newTestPage(s, "filters", "Filter sizes: the fridge water filter is a WF-1.\n"),
+	} {
+		if err := p.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s, llm
+}
+
+func TestSearchPages(t *testing.T) {
+	s, _ := askTestSite(t)
+	results := s.SearchPages("How often should the furnace filter be changed?", 5)
+	if len(results) != 2 || results[0].Identifier != "furnace" || results[1].Identifier != "filters" {
+		t.Errorf("Expected the furnace page then the filters page, got %+v", results)
+	}
+	if results := s.SearchPages("the and what", 5); len(results) != 0 {
+		t.Errorf("Expected stop words not to match anything, got %+v", results)
+	}
+}
+
+func TestSearchIndex(t *testing.T) {
+	s, _ := askTestSite(t)
+	pages, _, err := s.ExportPages(PageListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := NewSearchIndex()
+	for _, page := range pages {
+		title, _ := page.Frontmatter["title"].(string)
+		index.Add(page.Identifier, title, page.Markdown)
+	}
+	query := "How often should the furnace filter be changed?"
+	expected, got := s.SearchPages(query, 5), index.Search(query, 5)
+	if len(got) != len(expected) {
+		t.Fatalf("Expected the index to find %+v, got %+v", expected, got)
+	}
+	for i := range got {
+		if got[i].Identifier != expected[i].Identifier || got[i].Score != expected[i].Score {
+			t.Errorf("Expected the index to rank as SearchPages does, %+v, got %+v", expected, got)
+		}
+	}
+}
+
+func TestAskWiki(t *testing.T) {
+	s, llm := askTestSite(t)
+	answer, err := s.AskWiki("How often should the furnace filter be changed?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Answer != "Every month [furnace]." {
+		t.Errorf("Expected the model's answer, got %q", answer.Answer)
+	}
+	if !strings.Contains(llm.prompt, "### [furnace] Furnace") || strings.Contains(llm.prompt, "tomatoes") {
+		t.Errorf("Expected only the matching pages in the prompt, got %q", llm.prompt)
+	}
+	if len(answer.Sources) != 2 || !answer.Sources[0].Cited || answer.Sources[1].Cited {
+		t.Errorf("Expected the furnace to be the cited source, got %+v", answer.Sources)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/ask", bytes.NewBufferString(`{"question": "furnace filter?", "stream": true}`))
+	req.Header.Set("Content-Type", "application/json")
+	s.Router().ServeHTTP(w, req)
+	events := w.Body.String()
+	sources, chunk, done := strings.Index(events, "event:sources"), strings.Index(events, "data:month "), strings.Index(events, "event:done")
+	if sources < 0 || chunk < sources || done < chunk {
+		t.Errorf("Expected the sources, then the answer as it was written, then done, got\n%s", events)
+	}
+}
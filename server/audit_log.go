@@ -0,0 +1,122 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditLogFile holds the audit log, one JSON AuditEvent per line.
+const auditLogFile = "audit.log"
+
+// AuditEvent is something done to the wiki as a whole, e.g. its
+// configuration changing.
+type AuditEvent struct {
+	Time    time.Time              `json:"time"`
+	Event   string                 `json:"event"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Audit appends an event to the audit log.
+func (s *Site) Audit(event string, details map[string]interface{}) error {
+	data, err := json.Marshal(AuditEvent{Time: time.Now(), Event: event, Details: details})
+	if err != nil {
+		return err
+	}
+	s.auditMut.Lock()
+	defer s.auditMut.Unlock()
+	f, err := os.OpenFile(path.Join(s.PathToData, auditLogFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// AuditLog returns the last limit events, oldest first.
+func (s *Site) AuditLog(limit int) ([]AuditEvent, error) {
+	s.auditMut.Lock()
+	defer s.auditMut.Unlock()
+	events := []AuditEvent{}
+	f, err := os.Open(path.Join(s.PathToData, auditLogFile))
+	if os.IsNotExist(err) {
+		return events, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+		if len(events) > limit {
+			events = events[1:]
+		}
+	}
+	return events, scanner.Err()
+}
+
+// auditRequests adds each request that changes the wiki to the audit log
+// once it's handled, with who made it, how big it was and how it went,
+// when AuditRequests. Which requests change things is decided as it is for
+// API token scopes, see requiredScope; routes in AuditSkipRoutes, like the
+// edit locks taken every few seconds while editing, are left out.
+func (s *Site) auditRequests(c *gin.Context) {
+	if !s.AuditRequests || stringInSlice(c.Request.URL.Path, s.AuditSkipRoutes) {
+		return
+	}
+	if scope := requiredScope(c); scope == ScopeRead || scope == ScopeExport {
+		return
+	}
+	c.Next()
+	details := map[string]interface{}{
+		"method": c.Request.Method,
+		"route":  c.Request.URL.Path,
+		"status": c.Writer.Status(),
+		"bytes":  c.Request.ContentLength,
+	}
+	if identity := requestIdentity(c); identity != "" {
+		details["identity"] = identity
+	}
+	if role := c.GetString(roleKey); role != "" {
+		details["role"] = role
+	}
+	if token, ok := c.Get(apiTokenKey); ok {
+		details["api_token"] = token.(APIToken).Name
+	}
+	if err := s.Audit("request", details); err != nil {
+		s.Logger.Error("Could not audit %s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+	}
+}
+
+func (s *Site) handleAuditLog(c *gin.Context) {
+	type QueryJSON struct {
+		Limit int `json:"limit"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	if json.Limit <= 0 {
+		json.Limit = 100
+	}
+	events, err := s.AuditLog(json.Limit)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "events": events})
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/jcelliott/lumber"
+)
+
+func TestAuditRequests(t *testing.T) {
+	proxies, _ := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	s := &Site{PathToData: t.TempDir(), AuditRequests: true, AuditSkipRoutes: []string{"/edit_lock/acquire"}, AnonymousReadOnly: true, TrustedProxies: proxies, SessionStore: cookie.NewStore([]byte("secret")), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	newTestPage(s, "notes", "some notes")
+	router := s.Router()
+	send := func(url, body, identity string) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", url, strings.NewReader(body))
+		req.RemoteAddr = "10.1.2.3:4000"
+		if identity != "" {
+			req.Header.Set(defaultIdentityHeader, identity)
+		}
+		router.ServeHTTP(w, req)
+	}
+	send("/update", `{"page": "notes", "new_text": "more notes"}`, "alice@example.com")
+	send("/search", `{"query": "notes"}`, "alice@example.com")
+	send("/edit_lock/acquire", `{"page": "notes"}`, "alice@example.com")
+	send("/update", `{"page": "notes", "new_text": "defaced"}`, "")
+	send("/erase", `{"page": "notes"}`, "alice@example.com")
+
+	events, err := s.AuditLog(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected the two edits and the erase audited, not the search or the skipped route, got %+v", events)
+	}
+	edit, refused := events[0].Details, events[1].Details
+	if events[0].Event != "request" || edit["route"] != "/update" || edit["identity"] != "alice@example.com" || edit["status"] != float64(http.StatusOK) || edit["bytes"].(float64) <= 0 {
+		t.Errorf("Expected alice's edit, got %+v", events[0])
+	}
+	if refused["status"] != float64(http.StatusUnauthorized) || refused["identity"] != nil {
+		t.Errorf("Expected the anonymous edit audited as refused, got %+v", events[1])
+	}
+	if erase := events[2].Details; erase["route"] != "/erase" || erase["identity"] != "alice@example.com" || erase["status"] != float64(http.StatusOK) {
+		t.Errorf("Expected alice's erase, got %+v", events[2])
+	}
+}
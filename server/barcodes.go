@@ -0,0 +1,224 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// barcodesFile caches barcode lookups, code to suggestion, as JSON so each
+// code is only looked up once.
+const barcodesFile = "barcodes.table"
+
+// BarcodeSuggestion is what a UPC database knows about a barcode, for
+// pre-filling a new item's page. Found is false for codes the provider
+// doesn't know, which are cached too.
+type BarcodeSuggestion struct {
+	Code         string    `json:"code"`
+	Found        bool      `json:"found"`
+	Title        string    `json:"title,omitempty"`
+	Manufacturer string    `json:"manufacturer,omitempty"`
+	Image        string    `json:"image,omitempty"`
+	Identifier   string    `json:"identifier,omitempty"`
+	LookedUpAt   time.Time `json:"looked_up_at"`
+}
+
+// barcodeProviders are the UPC databases that can be named instead of
+// giving a URL.
+var barcodeProviders = map[string]string{
+	"upcitemdb":     "https://api.upcitemdb.com/prod/trial/lookup?upc={code}",
+	"openfoodfacts": "https://world.openfoodfacts.org/api/v0/product/{code}.json",
+}
+
+// barcodeProviderURL resolves --barcode-provider, a provider name or a URL
+// with {code} where the barcode goes.
+func barcodeProviderURL(provider string) (string, error) {
+	if known, ok := barcodeProviders[provider]; ok {
+		return known, nil
+	}
+	u, err := url.Parse(strings.Replace(provider, "{code}", "0", -1))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !strings.Contains(provider, "{code}") {
+		return "", fmt.Errorf("barcode provider %q should be upcitemdb, openfoodfacts, or an http URL with {code} in it", provider)
+	}
+	return provider, nil
+}
+
+// CheckBarcodeProvider says what is wrong with a --barcode-provider, if
+// anything.
+func CheckBarcodeProvider(provider string) error {
+	_, err := barcodeProviderURL(provider)
+	return err
+}
+
+// checkBarcode accepts UPC-E, EAN-8, UPC-A, EAN-13 and GTIN-14 codes.
+func checkBarcode(code string) error {
+	if len(code) < 8 || len(code) > 14 {
+		return fmt.Errorf("barcode %q should be 8 to 14 digits", code)
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return fmt.Errorf("barcode %q should be 8 to 14 digits", code)
+		}
+	}
+	return nil
+}
+
+// parseBarcodeResponse reads the answers of UPCitemdb, Open Food Facts, and
+// any provider answering {"title", "manufacturer", "image"}.
+func parseBarcodeResponse(data []byte) (BarcodeSuggestion, error) {
+	var response struct {
+		// UPCitemdb
+		Items []struct {
+			Title  string   `json:"title"`
+			Brand  string   `json:"brand"`
+			Images []string `json:"images"`
+		} `json:"items"`
+		// Open Food Facts
+		Product *struct {
+			ProductName string `json:"product_name"`
+			Brands      string `json:"brands"`
+			ImageURL    string `json:"image_url"`
+		} `json:"product"`
+		// anything else
+		Title        string `json:"title"`
+		Manufacturer string `json:"manufacturer"`
+		Image        string `json:"image"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return BarcodeSuggestion{}, err
+	}
+	suggestion := BarcodeSuggestion{Title: response.Title, Manufacturer: response.Manufacturer, Image: response.Image}
+	if len(response.Items) > 0 {
+		item := response.Items[0]
+		suggestion.Title, suggestion.Manufacturer = item.Title, item.Brand
+		if len(item.Images) > 0 {
+			suggestion.Image = item.Images[0]
+		}
+	}
+	if response.Product != nil {
+		suggestion.Title = response.Product.ProductName
+		suggestion.Manufacturer = response.Product.Brands
+		suggestion.Image = response.Product.ImageURL
+	}
+	suggestion.Found = suggestion.Title != ""
+	return suggestion, nil
+}
+
+func (s *Site) cachedBarcodes() (map[string]BarcodeSuggestion, error) {
+	cached := map[string]BarcodeSuggestion{}
+	data, err := ioutil.ReadFile(path.Join(s.PathToData, barcodesFile))
+	if os.IsNotExist(err) {
+		return cached, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &cached)
+	return cached, err
+}
+
+// LookupBarcode suggests a title, manufacturer and image for a barcode from
+// the configured UPC database, along with an identifier for the new page.
+// Answers are cached in the data folder.
+func (s *Site) LookupBarcode(code string) (BarcodeSuggestion, error) {
+	code = strings.TrimSpace(code)
+	if err := checkBarcode(code); err != nil {
+		return BarcodeSuggestion{}, err
+	}
+	s.barcodesMut.Lock()
+	cached, err := s.cachedBarcodes()
+	s.barcodesMut.Unlock()
+	if err != nil {
+		return BarcodeSuggestion{}, err
+	}
+	suggestion, ok := cached[code]
+	if !ok {
+		if suggestion, err = s.fetchBarcode(code); err != nil {
+			return BarcodeSuggestion{}, err
+		}
+		if err := s.cacheBarcode(suggestion); err != nil {
+			return BarcodeSuggestion{}, err
+		}
+	}
+	if suggestion.Found {
+		suggestion.Identifier = s.GenerateIdentifier(suggestion.Title).Identifier
+	}
+	return suggestion, nil
+}
+
+func (s *Site) fetchBarcode(code string) (BarcodeSuggestion, error) {
+	if s.BarcodeProvider == "" {
+		return BarcodeSuggestion{}, errors.New("barcode lookup needs the wiki to be started with --barcode-provider")
+	}
+	providerURL, err := barcodeProviderURL(s.BarcodeProvider)
+	if err != nil {
+		return BarcodeSuggestion{}, err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(strings.Replace(providerURL, "{code}", code, -1))
+	if err != nil {
+		return BarcodeSuggestion{}, err
+	}
+	defer resp.Body.Close()
+	suggestion := BarcodeSuggestion{}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		// an unknown code, cached like any other answer
+	case resp.StatusCode >= 300:
+		return BarcodeSuggestion{}, fmt.Errorf("barcode provider answered %s", resp.Status)
+	default:
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return BarcodeSuggestion{}, err
+		}
+		if suggestion, err = parseBarcodeResponse(data); err != nil {
+			return BarcodeSuggestion{}, fmt.Errorf("could not read the barcode provider's answer: %v", err)
+		}
+	}
+	suggestion.Code = code
+	suggestion.LookedUpAt = time.Now()
+	return suggestion, nil
+}
+
+func (s *Site) cacheBarcode(suggestion BarcodeSuggestion) error {
+	s.barcodesMut.Lock()
+	defer s.barcodesMut.Unlock()
+	cached, err := s.cachedBarcodes()
+	if err != nil {
+		return err
+	}
+	cached[suggestion.Code] = suggestion
+	data, err := json.MarshalIndent(cached, "", " ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(s.PathToData, barcodesFile), data, 0644)
+}
+
+func (s *Site) handleLookupBarcode(c *gin.Context) {
+	type QueryJSON struct {
+		Code string `json:"code"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	suggestion, err := s.LookupBarcode(json.Code)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "suggestion": suggestion})
+}
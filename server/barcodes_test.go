@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLookupBarcode(t *testing.T) {
+	lookups := 0
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lookups++
+		switch req.URL.Query().Get("upc") {
+		case "012345678905":
+			w.Write([]byte(`{"code": "OK", "items": [{"title": "Cordless Drill", "brand": "Makita", "images": ["http://img/drill.jpg"]}]}`))
+		default:
+			w.Write([]byte(`{"code": "OK", "items": []}`))
+		}
+	}))
+	defer provider.Close()
+
+	s := &Site{PathToData: t.TempDir()}
+	if _, err := s.LookupBarcode("012345678905"); err == nil {
+		t.Error("Expected lookups to need a provider")
+	}
+	s.BarcodeProvider = provider.URL + "/lookup?upc={code}"
+
+	if _, err := s.LookupBarcode("12ab"); err == nil {
+		t.Error("Expected a code that isn't a barcode to be refused")
+	}
+	suggestion, err := s.LookupBarcode("012345678905")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !suggestion.Found || suggestion.Title != "Cordless Drill" || suggestion.Manufacturer != "Makita" || suggestion.Image != "http://img/drill.jpg" {
+		t.Errorf("Expected the provider's suggestion, got %+v", suggestion)
+	}
+	if suggestion.Identifier != "cordless_drill" {
+		t.Errorf("Expected an identifier for the new page, got %q", suggestion.Identifier)
+	}
+
+	if suggestion, err := s.LookupBarcode("00000000"); err != nil || suggestion.Found {
+		t.Errorf("Expected an unknown code not to be found, got %+v %v", suggestion, err)
+	}
+	s.LookupBarcode("012345678905")
+	s.LookupBarcode("00000000")
+	if lookups != 2 {
+		t.Errorf("Expected each code to be looked up once, got %d lookups", lookups)
+	}
+}
+
+func TestParseOpenFoodFactsResponse(t *testing.T) {
+	suggestion, err := parseBarcodeResponse([]byte(`{"status": 1, "product": {"product_name": "Oat Milk", "brands": "Oatly", "image_url": "http://img/oat.jpg"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !suggestion.Found || suggestion.Title != "Oat Milk" || suggestion.Manufacturer != "Oatly" {
+		t.Errorf("Expected the Open Food Facts product, got %+v", suggestion)
+	}
+	if err := CheckBarcodeProvider("ftp://example.com/{code}"); err == nil {
+		t.Error("Expected a provider that isn't http to be refused")
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// CleanBasePath checks a --base-path setting and cleans it into "" for the
+// root, or a path like /wiki without a trailing slash.
+func CleanBasePath(basePath string) (string, error) {
+	if basePath == "" || basePath == "/" {
+		return "", nil
+	}
+	if !strings.HasPrefix(basePath, "/") || strings.ContainsAny(basePath, "?#\"' ") {
+		return "", fmt.Errorf("base-path %q should be a path like /wiki", basePath)
+	}
+	cleaned := path.Clean(basePath)
+	if cleaned != strings.TrimSuffix(basePath, "/") {
+		return "", fmt.Errorf("base-path %q should be a plain path like %s", basePath, cleaned)
+	}
+	return cleaned, nil
+}
+
+// rRootRelativeURL matches the links, images and forms in HTML that lead
+// somewhere on this server, like href="/x/view", but not href="//host/".
+var rRootRelativeURL = regexp.MustCompile(`(\s(?:href|src|action)=")/([^/"]|")`)
+
+// linkUnderBasePath moves the links to this server in rendered HTML under
+// BasePath. Pages' text links to /x/view whatever the base path, so it's
+// done as pages are shown rather than as they're rendered.
+func (s *Site) linkUnderBasePath(html []byte) []byte {
+	if s.BasePath == "" {
+		return html
+	}
+	return rRootRelativeURL.ReplaceAll(html, []byte("${1}"+s.BasePath+"/${2}"))
+}
+
+// underBasePath serves handler at basePath instead of the root, for a wiki
+// behind a reverse proxy that passes it /wiki/... without taking the prefix
+// off; redirects the handler makes to /x are sent to /wiki/x. Other paths
+// are not found.
+func underBasePath(basePath string, handler http.Handler) http.Handler {
+	if basePath == "" {
+		return handler
+	}
+	stripped := http.StripPrefix(basePath, handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == basePath:
+			http.Redirect(w, r, basePath+"/", http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, basePath+"/"):
+			stripped.ServeHTTP(&basePathWriter{ResponseWriter: w, basePath: basePath}, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// basePathWriter puts redirects to paths on this server under basePath.
+type basePathWriter struct {
+	http.ResponseWriter
+	basePath string
+}
+
+func (w *basePathWriter) WriteHeader(code int) {
+	if location := w.Header().Get("Location"); strings.HasPrefix(location, "/") && !strings.HasPrefix(location, "//") {
+		w.Header().Set("Location", w.basePath+location)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *basePathWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
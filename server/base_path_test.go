@@ -0,0 +1,99 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/jcelliott/lumber"
+)
+
+func TestCleanBasePath(t *testing.T) {
+	for given, expected := range map[string]string{"": "", "/": "", "/wiki": "/wiki", "/wiki/": "/wiki", "/home/wiki": "/home/wiki"} {
+		if cleaned, err := CleanBasePath(given); err != nil || cleaned != expected {
+			t.Errorf("Expected %q to be cleaned to %q, got %q %v", given, expected, cleaned, err)
+		}
+	}
+	for _, given := range []string{"wiki", "/wiki/../x", "//wiki", "/wiki?x=1", "/a wiki"} {
+		if _, err := CleanBasePath(given); err == nil {
+			t.Errorf("Expected %q to be refused", given)
+		}
+	}
+}
+
+func TestServingUnderBasePath(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), DefaultPage: "home", BasePath: "/wiki", SessionStore: cookie.NewStore([]byte("secret")), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	newTestPage(s, "home", "See the [[shelf]] and ![drill](/uploads/sha256-abc) or [elsewhere](//example.com/x)")
+	handler := underBasePath(s.BasePath, s.Router())
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get("/wiki"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/wiki/" {
+		t.Errorf("Expected the base path to redirect to itself with a slash, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := get("/wiki/"); w.Code != http.StatusFound || w.Header().Get("Location") != "/wiki/home/read" {
+		t.Errorf("Expected a redirect to the default page under the base path, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := get("/home/view"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected pages outside the base path not to be found, got %d", w.Code)
+	}
+
+	w := get("/wiki/home/view")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the page under the base path, got %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, expected := range []string{`href="/wiki/shelf/view"`, `src="/wiki/uploads/sha256-abc"`, `href="//example.com/x"`, `src="/wiki/static/js/simple_wiki.js"`, `basePath: "\/wiki"`} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected the page to have %s", expected)
+		}
+	}
+	if strings.Contains(body, `"/static/`) || strings.Contains(body, `href="/shelf/view"`) {
+		t.Errorf("Expected no links outside the base path")
+	}
+	if cookie := w.Header().Get("Set-Cookie"); !strings.Contains(cookie, "Path=/wiki/") {
+		t.Errorf("Expected the session cookie kept to the base path, got %q", cookie)
+	}
+
+	if w := get("/wiki/static/css/default.css"); w.Code != http.StatusOK {
+		t.Errorf("Expected static assets under the base path, got %d", w.Code)
+	}
+}
+
+func TestBasePathInsideListings(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), DefaultPage: "home", BasePath: "/wiki", Fileuploads: true, SessionStore: cookie.NewStore([]byte("secret")), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	p := newTestPage(s, "shelf", "first")
+	p.Update("second")
+	newTestPage(s, "projects/alpha/notes", "minutes")
+	if err := ioutil.WriteFile(filepath.Join(s.PathToData, "sha256-abc"), []byte("drill"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	handler := underBasePath(s.BasePath, s.Router())
+
+	for url, expected := range map[string]string{
+		"/wiki/shelf/history":             `href="/wiki/shelf/view\?version=`,
+		"/wiki/ls/view":                   `href="/wiki/(shelf|projects/alpha/notes)/view"`,
+		"/wiki/uploads/edit":              `href="/wiki/uploads/sha256-abc"`,
+		"/wiki/projects/alpha/notes/view": `href="/wiki/projects/alpha/view"`,
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected %s to render, got %d", url, w.Code)
+			continue
+		}
+		if !regexp.MustCompile(expected).MatchString(w.Body.String()) {
+			t.Errorf("Expected %s to have %s", url, expected)
+		}
+	}
+}
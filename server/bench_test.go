@@ -0,0 +1,130 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// benchmarkPage is a page like the ones the wiki is full of: frontmatter,
+// headings, a list and a template.
+const benchmarkPage = `+++
+identifier = "%[1]s"
+title = "Bin %[1]s"
+tags = ["garage", "hardware"]
+
+[inventory]
+container = "shelf"
+items = ["screws", "washers", "nuts"]
++++
+
+# {{or .Title .Identifier}}
+
+Odds and ends from the hardware store, sorted by size.
+
+- [ ] label the drawers
+- [x] sort the screws
+
+{{LinkTo "shelf"}}
+
+## Notes
+
+Metric on the left, imperial on the right. [[shelf]] is above it.
+`
+
+func newBenchmarkSite(b testing.TB, pages int) *Site {
+	s := &Site{PathToData: b.TempDir()}
+	for i := 0; i < pages; i++ {
+		id := fmt.Sprintf("bin_%d", i)
+		newTestPage(s, id, fmt.Sprintf(benchmarkPage, id))
+	}
+	return s
+}
+
+func BenchmarkPageSave(b *testing.B) {
+	s := newBenchmarkSite(b, 0)
+	p := newTestPage(s, "bin", fmt.Sprintf(benchmarkPage, "bin"))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := p.Save(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPageRender(b *testing.B) {
+	s := newBenchmarkSite(b, 1)
+	p := s.Open("bin_0")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Render()
+	}
+}
+
+func BenchmarkSearchPages(b *testing.B) {
+	s := newBenchmarkSite(b, 200)
+	s.SearchPages("screws", 10) // builds the index
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.SearchPages("metric screws", 10)
+	}
+}
+
+func BenchmarkMungeIdentifier(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		MungeIdentifier("Große Kiste: Schrauben & Muttern (M4–M8)")
+	}
+}
+
+func BenchmarkImportCSV(b *testing.B) {
+	s := newBenchmarkSite(b, 0)
+	csv := "identifier,inventory.quantity,tags[]\n"
+	for i := 0; i < 50; i++ {
+		csv += fmt.Sprintf("bolt_%d,%d,hardware\n", i, i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		previews, err := s.ParseCSVPreview(csv, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, preview := range previews {
+			if err := s.importCSVRow(preview); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// performanceBudgets are the most each benchmark may take per operation
+// before TestPerformanceBudgets fails. They're several times what a laptop
+// takes, to catch a hot path getting much slower rather than noise.
+var performanceBudgets = []struct {
+	name      string
+	benchmark func(*testing.B)
+	budget    time.Duration
+}{
+	{"page save", BenchmarkPageSave, 2 * time.Millisecond},
+	{"page render", BenchmarkPageRender, 2 * time.Millisecond},
+	{"search of 200 pages", BenchmarkSearchPages, 10 * time.Millisecond},
+	{"munging", BenchmarkMungeIdentifier, 20 * time.Microsecond},
+	{"csv import of 50 rows", BenchmarkImportCSV, 200 * time.Millisecond},
+}
+
+func TestPerformanceBudgets(t *testing.T) {
+	if testing.Short() {
+		t.Skip("benchmarks take a while")
+	}
+	for _, budget := range performanceBudgets {
+		result := testing.Benchmark(budget.benchmark)
+		if result.N == 0 {
+			t.Errorf("The %s benchmark failed", budget.name)
+			continue
+		}
+		took := time.Duration(result.NsPerOp())
+		t.Logf("%s: %v per operation", budget.name, took)
+		if took > budget.budget {
+			t.Errorf("%s took %v per operation, over its budget of %v", budget.name, took, budget.budget)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// calendarDateKeys are the frontmatter keys that put a page on the calendar.
+var calendarDateKeys = []string{"due_date", "event_date"}
+
+// CalendarEvent is a date taken from a page's frontmatter. Dates without a
+// time are all day events.
+type CalendarEvent struct {
+	Identifier string    `json:"identifier"`
+	Title      string    `json:"title"`
+	Kind       string    `json:"kind"`
+	Start      time.Time `json:"start"`
+	AllDay     bool      `json:"all_day"`
+}
+
+// calendarDate reads a TOML date or datetime, or a string in either form.
+func calendarDate(v interface{}) (time.Time, bool, bool) {
+	if t, ok := v.(time.Time); ok {
+		allDay := t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0
+		return t, allDay, true
+	}
+	text := frontmatterString(v)
+	if t, err := time.Parse(loanDateLayout, text); err == nil {
+		return t, true, true
+	}
+	if t, err := time.Parse(time.RFC3339, text); err == nil {
+		return t, false, true
+	}
+	return time.Time{}, false, false
+}
+
+// CalendarEvents lists every page's due and event dates, soonest first.
+func (s *Site) CalendarEvents() []CalendarEvent {
+	events := []CalendarEvent{}
+	s.EachFrontmatter(func(identifier string, matter map[string]interface{}) {
+		title := frontmatterString(matter["title"])
+		if title == "" {
+			title = identifier
+		}
+		for _, key := range calendarDateKeys {
+			start, allDay, ok := calendarDate(matter[key])
+			if !ok {
+				continue
+			}
+			events = append(events, CalendarEvent{
+				Identifier: identifier,
+				Title:      title,
+				Kind:       key,
+				Start:      start,
+				AllDay:     allDay,
+			})
+		}
+	})
+	sort.Slice(events, func(i, j int) bool { return events[i].Start.Before(events[j].Start) })
+	return events
+}
+
+// Upcoming lists the events from today through the given number of days.
+func (s *Site) Upcoming(now time.Time, days int) []CalendarEvent {
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	until := from.AddDate(0, 0, days+1)
+	upcoming := []CalendarEvent{}
+	for _, event := range s.CalendarEvents() {
+		if !event.Start.Before(from) && event.Start.Before(until) {
+			upcoming = append(upcoming, event)
+		}
+	}
+	return upcoming
+}
+
+// icsText escapes text for an iCalendar property value.
+func icsText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(text)
+}
+
+// icsLine writes a content line, folded at 75 octets as RFC 5545 asks.
+func icsLine(w io.Writer, line string) {
+	for len(line) > 75 {
+		cut := 75
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut-- // don't split a UTF-8 sequence
+		}
+		fmt.Fprint(w, line[:cut]+"\r\n ")
+		line = line[cut:]
+	}
+	fmt.Fprint(w, line+"\r\n")
+}
+
+// WriteICS writes the events as an iCalendar feed, linking each back to its
+// page under baseURL.
+func WriteICS(w io.Writer, events []CalendarEvent, baseURL string, now time.Time) {
+	icsLine(w, "BEGIN:VCALENDAR")
+	icsLine(w, "VERSION:2.0")
+	icsLine(w, "PRODID:-//simple_wiki//calendar//EN")
+	icsLine(w, "X-WR-CALNAME:simple_wiki")
+	for _, event := range events {
+		icsLine(w, "BEGIN:VEVENT")
+		icsLine(w, "UID:"+event.Identifier+"-"+event.Kind+"@simple_wiki")
+		icsLine(w, "DTSTAMP:"+now.UTC().Format("20060102T150405Z"))
+		if event.AllDay {
+			icsLine(w, "DTSTART;VALUE=DATE:"+event.Start.Format("20060102"))
+		} else {
+			icsLine(w, "DTSTART:"+event.Start.UTC().Format("20060102T150405Z"))
+		}
+		summary := event.Title
+		if event.Kind == "due_date" {
+			summary += " (due)"
+		}
+		icsLine(w, "SUMMARY:"+icsText(summary))
+		icsLine(w, "URL:"+baseURL+"/"+event.Identifier+"/view")
+		icsLine(w, "END:VEVENT")
+	}
+	icsLine(w, "END:VCALENDAR")
+}
+
+func (s *Site) handleCalendar(c *gin.Context) {
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Status(http.StatusOK)
+	WriteICS(c.Writer, s.CalendarEvents(), s.siteURL(c), time.Now())
+}
+
+func (s *Site) handleUpcoming(c *gin.Context) {
+	type QueryJSON struct {
+		Days int `json:"days"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	if json.Days <= 0 {
+		json.Days = 30
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "events": s.Upcoming(time.Now(), json.Days)})
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendar(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	for _, p := range []*Page{
+		newTestPage(s, "furnace", "+++\nidentifier = \"furnace\"\ntitle = \"Furnace, filter\"\ndue_date = 2022-03-20\n+++\n"),
+		newTestPage(s, "tv", "+++\nidentifier = \"tv\"\nevent_date = \"2023-01-05\"\n+++\n"),
+		newTestPage(s, "party", "+++\nidentifier = \"party\"\nevent_date = \"2022-03-12T18:00:00Z\"\n+++\n"),
+		newTestPage(s, "notes", "+++\nidentifier = \"notes\"\n+++\n"),
+	} {
+		if err := p.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events := s.CalendarEvents()
+	if len(events) != 3 || events[0].Identifier != "party" || events[2].Identifier != "tv" {
+		t.Fatalf("Expected the three dated pages soonest first, got %+v", events)
+	}
+	if events[0].AllDay || !events[1].AllDay {
+		t.Errorf("Expected only dates without times to be all day, got %+v", events)
+	}
+
+	now := time.Date(2022, 3, 10, 12, 0, 0, 0, time.UTC)
+	if upcoming := s.Upcoming(now, 30); len(upcoming) != 2 {
+		t.Errorf("Expected the party and furnace within 30 days, got %+v", upcoming)
+	}
+
+	var ics bytes.Buffer
+	WriteICS(&ics, events, "http://wiki", now)
+	feed := ics.String()
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"DTSTART;VALUE=DATE:20220320\r\n",
+		"SUMMARY:Furnace\\, filter (due)\r\n",
+		"DTSTART:20220312T180000Z\r\n",
+		"URL:http://wiki/tv/view\r\n",
+	} {
+		if !strings.Contains(feed, want) {
+			t.Errorf("Expected the feed to contain %q, got\n%s", want, feed)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChecklistItem is one `- [ ]` task list entry in a page's markdown.
+type ChecklistItem struct {
+	// ID stays the same while the entry's text does, wherever it moves on
+	// the page; see taskItemID.
+	ID      string   `json:"id"`
+	Text    string   `json:"text"`
+	Checked bool     `json:"checked"`
+	Tags    []string `json:"tags"`
+	Line    int      `json:"line"`
+}
+
+var rChecklistItem = regexp.MustCompile(`^\s*[-*+]\s+\[([ xX])\]\s+(.*)$`)
+var rHashtag = regexp.MustCompile(`(?:^|\s)#([\w-]+)`)
+var rCodeFence = regexp.MustCompile("^\\s*(```|~~~)")
+
+// taskPlaceholder stands in for a task's checkbox while the markdown is
+// rendered and sanitized; the sanitizer would drop the checkbox.
+const taskPlaceholder = "TASKf6c1d0"
+
+// rTaskPlaceholder matches the placeholders: the task's ID, 1 if checked,
+// and, for tasks shown on a page other than their own, P and the hex of the
+// page they are on.
+var rTaskPlaceholder = regexp.MustCompile(taskPlaceholder + `([0-9a-f]{8}(?:-\d+)?)([01])(?:P([0-9a-f]+))?Z`)
+
+// taskItemID is a hash of the entry's text, with -2, -3... added for the
+// second and later entries with the same text.
+func taskItemID(text string, seen map[string]int) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(text)))
+	id := hex.EncodeToString(sum[:4])
+	seen[id]++
+	if seen[id] > 1 {
+		id = fmt.Sprintf("%s-%d", id, seen[id])
+	}
+	return id
+}
+
+// eachTaskItem calls fn with each task list line of markdown, outside code
+// blocks: its index, the rChecklistItem match and its ID.
+func eachTaskItem(lines []string, fn func(i int, match []string, id string)) {
+	seen := map[string]int{}
+	fence := ""
+	for i, line := range lines {
+		if m := rCodeFence.FindStringSubmatch(line); m != nil {
+			if fence == "" {
+				fence = m[1]
+			} else if fence == m[1] {
+				fence = ""
+			}
+			continue
+		}
+		if fence != "" {
+			continue
+		}
+		if match := rChecklistItem.FindStringSubmatch(line); match != nil {
+			fn(i, match, taskItemID(match[2], seen))
+		}
+	}
+}
+
+// ParseChecklist finds the task list entries in markdown. Hashtags are pulled
+// out of each entry's text into its Tags, lowercased.
+func ParseChecklist(markdown string) []ChecklistItem {
+	items := []ChecklistItem{}
+	eachTaskItem(strings.Split(markdown, "\n"), func(i int, match []string, id string) {
+		item := ChecklistItem{
+			ID:      id,
+			Checked: match[1] != " ",
+			Tags:    []string{},
+			Line:    i,
+		}
+		for _, tag := range rHashtag.FindAllStringSubmatch(match[2], -1) {
+			item.Tags = append(item.Tags, strings.ToLower(tag[1]))
+		}
+		item.Text = strings.Join(strings.Fields(rHashtag.ReplaceAllString(match[2], "")), " ")
+		items = append(items, item)
+	})
+	return items
+}
+
+// HasTag reports whether the item was tagged with tag.
+func (i ChecklistItem) HasTag(tag string) bool {
+	return stringInSlice(strings.ToLower(tag), i.Tags)
+}
+
+// protectTaskItems swaps each task's [ ] or [x] for a placeholder carrying
+// its ID and whether it is checked.
+func protectTaskItems(markdown string) string {
+	lines := strings.Split(markdown, "\n")
+	eachTaskItem(lines, func(i int, match []string, id string) {
+		checked := "0"
+		if match[1] != " " {
+			checked = "1"
+		}
+		lines[i] = strings.Replace(lines[i], "["+match[1]+"]", taskPlaceholder+id+checked+"Z", 1)
+	})
+	return strings.Join(lines, "\n")
+}
+
+// renderTaskItems turns the placeholders into checkboxes, which toggle the
+// task through /tasks/toggle.
+func renderTaskItems(rendered []byte) []byte {
+	return rTaskPlaceholder.ReplaceAllFunc(rendered, func(placeholder []byte) []byte {
+		m := rTaskPlaceholder.FindSubmatch(placeholder)
+		checked := ""
+		if string(m[2]) == "1" {
+			checked = " checked"
+		}
+		page := ""
+		if identifier, err := hex.DecodeString(string(m[3])); err == nil && len(identifier) > 0 {
+			page = ` data-page="` + html.EscapeString(string(identifier)) + `"`
+		}
+		return []byte(`<input type="checkbox" class="task-item" data-task-id="` + string(m[1]) + `"` + page + checked + `>`)
+	})
+}
+
+// ToggleTaskItem checks or unchecks the task with the ID on the page,
+// saving the page if that changes it.
+func (s *Site) ToggleTaskItem(identifier, id string, checked bool) (ChecklistItem, error) {
+	return s.UpdateChecklistItem(identifier, id, ChecklistItemUpdate{Checked: &checked})
+}
+
+func (s *Site) handleToggleTaskItem(c *gin.Context) {
+	type QueryJSON struct {
+		Page    string `json:"page"`
+		ID      string `json:"id"`
+		Checked bool   `json:"checked"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	if pageIsLocked(s.Open(json.Page), c) {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Locked, must unlock first"})
+		return
+	}
+	item, err := s.ToggleTaskItem(json.Page, json.ID, json.Checked)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "item": item})
+}
+
+// ChecklistGroup is the items of a checklist with a tag. Items without tags
+// are grouped under "".
+type ChecklistGroup struct {
+	Tag   string          `json:"tag"`
+	Items []ChecklistItem `json:"items"`
+}
+
+// Checklist is a page's task list entries, and the same entries grouped by
+// tag; an entry with two tags is in two groups.
+type Checklist struct {
+	Page   string           `json:"page"`
+	Items  []ChecklistItem  `json:"items"`
+	Groups []ChecklistGroup `json:"groups"`
+	Done   int              `json:"done"`
+}
+
+// GroupChecklist groups items by tag, tags in order and the untagged last.
+func GroupChecklist(items []ChecklistItem) []ChecklistGroup {
+	byTag := map[string][]ChecklistItem{}
+	for _, item := range items {
+		if len(item.Tags) == 0 {
+			byTag[""] = append(byTag[""], item)
+		}
+		for _, tag := range item.Tags {
+			byTag[tag] = append(byTag[tag], item)
+		}
+	}
+	groups := []ChecklistGroup{}
+	for tag, tagged := range byTag {
+		groups = append(groups, ChecklistGroup{Tag: tag, Items: tagged})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if (groups[i].Tag == "") != (groups[j].Tag == "") {
+			return groups[j].Tag == ""
+		}
+		return groups[i].Tag < groups[j].Tag
+	})
+	return groups
+}
+
+// GetChecklist parses and groups a page's task list.
+func (s *Site) GetChecklist(identifier string) (Checklist, error) {
+	p := s.Open(identifier)
+	if p.IsNew() {
+		return Checklist{}, fmt.Errorf("no page %s", identifier)
+	}
+	checklist := Checklist{Page: strings.ToLower(identifier), Items: ParseChecklist(p.Text.GetCurrent())}
+	checklist.Groups = GroupChecklist(checklist.Items)
+	for _, item := range checklist.Items {
+		if item.Checked {
+			checklist.Done++
+		}
+	}
+	return checklist, nil
+}
+
+// ChecklistItemUpdate is what to change about a task list entry; nil fields
+// are left as they are.
+type ChecklistItemUpdate struct {
+	Checked *bool     `json:"checked"`
+	Text    *string   `json:"text"`
+	Tags    *[]string `json:"tags"`
+}
+
+// formatChecklistItem writes an entry's line after its indent and bullet.
+func formatChecklistItem(checked bool, text string, tags []string) string {
+	mark := " "
+	if checked {
+		mark = "x"
+	}
+	line := "[" + mark + "] " + strings.Join(strings.Fields(text), " ")
+	for _, tag := range tags {
+		line += " #" + strings.TrimPrefix(strings.ToLower(strings.TrimSpace(tag)), "#")
+	}
+	return line
+}
+
+// UpdateChecklistItem changes the task with the ID on the page and saves the
+// page if that changes it, returning the task as it is now. Changing its text
+// or tags changes its ID.
+func (s *Site) UpdateChecklistItem(identifier, id string, update ChecklistItemUpdate) (ChecklistItem, error) {
+	p := s.Open(identifier)
+	if p.IsNew() {
+		return ChecklistItem{}, fmt.Errorf("no page %s", identifier)
+	}
+	text := p.Text.GetCurrent()
+	lines := strings.Split(text, "\n")
+	var item *ChecklistItem
+	for _, parsed := range ParseChecklist(text) {
+		if parsed.ID == id {
+			found := parsed
+			item = &found
+			break
+		}
+	}
+	if item == nil {
+		return ChecklistItem{}, fmt.Errorf("no task %s on %s; it may have been edited", id, identifier)
+	}
+	if update.Checked != nil {
+		item.Checked = *update.Checked
+	}
+	if update.Text != nil {
+		if strings.TrimSpace(*update.Text) == "" {
+			return ChecklistItem{}, fmt.Errorf("a task needs some text")
+		}
+		item.Text = *update.Text
+	}
+	if update.Tags != nil {
+		item.Tags = *update.Tags
+	}
+
+	line := lines[item.Line]
+	box := strings.Index(line, "[")
+	if update.Text == nil && update.Tags == nil {
+		// only the box changes, so the text keeps its hashtags where they are
+		rest := line[box+3:]
+		lines[item.Line] = line[:box] + formatChecklistItem(item.Checked, "", nil)[:3] + rest
+	} else {
+		lines[item.Line] = line[:box] + formatChecklistItem(item.Checked, item.Text, item.Tags)
+	}
+	if updated := strings.Join(lines, "\n"); updated != text {
+		if err := p.Update(updated); err != nil {
+			return ChecklistItem{}, err
+		}
+		text = updated
+	}
+	for _, parsed := range ParseChecklist(text) {
+		if parsed.Line == item.Line {
+			return parsed, nil
+		}
+	}
+	return ChecklistItem{}, fmt.Errorf("no task %s on %s", id, identifier)
+}
+
+// BuildShowChecklist shows a page's task list grouped by tag, with boxes
+// that check off the entries on that page.
+func BuildShowChecklist(site *Site) func(string) string {
+	return func(identifier string) string {
+		checklist, err := site.GetChecklist(identifier)
+		if err != nil {
+			return err.Error()
+		}
+		if len(checklist.Items) == 0 {
+			return "Nothing on " + identifier + "\n"
+		}
+		page := hex.EncodeToString([]byte(checklist.Page))
+		text := ""
+		for _, group := range checklist.Groups {
+			name := "#" + group.Tag
+			if group.Tag == "" {
+				name = "Untagged"
+			}
+			text += "\n**" + name + "**\n\n"
+			for _, item := range group.Items {
+				checked := "0"
+				if item.Checked {
+					checked = "1"
+				}
+				text += "  - " + taskPlaceholder + item.ID + checked + "P" + page + "Z " + item.Text + "\n"
+			}
+		}
+		return text
+	}
+}
+
+func (s *Site) handleGetChecklist(c *gin.Context) {
+	type QueryJSON struct {
+		Page string `json:"page"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	checklist, err := s.GetChecklist(json.Page)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "checklist": checklist})
+}
+
+func (s *Site) handleUpdateChecklistItem(c *gin.Context) {
+	type QueryJSON struct {
+		Page string `json:"page"`
+		ID   string `json:"id"`
+		ChecklistItemUpdate
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	if pageIsLocked(s.Open(json.Page), c) {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Locked, must unlock first"})
+		return
+	}
+	item, err := s.UpdateChecklistItem(json.Page, json.ID, json.ChecklistItemUpdate)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "item": item})
+}
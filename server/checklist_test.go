@@ -0,0 +1,164 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseChecklist(t *testing.T) {
+	markdown := `
+# Groceries
+
+- [ ] milk #shopping #costco
+- [x] eggs #shopping
+* [ ] call the plumber
+- not a task
+`
+	items := ParseChecklist(markdown)
+	if len(items) != 3 {
+		t.Fatalf("Expected 3 items, got %v", items)
+	}
+	if items[0].Text != "milk" || items[0].Checked || !items[0].HasTag("costco") {
+		t.Errorf("Did not parse first item: %v", items[0])
+	}
+	if !items[1].Checked {
+		t.Errorf("Expected eggs to be checked: %v", items[1])
+	}
+	if len(items[2].Tags) != 0 {
+		t.Errorf("Expected no tags: %v", items[2])
+	}
+}
+
+func TestRefreshShoppingList(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "groceries", "- [ ] milk #shopping #costco\n- [x] eggs #shopping\n- [ ] bread #shopping\n")
+	newTestPage(s, "paper_towels", "+++\nidentifier = \"paper_towels\"\n[inventory]\nquantity = 1\nmin_quantity = 4\nunit = \"rolls\"\nstore = \"Costco\"\n+++\n")
+
+	if err := s.RefreshShoppingList(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	text := s.Open(shoppingListIdentifier).Text.GetCurrent()
+	costco := strings.Index(text, "## costco")
+	if costco < 0 || !strings.Contains(text[costco:], "milk") || !strings.Contains(text[costco:], "paper_towels") {
+		t.Errorf("Expected milk and paper towels under costco: %s", text)
+	}
+	if !strings.Contains(text, "## "+anyStore) || !strings.Contains(text, "bread") {
+		t.Errorf("Expected bread under %s: %s", anyStore, text)
+	}
+	if strings.Contains(text, "eggs") {
+		t.Errorf("Checked items should not be on the list: %s", text)
+	}
+
+	newTestPage(s, "groceries", "- [ ] cheese {{.Title}} #shopping\n")
+	if err := s.RefreshShoppingList(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if text := s.Open(shoppingListIdentifier).Text.GetCurrent(); !strings.Contains(text, `cheese {{"{{"}}.Title}}`) {
+		t.Errorf("Expected items to be escaped rather than run as templates: %s", text)
+	}
+
+	newTestPage(s, "groceries", "")
+	newTestPage(s, "pantry {{.Title}}", "- [ ] rice #shopping\n")
+	if err := s.RefreshShoppingList(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if text := s.Open(shoppingListIdentifier).Text.GetCurrent(); !strings.Contains(text, `pantry {{"{{"}}.title}}`) {
+		t.Errorf("Expected the pages items came from to be escaped too: %s", text)
+	}
+}
+
+func TestTaskItems(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	text := "- [ ] milk\n- [x] eggs\n- [ ] milk\n\n```\n- [ ] not a task\n```\n"
+	items := ParseChecklist(text)
+	if len(items) != 3 || items[0].ID == items[2].ID || items[2].ID != items[0].ID+"-2" {
+		t.Fatalf("Expected three items with distinct IDs, got %+v", items)
+	}
+	if moved := ParseChecklist("- [ ] bread\n" + text); moved[1].ID != items[0].ID {
+		t.Errorf("Expected IDs to stay put when other items are added, got %+v", moved)
+	}
+
+	p := newTestPage(s, "groceries", text)
+	p.Save()
+	p.Render()
+	html := string(p.RenderedPage)
+	if !strings.Contains(html, `<li><input type="checkbox" class="task-item" data-task-id="`+items[1].ID+`" checked> eggs</li>`) ||
+		strings.Count(html, `type="checkbox"`) != 3 || !strings.Contains(html, "- [ ] not a task") {
+		t.Errorf("Unexpected checkboxes in %s", html)
+	}
+
+	item, err := s.ToggleTaskItem("groceries", items[2].ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !item.Checked || item.Text != "milk" {
+		t.Errorf("Expected the second milk checked, got %+v", item)
+	}
+	if got := s.Open("groceries").Text.GetCurrent(); !strings.HasPrefix(got, "- [ ] milk\n- [x] eggs\n- [x] milk\n") {
+		t.Errorf("Expected only the second milk checked, got %s", got)
+	}
+	if _, err := s.ToggleTaskItem("groceries", "00000000", true); err == nil {
+		t.Error("Expected an unknown task to fail")
+	}
+}
+
+func TestExtendedMarkdown(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	p := newTestPage(s, "glossary", "Pancakes need flour.[^1]\n\nBatter\n: Flour, eggs and milk.\n\n[^1]: Or buckwheat.\n")
+	p.Render()
+	html := string(p.RenderedPage)
+	for _, expected := range []string{`<sup id="fnref:1"><a href="#fn:1"`, `<li id="fn:1">Or buckwheat.`, `href="#fnref:1"`, "<dt>Batter</dt>", "<dd>Flour, eggs and milk.</dd>"} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("Expected %s in %s", expected, html)
+		}
+	}
+}
+
+func TestChecklist(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "groceries", "- [ ] milk #shopping #costco\n- [x] eggs #shopping\n- [ ] call the plumber\n").Save()
+
+	checklist, err := s.GetChecklist("groceries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checklist.Items) != 3 || checklist.Done != 1 {
+		t.Fatalf("Unexpected checklist %+v", checklist)
+	}
+	var tags []string
+	for _, group := range checklist.Groups {
+		tags = append(tags, group.Tag)
+	}
+	if strings.Join(tags, ",") != "costco,shopping," || len(checklist.Groups[1].Items) != 2 {
+		t.Errorf("Unexpected groups %+v", checklist.Groups)
+	}
+	if _, err := s.GetChecklist("nothing_here"); err == nil {
+		t.Error("Expected a missing page to fail")
+	}
+
+	text, tagsUpdate := "oat milk", []string{"#Shopping"}
+	item, err := s.UpdateChecklistItem("groceries", checklist.Items[0].ID, ChecklistItemUpdate{Text: &text, Tags: &tagsUpdate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Text != "oat milk" || item.ID == checklist.Items[0].ID || !item.HasTag("shopping") || item.HasTag("costco") {
+		t.Errorf("Unexpected item %+v", item)
+	}
+	if got := s.Open("groceries").Text.GetCurrent(); !strings.HasPrefix(got, "- [ ] oat milk #shopping\n- [x] eggs #shopping\n") {
+		t.Errorf("Unexpected page %s", got)
+	}
+	empty := " "
+	if _, err := s.UpdateChecklistItem("groceries", item.ID, ChecklistItemUpdate{Text: &empty}); err == nil {
+		t.Error("Expected empty text to fail")
+	}
+
+	p := newTestPage(s, "list", `{{ ShowChecklist "groceries" }}`)
+	p.Save()
+	p.Render()
+	html := string(p.RenderedPage)
+	if !strings.Contains(html, `data-task-id="`+item.ID+`" data-page="groceries">`) || !strings.Contains(html, "Untagged") {
+		t.Errorf("Unexpected checklist in %s", html)
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// CheckCompression checks --compress-pages: gzip, or "" to write pages as
+// plain text. zstd is recognized on read but this build can't write it.
+func CheckCompression(compression string) error {
+	if compression == "" || compression == "gzip" {
+		return nil
+	}
+	return fmt.Errorf("page compression %q should be gzip, or empty for none", compression)
+}
+
+// readPageFile reads one of a page's files from the store, uncompressing it
+// if it starts with gzip's magic bytes; plain files are read as they are, so
+// a data directory can hold both.
+func (s *Site) readPageFile(identifier, extension string) ([]byte, error) {
+	key := pageKey(identifier, extension)
+	data, err := s.store().Get(key)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", key, err)
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	case bytes.HasPrefix(data, zstdMagic):
+		return nil, fmt.Errorf("%s is compressed with zstd, which this build can't read", key)
+	}
+	return data, nil
+}
+
+// writePageFile writes one of a page's files to the store, compressed as
+// the site's Compression says.
+func (s *Site) writePageFile(identifier, extension string, data []byte) error {
+	if s.Compression == "gzip" {
+		var compressed bytes.Buffer
+		w := gzip.NewWriter(&compressed)
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		data = compressed.Bytes()
+	}
+	return s.store().Put(pageKey(identifier, extension), data)
+}
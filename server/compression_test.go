@@ -0,0 +1,39 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestPageCompression(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "plain", "+++\ntitle = \"Plain\"\n+++\nwritten before compression").Save()
+
+	s.Compression = "gzip"
+	newTestPage(s, "squeezed", "+++\ntitle = \"Squeezed\"\n+++\nwritten compressed").Save()
+	for _, extension := range []string{".json", ".md"} {
+		data, _ := ioutil.ReadFile(s.pageFile("squeezed", extension))
+		if !bytes.HasPrefix(data, gzipMagic) {
+			t.Errorf("Expected the %s file compressed", extension)
+		}
+	}
+
+	if got := s.Open("squeezed").Text.GetCurrent(); got != "+++\ntitle = \"Squeezed\"\n+++\nwritten compressed" {
+		t.Errorf("Could not read a compressed page: %q", got)
+	}
+	if got := s.Open("plain").Text.GetCurrent(); got != "+++\ntitle = \"Plain\"\n+++\nwritten before compression" {
+		t.Errorf("Could not read a plain page with compression on: %q", got)
+	}
+	if matter, err := s.ReadFrontMatter("squeezed"); err != nil || matter["title"] != "Squeezed" {
+		t.Errorf("Could not read a compressed page's frontmatter: %v %v", matter, err)
+	}
+
+	ioutil.WriteFile(s.pageFile("zstd", ".md"), append(zstdMagic, 0), 0644)
+	if _, err := s.ReadFrontMatter("zstd"); err == nil {
+		t.Error("Expected a zstd page to fail to read")
+	}
+	if err := CheckCompression("brotli"); err == nil {
+		t.Error("Expected an unknown compression to fail")
+	}
+}
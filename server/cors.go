@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// corsMaxAge is how long a browser may remember an answer to a preflight.
+const corsMaxAge = 10 * time.Minute
+
+// tailnetDomain is what MagicDNS names end in, on every tailnet.
+const tailnetDomain = ".ts.net"
+
+// ParseCORSOrigin checks a --cors-origin: an origin like
+// https://dashboard.example.com, tailnet for pages served from the wiki's
+// own tailnet's names, as tailscaled gives them, or its addresses,
+// tailnet:tail1234.ts.net to give the tailnet's MagicDNS suffix instead,
+// or * for any site at all.
+func ParseCORSOrigin(spec string) (string, error) {
+	if spec == "*" || strings.ToLower(spec) == "tailnet" {
+		return strings.ToLower(spec), nil
+	}
+	if lower := strings.ToLower(spec); strings.HasPrefix(lower, "tailnet:") {
+		suffix := strings.Trim(strings.TrimPrefix(lower, "tailnet:"), ".")
+		if !strings.HasSuffix(suffix, tailnetDomain) {
+			return "", fmt.Errorf("cors-origin %q should give the tailnet's MagicDNS suffix, like tailnet:tail1234.ts.net", spec)
+		}
+		return "tailnet:" + suffix, nil
+	}
+	u, err := url.Parse(spec)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return "", fmt.Errorf("cors-origin %q should be an origin like https://dashboard.example.com, tailnet, or *", spec)
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), nil
+}
+
+// magicDNSSuffix is the MagicDNS suffix of the wiki's own tailnet, like
+// tail1234.ts.net, asked of tailscaled once; "" if it couldn't say.
+func (s *Site) magicDNSSuffix() string {
+	s.magicDNSOnce.Do(func() {
+		status, err := newTailscaleLocalAPI(s.TailscaleSocket).Status()
+		if err != nil {
+			s.Logger.Warn("Could not ask tailscale for the tailnet's name, so --cors-origin tailnet only allows tailnet addresses: %v", err)
+			return
+		}
+		s.magicDNS = strings.ToLower(strings.Trim(status.MagicDNSSuffix, "."))
+	})
+	return s.magicDNS
+}
+
+// inTailnetDomain is whether a host is a MagicDNS name under suffix.
+func inTailnetDomain(host, suffix string) bool {
+	return suffix != "" && strings.HasSuffix(host, "."+suffix)
+}
+
+// corsAllows is whether pages from an origin can call the wiki. Only the
+// wiki's own tailnet's names are allowed for tailnet, not every .ts.net
+// name, which anyone can have on a tailnet of their own.
+func (s *Site) corsAllows(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	origin = strings.ToLower(u.Scheme + "://" + u.Host)
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range s.CORSOrigins {
+		switch {
+		case allowed == "*":
+			return true
+		case allowed == "tailnet":
+			if inNetworks(net.ParseIP(host), tailnet) || inTailnetDomain(host, s.magicDNSSuffix()) {
+				return true
+			}
+		case strings.HasPrefix(allowed, "tailnet:"):
+			if inNetworks(net.ParseIP(host), tailnet) || inTailnetDomain(host, strings.TrimPrefix(allowed, "tailnet:")) {
+				return true
+			}
+		default:
+			if allowed == origin {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allowCORS lets pages from the CORSOrigins call the wiki from a browser,
+// answering their preflights itself. They don't get the visitor's session,
+// so they authenticate with an API token instead.
+func (s *Site) allowCORS(c *gin.Context) {
+	origin := c.GetHeader("Origin")
+	if len(s.CORSOrigins) == 0 || origin == "" {
+		return
+	}
+	c.Header("Vary", "Origin")
+	if !s.corsAllows(origin) {
+		return
+	}
+	c.Header("Access-Control-Allow-Origin", origin)
+	if c.Request.Method != http.MethodOptions || c.GetHeader("Access-Control-Request-Method") == "" {
+		return
+	}
+	c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	c.Header("Access-Control-Allow-Headers", "Authorization, X-API-Token, Content-Type, Accept")
+	c.Header("Access-Control-Max-Age", fmt.Sprintf("%d", int(corsMaxAge.Seconds())))
+	c.AbortWithStatus(http.StatusNoContent)
+}
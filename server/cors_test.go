@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/jcelliott/lumber"
+)
+
+func TestParseCORSOrigin(t *testing.T) {
+	for spec, expected := range map[string]string{
+		"https://Dashboard.example.com": "https://dashboard.example.com",
+		"http://localhost:3000/":        "http://localhost:3000",
+		"Tailnet":                       "tailnet",
+		"tailnet:Tail1234.ts.net.":      "tailnet:tail1234.ts.net",
+		"*":                             "*",
+	} {
+		if origin, err := ParseCORSOrigin(spec); err != nil || origin != expected {
+			t.Errorf("Expected %q to be %q, got %q %v", spec, expected, origin, err)
+		}
+	}
+	for _, spec := range []string{"dashboard.example.com", "ftp://example.com", "https://example.com/app", "tailnet:ts.net", "tailnet:example.com"} {
+		if _, err := ParseCORSOrigin(spec); err == nil {
+			t.Errorf("Expected %q to be refused", spec)
+		}
+	}
+}
+
+func TestAllowCORS(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), CORSOrigins: []string{"tailnet:tail1234.ts.net", "https://dashboard.example.com"}, SessionStore: cookie.NewStore([]byte("secret")), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	router := s.Router()
+	request := func(method, origin string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/api/routes", nil)
+		req.Header.Set("Origin", origin)
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, origin := range []string{"https://home.tail1234.ts.net", "http://100.101.102.103:8080", "https://dashboard.example.com"} {
+		w := request(http.MethodOptions, origin)
+		if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != origin || !strings.Contains(w.Header().Get("Access-Control-Allow-Headers"), "X-API-Token") {
+			t.Errorf("Expected a preflight from %s to be allowed, got %d %v", origin, w.Code, w.Header())
+		}
+	}
+	for _, origin := range []string{"https://evil.example", "https://evil.tail9999.ts.net", "https://tail1234.ts.net.evil.example"} {
+		if w := request(http.MethodOptions, origin); w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("Expected a preflight from %s not to be allowed", origin)
+		}
+	}
+	if w := request(http.MethodGet, "https://dashboard.example.com"); w.Header().Get("Access-Control-Allow-Origin") != "https://dashboard.example.com" || w.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Errorf("Expected a request from an allowed origin to say so, got %v", w.Header())
+	}
+
+	// the tailnet's name, as tailscaled would give it
+	s = &Site{PathToData: t.TempDir(), CORSOrigins: []string{"tailnet"}, SessionStore: cookie.NewStore([]byte("secret")), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	s.magicDNSOnce.Do(func() { s.magicDNS = "tail1234.ts.net" })
+	router = s.Router()
+	if w := request(http.MethodOptions, "https://home.tail1234.ts.net"); w.Code != http.StatusNoContent {
+		t.Errorf("Expected a preflight from the tailnet to be allowed, got %d", w.Code)
+	}
+	if w := request(http.MethodOptions, "https://home.tail9999.ts.net"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected a preflight from another tailnet not to be allowed")
+	}
+
+	s = &Site{PathToData: t.TempDir(), SessionStore: cookie.NewStore([]byte("secret")), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	router = s.Router()
+	if w := request(http.MethodOptions, "https://home.tail1234.ts.net"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected no origins to be allowed without --cors-origin")
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a parsed five field cron expression:
+// minute hour day-of-month month day-of-week.
+type CronSchedule struct {
+	minute, hour, dom, month, dow map[int]bool
+	// cron runs a job when either day field matches, unless one of them is `*`
+	domStar, dowStar bool
+}
+
+var cronShortcuts = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@nightly": "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// ParseCron parses a cron expression such as `30 2 * * 1-5` or `@daily`.
+func ParseCron(expression string) (*CronSchedule, error) {
+	expression = strings.TrimSpace(expression)
+	if shortcut, ok := cronShortcuts[expression]; ok {
+		expression = shortcut
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q should have 5 fields", expression)
+	}
+
+	var err error
+	c := &CronSchedule{domStar: fields[2] == "*", dowStar: fields[4] == "*"}
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	if c.dow[7] { // both 0 and 7 mean Sunday
+		c.dow[0] = true
+	}
+	return c, nil
+}
+
+// parseCronField handles `*`, `5`, `1-5`, `*/15`, `1-30/2` and comma
+// separated lists of those.
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return nil, fmt.Errorf("bad step in cron field %q", field)
+			}
+			part = part[:i]
+		}
+
+		low, high := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("bad value in cron field %q", field)
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("bad range in cron field %q", field)
+				}
+			} else if step > 1 {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return nil, fmt.Errorf("cron field %q is out of range %d-%d", field, min, max)
+		}
+		for v := low; v <= high; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+// Next returns the first time after t that the schedule matches.
+func (c *CronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Every schedule matches at least once in a little over four years (Feb 29).
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !c.month[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.hour[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.minute[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (c *CronSchedule) dayMatches(t time.Time) bool {
+	dom, dow := c.dom[t.Day()], c.dow[int(t.Weekday())]
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2022, 3, 10, 12, 34, 56, 0, time.UTC) // a Thursday
+	cases := []struct {
+		expression string
+		next       time.Time
+	}{
+		{"* * * * *", time.Date(2022, 3, 10, 12, 35, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2022, 3, 11, 3, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2022, 3, 10, 12, 45, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2022, 3, 11, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 0", time.Date(2022, 3, 13, 9, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		schedule, err := ParseCron(c.expression)
+		if err != nil {
+			t.Errorf("%q: %v", c.expression, err)
+			continue
+		}
+		if next := schedule.Next(from); !next.Equal(c.next) {
+			t.Errorf("%q: expected %v, got %v", c.expression, c.next, next)
+		}
+	}
+}
+
+func TestParseCronRejectsNonsense(t *testing.T) {
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "* * * * mon", "5-1 * * * *", "*/0 * * * *"} {
+		if _, err := ParseCron(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestSchedulerTick(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, SystemConfigurationIdentifier, "+++\n[schedules]\nshopping_list = \"0 3 * * *\"\nmystery = \"@daily\"\n+++\n")
+
+	scheduler := NewJobScheduler(s)
+	ran := make(chan struct{}, 1)
+	scheduler.Register("shopping_list", BackgroundQueue, func(*JobProgress) error {
+		ran <- struct{}{}
+		return nil
+	})
+
+	scheduler.Tick(time.Date(2022, 3, 10, 12, 0, 0, 0, time.UTC))
+	entries := scheduler.Schedule()
+	if len(entries) != 2 {
+		t.Fatalf("Expected two schedule entries, got %v", entries)
+	}
+	if entries[0].Job != "shopping_list" || !entries[0].NextRun.Equal(time.Date(2022, 3, 11, 3, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected next run: %+v", entries[0])
+	}
+	if entries[1].Error == "" {
+		t.Errorf("Expected an error for an unregistered job: %+v", entries[1])
+	}
+
+	scheduler.Tick(time.Date(2022, 3, 11, 3, 0, 0, 0, time.UTC))
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the job to run when due")
+	}
+}
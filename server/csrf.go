@@ -0,0 +1,97 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	csrfSessionKey = "csrfToken"
+	csrfHeader     = "X-CSRF-Token"
+)
+
+// sessionMaxAge is how long a session cookie lasts, in seconds.
+const sessionMaxAge = 30 * 24 * 60 * 60
+
+// isTLS is whether the client reached us over https, directly or through a
+// proxy like Tailscale Serve that says so in X-Forwarded-Proto.
+func isTLS(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+// hardenSessionCookie keeps the session cookie away from scripts and from
+// requests other sites start, and off plain http once it was set over https.
+func (s *Site) hardenSessionCookie(c *gin.Context) {
+	if s.SessionStore == nil {
+		c.Next()
+		return
+	}
+	sessions.Default(c).Options(sessions.Options{
+		Path:     s.BasePath + "/",
+		MaxAge:   sessionMaxAge,
+		HttpOnly: true,
+		Secure:   isTLS(c),
+		SameSite: http.SameSiteLaxMode,
+	})
+	c.Next()
+}
+
+// csrfToken is the session's token for changing things, made the first time
+// it's asked for. Pages hand it to their scripts, which send it back in the
+// X-CSRF-Token header.
+func csrfToken(c *gin.Context) string {
+	session := sessions.Default(c)
+	if token, ok := session.Get(csrfSessionKey).(string); ok && token != "" {
+		return token
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	token := hex.EncodeToString(b)
+	session.Set(csrfSessionKey, token)
+	session.Save()
+	return token
+}
+
+// fromBrowser is whether a request could have been made by a browser on
+// another site's behalf: browsers send the cookies they have and, for a
+// cross-site POST, an Origin. Scripts and the command line client send
+// neither, and have no session to borrow.
+func fromBrowser(c *gin.Context) bool {
+	return c.GetHeader("Cookie") != "" || c.GetHeader("Origin") != "" || c.GetHeader("Sec-Fetch-Site") != ""
+}
+
+// checkCSRF refuses requests from browsers that change things without the
+// session's CSRF token, so another site can't make a visitor's browser
+// edit the wiki.
+func (s *Site) checkCSRF(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+		return
+	}
+	if _, ok := c.Get(apiTokenKey); ok {
+		c.Next() // authenticated by authenticateAPITokens, not the session
+		return
+	}
+	if c.Request.URL.Path == "/api/inbox" || !fromBrowser(c) || s.SessionStore == nil {
+		c.Next()
+		return
+	}
+
+	// only the header: reading a form here would read a whole upload
+	presented := c.GetHeader(csrfHeader)
+	expected, _ := sessions.Default(c).Get(csrfSessionKey).(string)
+	if expected == "" || subtle.ConstantTimeCompare([]byte(presented), []byte(expected)) != 1 {
+		s.Logger.Info("Refused %s %s without a CSRF token", c.Request.Method, c.Request.URL.Path)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"success": false, "message": "Missing or stale CSRF token; reload the page and try again"})
+		return
+	}
+	c.Next()
+}
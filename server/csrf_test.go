@@ -0,0 +1,126 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/jcelliott/lumber"
+)
+
+func TestCSRF(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), SessionStore: cookie.NewStore([]byte("secret")), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	newTestPage(s, "notes", "some notes").Save()
+	router := s.Router()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/notes/view", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	router.ServeHTTP(w, req)
+	setCookies := w.Header().Values("Set-Cookie")
+	setCookie := setCookies[len(setCookies)-1]
+	if !strings.Contains(setCookie, "HttpOnly") || !strings.Contains(setCookie, "SameSite=Lax") || !strings.Contains(setCookie, "Secure") {
+		t.Errorf("Expected a hardened session cookie, got %q", setCookie)
+	}
+	m := regexp.MustCompile(`csrfToken: "([0-9a-f]+)"`).FindStringSubmatch(w.Body.String())
+	if m == nil {
+		t.Fatalf("Expected a CSRF token in the page: %s", w.Body.String())
+	}
+	sessionCookie := strings.Split(setCookie, ";")[0]
+
+	post := func(headers map[string]string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/update", strings.NewReader(`{"page": "notes", "new_text": "new notes"}`))
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := post(map[string]string{"Cookie": sessionCookie}); code != http.StatusForbidden {
+		t.Errorf("Expected a browser without the token to be refused, got %d", code)
+	}
+	if code := post(map[string]string{"Origin": "https://evil.example.com"}); code != http.StatusForbidden {
+		t.Errorf("Expected a cross-site request without a session to be refused, got %d", code)
+	}
+	if code := post(map[string]string{"Cookie": sessionCookie, "X-CSRF-Token": strings.Repeat("0", 64)}); code != http.StatusForbidden {
+		t.Errorf("Expected a wrong token to be refused, got %d", code)
+	}
+	if code := post(map[string]string{"Cookie": sessionCookie, "X-CSRF-Token": m[1]}); code != http.StatusOK {
+		t.Errorf("Expected the session's token to be accepted, got %d", code)
+	}
+	if code := post(nil); code != http.StatusOK {
+		t.Errorf("Expected a client without cookies to be let through, got %d", code)
+	}
+
+	// what a cross-site <img src=/notes/erase> would do
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/notes/erase", nil)
+	req.Header.Set("Cookie", sessionCookie)
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	router.ServeHTTP(w, req)
+	if s.Open("notes").IsNew() {
+		t.Error("Expected a cross-site GET not to erase the page")
+	}
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/erase", strings.NewReader(`{"page": "notes"}`))
+	req.Header.Set("Cookie", sessionCookie)
+	req.Header.Set("Origin", "https://evil.example.com")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden || s.Open("notes").IsNew() {
+		t.Errorf("Expected erasing without the token to be refused, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/notes/view", nil)
+	router.ServeHTTP(w, req)
+	if strings.Contains(w.Header().Get("Set-Cookie"), "Secure") {
+		t.Errorf("Expected no Secure cookie over http, got %q", w.Header().Get("Set-Cookie"))
+	}
+}
+
+func TestEditLockReleasedOnUnload(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), SessionStore: cookie.NewStore([]byte("secret")), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	newTestPage(s, "notes", "some notes").Save()
+	router := s.Router()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/notes/edit", nil)
+	router.ServeHTTP(w, req)
+	m := regexp.MustCompile(`csrfToken: "([0-9a-f]+)"`).FindStringSubmatch(w.Body.String())
+	if m == nil {
+		t.Fatalf("Expected a CSRF token in the page: %s", w.Body.String())
+	}
+	setCookies := w.Header().Values("Set-Cookie")
+	sessionCookie := strings.Split(setCookies[len(setCookies)-1], ";")[0]
+
+	// what the page's scripts send, the release being the keepalive fetch
+	// made as the page unloads
+	send := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", url, strings.NewReader(`{"page": "notes"}`))
+		req.Header.Set("Cookie", sessionCookie)
+		req.Header.Set("Origin", "http://example.com")
+		req.Header.Set("Sec-Fetch-Site", "same-origin")
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-CSRF-Token", m[1])
+		router.ServeHTTP(w, req)
+		if setCookies := w.Header().Values("Set-Cookie"); len(setCookies) > 0 {
+			sessionCookie = strings.Split(setCookies[len(setCookies)-1], ";")[0]
+		}
+		return w
+	}
+	if w := send("/edit_lock/acquire"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"success":true`) {
+		t.Fatalf("Expected the lock, got %d %s", w.Code, w.Body.String())
+	}
+	if w := send("/edit_lock/release"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"success":true`) {
+		t.Errorf("Expected the lock released, got %d %s", w.Code, w.Body.String())
+	}
+	if _, err := s.AcquireEditLock("notes", "bob", "session-b", time.Minute, time.Now()); err != nil {
+		t.Errorf("Expected the page free to edit, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CSVArraySuffix marks a column holding one element of an array; the header
+// is repeated once per element, e.g. `tags[],tags[]`.
+const CSVArraySuffix = "[]"
+
+// FrontmatterFilter matches pages by dotted frontmatter key. An empty value
+// matches any page that has the key; otherwise the value (or, for arrays, any
+// element) must be equal to it.
+type FrontmatterFilter map[string]string
+
+func (f FrontmatterFilter) matchesAll(matter map[string]interface{}) bool {
+	for key, want := range f {
+		if !frontmatterMatches(matter, key, want) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f FrontmatterFilter) matchesAny(matter map[string]interface{}) bool {
+	for key, want := range f {
+		if frontmatterMatches(matter, key, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func frontmatterMatches(matter map[string]interface{}, key, want string) bool {
+	v, ok := frontmatterPath(matter, key)
+	if !ok {
+		return false
+	}
+	if want == "" {
+		return true
+	}
+	if list, ok := v.([]interface{}); ok {
+		for _, element := range list {
+			if frontmatterText(element) == want {
+				return true
+			}
+		}
+		return false
+	}
+	return frontmatterText(v) == want
+}
+
+// ExportPagesCSV writes the given dotted frontmatter keys of every page that
+// matches all of include and none of exclude as CSV, one page per row. The
+// identifier is always the first column so the rows can be imported back.
+// Keys holding arrays get one `key[]` column per element.
+func (s *Site) ExportPagesCSV(include, exclude FrontmatterFilter, keys []string) ([]byte, error) {
+	type row struct {
+		identifier string
+		matter     map[string]interface{}
+	}
+	rows := []row{}
+	s.EachFrontmatter(func(identifier string, matter map[string]interface{}) {
+		if !include.matchesAll(matter) || exclude.matchesAny(matter) {
+			return
+		}
+		rows = append(rows, row{identifier, matter})
+	})
+	sort.Slice(rows, func(i, j int) bool { return rows[i].identifier < rows[j].identifier })
+
+	columns := []string{}
+	for _, key := range keys {
+		if key != "" && key != "identifier" {
+			columns = append(columns, key)
+		}
+	}
+
+	// how many columns each array key needs
+	widths := map[string]int{}
+	for _, r := range rows {
+		for _, key := range columns {
+			v, _ := frontmatterPath(r.matter, key)
+			if list, ok := v.([]interface{}); ok && len(list) > widths[key] {
+				widths[key] = len(list)
+			}
+		}
+	}
+
+	header := []string{"identifier"}
+	for _, key := range columns {
+		if width, isArray := widths[key]; isArray {
+			for i := 0; i < width; i++ {
+				header = append(header, key+CSVArraySuffix)
+			}
+		} else {
+			header = append(header, key)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		record := []string{r.identifier}
+		for _, key := range columns {
+			v, ok := frontmatterPath(r.matter, key)
+			if width, isArray := widths[key]; isArray {
+				list, _ := v.([]interface{})
+				for i := 0; i < width; i++ {
+					cell := ""
+					if i < len(list) {
+						cell = frontmatterText(list[i])
+					}
+					record = append(record, cell)
+				}
+			} else if ok {
+				record = append(record, frontmatterText(v))
+			} else {
+				record = append(record, "")
+			}
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func (s *Site) handleExportPagesCSV(c *gin.Context) {
+	type QueryJSON struct {
+		Include FrontmatterFilter `json:"include"`
+		Exclude FrontmatterFilter `json:"exclude"`
+		Keys    []string          `json:"keys"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	for _, key := range json.Keys {
+		if strings.HasSuffix(key, CSVArraySuffix) {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": "Give keys without " + CSVArraySuffix + "; arrays are found automatically"})
+			return
+		}
+	}
+	data, err := s.ExportPagesCSV(json.Include, json.Exclude, json.Keys)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="pages.csv"`)
+	c.Data(http.StatusOK, "text/csv", data)
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestExportPagesCSV(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "toolbox", "+++\nidentifier = \"toolbox\"\ntitle = \"Toolbox\"\n[inventory]\ncontainer = \"garage\"\nitems = [\"hammer\", \"saw\"]\n+++\n")
+	newTestPage(s, "bike", "+++\nidentifier = \"bike\"\ntitle = \"Bike, red\"\n[inventory]\ncontainer = \"garage\"\n+++\n")
+	newTestPage(s, "couch", "+++\nidentifier = \"couch\"\n[inventory]\ncontainer = \"living_room\"\n+++\n")
+	newTestPage(s, "notes", "+++\nidentifier = \"notes\"\ndraft = true\n[inventory]\ncontainer = \"garage\"\n+++\n")
+
+	data, err := s.ExportPagesCSV(
+		FrontmatterFilter{"inventory.container": "garage"},
+		FrontmatterFilter{"draft": ""},
+		[]string{"title", "inventory.items"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "identifier,title,inventory.items[],inventory.items[]\n" +
+		"bike,\"Bike, red\",,\n" +
+		"toolbox,Toolbox,hammer,saw\n"
+	if string(data) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, data)
+	}
+}
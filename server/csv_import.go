@@ -0,0 +1,363 @@
+package server
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FieldChange is one frontmatter value a CSV row would change. Old and New
+// are strings, or lists of strings for array columns; Old is nil when the
+// page doesn't have the field yet.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// CSVRowPreview is what importing one CSV row would do.
+type CSVRowPreview struct {
+	Row        int           `json:"row"`
+	Identifier string        `json:"identifier"`
+	PageExists bool          `json:"page_exists"`
+	Changes    []FieldChange `json:"changes"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// csvRow is a parsed CSV row: dotted keys to a string, or to a []string for
+// `key[]` columns.
+type csvRow struct {
+	identifier string
+	fields     map[string]interface{}
+	order      []string
+}
+
+// CSVColumnMapping says where a column of someone else's spreadsheet goes: the
+// dotted frontmatter Field (ending in `[]` for an array, or `identifier`)
+// and the Transforms applied to each cell, in order. The transforms are
+// `trim`, `lowercase`, `uppercase` and `split:<delimiter>`, which turns the
+// cell into an array.
+type CSVColumnMapping struct {
+	Column     string   `json:"column"`
+	Field      string   `json:"field"`
+	Transforms []string `json:"transforms"`
+}
+
+type csvColumn struct {
+	field      string
+	array      bool
+	transforms []func([]string) []string
+}
+
+func (c csvColumn) values(cell string) []string {
+	values := []string{cell}
+	for _, transform := range c.transforms {
+		values = transform(values)
+	}
+	kept := []string{}
+	for _, v := range values {
+		if v != "" {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+func eachCSVValue(f func(string) string) func([]string) []string {
+	return func(values []string) []string {
+		for i := range values {
+			values[i] = f(values[i])
+		}
+		return values
+	}
+}
+
+func parseCSVTransform(transform string) (func([]string) []string, error) {
+	switch {
+	case transform == "trim":
+		return eachCSVValue(strings.TrimSpace), nil
+	case transform == "lowercase":
+		return eachCSVValue(strings.ToLower), nil
+	case transform == "uppercase":
+		return eachCSVValue(strings.ToUpper), nil
+	case strings.HasPrefix(transform, "split:") && len(transform) > len("split:"):
+		delimiter := strings.TrimPrefix(transform, "split:")
+		return func(values []string) []string {
+			split := []string{}
+			for _, v := range values {
+				for _, part := range strings.Split(v, delimiter) {
+					split = append(split, strings.TrimSpace(part))
+				}
+			}
+			return split
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown transform %q", transform)
+}
+
+// csvColumns works out what each header column holds. Without a mapping the
+// header is read as ExportPagesCSV writes it, with every cell trimmed.
+// With one, columns it doesn't mention are ignored.
+func csvColumns(header []string, mapping []CSVColumnMapping) ([]csvColumn, error) {
+	columns := make([]csvColumn, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if mapping == nil {
+			columns[i] = csvColumn{
+				field:      strings.TrimSuffix(name, CSVArraySuffix),
+				array:      strings.HasSuffix(name, CSVArraySuffix),
+				transforms: []func([]string) []string{eachCSVValue(strings.TrimSpace)},
+			}
+			continue
+		}
+		for _, m := range mapping {
+			if !strings.EqualFold(strings.TrimSpace(m.Column), name) {
+				continue
+			}
+			column := csvColumn{
+				field: strings.TrimSuffix(m.Field, CSVArraySuffix),
+				array: strings.HasSuffix(m.Field, CSVArraySuffix),
+			}
+			for _, t := range m.Transforms {
+				transform, err := parseCSVTransform(t)
+				if err != nil {
+					return nil, fmt.Errorf("column %q: %v", m.Column, err)
+				}
+				column.transforms = append(column.transforms, transform)
+				if strings.HasPrefix(t, "split:") {
+					column.array = true
+				}
+			}
+			columns[i] = column
+		}
+	}
+	return columns, nil
+}
+
+// parseCSV reads CSV in the shape ExportPagesCSV writes, an identifier column,
+// dotted frontmatter keys, and repeated `key[]` columns for arrays, or in
+// any shape when given a mapping. Empty cells are left out, so they never
+// clear an existing value.
+func parseCSV(data string, mapping []CSVColumnMapping) ([]csvRow, error) {
+	records, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("CSV is empty")
+	}
+	columns, err := csvColumns(records[0], mapping)
+	if err != nil {
+		return nil, err
+	}
+	hasIdentifier := false
+	for _, column := range columns {
+		hasIdentifier = hasIdentifier || column.field == "identifier"
+	}
+	if !hasIdentifier {
+		return nil, errors.New("CSV needs an identifier column")
+	}
+
+	rows := []csvRow{}
+	for _, record := range records[1:] {
+		row := csvRow{fields: map[string]interface{}{}}
+		for i, cell := range record {
+			if i >= len(columns) || columns[i].field == "" {
+				continue
+			}
+			column := columns[i]
+			values := column.values(cell)
+			if column.field == "identifier" {
+				if len(values) > 0 {
+					row.identifier = strings.ToLower(values[0])
+				}
+				continue
+			}
+			if column.array {
+				list, seen := row.fields[column.field].([]string)
+				if !seen {
+					list = []string{}
+					row.order = append(row.order, column.field)
+				}
+				row.fields[column.field] = append(list, values...)
+			} else if len(values) > 0 {
+				if _, seen := row.fields[column.field]; !seen {
+					row.order = append(row.order, column.field)
+				}
+				row.fields[column.field] = values[0]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// ParseCSVPreview works out, field by field, what importing the CSV would
+// change. Rows for new pages list every field as a change from nothing.
+func (s *Site) ParseCSVPreview(data string, mapping []CSVColumnMapping) ([]CSVRowPreview, error) {
+	rows, err := parseCSV(data, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	previews := []CSVRowPreview{}
+	for i, row := range rows {
+		preview := CSVRowPreview{Row: i + 1, Identifier: row.identifier, Changes: []FieldChange{}}
+		if row.identifier == "" {
+			preview.Error = "no identifier"
+			previews = append(previews, preview)
+			continue
+		}
+
+		matter := map[string]interface{}{}
+		if s.pageExists(row.identifier) {
+			preview.PageExists = true
+			if existing, err := s.ReadFrontMatter(row.identifier); err == nil {
+				normalizeFrontmatter(existing)
+				matter = existing
+			}
+		}
+
+		for _, field := range row.order {
+			var old interface{}
+			if v, ok := frontmatterPath(matter, field); ok {
+				old = csvValue(v)
+			}
+			if !reflect.DeepEqual(old, row.fields[field]) {
+				preview.Changes = append(preview.Changes, FieldChange{Field: field, Old: old, New: row.fields[field]})
+			}
+		}
+		previews = append(previews, preview)
+	}
+	return previews, nil
+}
+
+// csvValue is how an existing frontmatter value would look in the CSV.
+func csvValue(v interface{}) interface{} {
+	if list, ok := v.([]interface{}); ok {
+		values := []string{}
+		for _, element := range list {
+			values = append(values, frontmatterText(element))
+		}
+		return values
+	}
+	return frontmatterText(v)
+}
+
+func (s *Site) handleParseCSVPreview(c *gin.Context) {
+	type QueryJSON struct {
+		CSV     string             `json:"csv"`
+		Mapping []CSVColumnMapping `json:"mapping"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	previews, err := s.ParseCSVPreview(json.CSV, json.Mapping)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "rows": previews})
+}
+
+// ImportCSV applies the CSV to the wiki on the user job queue, one job record
+// per row, creating pages that don't exist yet. trace is the id of the
+// request asking for it. It returns the job's id.
+func (s *Site) ImportCSV(trace, data string, mapping []CSVColumnMapping) (string, error) {
+	previews, err := s.ParseCSVPreview(data, mapping)
+	if err != nil {
+		return "", err
+	}
+	return s.jobs().EnqueueTraced(trace, UserQueue, "csv import", func(progress *JobProgress) error {
+		progress.SetTotal(len(previews))
+		for _, preview := range previews {
+			started := time.Now()
+			record := fmt.Sprintf("row %d (%s)", preview.Row, preview.Identifier)
+			if preview.Error != "" {
+				progress.Record(record, started, errors.New(preview.Error))
+				continue
+			}
+			progress.Record(record, started, s.importCSVRow(preview))
+		}
+		return nil
+	})
+}
+
+func (s *Site) importCSVRow(preview CSVRowPreview) error {
+	p := s.Open(preview.Identifier)
+	if p.IsNew() {
+		if err := s.checkIdentifierCollision(preview.Identifier); err != nil {
+			return err
+		}
+		text, err := JoinFrontmatter(map[string]interface{}{"identifier": preview.Identifier}, "\n# {{or .Title .Identifier}}\n", false)
+		if err != nil {
+			return err
+		}
+		p.Identifier = preview.Identifier
+		if err := p.Update(text); err != nil {
+			return err
+		}
+	}
+	return p.UpdateFrontmatter(func(matter map[string]interface{}) error {
+		for _, change := range preview.Changes {
+			old, _ := frontmatterPath(matter, change.Field)
+			setFrontmatterPath(matter, change.Field, csvFrontmatterValue(change.New, old))
+		}
+		return nil
+	})
+}
+
+// csvFrontmatterValue turns an imported cell back into frontmatter, keeping
+// numbers and booleans as such when that is what the field held before.
+func csvFrontmatterValue(v interface{}, old interface{}) interface{} {
+	if list, ok := v.([]string); ok {
+		values := []interface{}{}
+		for _, element := range list {
+			values = append(values, element)
+		}
+		return values
+	}
+	text, _ := v.(string)
+	if _, ok := frontmatterNumber(old); ok {
+		if n, err := strconv.ParseFloat(text, 64); err == nil {
+			return frontmatterNumberValue(n)
+		}
+	}
+	if _, ok := old.(bool); ok {
+		if b, err := strconv.ParseBool(text); err == nil {
+			return b
+		}
+	}
+	return text
+}
+
+func (s *Site) handleImportCSV(c *gin.Context) {
+	type QueryJSON struct {
+		CSV     string             `json:"csv"`
+		Mapping []CSVColumnMapping `json:"mapping"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	id, err := s.ImportCSV(requestTrace(c), json.CSV, json.Mapping)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Importing", "job_id": id})
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCSVPreviewDiffsExistingPages(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "toolbox", "+++\nidentifier = \"toolbox\"\ntitle = \"Toolbox\"\n[inventory]\ncontainer = \"garage\"\nitems = [\"hammer\", \"saw\"]\n+++\n")
+
+	csv := "identifier,title,inventory.container,inventory.items[],inventory.items[]\n" +
+		"toolbox,Toolbox,shed,hammer,\n" +
+		"ladder,Ladder,,,\n" +
+		",Nobody,,,\n"
+
+	previews, err := s.ParseCSVPreview(csv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(previews) != 3 {
+		t.Fatalf("Expected 3 rows, got %v", previews)
+	}
+
+	toolbox := previews[0]
+	if !toolbox.PageExists {
+		t.Error("Expected toolbox to exist")
+	}
+	expected := []FieldChange{
+		{Field: "inventory.container", Old: "garage", New: "shed"},
+		{Field: "inventory.items", Old: []string{"hammer", "saw"}, New: []string{"hammer"}},
+	}
+	if !reflect.DeepEqual(toolbox.Changes, expected) {
+		t.Errorf("Expected %v, got %v", expected, toolbox.Changes)
+	}
+
+	ladder := previews[1]
+	if ladder.PageExists || len(ladder.Changes) != 2 || ladder.Changes[0].Old != nil {
+		t.Errorf("Expected a new page with title and an empty item list, got %+v", ladder)
+	}
+
+	if previews[2].Error == "" {
+		t.Error("Expected an error for a row without an identifier")
+	}
+}
+
+func TestParseCSVPreviewNeedsIdentifier(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	if _, err := s.ParseCSVPreview("title\nFoo\n", nil); err == nil {
+		t.Error("Expected an error without an identifier column")
+	}
+}
+
+func TestParseCSVPreviewWithMapping(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	csv := "Item Name,Where,Labels,Notes\n" +
+		"Cordless Drill , GARAGE,power; tools,ignored\n"
+	mapping := []CSVColumnMapping{
+		{Column: "item name", Field: "identifier", Transforms: []string{"trim", "lowercase"}},
+		{Column: "Where", Field: "inventory.container", Transforms: []string{"trim", "lowercase"}},
+		{Column: "Labels", Field: "tags", Transforms: []string{"split:;"}},
+	}
+
+	previews, err := s.ParseCSVPreview(csv, mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(previews) != 1 || previews[0].Identifier != "cordless drill" {
+		t.Fatalf("Unexpected previews: %+v", previews)
+	}
+	expected := []FieldChange{
+		{Field: "inventory.container", Old: nil, New: "garage"},
+		{Field: "tags", Old: nil, New: []string{"power", "tools"}},
+	}
+	if !reflect.DeepEqual(previews[0].Changes, expected) {
+		t.Errorf("Expected %v, got %v", expected, previews[0].Changes)
+	}
+
+	if _, err := s.ParseCSVPreview(csv, []CSVColumnMapping{{Column: "Where", Field: "identifier", Transforms: []string{"shout"}}}); err == nil {
+		t.Error("Expected an unknown transform to be rejected")
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "milk", "+++\nidentifier = \"milk\"\n[inventory]\nquantity = 1\n+++\n\n# Milk\n")
+
+	id, err := s.ImportCSV("req-42", "identifier,inventory.quantity,tags[]\nmilk,3,dairy\neggs,12,\n,5,\n", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var details *JobDetails
+	for i := 0; i < 100; i++ {
+		if details, _ = s.jobs().Details(id); details.State == JobSucceeded {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if details.Processed != 3 || details.Failures != 1 {
+		t.Errorf("Expected 3 rows with one failure, got %+v", details)
+	}
+	if details.Trace != "req-42" {
+		t.Errorf("Expected the job to keep the request's trace, got %q", details.Trace)
+	}
+
+	matter, _ := s.ReadFrontMatter("milk")
+	inventory := matter["inventory"].(map[string]interface{})
+	if quantity, _ := frontmatterNumber(inventory["quantity"]); quantity != 3 {
+		t.Errorf("Expected quantity to be imported as a number, got %#v", inventory["quantity"])
+	}
+	if !strings.Contains(s.Open("milk").Text.GetCurrent(), "# Milk") {
+		t.Error("Import should keep the page body")
+	}
+	if !s.pageExists("eggs") {
+		t.Error("Expected eggs to be created")
+	}
+}
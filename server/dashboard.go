@@ -0,0 +1,196 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+const dashboardIdentifier = "dashboard"
+
+// dashboardText is the landing page made for a wiki that hasn't one. It is
+// only written once, so it can be edited freely afterwards.
+const dashboardText = `+++
+identifier = "dashboard"
+title = "Dashboard"
++++
+
+# Dashboard
+
+## Recently changed
+
+{{ ShowRecentChanges 10 }}
+
+## Most visited
+
+{{ ShowPopularPages 5 }}
+
+## Open checklists
+
+{{ ShowOpenChecklists }}
+
+## Inventory
+
+{{ ShowInventoryRoots }}
+
+## Jobs
+
+{{ ShowJobStatus }}
+
+<!-- ShowPinnedPages, given someone's login, lists the pages they pinned. -->
+`
+
+// OpenChecklist is a page with unchecked checklist items.
+type OpenChecklist struct {
+	Identifier string `json:"identifier"`
+	Open       int    `json:"open"`
+	Total      int    `json:"total"`
+}
+
+// EnsureDashboard writes the dashboard page if there isn't one yet, so
+// --default-page dashboard lands somewhere useful out of the box.
+func (s *Site) EnsureDashboard() error {
+	if s.hasPageFile(dashboardIdentifier, ".json") {
+		return nil
+	}
+	return s.Open(dashboardIdentifier).Update(dashboardText)
+}
+
+// OpenChecklists lists the pages with checklist items left to do, the most
+// left first.
+func (s *Site) OpenChecklists() []OpenChecklist {
+	checklists := []OpenChecklist{}
+	for _, identifier := range s.PageIdentifiers() {
+		identifier = strings.ToLower(identifier)
+		if _, archived := s.ArchivedAt(identifier); archived {
+			continue
+		}
+		items := ParseChecklist(StripFrontmatter(s.Open(identifier).Text.GetCurrent()))
+		checklist := OpenChecklist{Identifier: identifier, Total: len(items)}
+		for _, item := range items {
+			if !item.Checked {
+				checklist.Open++
+			}
+		}
+		if checklist.Open > 0 {
+			checklists = append(checklists, checklist)
+		}
+	}
+	sort.Slice(checklists, func(i, j int) bool {
+		if checklists[i].Open != checklists[j].Open {
+			return checklists[i].Open > checklists[j].Open
+		}
+		return checklists[i].Identifier < checklists[j].Identifier
+	})
+	return checklists
+}
+
+// InventoryRoots summarizes the containers that aren't in another
+// container, where the inventory tree starts.
+func (s *Site) InventoryRoots() []ContainerSummary {
+	roots := []ContainerSummary{}
+	s.EachFrontmatter(func(identifier string, matter map[string]interface{}) {
+		inventory, ok := frontmatterTable(matter, "inventory", false)
+		if !ok || frontmatterString(inventory["container"]) != "" {
+			return
+		}
+		if _, isContainer := inventory["items"]; !isContainer {
+			return
+		}
+		if summary, err := s.ContainerSummary(context.Background(), identifier); err == nil {
+			roots = append(roots, *summary)
+		}
+	})
+	sort.Slice(roots, func(i, j int) bool { return roots[i].Identifier < roots[j].Identifier })
+	return roots
+}
+
+// executeDashboardTemplate fills in one of the dashboard's blocks.
+func executeDashboardTemplate(site *Site, tmplString string, data interface{}) string {
+	funcs := template.FuncMap{
+		"LinkTo": BuildLinkTo(site),
+	}
+	tmpl, err := template.New("content").Funcs(funcs).Parse(tmplString)
+	if err != nil {
+		return err.Error()
+	}
+	buf := &bytes.Buffer{}
+	err = tmpl.Execute(buf, data)
+	if err != nil {
+		return err.Error()
+	}
+	return buf.String()
+}
+
+// BuildShowRecentChanges lists the n most recently changed pages, leaving
+// out the users' own pages.
+func BuildShowRecentChanges(site *Site) func(int) string {
+	return func(n int) string {
+		pages, _, _ := site.ListPages(PageListOptions{Sort: "-modified"})
+		recent := []PageListing{}
+		for _, page := range pages {
+			if len(recent) == n {
+				break
+			}
+			if !strings.HasPrefix(page.Identifier, usersNamespace+NamespaceSeparator) {
+				recent = append(recent, page)
+			}
+		}
+		return executeDashboardTemplate(site, `{{range .}}
+  - {{LinkTo .Identifier}}, {{.LastModified.Format "Jan 2 15:04"}}
+{{else}}
+	Nothing has been written yet
+{{end}}
+`, recent)
+	}
+}
+
+// BuildShowPinnedPages lists the pages someone pinned. Pages are rendered
+// the same for everyone, so whose pins is written into the template.
+func BuildShowPinnedPages(site *Site) func(string) string {
+	return func(identity string) string {
+		return executeDashboardTemplate(site, `{{range .}}
+  - {{LinkTo .Identifier}}
+{{else}}
+	Nothing is pinned
+{{end}}
+`, site.ListPinnedPages(strings.ToLower(identity)))
+	}
+}
+
+// BuildShowOpenChecklists lists the pages with checklist items left to do.
+func BuildShowOpenChecklists(site *Site) func() string {
+	return func() string {
+		return executeDashboardTemplate(site, `{{range .}}
+  - {{LinkTo .Identifier}}: {{.Open}} of {{.Total}} left
+{{else}}
+	Every checklist is done
+{{end}}
+`, site.OpenChecklists())
+	}
+}
+
+// BuildShowInventoryRoots lists the outermost inventory containers.
+func BuildShowInventoryRoots(site *Site) func() string {
+	return func() string {
+		return executeDashboardTemplate(site, `{{range .}}
+  - {{LinkTo .Identifier}}: {{.DescendantCount}} items{{if .LocationHint}} ({{.LocationHint}}){{end}}
+{{else}}
+	Nothing is in the inventory
+{{end}}
+`, site.InventoryRoots())
+	}
+}
+
+// BuildShowJobStatus tabulates the job queues.
+func BuildShowJobStatus(site *Site) func() string {
+	return func() string {
+		return executeDashboardTemplate(site, `
+| Queue | Pending | Running | Completed | Failed |
+|---|---|---|---|---|
+{{range .}}| {{.Name}} | {{.Pending}} | {{.Running}} | {{.Completed}} | {{.Failed}} |
+{{end}}`, site.jobs().Status())
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDashboard(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	for _, p := range []*Page{
+		newTestPage(s, "garage", "+++\nidentifier = \"garage\"\n\n[inventory]\nitems = [\"toolbox\"]\nlocation_hint = \"behind the house\"\n+++\n"),
+		newTestPage(s, "toolbox", "+++\nidentifier = \"toolbox\"\n\n[inventory]\ncontainer = \"garage\"\nitems = [\"drill\", \"hammer\"]\n+++\n"),
+		newTestPage(s, "groceries", "+++\nidentifier = \"groceries\"\n+++\n- [ ] milk\n- [x] eggs\n- [ ] bread\n"),
+		newTestPage(s, "chores", "- [ ] sweep\n- [x] dishes\n"),
+		newTestPage(s, "done", "- [x] everything\n"),
+	} {
+		if err := p.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.PinPage("alice@example.com", "groceries", false); err != nil {
+		t.Fatal(err)
+	}
+
+	checklists := s.OpenChecklists()
+	if len(checklists) != 2 || checklists[0] != (OpenChecklist{"groceries", 2, 3}) || checklists[1] != (OpenChecklist{"chores", 1, 2}) {
+		t.Errorf("got %+v", checklists)
+	}
+	roots := s.InventoryRoots()
+	if len(roots) != 1 || roots[0].Identifier != "garage" || roots[0].DescendantCount != 3 {
+		t.Errorf("got %+v", roots)
+	}
+
+	if err := s.EnsureDashboard(); err != nil {
+		t.Fatal(err)
+	}
+	dashboard := s.Open(dashboardIdentifier)
+	dashboard.Render()
+	html := string(dashboard.RenderedPage)
+	for _, want := range []string{"2 of 3 left", "garage</a>: 3 items (behind the house)", "<td>background</td>"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected %q in %s", want, html)
+		}
+	}
+	if strings.Contains(html, "users/") {
+		t.Errorf("expected the users' pages to be left out of recent changes: %s", html)
+	}
+	if pinned := BuildShowPinnedPages(s)("Alice@example.com"); !strings.Contains(pinned, "[groceries](/groceries)") {
+		t.Errorf("got %s", pinned)
+	}
+
+	dashboard.Update("# My own dashboard")
+	if err := s.EnsureDashboard(); err != nil {
+		t.Fatal(err)
+	}
+	if text := s.Open(dashboardIdentifier).Text.GetCurrent(); text != "# My own dashboard" {
+		t.Errorf("expected an edited dashboard to be left alone, got %s", text)
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const deadLetterReportIdentifier = "dead_letter_jobs"
+
+// DeadLetters lists the jobs that failed every attempt, oldest first.
+func (c *JobQueueCoordinator) DeadLetters() []JobDetails {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dead := []JobDetails{}
+	for _, id := range c.deadLetters {
+		dead = append(dead, *c.jobs[id].details())
+	}
+	return dead
+}
+
+// writeDeadLetterReport rewrites the page listing the dead-lettered jobs.
+// Their errors can quote pages, so they're escaped rather than run as
+// templates there.
+func (s *Site) writeDeadLetterReport() error {
+	dead := s.jobs().DeadLetters()
+
+	text := "+++\nidentifier = \"" + deadLetterReportIdentifier + "\"\ntitle = \"Dead Letter Jobs\"\n+++\n\n# Dead Letter Jobs\n\n"
+	text += "_These jobs failed every time they were tried. Retry one by POSTing its `job_id` to `/jobs/retry`._\n"
+	if len(dead) == 0 {
+		text += "\nNone.\n"
+	}
+	for _, job := range dead {
+		text += fmt.Sprintf("\n## Job %s: %s\n\n", job.ID, escapeTemplates(job.Name))
+		text += fmt.Sprintf("  - Queue: %s\n", job.Queue)
+		text += fmt.Sprintf("  - Attempts: %d\n", job.Attempts)
+		text += fmt.Sprintf("  - Last failed: %s\n", job.FinishedAt.Format(time.RFC1123))
+		text += fmt.Sprintf("  - Error: `%s`\n", escapeTemplates(job.Error))
+		for _, record := range job.Records {
+			if record.Error != "" {
+				text += fmt.Sprintf("  - %s: `%s`\n", escapeTemplates(record.Record), escapeTemplates(record.Error))
+			}
+		}
+	}
+
+	return s.Open(deadLetterReportIdentifier).Update(text)
+}
+
+func (s *Site) handleRetryJob(c *gin.Context) {
+	type QueryJSON struct {
+		JobID string `json:"job_id"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	if err := s.jobs().Retry(json.JobID); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Queued job " + json.JobID + " again"})
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// diagramsDir holds the rendered diagrams, named by the hash of their kind
+// and source, so each is only rendered once.
+const diagramsDir = "diagrams"
+
+// rDiagramBlock finds fenced ```mermaid and ```plantuml blocks.
+var rDiagramBlock = regexp.MustCompile("(?ms)^```(mermaid|plantuml)[ \\t]*\\r?\\n(.*?)^```[ \\t]*$")
+
+var rDiagramFile = regexp.MustCompile(`^[0-9a-f]{64}\.svg$`)
+
+// DiagramRenderer turns a diagram's source into SVG. kind is mermaid or
+// plantuml.
+type DiagramRenderer interface {
+	RenderSVG(kind, source string) ([]byte, error)
+}
+
+// krokiDiagrams posts diagrams to a Kroki server.
+type krokiDiagrams struct {
+	url    string
+	client *http.Client
+}
+
+func (k krokiDiagrams) RenderSVG(kind, source string) ([]byte, error) {
+	resp, err := k.client.Post(k.url+"/"+kind+"/svg", "text/plain", strings.NewReader(source))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("diagram server answered %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// localDiagrams runs mmdc (the mermaid CLI) and plantuml, which have to be
+// on the PATH.
+type localDiagrams struct{}
+
+func (localDiagrams) RenderSVG(kind, source string) ([]byte, error) {
+	var cmd *exec.Cmd
+	switch kind {
+	case "plantuml":
+		cmd = exec.Command("plantuml", "-tsvg", "-pipe")
+	case "mermaid":
+		// mmdc only writes SVG to a file
+		dir, err := ioutil.TempDir("", "diagram")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		out := filepath.Join(dir, "diagram.svg")
+		cmd = exec.Command("mmdc", "--input", "-", "--output", out)
+		cmd.Stdin = strings.NewReader(source)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("mmdc: %v %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return ioutil.ReadFile(out)
+	default:
+		return nil, fmt.Errorf("can't render %s diagrams", kind)
+	}
+	cmd.Stdin = strings.NewReader(source)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v %s", kind, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// NewDiagramRenderer makes the renderer named by --diagrams: local, for the
+// mmdc and plantuml commands, kroki, for kroki.io, or the http URL of a
+// Kroki server.
+func NewDiagramRenderer(spec string) (DiagramRenderer, error) {
+	switch spec {
+	case "local":
+		return localDiagrams{}, nil
+	case "kroki":
+		spec = "https://kroki.io"
+	}
+	u, err := url.Parse(spec)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("diagrams %q should be local, kroki, or the http URL of a Kroki server", spec)
+	}
+	return krokiDiagrams{url: strings.TrimSuffix(spec, "/"), client: &http.Client{Timeout: 20 * time.Second}}, nil
+}
+
+// diagrams returns the site's diagram renderer, or nil when there is none.
+func (s *Site) diagrams() DiagramRenderer {
+	s.diagramsOnce.Do(func() {
+		if s.Diagrams != nil || s.DiagramProvider == "" {
+			return
+		}
+		renderer, err := NewDiagramRenderer(s.DiagramProvider)
+		if err != nil {
+			if s.Logger != nil {
+				s.Logger.Error("Can't render diagrams: %v", err)
+			}
+			return
+		}
+		s.Diagrams = renderer
+	})
+	return s.Diagrams
+}
+
+func diagramFile(kind, source string) string {
+	sum := sha256.Sum256([]byte(kind + "\n" + source))
+	return hex.EncodeToString(sum[:]) + ".svg"
+}
+
+// renderDiagram returns the name of the diagram's SVG, rendering it unless
+// it already has been.
+func (s *Site) renderDiagram(renderer DiagramRenderer, kind, source string) (string, error) {
+	name := diagramFile(kind, source)
+	target := path.Join(s.PathToData, diagramsDir, name)
+	if exists(target) {
+		return name, nil
+	}
+	svg, err := renderer.RenderSVG(kind, source)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(path.Join(s.PathToData, diagramsDir), 0755); err != nil {
+		return "", err
+	}
+	// write then rename, so a half written diagram is never served
+	if err := ioutil.WriteFile(target+".tmp", svg, 0644); err != nil {
+		return "", err
+	}
+	return name, os.Rename(target+".tmp", target)
+}
+
+// RenderDiagrams swaps the fenced mermaid and plantuml blocks in markdown
+// for images of them. Blocks that can't be rendered are left as code, and
+// everything is left alone without --diagrams.
+func (s *Site) RenderDiagrams(markdown string) string {
+	renderer := s.diagrams()
+	if renderer == nil {
+		return markdown
+	}
+	return rDiagramBlock.ReplaceAllStringFunc(markdown, func(block string) string {
+		parts := rDiagramBlock.FindStringSubmatch(block)
+		name, err := s.renderDiagram(renderer, parts[1], parts[2])
+		if err != nil {
+			if s.Logger != nil {
+				s.Logger.Error("Rendering a %s diagram: %v", parts[1], err)
+			}
+			return block
+		}
+		return "![" + parts[1] + " diagram](/" + diagramsDir + "/" + name + ")"
+	})
+}
+
+// handleDiagram serves a rendered diagram. Rendered SVG can carry scripts,
+// so it is served unable to run any.
+func (s *Site) handleDiagram(c *gin.Context, name string) {
+	if !rDiagramFile.MatchString(name) {
+		c.String(http.StatusNotFound, "No such diagram")
+		return
+	}
+	data, err := ioutil.ReadFile(path.Join(s.PathToData, diagramsDir, name))
+	if err != nil {
+		c.String(http.StatusNotFound, "No such diagram")
+		return
+	}
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src data:")
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Data(http.StatusOK, "image/svg+xml", data)
+}
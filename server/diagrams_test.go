@@ -0,0 +1,88 @@
+package server
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/jcelliott/lumber"
+)
+
+type fakeDiagrams struct {
+	rendered []string
+	err      error
+}
+
+func (f *fakeDiagrams) RenderSVG(kind, source string) ([]byte, error) {
+	f.rendered = append(f.rendered, kind+":"+source)
+	return []byte("<svg>" + kind + "</svg>"), f.err
+}
+
+func TestRenderDiagrams(t *testing.T) {
+	renderer := &fakeDiagrams{}
+	s := &Site{
+		PathToData:   t.TempDir(),
+		Diagrams:     renderer,
+		SessionStore: cookie.NewStore([]byte("secret")),
+		Logger:       lumber.NewConsoleLogger(lumber.WARN),
+	}
+	page := "# Flow\n\n```mermaid\ngraph TD\n  A-->B\n```\n\n```go\nfmt.Println()\n```\n"
+	p := newTestPage(s, "flow", page)
+	p.Save()
+	p.Render()
+	name := diagramFile("mermaid", "graph TD\n  A-->B\n")
+	if !strings.Contains(string(p.RenderedPage), `src="/diagrams/`+name+`"`) || !strings.Contains(string(p.RenderedPage), "fmt.Println()") {
+		t.Errorf("Expected the diagram as an image and other code left alone, got %s", p.RenderedPage)
+	}
+	if strings.Contains(p.Text.GetCurrent(), "/diagrams/") {
+		t.Errorf("Rendering diagrams should not change the page's text, got %s", p.Text.GetCurrent())
+	}
+	p.Render()
+	if len(renderer.rendered) != 1 {
+		t.Errorf("Expected the diagram rendered once and then cached, got %v", renderer.rendered)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/diagrams/"+name, nil)
+	s.Router().ServeHTTP(w, req)
+	if w.Body.String() != "<svg>mermaid</svg>" || w.Header().Get("Content-Type") != "image/svg+xml" || w.Header().Get("Content-Security-Policy") == "" {
+		t.Errorf("Unexpected diagram: %d %v %s", w.Code, w.Header(), w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/diagrams/..%2Fflow.svg", nil)
+	s.Router().ServeHTTP(w, req)
+	if strings.Contains(w.Body.String(), "<svg>") {
+		t.Error("Should only serve diagrams")
+	}
+
+	renderer.err = errors.New("syntax error")
+	if text := "```plantuml\nBob -> Alice\n```\n"; s.RenderDiagrams(text) != text {
+		t.Errorf("Expected a diagram that fails to render to be left as code")
+	}
+	if text := "```mermaid\ngraph TD\n```\n"; (&Site{}).RenderDiagrams(text) != text {
+		t.Errorf("Expected diagrams left as code without a renderer")
+	}
+}
+
+func TestKrokiDiagrams(t *testing.T) {
+	kroki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		w.Write([]byte("<svg>" + req.URL.Path + " " + string(body) + "</svg>"))
+	}))
+	defer kroki.Close()
+	renderer, err := NewDiagramRenderer(kroki.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg, err := renderer.RenderSVG("plantuml", "Bob -> Alice")
+	if err != nil || string(svg) != "<svg>/plantuml/svg Bob -> Alice</svg>" {
+		t.Errorf("Unexpected SVG %s %v", svg, err)
+	}
+	if _, err := NewDiagramRenderer("graphviz"); err == nil {
+		t.Error("Expected an unknown renderer to be refused")
+	}
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+)
+
+const megabyte = 1024 * 1024
+
+var errDiskQuotaExceeded = errors.New("the wiki has used up its disk quota")
+
+// diskWarnings says which of the configured limits the data directory is over.
+func (s *Site) diskWarnings(usage DiskUsage) []string {
+	warnings := []string{}
+	if s.DiskQuotaMB > 0 && usage.Total >= int64(s.DiskQuotaMB)*megabyte {
+		warnings = append(warnings, fmt.Sprintf("Disk quota reached: %s of %d MB used; uploads are refused", formatMB(usage.Total), s.DiskQuotaMB))
+	} else if s.DiskWarningMB > 0 && usage.Total >= int64(s.DiskWarningMB)*megabyte {
+		warnings = append(warnings, fmt.Sprintf("Disk usage is over the warning level: %s of %d MB used", formatMB(usage.Total), s.DiskWarningMB))
+	}
+	return warnings
+}
+
+// checkDiskQuota refuses to add bytes that would take the data directory over
+// its quota.
+func (s *Site) checkDiskQuota(adding int64) error {
+	if s.DiskQuotaMB == 0 {
+		return nil
+	}
+	usage, err := s.DiskUsage()
+	if err != nil {
+		return err
+	}
+	if usage.Total+adding > int64(s.DiskQuotaMB)*megabyte {
+		return errDiskQuotaExceeded
+	}
+	if warnings := s.diskWarnings(usage); len(warnings) > 0 && s.Logger != nil {
+		s.Logger.Warn(warnings[0])
+	}
+	return nil
+}
+
+func formatMB(bytes int64) string {
+	return fmt.Sprintf("%.1f MB", float64(bytes)/megabyte)
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestDiskQuota(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), DiskWarningMB: 1, DiskQuotaMB: 2}
+	ioutil.WriteFile(path.Join(s.PathToData, "sha256-a.upload"), make([]byte, megabyte+1), 0644)
+
+	status, err := s.SystemStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Warnings) != 1 || !strings.Contains(status.Warnings[0], "warning level") {
+		t.Errorf("Expected a warning, got %v", status.Warnings)
+	}
+	if _, err := s.saveUpload("manual.pdf", make([]byte, 100)); err != nil {
+		t.Errorf("A small upload should fit: %v", err)
+	}
+	if _, err := s.saveUpload("video.mp4", make([]byte, megabyte)); err != errDiskQuotaExceeded {
+		t.Errorf("Expected the quota to refuse the upload, got %v", err)
+	}
+
+	s.DiskQuotaMB = 1
+	if status, _ := s.SystemStatus(); len(status.Warnings) != 1 || !strings.Contains(status.Warnings[0], "quota") {
+		t.Errorf("Expected the quota warning, got %v", status.Warnings)
+	}
+}
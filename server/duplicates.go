@@ -0,0 +1,146 @@
+package server
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+const mergeCandidatesReportIdentifier = "merge_candidates"
+
+// defaultDuplicateThreshold is how much of two pages' text must be the same
+// for them to be reported as duplicates.
+const defaultDuplicateThreshold = 0.8
+
+// shingleSize is how many words each shingle has.
+const shingleSize = 3
+
+// minShingles keeps pages with almost no text, which all look alike, out of
+// the comparison.
+const minShingles = 3
+
+// DuplicatePages are two pages with much the same text.
+type DuplicatePages struct {
+	Page       string  `json:"page"`
+	Duplicate  string  `json:"duplicate"`
+	Similarity float64 `json:"similarity"`
+}
+
+// shingles hashes every run of shingleSize words in the text.
+func shingles(text string) map[uint64]bool {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	set := map[uint64]bool{}
+	for i := 0; i+shingleSize <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+shingleSize], " ")))
+		set[h.Sum64()] = true
+	}
+	return set
+}
+
+// FindDuplicatePages compares the shingles of every pair of pages that
+// aren't archived, reporting those whose Jaccard similarity is at least
+// threshold, most similar first. There are no embeddings to compare, so
+// only pages that share their wording are found.
+func (s *Site) FindDuplicatePages(threshold float64) []DuplicatePages {
+	if threshold <= 0 || threshold > 1 {
+		threshold = defaultDuplicateThreshold
+	}
+	documents, _ := s.searchDocuments()
+	type shingled struct {
+		identifier string
+		set        map[uint64]bool
+	}
+	pages := []shingled{}
+	for _, doc := range documents {
+		set := shingles(doc.result.Title + "\n" + doc.result.body)
+		if len(set) >= minShingles {
+			pages = append(pages, shingled{doc.result.Identifier, set})
+		}
+	}
+	sort.Slice(pages, func(i, j int) bool { return len(pages[i].set) < len(pages[j].set) })
+
+	duplicates := []DuplicatePages{}
+	for i, a := range pages {
+		for _, b := range pages[i+1:] {
+			// The similarity can be no more than the smaller set over the
+			// bigger, and the sets only get bigger from here.
+			if float64(len(a.set))/float64(len(b.set)) < threshold {
+				break
+			}
+			shared := 0
+			for shingle := range a.set {
+				if b.set[shingle] {
+					shared++
+				}
+			}
+			similarity := float64(shared) / float64(len(a.set)+len(b.set)-shared)
+			if similarity >= threshold {
+				first, second := a.identifier, b.identifier
+				if second < first {
+					first, second = second, first
+				}
+				duplicates = append(duplicates, DuplicatePages{Page: first, Duplicate: second, Similarity: similarity})
+			}
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		if duplicates[i].Similarity != duplicates[j].Similarity {
+			return duplicates[i].Similarity > duplicates[j].Similarity
+		}
+		return duplicates[i].Page < duplicates[j].Page
+	})
+	return duplicates
+}
+
+// writeMergeCandidatesReport rewrites the page listing duplicate pages.
+func (s *Site) writeMergeCandidatesReport(duplicates []DuplicatePages) error {
+	text := "+++\nidentifier = \"" + mergeCandidatesReportIdentifier + "\"\ntitle = \"Merge Candidates\"\n+++\n\n# Merge Candidates\n\n"
+	text += "_These pages say much the same thing, perhaps the same item created twice under different names. Merge them, and rename the one left over to redirect._\n"
+	if len(duplicates) == 0 {
+		text += "\nNone.\n"
+	} else {
+		text += "\n"
+	}
+	for _, duplicate := range duplicates {
+		text += fmt.Sprintf("  - [[%s]] and [[%s]] (%.0f%% the same)\n", duplicate.Page, duplicate.Duplicate, duplicate.Similarity*100)
+	}
+	return s.Open(mergeCandidatesReportIdentifier).Update(text)
+}
+
+func (s *Site) duplicatePagesJob(progress *JobProgress) error {
+	started := time.Now()
+	duplicates := s.FindDuplicatePages(defaultDuplicateThreshold)
+	progress.SetTotal(len(duplicates))
+	for _, duplicate := range duplicates {
+		progress.Record(duplicate.Page+", "+duplicate.Duplicate, started, fmt.Errorf("%.0f%% the same", duplicate.Similarity*100))
+	}
+	return s.writeMergeCandidatesReport(duplicates)
+}
+
+func (s *Site) handleFindDuplicatePages(c *gin.Context) {
+	type QueryJSON struct {
+		Threshold float64 `json:"threshold"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	duplicates := s.FindDuplicatePages(json.Threshold)
+	if err := s.writeMergeCandidatesReport(duplicates); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "duplicates": duplicates, "page": mergeCandidatesReportIdentifier})
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindDuplicatePages(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	manual := "The cordless drill takes the 18V batteries in the garage cabinet. Charge them for an hour before use and store them half charged over winter."
+	for _, p := range []*Page{
+		newTestPage(s, "cordless_drill", manual),
+		newTestPage(s, "drill", manual+" Bits: red case."),
+		newTestPage(s, "impact_driver", "The impact driver takes the same 18V batteries as the drill, which are in the garage cabinet."),
+		newTestPage(s, "stub_a", "TODO"),
+		newTestPage(s, "stub_b", "TODO"),
+	} {
+		if err := p.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	duplicates := s.FindDuplicatePages(0)
+	if len(duplicates) != 1 || duplicates[0].Page != "cordless_drill" || duplicates[0].Duplicate != "drill" {
+		t.Fatalf("Expected only the two drill pages to be duplicates, got %+v", duplicates)
+	}
+	if duplicates[0].Similarity < 0.8 || duplicates[0].Similarity >= 1 {
+		t.Errorf("Expected the drills to be nearly the same, got %v", duplicates[0].Similarity)
+	}
+
+	if err := s.duplicatePagesJob(&JobProgress{}); err != nil {
+		t.Fatal(err)
+	}
+	if text := s.Open(mergeCandidatesReportIdentifier).Text.GetCurrent(); !strings.Contains(text, "cordless_drill") || !strings.Contains(text, "the same)") {
+		t.Errorf("Expected the report to list the drills, got %q", text)
+	}
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// An edit lock lasts defaultEditLockTTL unless asked for longer, up to
+// maxEditLockTTL; editors renew theirs while the page is open.
+const (
+	defaultEditLockTTL = 2 * time.Minute
+	maxEditLockTTL     = 30 * time.Minute
+)
+
+// EditLock says someone is editing a page. It is advisory: saves aren't
+// refused, but other editors are warned.
+type EditLock struct {
+	Page       string    `json:"page"`
+	Holder     string    `json:"holder"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	session    string
+}
+
+// EditLockHeldError is returned when someone else holds a page's edit lock.
+type EditLockHeldError struct {
+	Lock EditLock
+}
+
+func (e *EditLockHeldError) Error() string {
+	return fmt.Sprintf("%s is editing %s until %s", e.Lock.Holder, e.Lock.Page, e.Lock.ExpiresAt.Format("15:04:05"))
+}
+
+// editLock returns the unexpired lock on page, forgetting it if it has
+// expired. s.editLocksMut must be held.
+func (s *Site) editLock(page string, now time.Time) (EditLock, bool) {
+	lock, ok := s.editLocks[page]
+	if ok && !now.Before(lock.ExpiresAt) {
+		delete(s.editLocks, page)
+		return EditLock{}, false
+	}
+	return lock, ok
+}
+
+// AcquireEditLock gives the editor with session the lock on page for ttl, or
+// renews the one it has. holder is who other editors are told has it.
+func (s *Site) AcquireEditLock(page, holder, session string, ttl time.Duration, now time.Time) (EditLock, error) {
+	page = strings.ToLower(strings.TrimSpace(page))
+	if ttl <= 0 {
+		ttl = defaultEditLockTTL
+	}
+	if ttl > maxEditLockTTL {
+		ttl = maxEditLockTTL
+	}
+	s.editLocksMut.Lock()
+	defer s.editLocksMut.Unlock()
+	if s.editLocks == nil {
+		s.editLocks = map[string]EditLock{}
+	}
+	lock, ok := s.editLock(page, now)
+	if ok && lock.session != session {
+		return lock, &EditLockHeldError{Lock: lock}
+	}
+	if !ok {
+		lock = EditLock{Page: page, AcquiredAt: now, session: session}
+	}
+	lock.Holder = holder
+	lock.ExpiresAt = now.Add(ttl)
+	s.editLocks[page] = lock
+	return lock, nil
+}
+
+// ReleaseEditLock gives up the lock on page the editor with session holds.
+func (s *Site) ReleaseEditLock(page, session string, now time.Time) error {
+	page = strings.ToLower(strings.TrimSpace(page))
+	s.editLocksMut.Lock()
+	defer s.editLocksMut.Unlock()
+	lock, ok := s.editLock(page, now)
+	if !ok {
+		return nil
+	}
+	if lock.session != session {
+		return &EditLockHeldError{Lock: lock}
+	}
+	delete(s.editLocks, page)
+	return nil
+}
+
+func (s *Site) handleAcquireEditLock(c *gin.Context) {
+	type QueryJSON struct {
+		Page       string `json:"page"`
+		Holder     string `json:"holder"`
+		TTLSeconds int    `json:"ttl_seconds"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	if json.Holder == "" {
+		json.Holder = c.ClientIP()
+	}
+	lock, err := s.AcquireEditLock(json.Page, json.Holder, getSetSessionID(c), time.Duration(json.TTLSeconds)*time.Second, time.Now())
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error(), "lock": lock})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Locked for editing", "lock": lock})
+}
+
+func (s *Site) handleReleaseEditLock(c *gin.Context) {
+	type QueryJSON struct {
+		Page string `json:"page"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	if err := s.ReleaseEditLock(json.Page, getSetSessionID(c), time.Now()); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Released"})
+}
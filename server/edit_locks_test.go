@@ -0,0 +1,42 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEditLocks(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	now := time.Now()
+
+	lock, err := s.AcquireEditLock("Drill", "alice", "session-a", time.Minute, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock.Page != "drill" || lock.ExpiresAt != now.Add(time.Minute) {
+		t.Errorf("Unexpected lock: %+v", lock)
+	}
+
+	_, err = s.AcquireEditLock("drill", "bob", "session-b", time.Minute, now.Add(time.Second))
+	held, ok := err.(*EditLockHeldError)
+	if !ok || held.Lock.Holder != "alice" {
+		t.Fatalf("Expected bob to be told alice is editing, got %v", err)
+	}
+	if err := s.ReleaseEditLock("drill", "session-b", now); err == nil {
+		t.Error("Expected bob not to be able to release alice's lock")
+	}
+
+	if renewed, err := s.AcquireEditLock("drill", "alice", "session-a", time.Minute, now.Add(30*time.Second)); err != nil || renewed.AcquiredAt != now {
+		t.Errorf("Expected alice to renew the lock, got %+v %v", renewed, err)
+	}
+
+	if _, err := s.AcquireEditLock("drill", "bob", "session-b", time.Minute, now.Add(2*time.Minute)); err != nil {
+		t.Errorf("Expected a stale lock to expire, got %v", err)
+	}
+	if err := s.ReleaseEditLock("drill", "session-b", now.Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AcquireEditLock("drill", "alice", "session-a", 0, now.Add(2*time.Minute)); err != nil {
+		t.Errorf("Expected the released lock to be free, got %v", err)
+	}
+}
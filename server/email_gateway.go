@@ -0,0 +1,297 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// rHTMLTag matches markup, for reading mail that only came as HTML.
+var rHTMLTag = regexp.MustCompile(`<[^>]*>`)
+
+// emailAttachment is a file sent with an email.
+type emailAttachment struct {
+	filename    string
+	contentType string
+	data        []byte
+}
+
+// decodePart undoes a MIME part's Content-Transfer-Encoding.
+func decodePart(encoding string, r io.Reader) ([]byte, error) {
+	switch strings.ToLower(encoding) {
+	case "base64":
+		return ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, r))
+	case "quoted-printable":
+		return ioutil.ReadAll(quotedprintable.NewReader(r))
+	}
+	return ioutil.ReadAll(r)
+}
+
+// readEmailParts walks a (possibly nested multipart) body, keeping the first
+// text/plain part as the text, the first text/html part in case there is no
+// plain text, and every part with a filename as an attachment.
+func readEmailParts(header textproto.MIMEHeader, body io.Reader, text, html *string, attachments *[]emailAttachment) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := readEmailParts(part.Header, part, text, html, attachments); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := decodePart(header.Get("Content-Transfer-Encoding"), body)
+	if err != nil {
+		return err
+	}
+	_, disposition, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := disposition["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	switch {
+	case filename != "":
+		*attachments = append(*attachments, emailAttachment{filename: filename, contentType: mediaType, data: data})
+	case mediaType == "text/plain" && *text == "":
+		*text = string(data)
+	case mediaType == "text/html" && *html == "":
+		*html = string(data)
+	}
+	return nil
+}
+
+// EmailToPage turns an email into a page: the subject is its title and the
+// plain text its markdown, with the attachments stored by upload and linked
+// at the end.
+func EmailToPage(message []byte, upload func(filename string, data []byte) (string, error)) (ImportedPage, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(message))
+	if err != nil {
+		return ImportedPage{}, err
+	}
+	decoder := mime.WordDecoder{}
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	from, _ := decoder.DecodeHeader(msg.Header.Get("From"))
+
+	var text, html string
+	attachments := []emailAttachment{}
+	if err := readEmailParts(textproto.MIMEHeader(msg.Header), msg.Body, &text, &html, &attachments); err != nil {
+		return ImportedPage{}, err
+	}
+	if text == "" && html != "" {
+		text = strings.TrimSpace(rHTMLTag.ReplaceAllString(html, ""))
+	}
+
+	page := ImportedPage{Title: strings.TrimSpace(subject), Tags: []string{"email"}}
+	markdown := strings.Replace(strings.TrimSpace(text), "\r\n", "\n", -1)
+	if from != "" {
+		markdown = "*From " + from + "*\n\n" + markdown
+	}
+	if len(attachments) > 0 {
+		markdown += "\n\n## Attachments\n"
+		for _, attachment := range attachments {
+			link, err := upload(attachment.filename, attachment.data)
+			if err != nil {
+				page.Warnings = append(page.Warnings, fmt.Sprintf("could not store %s: %v", attachment.filename, err))
+				continue
+			}
+			if strings.HasPrefix(attachment.contentType, "image/") {
+				markdown += "\n![" + attachment.filename + "](" + link + ")\n"
+			} else {
+				markdown += "\n- [" + attachment.filename + "](" + link + ")"
+			}
+		}
+	}
+	page.Markdown = markdown + "\n"
+	return page, nil
+}
+
+// ReceiveEmail makes a page of an email on the user job queue, named from
+// its subject, with the time it arrived added when that is taken. It
+// returns the job's id.
+func (s *Site) ReceiveEmail(message []byte) (string, error) {
+	return s.jobs().Enqueue(UserQueue, "email", func(progress *JobProgress) error {
+		started := time.Now()
+		page, err := EmailToPage(message, s.saveUpload)
+		if err != nil {
+			return err
+		}
+		generated := s.GenerateIdentifier(page.Title)
+		page.Identifier = generated.Identifier
+		if page.Identifier == "" || !generated.IsUnique {
+			page.Identifier = strings.Trim(page.Identifier+"_"+started.Format("20060102_150405"), "_")
+		}
+		err = s.writeImportedPage(page)
+		if err == nil && len(page.Warnings) > 0 {
+			err = errors.New("imported, but " + strings.Join(page.Warnings, "; "))
+		}
+		progress.Record(page.Identifier, started, err)
+		return nil
+	})
+}
+
+// emailOverhead is room in a message for its headers and text, beyond its
+// attachments.
+const emailOverhead = 1 << 20
+
+// EmailGateway is a small SMTP server that takes mail for one address and
+// turns each message into a page. It doesn't authenticate anyone, so it
+// belongs on a private network; senders, if set, are the only envelope
+// senders it takes mail from.
+type EmailGateway struct {
+	site    *Site
+	address string
+	senders []string
+	maxSize int64
+}
+
+func NewEmailGateway(site *Site, address string, senders []string, maxSize int64) *EmailGateway {
+	lowered := make([]string, len(senders))
+	for i, sender := range senders {
+		lowered[i] = strings.ToLower(strings.TrimSpace(sender))
+	}
+	return &EmailGateway{site: site, address: strings.ToLower(address), senders: lowered, maxSize: maxSize}
+}
+
+// allowsSender is whether mail from address is taken: any, without senders,
+// or else one of them or one at a domain (@example.com) among them.
+func (g *EmailGateway) allowsSender(address string) bool {
+	if len(g.senders) == 0 {
+		return true
+	}
+	for _, sender := range g.senders {
+		if address == sender || (strings.HasPrefix(sender, "@") && strings.HasSuffix(address, sender)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListenAndServe takes mail on addr until the listener fails.
+func (g *EmailGateway) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go g.serve(conn)
+	}
+}
+
+func smtpAddress(arg, prefix string) (string, bool) {
+	if !strings.HasPrefix(strings.ToUpper(arg), prefix) {
+		return "", false
+	}
+	address := strings.TrimSpace(arg[len(prefix):])
+	if i := strings.Index(address, ">"); i >= 0 {
+		address = address[:i]
+	}
+	return strings.ToLower(strings.TrimPrefix(address, "<")), true
+}
+
+// serve speaks enough SMTP for a mail server to hand over messages.
+func (g *EmailGateway) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	reply := func(code int, message string) {
+		text.PrintfLine("%d %s", code, message)
+	}
+	reply(220, "simple_wiki ready")
+
+	sender, recipient := false, false
+	for {
+		conn.SetDeadline(time.Now().Add(5 * time.Minute))
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command, arg := line, ""
+		if i := strings.Index(line, " "); i >= 0 {
+			command, arg = line[:i], line[i+1:]
+		}
+		switch strings.ToUpper(command) {
+		case "HELO", "EHLO":
+			reply(250, "simple_wiki")
+		case "MAIL":
+			recipient, sender = false, false
+			if address, ok := smtpAddress(arg, "FROM:"); !ok || !g.allowsSender(address) {
+				reply(550, "Not taking mail from that sender")
+				continue
+			}
+			sender = true
+			reply(250, "OK")
+		case "RCPT":
+			if !sender {
+				reply(503, "Need a sender first")
+				continue
+			}
+			address, ok := smtpAddress(arg, "TO:")
+			if !ok || address != g.address {
+				reply(550, "No such mailbox")
+				continue
+			}
+			recipient = true
+			reply(250, "OK")
+		case "DATA":
+			if !recipient {
+				reply(503, "Need a recipient first")
+				continue
+			}
+			reply(354, "Go ahead, end with <CRLF>.<CRLF>")
+			message, err := ioutil.ReadAll(io.LimitReader(text.DotReader(), g.maxSize+1))
+			if err != nil {
+				return
+			}
+			if int64(len(message)) > g.maxSize {
+				io.Copy(ioutil.Discard, text.DotReader())
+				reply(552, "Message too big")
+				continue
+			}
+			if _, err := g.site.ReceiveEmail(message); err != nil {
+				reply(451, err.Error())
+				continue
+			}
+			recipient = false
+			reply(250, "Queued as a page")
+		case "RSET":
+			recipient = false
+			reply(250, "OK")
+		case "NOOP":
+			reply(250, "OK")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			reply(502, "Not implemented")
+		}
+	}
+}
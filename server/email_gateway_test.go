@@ -0,0 +1,120 @@
+package server
+
+import (
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testEmail = "From: Pat <pat@example.com>\r\n" +
+	"To: wiki@home.example\r\n" +
+	"Subject: =?utf-8?q?Dishwasher_Manual?=\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=b1\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: multipart/alternative; boundary=b2\r\n" +
+	"\r\n" +
+	"--b2\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Clean the filter=\r\n monthly.\r\n" +
+	"--b2\r\n" +
+	"Content-Type: text/html\r\n" +
+	"\r\n" +
+	"<p>Clean the filter monthly.</p>\r\n" +
+	"--b2--\r\n" +
+	"--b1\r\n" +
+	"Content-Type: application/pdf; name=\"manual.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"manual.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQ=\r\n" +
+	"--b1--\r\n"
+
+func TestEmailToPage(t *testing.T) {
+	uploaded := map[string]string{}
+	page, err := EmailToPage([]byte(testEmail), func(filename string, data []byte) (string, error) {
+		uploaded[filename] = string(data)
+		return "/uploads/" + filename, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Title != "Dishwasher Manual" {
+		t.Errorf("Expected the subject as the title, got %q", page.Title)
+	}
+	if !strings.Contains(page.Markdown, "Clean the filter monthly.") || strings.Contains(page.Markdown, "<p>") {
+		t.Errorf("Expected the plain text as the markdown, got %q", page.Markdown)
+	}
+	if uploaded["manual.pdf"] != "%PDF-1.4" {
+		t.Errorf("Expected the attachment to be decoded and stored, got %v", uploaded)
+	}
+	if !strings.Contains(page.Markdown, "[manual.pdf](/uploads/manual.pdf)") {
+		t.Errorf("Expected the attachment to be linked, got %q", page.Markdown)
+	}
+}
+
+func TestEmailGateway(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	gateway := NewEmailGateway(s, "Wiki@home.example", []string{"@Example.com"}, 1<<20)
+	client, server := net.Pipe()
+	defer client.Close()
+	go gateway.serve(server)
+
+	conn := textproto.NewConn(client)
+	expect := func(code int) {
+		t.Helper()
+		if _, _, err := conn.ReadResponse(code); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send := func(line string, code int) {
+		t.Helper()
+		conn.PrintfLine("%s", line)
+		expect(code)
+	}
+
+	expect(220)
+	send("EHLO mail.example.com", 250)
+	send("RCPT TO:<wiki@home.example>", 503)
+	send("MAIL FROM:<mallory@elsewhere.example>", 550)
+	send("RCPT TO:<wiki@home.example>", 503)
+	send("MAIL FROM:<pat@example.com>", 250)
+	send("RCPT TO:<someone@home.example>", 550)
+	send("DATA", 503)
+	send("RCPT TO:<wiki@home.example>", 250)
+	send("DATA", 354)
+	w := conn.DotWriter()
+	w.Write([]byte(testEmail))
+	w.Close()
+	expect(250)
+	send("QUIT", 221)
+
+	var matter map[string]interface{}
+	for i := 0; i < 100; i++ {
+		if matter, _ = s.ReadFrontMatter("dishwasher_manual"); matter != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if matter["title"] != "Dishwasher Manual" {
+		t.Errorf("Expected the email to become a page, got %v", matter)
+	}
+}
+
+func TestEmailGatewaySenders(t *testing.T) {
+	anyone := NewEmailGateway(nil, "wiki@home.example", nil, 1<<20)
+	if !anyone.allowsSender("mallory@elsewhere.example") {
+		t.Error("Expected mail from anyone without senders")
+	}
+	gateway := NewEmailGateway(nil, "wiki@home.example", []string{"Alice@Example.com", "@home.example"}, 1<<20)
+	for sender, allowed := range map[string]bool{"alice@example.com": true, "bob@example.com": false, "pat@home.example": true, "pat@nothome.example": false, "": false} {
+		if gateway.allowsSender(sender) != allowed {
+			t.Errorf("Expected %q allowed to be %v", sender, allowed)
+		}
+	}
+}
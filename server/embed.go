@@ -7,5 +7,8 @@ import (
 //go:embed templates/index.tmpl
 var IndexTemplate string
 
+//go:embed templates/print.tmpl
+var PrintTemplate string
+
 //go:embed static/**
 var StaticContent embed.FS
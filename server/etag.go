@@ -0,0 +1,88 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// staticAssetCacheControl lets browsers keep the bundled assets for a day
+// before checking them again; they only change with a new build.
+const staticAssetCacheControl = "public, max-age=86400"
+
+// pageCacheControl has browsers check pages every time, which costs only a
+// 304 when they haven't changed.
+const pageCacheControl = "private, no-cache"
+
+// contentETag is a strong ETag of the content.
+func contentETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches is whether an If-None-Match header names the ETag.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// dataWithETag answers with the content and its ETag, or a 304 if the
+// client already has it.
+func dataWithETag(c *gin.Context, contentType, cacheControl string, content []byte) {
+	etag := contentETag(content)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", cacheControl)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, contentType, content)
+}
+
+// etagWriter holds back what a handler writes, to send with its ETag.
+type etagWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *etagWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *etagWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// withETag runs the handler with what it writes held back, then sends it
+// with an ETag of it, or a 304 if the client already has it. It's for
+// pages rendered from templates, where the whole page is the only thing
+// that says what it depends on.
+func withETag(c *gin.Context, handler func()) {
+	original := c.Writer
+	w := &etagWriter{ResponseWriter: original}
+	c.Writer = w
+	handler()
+	c.Writer = original
+	if original.Status() != http.StatusOK || original.Written() {
+		original.Write(w.body.Bytes())
+		return
+	}
+	etag := contentETag(w.body.Bytes())
+	original.Header().Set("ETag", etag)
+	original.Header().Set("Cache-Control", pageCacheControl)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		original.WriteHeader(http.StatusNotModified)
+		original.WriteHeaderNow()
+		return
+	}
+	original.Write(w.body.Bytes())
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/jcelliott/lumber"
+)
+
+func TestETags(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), SessionStore: cookie.NewStore([]byte("secret")), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	newTestPage(s, "notes", "some notes")
+	router := s.Router()
+	sessionCookie := ""
+	get := func(url, ifNoneMatch string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		if sessionCookie != "" {
+			req.Header.Set("Cookie", sessionCookie)
+		}
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		router.ServeHTTP(w, req)
+		if setCookies := w.Header().Values("Set-Cookie"); len(setCookies) > 0 {
+			sessionCookie = strings.Split(setCookies[len(setCookies)-1], ";")[0]
+		}
+		return w
+	}
+
+	get("/notes/view", "")
+	w := get("/notes/view", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Header().Get("Cache-Control") != pageCacheControl {
+		t.Fatalf("Expected the page with an ETag, got %d %v", w.Code, w.Header())
+	}
+	if w = get("/notes/view", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("Expected 304 for an unchanged page, got %d with %d bytes", w.Code, w.Body.Len())
+	}
+	newTestPage(s, "notes", "other notes")
+	if w = get("/notes/view", etag); w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("Expected the changed page with a new ETag, got %d %s", w.Code, w.Header().Get("ETag"))
+	}
+
+	w = get("/notes.md", "")
+	if w = get("/notes.md", w.Header().Get("ETag")); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for unchanged markdown, got %d", w.Code)
+	}
+	w = get("/notes.json", "")
+	if w = get("/notes.json", `"other", `+w.Header().Get("ETag")); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for unchanged JSON, got %d", w.Code)
+	}
+
+	w = get("/static/css/default.css", "")
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != staticAssetCacheControl {
+		t.Errorf("Expected a cacheable asset, got %d %v", w.Code, w.Header())
+	}
+	if w = get("/static/css/default.css", w.Header().Get("ETag")); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for an unchanged asset, got %d", w.Code)
+	}
+}
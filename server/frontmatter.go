@@ -0,0 +1,199 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/adrg/frontmatter"
+	"gopkg.in/yaml.v2"
+)
+
+// SplitFrontmatter separates a page's text into its decoded frontmatter and
+// the remaining markdown body. isYaml reports whether the frontmatter used
+// the `---` delimiters rather than TOML's `+++`.
+func SplitFrontmatter(text string) (matter map[string]interface{}, body string, isYaml bool, err error) {
+	matter = map[string]interface{}{}
+	rest, err := frontmatter.Parse(strings.NewReader(text), &matter)
+	if err != nil {
+		return nil, "", false, err
+	}
+	normalizeFrontmatter(matter)
+
+	trimmed := strings.TrimLeft(text, " \t\r\n")
+	isYaml = strings.HasPrefix(trimmed, "---") && !strings.HasPrefix(trimmed, "---toml")
+	return matter, string(rest), isYaml, nil
+}
+
+// JoinFrontmatter is the inverse of SplitFrontmatter.
+func JoinFrontmatter(matter map[string]interface{}, body string, isYaml bool) (string, error) {
+	if len(matter) == 0 {
+		return body, nil
+	}
+
+	if isYaml {
+		out, err := yaml.Marshal(matter)
+		if err != nil {
+			return "", err
+		}
+		return "---\n" + string(out) + "---\n" + body, nil
+	}
+
+	buf := &bytes.Buffer{}
+	if err := toml.NewEncoder(buf).Encode(matter); err != nil {
+		return "", err
+	}
+	return "+++\n" + buf.String() + "+++\n" + body, nil
+}
+
+// UpdateFrontmatter rewrites the frontmatter of the page with whatever mutate
+// does to it, leaving the markdown body alone, and saves the result.
+func (p *Page) UpdateFrontmatter(mutate func(matter map[string]interface{}) error) error {
+	matter, body, isYaml, err := SplitFrontmatter(p.Text.GetCurrent())
+	if err != nil {
+		return err
+	}
+
+	if err = mutate(matter); err != nil {
+		return err
+	}
+
+	text, err := JoinFrontmatter(matter, body, isYaml)
+	if err != nil {
+		return err
+	}
+
+	return p.Update(text)
+}
+
+// normalizeFrontmatter converts the map[interface{}]interface{} values that
+// yaml produces for nested tables into map[string]interface{} so frontmatter
+// can be walked the same way regardless of the format it was written in.
+func normalizeFrontmatter(matter map[string]interface{}) {
+	for k, v := range matter {
+		matter[k] = normalizeFrontmatterValue(v)
+	}
+}
+
+func normalizeFrontmatterValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, inner := range val {
+			m[fmt.Sprint(k)] = normalizeFrontmatterValue(inner)
+		}
+		return m
+	case map[string]interface{}:
+		normalizeFrontmatter(val)
+		return val
+	case []interface{}:
+		for i := range val {
+			val[i] = normalizeFrontmatterValue(val[i])
+		}
+		return val
+	}
+	return v
+}
+
+// frontmatterTable returns the nested table stored under key, creating it
+// when create is set.
+func frontmatterTable(matter map[string]interface{}, key string, create bool) (map[string]interface{}, bool) {
+	if table, ok := matter[key].(map[string]interface{}); ok {
+		return table, true
+	}
+	if !create {
+		return nil, false
+	}
+	table := map[string]interface{}{}
+	matter[key] = table
+	return table, true
+}
+
+// frontmatterNumber reads a numeric frontmatter value; toml, yaml and json
+// each decode numbers into different types.
+func frontmatterNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// frontmatterString reads a string frontmatter value.
+func frontmatterString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return ""
+}
+
+// frontmatterNumberValue is the inverse of frontmatterNumber, keeping whole
+// numbers as integers so they are written back without a trailing `.0`.
+func frontmatterNumberValue(n float64) interface{} {
+	if n == float64(int64(n)) {
+		return int64(n)
+	}
+	return n
+}
+
+// frontmatterPath looks up a dotted key such as `inventory.container`.
+func frontmatterPath(matter map[string]interface{}, dotted string) (interface{}, bool) {
+	parts := strings.Split(dotted, ".")
+	table := matter
+	for _, part := range parts[:len(parts)-1] {
+		var ok bool
+		if table, ok = frontmatterTable(table, part, false); !ok {
+			return nil, false
+		}
+	}
+	v, ok := table[parts[len(parts)-1]]
+	return v, ok
+}
+
+// frontmatterText formats a scalar frontmatter value the way it would be
+// typed into the frontmatter.
+func frontmatterText(v interface{}) string {
+	if n, ok := frontmatterNumber(v); ok {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// setFrontmatterPath sets a dotted key, creating the tables along the way.
+func setFrontmatterPath(matter map[string]interface{}, dotted string, v interface{}) {
+	parts := strings.Split(dotted, ".")
+	table := matter
+	for _, part := range parts[:len(parts)-1] {
+		table, _ = frontmatterTable(table, part, true)
+	}
+	table[parts[len(parts)-1]] = v
+}
+
+// frontmatterStrings reads a list of strings, or a single string, as a list.
+func frontmatterStrings(v interface{}) []string {
+	values := []string{}
+	switch val := v.(type) {
+	case string:
+		if val != "" {
+			values = append(values, val)
+		}
+	case []interface{}:
+		for _, element := range val {
+			if s := frontmatterText(element); s != "" {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/jcelliott/lumber"
+)
+
+func TestUploadIsStreamedToDisk(t *testing.T) {
+	s := &Site{
+		PathToData:    t.TempDir(),
+		Fileuploads:   true,
+		MaxUploadSize: 1,
+		SessionStore:  cookie.NewStore([]byte("secret")),
+		Logger:        lumber.NewConsoleLogger(lumber.WARN),
+	}
+	router := s.Router()
+	upload := func(content []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("note", "fields before the file are skipped")
+		part, _ := form.CreateFormFile("file", "manual.pdf")
+		part.Write(content)
+		form.Close()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/uploads", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	content := bytes.Repeat([]byte("pdf"), 1000)
+	w := upload(content)
+	location := w.Header().Get("Location")
+	if !strings.HasPrefix(location, "/uploads/sha256-") || !strings.HasSuffix(location, "?filename=manual.pdf") {
+		t.Fatalf("Expected the upload's location, got %d %q", w.Code, location)
+	}
+	name := strings.TrimPrefix(strings.Split(location, "?")[0], "/uploads/")
+	if saved, err := ioutil.ReadFile(s.uploadPath(name)); err != nil || !bytes.Equal(saved, content) {
+		t.Errorf("Expected the upload saved as %s: %v", name, err)
+	}
+	if metadata, err := s.UploadMetadata(name); err != nil || metadata.Filename != "manual.pdf" {
+		t.Errorf("Expected the upload's filename recorded, got %+v %v", metadata, err)
+	}
+
+	if w := upload(make([]byte, 3*megabyte)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected an upload over max-upload-mb to be refused, got %d", w.Code)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(s.PathToData, "upload-*.tmp")); len(leftovers) > 0 {
+		t.Errorf("Expected no temporary files left behind, got %v", leftovers)
+	}
+}
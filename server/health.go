@@ -0,0 +1,49 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The health states /healthz reports, named as in the gRPC health checking
+// protocol so probes written for either read the same.
+const (
+	HealthServing    = "SERVING"
+	HealthNotServing = "NOT_SERVING"
+)
+
+// Health is whether the wiki can serve pages: its data directory has to be
+// readable.
+func (s *Site) Health() (string, error) {
+	if _, err := ioutil.ReadDir(s.PathToData); err != nil {
+		return HealthNotServing, err
+	}
+	return HealthServing, nil
+}
+
+// handleHealth answers liveness probes. It needs no access code, so load
+// balancers can use it.
+func (s *Site) handleHealth(c *gin.Context) {
+	status, err := s.Health()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": status, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": status})
+}
+
+// handleListRoutes lists the routes the router serves, so scripts can find
+// out what this wiki supports.
+func handleListRoutes(router *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		routes := []gin.H{}
+		for _, route := range router.Routes() {
+			routes = append(routes, gin.H{"method": route.Method, "path": route.Path})
+		}
+		sort.SliceStable(routes, func(i, j int) bool { return routes[i]["path"].(string) < routes[j]["path"].(string) })
+		c.JSON(http.StatusOK, gin.H{"success": true, "routes": routes})
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/jcelliott/lumber"
+)
+
+func TestHealth(t *testing.T) {
+	s := &Site{
+		PathToData:   t.TempDir(),
+		SecretCode:   "letmein",
+		SessionStore: cookie.NewStore([]byte("secret")),
+		Logger:       lumber.NewConsoleLogger(lumber.WARN),
+	}
+	router := s.Router()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), HealthServing) {
+		t.Errorf("Expected to be serving without logging in, got %d %s", w.Code, w.Body.String())
+	}
+
+	s.PathToData = filepath.Join(s.PathToData, "gone")
+	os.RemoveAll(s.PathToData)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), HealthNotServing) {
+		t.Errorf("Expected not serving without a data directory, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/routes", nil)
+	req.Header.Set("Authorization", "letmein")
+	router.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `"path":"/pages/list"`) {
+		t.Errorf("Expected the routes listed, got %s", w.Body.String())
+	}
+}
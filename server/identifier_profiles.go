@@ -0,0 +1,132 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// IdentifierProfile is a way of munging text into identifiers.
+type IdentifierProfile interface {
+	Munge(text string) string
+}
+
+// separatorProfile lowercases text and joins its runs of letters and digits
+// with the separator. Each namespace in the text is munged on its own, so
+// "Projects/Alpha Notes" becomes projects/alpha_notes.
+type separatorProfile string
+
+func (separator separatorProfile) Munge(text string) string {
+	segments := []string{}
+	for _, segment := range strings.Split(text, NamespaceSeparator) {
+		if munged := separator.mungeSegment(segment); munged != "" {
+			segments = append(segments, munged)
+		}
+	}
+	return strings.Join(segments, NamespaceSeparator)
+}
+
+func (separator separatorProfile) mungeSegment(text string) string {
+	var b strings.Builder
+	pending := false
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if pending && b.Len() > 0 {
+				b.WriteString(string(separator))
+			}
+			pending = false
+			b.WriteRune(r)
+		} else {
+			pending = true
+		}
+	}
+	return b.String()
+}
+
+const DefaultIdentifierProfile = "snake_case"
+
+// IdentifierProfiles are the profiles a deployment can choose between.
+var IdentifierProfiles = map[string]IdentifierProfile{
+	"snake_case": separatorProfile("_"), // Foo Bar -> foo_bar
+	"hyphenated": separatorProfile("-"), // Foo Bar -> foo-bar
+}
+
+// identifierProfileFile records the profile the existing pages were munged
+// with, so a change of profile can be noticed on startup.
+const identifierProfileFile = "identifier_profile"
+
+// systemPages are written by the wiki itself under fixed identifiers, so they
+// keep them whatever the profile.
+var systemPages = []string{
+	SystemConfigurationIdentifier,
+	deadLetterReportIdentifier,
+	shoppingListIdentifier,
+	identifierCollisionsReportIdentifier,
+	metricsReportIdentifier,
+}
+
+func (s *Site) identifierProfile() IdentifierProfile {
+	if profile, ok := IdentifierProfiles[s.IdentifierProfile]; ok {
+		return profile
+	}
+	return IdentifierProfiles[DefaultIdentifierProfile]
+}
+
+func (s *Site) identifierProfileName() string {
+	if _, ok := IdentifierProfiles[s.IdentifierProfile]; ok {
+		return s.IdentifierProfile
+	}
+	return DefaultIdentifierProfile
+}
+
+// recordedIdentifierProfile is the profile the pages were last migrated to.
+// Wikis from before profiles existed used the default.
+func (s *Site) recordedIdentifierProfile() string {
+	recorded, err := ioutil.ReadFile(path.Join(s.PathToData, identifierProfileFile))
+	if os.IsNotExist(err) || strings.TrimSpace(string(recorded)) == "" {
+		return DefaultIdentifierProfile
+	}
+	return strings.TrimSpace(string(recorded))
+}
+
+// MigrateIdentifierProfile queues a background job to rename existing pages
+// when the configured profile differs from the one they were munged with.
+// It returns the job's id, or "" when there is nothing to do.
+func (s *Site) MigrateIdentifierProfile() (string, error) {
+	if s.recordedIdentifierProfile() == s.identifierProfileName() {
+		return "", nil
+	}
+	return s.jobs().Enqueue(BackgroundQueue, "identifier profile migration", s.identifierProfileMigrationJob)
+}
+
+// identifierProfileMigrationJob re-munges every page's identifier with the
+// configured profile and renames the pages that change, leaving redirects
+// behind. The new profile is only recorded once every page has moved, so a
+// failed migration is tried again.
+func (s *Site) identifierProfileMigrationJob(progress *JobProgress) error {
+	profile := s.identifierProfile()
+	identifiers := s.PageIdentifiers()
+	progress.SetTotal(len(identifiers))
+	failed := 0
+	for _, identifier := range identifiers {
+		started := time.Now()
+		munged := profile.Munge(identifier)
+		if munged == identifier || munged == "" || stringInSlice(identifier, systemPages) {
+			progress.Record(identifier, started, nil)
+			continue
+		}
+		err := s.RenamePage(identifier, munged)
+		if err != nil {
+			failed++
+		}
+		progress.Record(identifier+" -> "+munged, started, err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("could not rename %d pages", failed)
+	}
+	return ioutil.WriteFile(path.Join(s.PathToData, identifierProfileFile), []byte(s.identifierProfileName()+"\n"), 0644)
+}
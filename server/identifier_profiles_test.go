@@ -0,0 +1,53 @@
+package server
+
+import (
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestIdentifierProfiles(t *testing.T) {
+	for name, expected := range map[string]string{"snake_case": "tape_measure_25ft", "hyphenated": "tape-measure-25ft"} {
+		if munged := IdentifierProfiles[name].Munge("Tape Measure (25ft)"); munged != expected {
+			t.Errorf("%s munged to %q, expected %q", name, munged, expected)
+		}
+	}
+
+	s := &Site{PathToData: t.TempDir(), IdentifierProfile: "hyphenated"}
+	if generated := s.GenerateIdentifier("Tape Measure"); generated.Identifier != "tape-measure" {
+		t.Errorf("Expected the site's profile to be used, got %q", generated.Identifier)
+	}
+}
+
+func TestIdentifierProfileMigration(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "tape_measure", "+++\nidentifier = \"tape_measure\"\n+++\n")
+	newTestPage(s, "drill", "# Drill")
+	newTestPage(s, SystemConfigurationIdentifier, "# Settings")
+
+	if id, _ := s.MigrateIdentifierProfile(); id != "" {
+		t.Error("Nothing to migrate when the profile hasn't changed")
+	}
+
+	s.IdentifierProfile = "hyphenated"
+	if err := s.identifierProfileMigrationJob(&JobProgress{}); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(s.pageFile("tape-measure", ".json")) || exists(s.pageFile("tape_measure", ".json")) {
+		t.Error("Expected tape_measure to be renamed to tape-measure")
+	}
+	if target, _ := s.Redirect("tape_measure"); target != "tape-measure" {
+		t.Errorf("Expected a redirect from the old identifier, got %q", target)
+	}
+	if !exists(s.pageFile(SystemConfigurationIdentifier, ".json")) {
+		t.Error("System pages should keep their identifiers")
+	}
+	recorded, _ := ioutil.ReadFile(path.Join(s.PathToData, identifierProfileFile))
+	if strings.TrimSpace(string(recorded)) != "hyphenated" {
+		t.Errorf("Expected the new profile to be recorded, got %q", recorded)
+	}
+	if id, _ := s.MigrateIdentifierProfile(); id != "" {
+		t.Error("Nothing to migrate once the profile is recorded")
+	}
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const identifierCollisionsReportIdentifier = "identifier_collisions"
+
+// MungeIdentifier turns text such as a title into an identifier with the
+// default profile: lowercase, with every run of anything but letters and
+// digits made into a single `_`, except the `/` between namespaces. Whatever the profile, "Foo Bar" and
+// "foo_bar" munge to the same identifier, so it is also how collisions are
+// found.
+func MungeIdentifier(text string) string {
+	return IdentifierProfiles[DefaultIdentifierProfile].Munge(text)
+}
+
+// maxGenerateIdentifiersBatch caps how many identifiers one request to
+// GenerateIdentifiers can ask for.
+const maxGenerateIdentifiersBatch = 100
+
+// GeneratedIdentifier is the identifier a new page for Text would get.
+// IsUnique is false when a page, redirect or alias already has it, or
+// another page's identifier munges the same; Existing is that page.
+type GeneratedIdentifier struct {
+	Text          string `json:"text"`
+	Identifier    string `json:"identifier"`
+	IsUnique      bool   `json:"is_unique"`
+	Existing      string `json:"existing,omitempty"`
+	ExistingTitle string `json:"existing_title,omitempty"`
+}
+
+// GenerateIdentifier munges text into an identifier and says whether a page
+// could be created with it.
+func (s *Site) GenerateIdentifier(text string) GeneratedIdentifier {
+	generated := GeneratedIdentifier{Text: text, Identifier: s.identifierProfile().Munge(text)}
+	if generated.Identifier == "" {
+		return generated
+	}
+	if s.hasPageFile(generated.Identifier, ".json") {
+		generated.Existing = generated.Identifier
+	} else if target, ok := s.lookupIdentifier(generated.Identifier); ok {
+		generated.Existing = target
+	} else if collision, ok := s.checkIdentifierCollision(generated.Identifier).(*IdentifierCollisionError); ok {
+		generated.Existing = collision.Existing
+		generated.ExistingTitle = collision.Title
+	}
+	if generated.Existing != "" && generated.ExistingTitle == "" {
+		generated.ExistingTitle = generated.Existing
+		if matter, err := s.ReadFrontMatter(generated.Existing); err == nil {
+			if title := frontmatterString(matter["title"]); title != "" {
+				generated.ExistingTitle = title
+			}
+		}
+	}
+	generated.IsUnique = generated.Existing == ""
+	return generated
+}
+
+// GenerateIdentifiers is GenerateIdentifier for many texts at once. A text
+// that munges the same as an earlier one in the batch isn't unique either.
+func (s *Site) GenerateIdentifiers(texts []string) ([]GeneratedIdentifier, error) {
+	if len(texts) > maxGenerateIdentifiersBatch {
+		return nil, fmt.Errorf("can generate at most %d identifiers at once", maxGenerateIdentifiersBatch)
+	}
+	generated := []GeneratedIdentifier{}
+	first := map[string]string{}
+	for _, text := range texts {
+		g := s.GenerateIdentifier(text)
+		if earlier, seen := first[g.Identifier]; seen && g.IsUnique {
+			g.IsUnique = false
+			g.ExistingTitle = earlier
+		} else if !seen {
+			first[g.Identifier] = text
+		}
+		generated = append(generated, g)
+	}
+	return generated, nil
+}
+
+func (s *Site) handleGenerateIdentifier(c *gin.Context) {
+	type QueryJSON struct {
+		Text string `json:"text"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "identifier": s.GenerateIdentifier(json.Text)})
+}
+
+func (s *Site) handleGenerateIdentifiers(c *gin.Context) {
+	type QueryJSON struct {
+		Texts []string `json:"texts"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	generated, err := s.GenerateIdentifiers(json.Texts)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "identifiers": generated})
+}
+
+// IdentifierCollisionError says that a new page's identifier munges to the
+// same thing as an existing page's.
+type IdentifierCollisionError struct {
+	Identifier string
+	Existing   string
+	Title      string
+}
+
+func (e *IdentifierCollisionError) Error() string {
+	return fmt.Sprintf("%q already exists as %q (%s)", e.Identifier, e.Existing, e.Title)
+}
+
+// checkIdentifierCollision is run before a page is created. It returns an
+// *IdentifierCollisionError when another page's identifier munges the same.
+func (s *Site) checkIdentifierCollision(identifier string) error {
+	identifier = strings.ToLower(identifier)
+	if s.hasPageFile(identifier, ".json") {
+		return nil
+	}
+	munged := MungeIdentifier(identifier)
+	for _, existing := range s.PageIdentifiers() {
+		if strings.ToLower(existing) == identifier || MungeIdentifier(existing) != munged {
+			continue
+		}
+		title := existing
+		if matter, err := s.ReadFrontMatter(existing); err == nil {
+			if t := frontmatterString(matter["title"]); t != "" {
+				title = t
+			}
+		}
+		return &IdentifierCollisionError{Identifier: identifier, Existing: existing, Title: title}
+	}
+	return nil
+}
+
+// FindIdentifierCollisions lists the groups of existing pages whose
+// identifiers munge the same, which predate the check on creation.
+func (s *Site) FindIdentifierCollisions() [][]string {
+	byMunged := map[string][]string{}
+	for _, identifier := range s.PageIdentifiers() {
+		munged := MungeIdentifier(identifier)
+		byMunged[munged] = append(byMunged[munged], identifier)
+	}
+	collisions := [][]string{}
+	for _, identifiers := range byMunged {
+		if len(identifiers) > 1 {
+			sort.Strings(identifiers)
+			collisions = append(collisions, identifiers)
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool { return collisions[i][0] < collisions[j][0] })
+	return collisions
+}
+
+// writeIdentifierCollisionsReport rewrites the page listing colliding
+// identifiers.
+func (s *Site) writeIdentifierCollisionsReport(collisions [][]string) error {
+	text := "+++\nidentifier = \"" + identifierCollisionsReportIdentifier + "\"\ntitle = \"Identifier Collisions\"\n+++\n\n# Identifier Collisions\n\n"
+	text += "_These pages have identifiers that only differ in punctuation or spacing. Merge them, or rename all but one._\n"
+	if len(collisions) == 0 {
+		text += "\nNone.\n"
+	}
+	for _, identifiers := range collisions {
+		text += "\n"
+		for _, identifier := range identifiers {
+			text += "  - [[" + identifier + "]]\n"
+		}
+	}
+	return s.Open(identifierCollisionsReportIdentifier).Update(text)
+}
+
+func (s *Site) identifierCollisionsJob(progress *JobProgress) error {
+	started := time.Now()
+	collisions := s.FindIdentifierCollisions()
+	progress.SetTotal(len(collisions))
+	for _, identifiers := range collisions {
+		progress.Record(strings.Join(identifiers, ", "), started, fmt.Errorf("%d pages munge to %q", len(identifiers), MungeIdentifier(identifiers[0])))
+	}
+	return s.writeIdentifierCollisionsReport(collisions)
+}
+
+func (s *Site) handleFindIdentifierCollisions(c *gin.Context) {
+	collisions := s.FindIdentifierCollisions()
+	if err := s.writeIdentifierCollisionsReport(collisions); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "collisions": collisions, "page": identifierCollisionsReportIdentifier})
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMungeIdentifier(t *testing.T) {
+	for text, expected := range map[string]string{
+		"Foo Bar":          "foo_bar",
+		"foo_bar":          "foo_bar",
+		"  Foo -- Bar!  ":  "foo_bar",
+		"Café Menu":        "café_menu",
+		"10mm Socket (x2)": "10mm_socket_x2",
+	} {
+		if munged := MungeIdentifier(text); munged != expected {
+			t.Errorf("MungeIdentifier(%q) = %q, expected %q", text, munged, expected)
+		}
+	}
+}
+
+func TestIdentifierCollisionOnCreate(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "foo_bar", "+++\ntitle = \"Foo Bar\"\n+++\n")
+
+	err := s.checkIdentifierCollision("foo-bar")
+	collision, ok := err.(*IdentifierCollisionError)
+	if !ok || collision.Existing != "foo_bar" || collision.Title != "Foo Bar" {
+		t.Fatalf("Expected a collision with foo_bar, got %v", err)
+	}
+	if err := s.checkIdentifierCollision("foo_bar"); err != nil {
+		t.Errorf("An existing page does not collide with itself: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/foo-bar/view", nil)
+	s.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "Foo Bar") {
+		t.Errorf("Expected a conflict naming Foo Bar, got %d %s", w.Code, w.Body.String())
+	}
+	if exists(s.pageFile("foo-bar", ".json")) {
+		t.Error("Should not have created the colliding page")
+	}
+}
+
+func TestFindIdentifierCollisions(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "foo_bar", "one")
+	newTestPage(s, "foo-bar", "two")
+	newTestPage(s, "baz", "three")
+
+	collisions := s.FindIdentifierCollisions()
+	if !reflect.DeepEqual(collisions, [][]string{{"foo-bar", "foo_bar"}}) {
+		t.Errorf("Unexpected collisions: %v", collisions)
+	}
+	if err := s.identifierCollisionsJob(&JobProgress{}); err != nil {
+		t.Fatal(err)
+	}
+	if text := s.Open(identifierCollisionsReportIdentifier).Text.GetCurrent(); !strings.Contains(text, "[foo-bar](/foo-bar/view)") {
+		t.Errorf("Expected the report to link the colliding pages: %s", text)
+	}
+}
+
+func TestGenerateIdentifiers(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "hammer", "+++\ntitle = \"Claw Hammer\"\n+++\n")
+	newTestPage(s, "cordless_drill", "+++\naliases = [\"drill\"]\n+++\n")
+
+	generated, err := s.GenerateIdentifiers([]string{"Tape Measure", "Hammer", "Drill", "tape-measure", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []GeneratedIdentifier{
+		{Text: "Tape Measure", Identifier: "tape_measure", IsUnique: true},
+		{Text: "Hammer", Identifier: "hammer", Existing: "hammer", ExistingTitle: "Claw Hammer"},
+		{Text: "Drill", Identifier: "drill", Existing: "cordless_drill", ExistingTitle: "cordless_drill"},
+		{Text: "tape-measure", Identifier: "tape_measure", ExistingTitle: "Tape Measure"},
+		{Text: ""},
+	}
+	if !reflect.DeepEqual(generated, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, generated)
+	}
+
+	if _, err := s.GenerateIdentifiers(make([]string, maxGenerateIdentifiersBatch+1)); err == nil {
+		t.Error("Expected too big a batch to be refused")
+	}
+}
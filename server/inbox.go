@@ -0,0 +1,147 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InboxItem is something sent to the inbox by another system: markdown for a
+// new page, or to append to the AppendTo page.
+type InboxItem struct {
+	Identifier string   `json:"identifier"`
+	Title      string   `json:"title"`
+	Markdown   string   `json:"markdown"`
+	Tags       []string `json:"tags"`
+	AppendTo   string   `json:"append_to"`
+}
+
+// inboxToken checks the request's X-Inbox-Token header, or its bearer token,
+// against InboxTokens. With an access code set, the access code check slows
+// every request with an Authorization header, so X-Inbox-Token is better.
+func (s *Site) inboxToken(c *gin.Context) bool {
+	token := c.GetHeader("X-Inbox-Token")
+	if token == "" {
+		token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	for _, allowed := range s.InboxTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(allowed)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Inbox creates a page from the item, or appends it to its AppendTo page
+// under a heading with the time, creating that page if need be. It returns
+// the identifier of the page written.
+func (s *Site) Inbox(item InboxItem, now time.Time) (string, error) {
+	if strings.TrimSpace(item.Markdown) == "" {
+		return "", errors.New("nothing to add")
+	}
+	markdown := escapeTemplates(strings.TrimSpace(item.Markdown))
+
+	if item.AppendTo != "" {
+		s.inboxMut.Lock()
+		defer s.inboxMut.Unlock()
+		identifier := strings.ToLower(strings.TrimSpace(item.AppendTo))
+		p := s.Open(identifier)
+		text := p.Text.GetCurrent()
+		if p.IsNew() {
+			if err := s.checkIdentifierCollision(identifier); err != nil {
+				return "", err
+			}
+			p.Identifier = identifier
+			matter := map[string]interface{}{"identifier": identifier}
+			if item.Title != "" {
+				matter["title"] = item.Title
+			}
+			var err error
+			if text, err = JoinFrontmatter(matter, "\n", false); err != nil {
+				return "", err
+			}
+		}
+		heading := now.Format("2006-01-02 15:04:05")
+		if item.Title != "" && !p.IsNew() {
+			heading += " " + item.Title
+		}
+		return p.Identifier, p.Update(strings.TrimRight(text, "\n") + "\n\n## " + heading + "\n\n" + markdown + "\n")
+	}
+
+	identifier := strings.ToLower(strings.TrimSpace(item.Identifier))
+	if identifier == "" && item.Title != "" {
+		identifier = s.GenerateIdentifier(item.Title).Identifier
+	}
+	if identifier == "" {
+		identifier = "inbox_" + now.Format("20060102_150405")
+	}
+	page := ImportedPage{Identifier: identifier, Title: item.Title, Tags: item.Tags, Markdown: item.Markdown}
+	if err := s.writeImportedPage(page); err != nil {
+		return "", err
+	}
+	return identifier, nil
+}
+
+// handleInbox takes a JSON InboxItem, or any other JSON, which is added as a
+// code block, or markdown with the rest of the item in the query string.
+func (s *Site) handleInbox(c *gin.Context) {
+	if len(s.InboxTokens) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "The inbox is turned off"})
+		return
+	}
+	if !s.inboxToken(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Needs an inbox token"})
+		return
+	}
+	reader := c.Request.Body
+	if limit := s.Settings().MaxDocumentSize; limit > 0 {
+		reader = http.MaxBytesReader(c.Writer, reader, int64(limit))
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	item := InboxItem{
+		Identifier: c.Query("identifier"),
+		Title:      c.Query("title"),
+		AppendTo:   c.Query("append_to"),
+		Tags:       c.QueryArray("tag"),
+		Markdown:   string(body),
+	}
+	if strings.HasPrefix(c.ContentType(), "application/json") {
+		var payload map[string]interface{}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Wrong JSON"})
+			return
+		}
+		if _, ok := payload["markdown"]; ok {
+			item = InboxItem{}
+			if err := json.Unmarshal(body, &item); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Wrong JSON"})
+				return
+			}
+		} else {
+			pretty, _ := json.MarshalIndent(payload, "", "  ")
+			item.Markdown = "```json\n" + string(pretty) + "\n```"
+		}
+	}
+
+	identifier, err := s.Inbox(item, time.Now())
+	if collision, ok := err.(*IdentifierCollisionError); ok {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": collision.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "identifier": identifier, "message": "Added to " + identifier})
+}
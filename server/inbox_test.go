@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+)
+
+func TestInbox(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), SessionStore: cookie.NewStore([]byte("secret")), SecretCode: "letmein", InboxTokens: []string{"t0ken"}}
+	router := s.Router()
+	post := func(token, contentType, query, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/inbox"+query, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if token != "" {
+			req.Header.Set("X-Inbox-Token", token)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post("wrong", "text/markdown", "", "hi"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong token to be refused, got %d", w.Code)
+	}
+
+	if w := post("t0ken", "application/json", "", `{"title": "Furnace Manual", "markdown": "Change the filter.", "tags": ["hvac"]}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected the page to be created, got %d %s", w.Code, w.Body.String())
+	}
+	matter, err := s.ReadFrontMatter("furnace_manual")
+	if err != nil || matter["title"] != "Furnace Manual" {
+		t.Errorf("Expected a page named from its title, got %v %v", matter, err)
+	}
+	if w := post("t0ken", "application/json", "", `{"title": "Furnace Manual", "markdown": "again"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a second page with the same identifier to be refused, got %d", w.Code)
+	}
+
+	post("t0ken", "text/markdown", "?append_to=door_log", "Front door opened")
+	post("t0ken", "application/json", "?append_to=door_log", `{"door": "back", "state": "open"}`)
+	text := s.Open("door_log").Text.GetCurrent()
+	if !strings.Contains(text, "Front door opened") || !strings.Contains(text, "```json") || strings.Count(text, "\n## ") != 2 {
+		t.Errorf("Expected both events appended under their own headings, got %s", text)
+	}
+}
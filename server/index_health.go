@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IndexHealth describes one of the wiki's in-memory indexes. An index that
+// hasn't been needed yet isn't Built.
+type IndexHealth struct {
+	Index               string        `json:"index"`
+	Built               bool          `json:"built"`
+	Entries             int           `json:"entries"`
+	LastRebuild         time.Time     `json:"last_rebuild"`
+	LastRebuildDuration time.Duration `json:"last_rebuild_duration"`
+	// Pending are the pages saved but not yet reindexed.
+	Pending int `json:"pending"`
+}
+
+// IndexHealth reports on every index.
+func (s *Site) IndexHealth() []IndexHealth {
+	s.aliasesMut.Lock()
+	aliases := IndexHealth{
+		Index:               "aliases",
+		Built:               s.aliases != nil,
+		Entries:             len(s.aliases),
+		LastRebuild:         s.aliasesBuilt,
+		LastRebuildDuration: s.aliasesBuildTook,
+	}
+	s.aliasesMut.Unlock()
+
+	s.searchIndexMut.Lock()
+	defer s.searchIndexMut.Unlock()
+	search := IndexHealth{Index: "search", Built: s.searchDocs != nil}
+	if s.searchDocs != nil {
+		search.Entries = len(s.searchDocs.documents)
+		search.Pending = len(s.searchDocs.pending)
+		search.LastRebuild = s.searchDocs.built
+		search.LastRebuildDuration = s.searchDocs.buildTook
+	}
+	return []IndexHealth{aliases, search}
+}
+
+func (s *Site) handleIndexHealth(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "pages": len(s.PageIdentifiers()), "indexes": s.IndexHealth()})
+}
@@ -0,0 +1,31 @@
+package server
+
+import "testing"
+
+func TestIndexHealth(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	if health := s.IndexHealth(); len(health) != 2 || health[0].Built || health[1].Built {
+		t.Errorf("Expected the indexes not to be built yet: %+v", health)
+	}
+
+	newTestPage(s, "cordless_drill", "+++\naliases = [\"drill\", \"makita\"]\n+++\n")
+	health := s.IndexHealth()[0]
+	if !health.Built || health.Entries != 2 || health.LastRebuild.IsZero() {
+		t.Errorf("Expected the alias index to be built with 2 entries: %+v", health)
+	}
+	if summaries := s.metrics().LatencySummaries(); len(summaries) != 1 || summaries[0].Name != "wiki_index_rebuild_duration_seconds" {
+		t.Errorf("Expected the rebuild to be timed: %+v", summaries)
+	}
+
+	s.SearchPages("drill", 10)
+	newTestPage(s, "hammer", "# Hammer")
+	if search := s.IndexHealth()[1]; !search.Built || search.Entries != 1 || search.Pending != 1 {
+		t.Errorf("Expected the saved page to wait to be reindexed: %+v", search)
+	}
+	if results := s.SearchPages("hammer", 10); len(results) != 1 || results[0].Identifier != "hammer" {
+		t.Errorf("Expected a search to reindex the saved page first: %+v", results)
+	}
+	if search := s.IndexHealth()[1]; search.Entries != 2 || search.Pending != 0 {
+		t.Errorf("Expected the search index to be caught up: %+v", search)
+	}
+}
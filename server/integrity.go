@@ -0,0 +1,205 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adrg/frontmatter"
+	"github.com/gin-gonic/gin"
+)
+
+const integrityReportIdentifier = "integrity_report"
+
+// quarantineDir is the folder in the data folder corrupt page files are
+// moved to, under their own names, so they can be looked at and put back.
+const quarantineDir = "quarantine"
+
+// IntegrityProblem is something wrong with a page file. Quarantined files
+// were moved to quarantineDir, Repaired ones were rewritten.
+type IntegrityProblem struct {
+	File        string `json:"file"`
+	Identifier  string `json:"identifier,omitempty"`
+	Problem     string `json:"problem"`
+	Quarantined bool   `json:"quarantined,omitempty"`
+	Repaired    bool   `json:"repaired,omitempty"`
+}
+
+// IntegrityReport is what CheckIntegrity found.
+type IntegrityReport struct {
+	CheckedAt time.Time          `json:"checked_at"`
+	Pages     int                `json:"pages"`
+	Files     int                `json:"files"`
+	Problems  []IntegrityProblem `json:"problems"`
+}
+
+// CheckIntegrity checks every page file: that its name decodes from base32,
+// that its .json history decodes, that its markdown's frontmatter parses and
+// that it has both a .json and a .md file. With repair, corrupt files and
+// files with no page are quarantined, and a missing .md is rewritten from
+// the history. Frontmatter that doesn't parse is only reported; it's fixed
+// by editing the page.
+func (s *Site) CheckIntegrity(repair bool) (IntegrityReport, error) {
+	report := IntegrityReport{CheckedAt: time.Now(), Problems: []IntegrityProblem{}}
+	names, err := s.store().List("")
+	if err != nil {
+		return report, err
+	}
+	files := map[string]bool{}
+	for _, name := range names {
+		files[name] = true
+	}
+
+	problem := func(file, identifier, format string, args ...interface{}) *IntegrityProblem {
+		report.Problems = append(report.Problems, IntegrityProblem{File: file, Identifier: identifier, Problem: fmt.Sprintf(format, args...)})
+		return &report.Problems[len(report.Problems)-1]
+	}
+	quarantine := func(found *IntegrityProblem) {
+		if !repair {
+			return
+		}
+		if err := moveKey(s.store(), found.File, quarantineDir+"/"+found.File); err != nil {
+			found.Problem += fmt.Sprintf("; could not quarantine it: %v", err)
+			return
+		}
+		found.Quarantined = true
+	}
+
+	// histories first, so a page's other files know if it is readable
+	sort.Slice(names, func(i, j int) bool {
+		if iJSON, jJSON := strings.HasSuffix(names[i], ".json"), strings.HasSuffix(names[j], ".json"); iJSON != jJSON {
+			return iJSON
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		extension := ""
+		for _, candidate := range trashedExtensions {
+			if strings.HasSuffix(name, candidate) {
+				extension = candidate
+			}
+		}
+		if extension == "" {
+			continue // not a page file
+		}
+		report.Files++
+		encoded := strings.TrimSuffix(name, extension)
+		identifier, err := decodeFromBase32(encoded)
+		if err != nil || identifier == "" || encodeToBase32(identifier) != encoded {
+			quarantine(problem(name, "", "the file name isn't a base32 page identifier"))
+			continue
+		}
+
+		switch extension {
+		case ".json":
+			report.Pages++
+			data, err := s.readPageFile(identifier, ".json")
+			var p Page
+			if err == nil {
+				err = json.Unmarshal(data, &p)
+			}
+			if err != nil {
+				quarantine(problem(name, identifier, "the history doesn't decode: %v", err))
+				files[name] = false // its other files go with it
+				continue
+			}
+			if files[encoded+".md"] {
+				continue
+			}
+			found := problem(name, identifier, "there is no markdown file")
+			if repair {
+				if err := s.writePageFile(identifier, ".md", []byte(p.Text.GetCurrent())); err != nil {
+					found.Problem += fmt.Sprintf("; could not rewrite it: %v", err)
+				} else {
+					found.Repaired = true
+				}
+			}
+		case ".md":
+			if !files[encoded+".json"] {
+				quarantine(problem(name, identifier, "there is markdown but no readable page history"))
+				continue
+			}
+			data, err := s.readPageFile(identifier, ".md")
+			if err != nil {
+				quarantine(problem(name, identifier, "the markdown can't be read: %v", err))
+				continue
+			}
+			matter := map[string]interface{}{}
+			if _, err := frontmatter.Parse(bytes.NewReader(data), &matter); err != nil {
+				problem(name, identifier, "the frontmatter doesn't parse: %v", err)
+			}
+		case ".annotations":
+			if !files[encoded+".json"] {
+				quarantine(problem(name, identifier, "there are annotations but no readable page history"))
+			}
+		}
+	}
+	if repair && len(report.Problems) > 0 {
+		s.invalidateSearchIndex()
+	}
+	return report, nil
+}
+
+const integrityReportTemplate = `+++
+identifier = "` + integrityReportIdentifier + `"
+title = "Integrity Report"
++++
+
+# Integrity Report
+
+_Checked %s: %d pages in %d files. Edits here will be overwritten._
+
+%s`
+
+// RefreshIntegrityReport writes the report to the Integrity Report page,
+// if there are problems or the page is already there to be updated.
+func (s *Site) RefreshIntegrityReport(report IntegrityReport) error {
+	if len(report.Problems) == 0 && !s.hasPageFile(integrityReportIdentifier, ".json") {
+		return nil
+	}
+	problems := "No problems found.\n"
+	if len(report.Problems) > 0 {
+		problems = "| File | Page | Problem | Done |\n| --- | --- | --- | --- |\n"
+		for _, found := range report.Problems {
+			done := ""
+			if found.Quarantined {
+				done = "moved to " + quarantineDir + "/"
+			} else if found.Repaired {
+				done = "repaired"
+			}
+			page := found.Identifier
+			if page != "" && !found.Quarantined {
+				page = "[" + page + "](/" + page + "/view)"
+			}
+			problems += fmt.Sprintf("| `%s` | %s | %s | %s |\n", found.File, page, strings.ReplaceAll(found.Problem, "|", "\\|"), done)
+		}
+	}
+	text := fmt.Sprintf(integrityReportTemplate, report.CheckedAt.Format("Mon Jan 2 15:04:05 MST 2006"), report.Pages, report.Files, problems)
+	return s.Open(integrityReportIdentifier).Update(text)
+}
+
+func (s *Site) handleCheckIntegrity(c *gin.Context) {
+	type QueryJSON struct {
+		Repair bool `json:"repair"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	report, err := s.CheckIntegrity(json.Repair)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if err := s.RefreshIntegrityReport(report); err != nil {
+		s.Logger.Error("Could not write the integrity report: %v", err)
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "report": report})
+}
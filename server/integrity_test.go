@@ -0,0 +1,68 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/jcelliott/lumber"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	newTestPage(s, "drill", "# Drill")
+	newTestPage(s, "saw", "# Saw")
+	newTestPage(s, "broken_matter", "# Oops")
+	ioutil.WriteFile(s.pageFile("broken_matter", ".md"), []byte("+++\ntitle = \n+++\n# Oops"), 0644)
+	os.Remove(s.pageFile("saw", ".md"))
+	ioutil.WriteFile(s.pageFile("hammer", ".json"), []byte("{not json"), 0644)
+	ioutil.WriteFile(s.pageFile("hammer", ".md"), []byte("# Hammer"), 0644)
+	ioutil.WriteFile(s.pageFile("orphan", ".md"), []byte("# Orphan"), 0644)
+	ioutil.WriteFile(path.Join(s.PathToData, "not-base32!.json"), []byte("{}"), 0644)
+
+	report, err := s.CheckIntegrity(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems := map[string]IntegrityProblem{}
+	for _, found := range report.Problems {
+		problems[found.File] = found
+	}
+	for _, file := range []string{pageKey("saw", ".json"), pageKey("hammer", ".json"), pageKey("hammer", ".md"), pageKey("orphan", ".md"), "not-base32!.json", pageKey("broken_matter", ".md")} {
+		if _, ok := problems[file]; !ok {
+			t.Errorf("Expected a problem with %s, got %+v", file, report.Problems)
+		}
+	}
+	if len(report.Problems) != 6 || problems[pageKey("hammer", ".json")].Quarantined || !exists(s.pageFile("orphan", ".md")) {
+		t.Errorf("Expected only reports without repair, got %+v", report.Problems)
+	}
+
+	report, err = s.CheckIntegrity(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists(s.pageFile("hammer", ".json")) || exists(s.pageFile("hammer", ".md")) || !exists(path.Join(s.PathToData, quarantineDir, pageKey("hammer", ".json"))) {
+		t.Error("Expected the corrupt page quarantined")
+	}
+	if exists(s.pageFile("orphan", ".md")) || exists(path.Join(s.PathToData, "not-base32!.json")) {
+		t.Error("Expected the files without pages quarantined")
+	}
+	if got := s.Open("saw").Text.GetCurrent(); got != "# Saw" || !exists(s.pageFile("saw", ".md")) {
+		t.Errorf("Expected the markdown rewritten, got %q", got)
+	}
+	if !exists(s.pageFile("broken_matter", ".md")) || s.Open("drill").Text.GetCurrent() != "# Drill" {
+		t.Error("Expected good pages and bad frontmatter left alone")
+	}
+
+	if err := s.RefreshIntegrityReport(report); err != nil {
+		t.Fatal(err)
+	}
+	if text := s.Open(integrityReportIdentifier).Text.GetCurrent(); !strings.Contains(text, "moved to quarantine/") || !strings.Contains(text, "repaired") {
+		t.Errorf("Unexpected report %s", text)
+	}
+	if report, _ := s.CheckIntegrity(true); len(report.Problems) != 1 {
+		t.Errorf("Expected only the frontmatter left to fix, got %+v", report.Problems)
+	}
+}
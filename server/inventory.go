@@ -0,0 +1,408 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LowStockItem is an inventory item whose quantity has fallen below its
+// min_quantity.
+type LowStockItem struct {
+	Identifier  string  `json:"identifier"`
+	Quantity    float64 `json:"quantity"`
+	MinQuantity float64 `json:"min_quantity"`
+	Unit        string  `json:"unit"`
+	Store       string  `json:"store"`
+}
+
+// AdjustQuantity changes inventory.quantity on the page by delta and returns
+// the new quantity. Quantities never go below zero.
+func (p *Page) AdjustQuantity(delta float64) (float64, error) {
+	var quantity float64
+	err := p.UpdateFrontmatter(func(matter map[string]interface{}) error {
+		inventory, _ := frontmatterTable(matter, "inventory", true)
+		current, _ := frontmatterNumber(inventory["quantity"])
+		quantity = current + delta
+		if quantity < 0 {
+			return errors.New("quantity can't go below zero")
+		}
+		inventory["quantity"] = frontmatterNumberValue(quantity)
+		return nil
+	})
+	return quantity, err
+}
+
+// LowStockItems finds every inventory item with a min_quantity whose quantity
+// is below it.
+func (s *Site) LowStockItems() []LowStockItem {
+	items := []LowStockItem{}
+	s.EachFrontmatter(func(identifier string, matter map[string]interface{}) {
+		inventory, ok := frontmatterTable(matter, "inventory", false)
+		if !ok {
+			return
+		}
+		minQuantity, ok := frontmatterNumber(inventory["min_quantity"])
+		if !ok {
+			return
+		}
+		quantity, _ := frontmatterNumber(inventory["quantity"])
+		if quantity >= minQuantity {
+			return
+		}
+		items = append(items, LowStockItem{
+			Identifier:  identifier,
+			Quantity:    quantity,
+			MinQuantity: minQuantity,
+			Unit:        frontmatterString(inventory["unit"]),
+			Store:       frontmatterString(inventory["store"]),
+		})
+	})
+	sort.Slice(items, func(i, j int) bool { return items[i].Identifier < items[j].Identifier })
+	return items
+}
+
+func BuildShowLowStock(site *Site) func() string {
+	linkTo := BuildLinkTo(site)
+	return func() string {
+		tmplString := `{{range .}}
+  - {{LinkTo .Identifier}}: {{FormatQuantity .Quantity}} of {{FormatQuantity .MinQuantity}} {{.Unit}}
+{{else}}
+	Nothing is low on stock
+{{end}}
+`
+		funcs := template.FuncMap{
+			"LinkTo":         linkTo,
+			"FormatQuantity": formatQuantity,
+		}
+
+		tmpl, err := template.New("content").Funcs(funcs).Parse(tmplString)
+		if err != nil {
+			return err.Error()
+		}
+
+		buf := &bytes.Buffer{}
+		err = tmpl.Execute(buf, site.LowStockItems())
+		if err != nil {
+			return err.Error()
+		}
+
+		return buf.String()
+	}
+}
+
+func formatQuantity(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+func (s *Site) handleAdjustQuantity(c *gin.Context) {
+	type QueryJSON struct {
+		Page  string  `json:"page"`
+		Delta float64 `json:"delta"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	p, ok := s.openInventoryItem(c, json.Page)
+	if !ok {
+		return
+	}
+	quantity, err := p.AdjustQuantity(json.Delta)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": fmt.Sprintf("Quantity is now %s", formatQuantity(quantity)), "quantity": quantity})
+}
+
+func (s *Site) handleLowStock(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "items": s.LowStockItems()})
+}
+
+const loanDateLayout = "2006-01-02"
+
+// Loan records who has borrowed an inventory item and when it is due back.
+type Loan struct {
+	Identifier   string `json:"identifier"`
+	Borrower     string `json:"borrower"`
+	CheckedOutAt string `json:"checked_out_at"`
+	DueBack      string `json:"due_back"`
+}
+
+// CheckOut records a loan of the item in inventory.loan. dueBack is optional
+// and, when given, must be a YYYY-MM-DD date.
+func (p *Page) CheckOut(borrower, dueBack string, now time.Time) error {
+	if borrower == "" {
+		return errors.New("must say who is borrowing it")
+	}
+	if dueBack != "" {
+		if _, err := time.Parse(loanDateLayout, dueBack); err != nil {
+			return fmt.Errorf("due back date must look like %s", loanDateLayout)
+		}
+	}
+	return p.UpdateFrontmatter(func(matter map[string]interface{}) error {
+		inventory, _ := frontmatterTable(matter, "inventory", true)
+		if loan, ok := frontmatterTable(inventory, "loan", false); ok {
+			return fmt.Errorf("already checked out by %s", frontmatterString(loan["borrower"]))
+		}
+		loan := map[string]interface{}{
+			"borrower":       borrower,
+			"checked_out_at": now.Format(time.RFC3339),
+		}
+		if dueBack != "" {
+			loan["due_back"] = dueBack
+		}
+		inventory["loan"] = loan
+		return nil
+	})
+}
+
+// CheckIn clears the loan recorded by CheckOut.
+func (p *Page) CheckIn() error {
+	return p.UpdateFrontmatter(func(matter map[string]interface{}) error {
+		inventory, _ := frontmatterTable(matter, "inventory", false)
+		if _, ok := frontmatterTable(inventory, "loan", false); !ok {
+			return errors.New("not checked out")
+		}
+		delete(inventory, "loan")
+		return nil
+	})
+}
+
+// OverdueLoans finds every loan whose due back date is before today.
+func (s *Site) OverdueLoans(now time.Time) []Loan {
+	today := now.Format(loanDateLayout)
+	loans := []Loan{}
+	s.EachFrontmatter(func(identifier string, matter map[string]interface{}) {
+		inventory, ok := frontmatterTable(matter, "inventory", false)
+		if !ok {
+			return
+		}
+		loan, ok := frontmatterTable(inventory, "loan", false)
+		if !ok {
+			return
+		}
+		dueBack := frontmatterString(loan["due_back"])
+		// YYYY-MM-DD sorts the same as the dates it represents.
+		if dueBack == "" || dueBack >= today {
+			return
+		}
+		loans = append(loans, Loan{
+			Identifier:   identifier,
+			Borrower:     frontmatterString(loan["borrower"]),
+			CheckedOutAt: frontmatterString(loan["checked_out_at"]),
+			DueBack:      dueBack,
+		})
+	})
+	sort.Slice(loans, func(i, j int) bool { return loans[i].DueBack < loans[j].DueBack })
+	return loans
+}
+
+func BuildShowOverdueLoans(site *Site) func() string {
+	linkTo := BuildLinkTo(site)
+	return func() string {
+		tmplString := `{{range .}}
+  - {{LinkTo .Identifier}}: borrowed by {{.Borrower}}, due back {{.DueBack}}
+{{else}}
+	Nothing is overdue
+{{end}}
+`
+		funcs := template.FuncMap{
+			"LinkTo": linkTo,
+		}
+
+		tmpl, err := template.New("content").Funcs(funcs).Parse(tmplString)
+		if err != nil {
+			return err.Error()
+		}
+
+		buf := &bytes.Buffer{}
+		err = tmpl.Execute(buf, site.OverdueLoans(time.Now()))
+		if err != nil {
+			return err.Error()
+		}
+
+		return buf.String()
+	}
+}
+
+func (s *Site) handleCheckOut(c *gin.Context) {
+	type QueryJSON struct {
+		Page     string `json:"page"`
+		Borrower string `json:"borrower"`
+		DueBack  string `json:"due_back"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	p, ok := s.openInventoryItem(c, json.Page)
+	if !ok {
+		return
+	}
+	// whoever is known to be asking is the borrower; the one in the body is
+	// only for wikis that can't tell who people are
+	borrower := requestIdentity(c)
+	if borrower == "" {
+		borrower = json.Borrower
+	}
+	if err := p.CheckOut(borrower, json.DueBack, time.Now()); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Checked out to " + borrower})
+}
+
+func (s *Site) handleCheckIn(c *gin.Context) {
+	type QueryJSON struct {
+		Page string `json:"page"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	p, ok := s.openInventoryItem(c, json.Page)
+	if !ok {
+		return
+	}
+	if err := p.CheckIn(); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Checked in"})
+}
+
+func (s *Site) handleOverdueLoans(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "loans": s.OverdueLoans(time.Now())})
+}
+
+// openInventoryItem opens an existing, unlocked page for one of the inventory
+// mutations, answering the request itself when that isn't possible.
+func (s *Site) openInventoryItem(c *gin.Context, page string) (*Page, bool) {
+	if len(page) == 0 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Must specify `page`"})
+		return nil, false
+	}
+	p := s.Open(page)
+	if p.IsNew() {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": page + " not found"})
+		return nil, false
+	}
+	if pageIsLocked(p, c) {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Locked, must unlock first"})
+		return nil, false
+	}
+	return p, true
+}
+
+// ContainerSummary describes what is inside an inventory container.
+type ContainerSummary struct {
+	Identifier      string   `json:"identifier"`
+	LocationHint    string   `json:"location_hint"`
+	Photo           string   `json:"photo"`
+	ItemCount       int      `json:"item_count"`
+	Children        []string `json:"children"`
+	DescendantCount int      `json:"descendant_count"`
+}
+
+// ContainerSummary counts the items directly in the container and everything
+// nested inside them. Containers that (wrongly) contain themselves are only
+// counted once. Counting reads a page for each container nested inside, so
+// it stops, returning ctx's error, once ctx is done.
+func (s *Site) ContainerSummary(ctx context.Context, identifier string) (*ContainerSummary, error) {
+	identifier = strings.ToLower(identifier)
+	matter, err := s.ReadFrontMatter(identifier)
+	if err != nil {
+		return nil, err
+	}
+	normalizeFrontmatter(matter)
+	inventory, _ := frontmatterTable(matter, "inventory", false)
+
+	summary := &ContainerSummary{
+		Identifier:   identifier,
+		LocationHint: frontmatterString(inventory["location_hint"]),
+		Photo:        frontmatterString(inventory["photo"]),
+		Children:     s.containerItems(identifier),
+	}
+	summary.ItemCount = len(summary.Children)
+
+	seen := map[string]bool{identifier: true}
+	var countDescendants func(container string)
+	countDescendants = func(container string) {
+		if ctx.Err() != nil {
+			return
+		}
+		for _, item := range s.containerItems(container) {
+			if seen[item] {
+				continue
+			}
+			seen[item] = true
+			summary.DescendantCount++
+			countDescendants(item)
+		}
+	}
+	countDescendants(identifier)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+func (s *Site) containerItems(container string) []string {
+	items := []string{}
+	matter, err := s.ReadFrontMatter(container)
+	if err != nil {
+		return items
+	}
+	normalizeFrontmatter(matter)
+	inventory, _ := frontmatterTable(matter, "inventory", false)
+	list, _ := inventory["items"].([]interface{})
+	for _, item := range list {
+		if item := strings.ToLower(frontmatterString(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (s *Site) handleContainerSummary(c *gin.Context) {
+	type QueryJSON struct {
+		Page string `json:"page"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	summary, err := s.ContainerSummary(c.Request.Context(), json.Page)
+	if err != nil {
+		message := json.Page + " not found"
+		if c.Request.Context().Err() != nil {
+			message = err.Error()
+		}
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": message})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "summary": summary})
+}
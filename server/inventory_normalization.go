@@ -0,0 +1,165 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InventoryFinding is one problem the inventory normalization found, whether
+// it can be fixed automatically, and whether it was.
+type InventoryFinding struct {
+	Page    string `json:"page"`
+	Problem string `json:"problem"`
+	Fixable bool   `json:"fixable"`
+	Fixed   bool   `json:"fixed"`
+}
+
+type inventoryEntry struct {
+	container string
+	items     []string
+}
+
+// NormalizeInventory makes the two halves of the inventory agree: a container
+// listing an item in inventory.items, and the item naming the container in
+// inventory.container. Missing halves are filled in; conflicts and dangling
+// references are only reported. An item two containers list, that doesn't
+// name one, is put in the first by identifier. With dryRun nothing is
+// written.
+func (s *Site) NormalizeInventory(dryRun bool) []InventoryFinding {
+	entries := map[string]inventoryEntry{}
+	s.EachFrontmatter(func(identifier string, matter map[string]interface{}) {
+		inventory, ok := frontmatterTable(matter, "inventory", false)
+		if !ok {
+			return
+		}
+		entry := inventoryEntry{container: strings.ToLower(frontmatterString(inventory["container"]))}
+		if items, ok := inventory["items"].([]interface{}); ok {
+			for _, item := range items {
+				if item := strings.ToLower(frontmatterString(item)); item != "" {
+					entry.items = append(entry.items, item)
+				}
+			}
+		}
+		entries[identifier] = entry
+	})
+	// looked at in order, so that when two containers list an item that
+	// doesn't say where it is, the same one is chosen every time
+	identifiers := make([]string, 0, len(entries))
+	for identifier := range entries {
+		identifiers = append(identifiers, identifier)
+	}
+	sort.Strings(identifiers)
+
+	findings := []InventoryFinding{}
+	report := func(page, problem string, fix func() error) {
+		finding := InventoryFinding{Page: page, Problem: problem, Fixable: fix != nil}
+		if fix != nil && !dryRun {
+			if err := fix(); err != nil {
+				finding.Problem += " (fix failed: " + err.Error() + ")"
+			} else {
+				finding.Fixed = true
+			}
+		}
+		findings = append(findings, finding)
+	}
+
+	for _, container := range identifiers {
+		for _, item := range entries[container].items {
+			itemEntry, ok := entries[item]
+			switch {
+			case !s.pageExists(item):
+				report(container, "lists "+item+", which has no page", nil)
+			case !ok || itemEntry.container == "":
+				container, item := container, item
+				report(item, "is in "+container+" but doesn't say so", func() error {
+					return s.setInventoryContainer(item, container)
+				})
+				// so a second container listing the item is reported as a conflict
+				itemEntry.container = container
+				entries[item] = itemEntry
+			case itemEntry.container != container:
+				report(item, "is listed in "+container+" but says it is in "+itemEntry.container, nil)
+			}
+		}
+	}
+
+	for _, item := range identifiers {
+		entry := entries[item]
+		if entry.container == "" {
+			continue
+		}
+		containerEntry, ok := entries[entry.container]
+		switch {
+		case !s.pageExists(entry.container):
+			report(item, "says it is in "+entry.container+", which has no page", nil)
+		case !ok || !stringInSlice(item, containerEntry.items):
+			container, item := entry.container, item
+			report(container, "doesn't list "+item+", which says it is in there", func() error {
+				return s.addInventoryItem(container, item)
+			})
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Page < findings[j].Page })
+	return findings
+}
+
+func (s *Site) pageExists(identifier string) bool {
+	return !s.Open(identifier).IsNew()
+}
+
+func (s *Site) setInventoryContainer(item, container string) error {
+	return s.Open(item).UpdateFrontmatter(func(matter map[string]interface{}) error {
+		inventory, _ := frontmatterTable(matter, "inventory", true)
+		inventory["container"] = container
+		return nil
+	})
+}
+
+func (s *Site) addInventoryItem(container, item string) error {
+	return s.Open(container).UpdateFrontmatter(func(matter map[string]interface{}) error {
+		inventory, _ := frontmatterTable(matter, "inventory", true)
+		items, _ := inventory["items"].([]interface{})
+		inventory["items"] = append(items, item)
+		return nil
+	})
+}
+
+// ScheduleInventoryNormalization normalizes the inventory on the background
+// queue every interval until the process exits.
+func (s *Site) ScheduleInventoryNormalization(interval time.Duration) {
+	s.scheduleEvery(interval, "inventory normalization", s.inventoryNormalizationJob)
+}
+
+func (s *Site) inventoryNormalizationJob(progress *JobProgress) error {
+	started := time.Now()
+	findings := s.NormalizeInventory(false)
+	progress.SetTotal(len(findings))
+	for _, finding := range findings {
+		var err error
+		if !finding.Fixed {
+			err = errors.New(finding.Problem)
+		}
+		progress.Record(finding.Page+" "+finding.Problem, started, err)
+	}
+	return nil
+}
+
+func (s *Site) handleRunInventoryNormalization(c *gin.Context) {
+	type QueryJSON struct {
+		DryRun bool `json:"dry_run"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "dry_run": json.DryRun, "findings": s.NormalizeInventory(json.DryRun)})
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/jcelliott/lumber"
+	"github.com/schollz/versionedtext"
+)
+
+func newTestPage(s *Site, identifier, text string) *Page {
+	p := &Page{Site: s, Identifier: identifier}
+	p.Text = versionedtext.NewVersionedText("")
+	p.Update(text)
+	return p
+}
+
+func TestUpdateFrontmatterKeepsBody(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	p := newTestPage(s, "milk", "+++\nidentifier = \"milk\"\n+++\n\n# Milk\n")
+
+	err := p.UpdateFrontmatter(func(matter map[string]interface{}) error {
+		matter["title"] = "Whole Milk"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := p.Text.GetCurrent()
+	if !strings.Contains(text, `title = "Whole Milk"`) {
+		t.Errorf("Did not write title: %s", text)
+	}
+	if !strings.Contains(text, "# Milk") {
+		t.Errorf("Lost the body: %s", text)
+	}
+}
+
+func TestAdjustQuantity(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	p := newTestPage(s, "milk", "+++\nidentifier = \"milk\"\n[inventory]\nquantity = 2\n+++\n")
+
+	quantity, err := p.AdjustQuantity(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quantity != 1 {
+		t.Errorf("Expected 1, got %v", quantity)
+	}
+
+	_, err = p.AdjustQuantity(-5)
+	if err == nil {
+		t.Error("Should not allow quantity below zero")
+	}
+}
+
+func TestLowStockItems(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "milk", "+++\nidentifier = \"milk\"\n[inventory]\nquantity = 1\nmin_quantity = 2\nunit = \"gallon\"\n+++\n")
+	newTestPage(s, "eggs", "+++\nidentifier = \"eggs\"\n[inventory]\nquantity = 12\nmin_quantity = 6\n+++\n")
+	newTestPage(s, "hammer", "+++\nidentifier = \"hammer\"\n[inventory]\ncontainer = \"toolbox\"\n+++\n")
+
+	items := s.LowStockItems()
+	if len(items) != 1 {
+		t.Fatalf("Expected one low stock item, got %v", items)
+	}
+	if items[0].Identifier != "milk" || items[0].Unit != "gallon" {
+		t.Errorf("Unexpected low stock item: %v", items[0])
+	}
+}
+
+func TestCheckOutAndOverdueLoans(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	drill := newTestPage(s, "drill", "+++\nidentifier = \"drill\"\n[inventory]\ncontainer = \"garage\"\n+++\n")
+	now := time.Date(2022, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	if err := drill.CheckOut("alice", "2022-03-01", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := drill.CheckOut("bob", "", now); err == nil {
+		t.Error("Should not check out an item twice")
+	}
+
+	loans := s.OverdueLoans(now)
+	if len(loans) != 1 || loans[0].Borrower != "alice" {
+		t.Fatalf("Expected alice's loan to be overdue, got %v", loans)
+	}
+
+	if err := drill.CheckIn(); err != nil {
+		t.Fatal(err)
+	}
+	if loans := s.OverdueLoans(now); len(loans) != 0 {
+		t.Errorf("Expected no overdue loans after check in, got %v", loans)
+	}
+}
+
+func TestNormalizeInventoryIsDeterministic(t *testing.T) {
+	var first []InventoryFinding
+	for run := 0; run < 10; run++ {
+		s := &Site{PathToData: t.TempDir()}
+		newTestPage(s, "workbench", "+++\nidentifier = \"workbench\"\n[inventory]\nitems = [\"hammer\"]\n+++\n")
+		newTestPage(s, "toolbox", "+++\nidentifier = \"toolbox\"\n[inventory]\nitems = [\"hammer\"]\n+++\n")
+		newTestPage(s, "shed", "+++\nidentifier = \"shed\"\n[inventory]\nitems = [\"hammer\"]\n+++\n")
+		newTestPage(s, "hammer", "+++\nidentifier = \"hammer\"\n+++\n")
+
+		findings := s.NormalizeInventory(false)
+		matter, _ := s.ReadFrontMatter("hammer")
+		inventory, _ := frontmatterTable(matter, "inventory", false)
+		if container := frontmatterString(inventory["container"]); container != "shed" {
+			t.Fatalf("Expected the hammer put in the first container by name, got %q", container)
+		}
+		if first == nil {
+			first = findings
+			continue
+		}
+		if len(findings) != len(first) {
+			t.Fatalf("Expected every run to find the same, got %v then %v", first, findings)
+		}
+		for i := range findings {
+			if findings[i] != first[i] {
+				t.Fatalf("Expected every run to find the same, got %v then %v", first, findings)
+			}
+		}
+	}
+}
+
+func TestCheckOutBorrowerIsRequester(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), SessionStore: cookie.NewStore([]byte("secret")), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	newTestPage(s, "drill", "+++\nidentifier = \"drill\"\n[inventory]\ncontainer = \"garage\"\n+++\n")
+	newTestPage(s, "saw", "+++\nidentifier = \"saw\"\n[inventory]\ncontainer = \"garage\"\n+++\n")
+	router := s.Router()
+	checkOut := func(page, identity string) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/inventory/check_out", strings.NewReader(`{"page": "`+page+`", "borrower": "mallory", "due_back": "2000-01-01"}`))
+		if identity != "" {
+			req.Header.Set(defaultIdentityHeader, identity)
+		}
+		router.ServeHTTP(w, req)
+	}
+	checkOut("drill", "alice@example.com")
+	checkOut("saw", "")
+
+	borrowers := map[string]string{}
+	for _, loan := range s.OverdueLoans(time.Now()) {
+		borrowers[loan.Identifier] = loan.Borrower
+	}
+	if borrowers["drill"] != "alice@example.com" {
+		t.Errorf("Expected the drill lent to who asked for it, not who they said, got %v", borrowers)
+	}
+	if borrowers["saw"] != "mallory" {
+		t.Errorf("Expected the borrower given when nobody is known to be asking, got %v", borrowers)
+	}
+}
+
+func TestNormalizeInventory(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "toolbox", "+++\nidentifier = \"toolbox\"\n[inventory]\nitems = [\"hammer\"]\n+++\n")
+	newTestPage(s, "hammer", "+++\nidentifier = \"hammer\"\n+++\n")
+	newTestPage(s, "saw", "+++\nidentifier = \"saw\"\n[inventory]\ncontainer = \"toolbox\"\n+++\n")
+
+	findings := s.NormalizeInventory(true)
+	if len(findings) != 2 {
+		t.Fatalf("Expected two findings, got %v", findings)
+	}
+	for _, finding := range findings {
+		if finding.Fixed {
+			t.Errorf("Dry run should not fix anything: %v", finding)
+		}
+	}
+
+	s.NormalizeInventory(false)
+	if findings := s.NormalizeInventory(true); len(findings) != 0 {
+		t.Errorf("Expected nothing left to normalize, got %v", findings)
+	}
+}
+
+func TestContainerSummary(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "garage", "+++\nidentifier = \"garage\"\n[inventory]\nlocation_hint = \"behind the house\"\nitems = [\"toolbox\", \"bike\"]\n+++\n")
+	newTestPage(s, "toolbox", "+++\nidentifier = \"toolbox\"\n[inventory]\ncontainer = \"garage\"\nitems = [\"hammer\", \"saw\", \"garage\"]\n+++\n")
+
+	summary, err := s.ContainerSummary(context.Background(), "Garage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.ItemCount != 2 {
+		t.Errorf("Expected 2 direct items, got %d", summary.ItemCount)
+	}
+	if summary.DescendantCount != 4 {
+		t.Errorf("Expected 4 descendants, got %d", summary.DescendantCount)
+	}
+	if summary.LocationHint != "behind the house" {
+		t.Errorf("Did not read location hint: %q", summary.LocationHint)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.ContainerSummary(ctx, "garage"); err != context.Canceled {
+		t.Errorf("Expected counting to stop once the request is gone, got %v", err)
+	}
+}
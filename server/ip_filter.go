@@ -0,0 +1,119 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tailscaleNetworks are the addresses tailscale gives devices on a
+// tailnet, which "tailscale" stands for in an allow or deny list.
+var tailscaleNetworks = []string{"100.64.0.0/10", "fd7a:115c:a1e0::/48"}
+
+// parseNetworks parses the addresses given to a flag, each a CIDR like
+// 10.0.0.0/8, a single IP address, or tailscale for tailscaleNetworks.
+func parseNetworks(flag string, specs []string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if strings.ToLower(spec) == "tailscale" {
+			for _, cidr := range tailscaleNetworks {
+				_, network, _ := net.ParseCIDR(cidr)
+				networks = append(networks, network)
+			}
+			continue
+		}
+		if !strings.Contains(spec, "/") {
+			ip := net.ParseIP(spec)
+			if ip == nil {
+				return nil, fmt.Errorf("%s %q should be an IP address, a CIDR like 10.0.0.0/8, or tailscale", flag, spec)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			spec = fmt.Sprintf("%s/%d", ip, bits)
+		}
+		_, network, err := net.ParseCIDR(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s %q should be an IP address, a CIDR like 10.0.0.0/8, or tailscale", flag, spec)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// inNetworks is whether the address is in any of the networks.
+func inNetworks(ip net.IP, networks []*net.IPNet) bool {
+	for _, network := range networks {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP is the address the request came from: the peer, not whoever it
+// claims to be forwarded for, except over a unix socket; see forwardedFor.
+// It's nil if it isn't known.
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// IPFilter says which addresses can reach the wiki at all, for when it
+// listens on a LAN as well as a tailnet.
+type IPFilter struct {
+	// Allow are the only networks let in; empty for any not denied.
+	Allow []*net.IPNet
+	// Deny are networks kept out, even if they're allowed too.
+	Deny []*net.IPNet
+}
+
+// NewIPFilter parses --allow-ip and --deny-ip; see parseNetworks. It's nil,
+// letting everyone in, if both are empty.
+func NewIPFilter(allow, deny []string) (*IPFilter, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+	f := &IPFilter{}
+	var err error
+	if f.Allow, err = parseNetworks("allow-ip", allow); err != nil {
+		return nil, err
+	}
+	if f.Deny, err = parseNetworks("deny-ip", deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Allows is whether an address can reach the wiki.
+func (f *IPFilter) Allows(ip net.IP) bool {
+	if f == nil {
+		return true
+	}
+	if inNetworks(ip, f.Deny) {
+		return false
+	}
+	return len(f.Allow) == 0 || inNetworks(ip, f.Allow)
+}
+
+// filterIPs turns away requests from addresses the IPFilter doesn't allow,
+// before anything else is done with them. Requests over a unix socket the
+// proxy didn't give an address for are let through.
+func (s *Site) filterIPs(c *gin.Context) {
+	ip := remoteIP(c.Request)
+	if ip == nil && viaUnixSocket(c.Request) {
+		return
+	}
+	if !s.IPFilter.Allows(ip) {
+		s.metrics().Inc("wiki_ip_filtered_total")
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"success": false, "message": "This wiki can't be reached from your address"})
+	}
+}
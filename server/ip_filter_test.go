@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/jcelliott/lumber"
+)
+
+func TestIPFilter(t *testing.T) {
+	if f, err := NewIPFilter(nil, nil); f != nil || err != nil || !f.Allows(net.ParseIP("203.0.113.5")) {
+		t.Errorf("Expected no filter to let everyone in, got %v %v", f, err)
+	}
+	f, err := NewIPFilter([]string{"tailscale", "192.168.1.0/24"}, []string{"192.168.1.13"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for address, allowed := range map[string]bool{
+		"100.101.102.103":      true,
+		"fd7a:115c:a1e0::1234": true,
+		"192.168.1.20":         true,
+		"192.168.1.13":         false,
+		"192.168.2.20":         false,
+		"203.0.113.5":          false,
+		"::ffff:192.168.1.20":  true,
+	} {
+		if f.Allows(net.ParseIP(address)) != allowed {
+			t.Errorf("Expected %s allowed to be %v", address, allowed)
+		}
+	}
+	if f.Allows(nil) {
+		t.Errorf("Expected an unknown address to be kept out when only some are allowed")
+	}
+
+	if f, _ := NewIPFilter(nil, []string{"tailscale"}); f.Allows(net.ParseIP("100.64.0.1")) || !f.Allows(net.ParseIP("10.0.0.1")) {
+		t.Errorf("Expected only the tailnet to be denied")
+	}
+	for _, spec := range []string{"lan", "192.168.1.0/40"} {
+		if _, err := NewIPFilter([]string{spec}, nil); err == nil {
+			t.Errorf("Expected %q to be refused", spec)
+		}
+	}
+}
+
+func TestFilterIPs(t *testing.T) {
+	filter, _ := NewIPFilter([]string{"192.168.1.0/24"}, nil)
+	s := &Site{PathToData: t.TempDir(), IPFilter: filter, SessionStore: cookie.NewStore([]byte("secret")), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	router := s.Router()
+	get := func(remoteAddr, forwardedFor string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/static/css/default.css", nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := get("192.168.1.20:5000", ""); code != http.StatusOK {
+		t.Errorf("Expected an allowed address in, got %d", code)
+	}
+	if code := get("203.0.113.5:5000", "192.168.1.20"); code != http.StatusForbidden {
+		t.Errorf("Expected another address kept out whatever it says it's forwarded for, got %d", code)
+	}
+	if s.metrics().Counter("wiki_ip_filtered_total") != 1 {
+		t.Errorf("Expected the refusal counted")
+	}
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	// JobDeadLettered jobs failed every attempt and wait for RetryJob.
+	JobDeadLettered = "dead_lettered"
+)
+
+// JobRecord is the outcome of one unit of a job's work, e.g. one row of an
+// import.
+type JobRecord struct {
+	Record   string        `json:"record"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// JobProgress is how a running job reports what it has done so far.
+type JobProgress struct {
+	mu      sync.Mutex
+	trace   string
+	total   int
+	records []JobRecord
+}
+
+// Trace is the trace id of the request that started the job, if any.
+func (p *JobProgress) Trace() string {
+	return p.trace
+}
+
+// SetTotal says how many records the job expects to process.
+func (p *JobProgress) SetTotal(total int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total = total
+}
+
+// Record notes that record was processed, taking since how long ago it was
+// started, and failing with err if that isn't nil.
+func (p *JobProgress) Record(record string, started time.Time, err error) {
+	entry := JobRecord{Record: record, Duration: time.Since(started)}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.records = append(p.records, entry)
+}
+
+// JobDetails describes a single job and everything it has recorded.
+type JobDetails struct {
+	ID         string      `json:"id"`
+	Name       string      `json:"name"`
+	Queue      string      `json:"queue"`
+	Trace      string      `json:"trace,omitempty"`
+	State      string      `json:"state"`
+	Attempts   int         `json:"attempts"`
+	Error      string      `json:"error,omitempty"`
+	EnqueuedAt time.Time   `json:"enqueued_at"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt time.Time   `json:"finished_at"`
+	Total      int         `json:"total"`
+	Processed  int         `json:"processed"`
+	Failures   int         `json:"failures"`
+	Records    []JobRecord `json:"records"`
+}
+
+// Details looks up a pending, running, dead-lettered, or recently finished
+// job.
+func (c *JobQueueCoordinator) Details(id string) (*JobDetails, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	job, ok := c.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("no job %s", id)
+	}
+	return job.details(), nil
+}
+
+// details must be called with the coordinator's lock held.
+func (job *queuedJob) details() *JobDetails {
+	details := &JobDetails{
+		ID:         job.id,
+		Name:       job.name,
+		Queue:      job.queue,
+		Trace:      job.trace,
+		State:      job.state,
+		Attempts:   job.attempts,
+		EnqueuedAt: job.enqueuedAt,
+		StartedAt:  job.startedAt,
+		FinishedAt: job.finishedAt,
+	}
+	if job.err != nil {
+		details.Error = job.err.Error()
+	}
+
+	job.progress.mu.Lock()
+	defer job.progress.mu.Unlock()
+	details.Total = job.progress.total
+	details.Processed = len(job.progress.records)
+	details.Records = append([]JobRecord{}, job.progress.records...)
+	for _, record := range details.Records {
+		if record.Error != "" {
+			details.Failures++
+		}
+	}
+	return details
+}
+
+func (s *Site) handleJobDetails(c *gin.Context) {
+	type QueryJSON struct {
+		JobID string `json:"job_id"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	details, err := s.jobs().Details(json.JobID)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "job": details})
+}
@@ -0,0 +1,339 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	UserQueue       = "user"
+	BackgroundQueue = "background"
+)
+
+// QueueConfig describes one named job queue. When workers are scarce, queues
+// with a higher Priority get their jobs started first; Workers caps how many
+// of the queue's jobs run at once.
+type QueueConfig struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+	Workers  int    `json:"workers"`
+}
+
+// DefaultQueues lets things a person is waiting on jump ahead of upkeep.
+var DefaultQueues = []QueueConfig{
+	{Name: UserQueue, Priority: 10, Workers: 2},
+	{Name: BackgroundQueue, Priority: 0, Workers: 1},
+}
+
+// ParseQueueConfig parses a `name:priority:workers` queue description.
+func ParseQueueConfig(spec string) (QueueConfig, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 || parts[0] == "" {
+		return QueueConfig{}, fmt.Errorf("job queue %q should look like name:priority:workers", spec)
+	}
+	priority, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return QueueConfig{}, fmt.Errorf("job queue %q has a bad priority: %v", spec, err)
+	}
+	workers, err := strconv.Atoi(parts[2])
+	if err != nil || workers < 1 {
+		return QueueConfig{}, fmt.Errorf("job queue %q needs at least one worker", spec)
+	}
+	return QueueConfig{Name: parts[0], Priority: priority, Workers: workers}, nil
+}
+
+// QueueStatus is a snapshot of one queue.
+type QueueStatus struct {
+	QueueConfig
+	Pending   int `json:"pending"`
+	Running   int `json:"running"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+// JobFunc is the work a job does. It reports how far along it is through
+// progress.
+type JobFunc func(progress *JobProgress) error
+
+type queuedJob struct {
+	id         string
+	name       string
+	queue      string
+	trace      string
+	run        JobFunc
+	progress   *JobProgress
+	state      string
+	err        error
+	attempts   int
+	enqueuedAt time.Time
+	startedAt  time.Time
+	finishedAt time.Time
+}
+
+type jobQueue struct {
+	QueueConfig
+	pending   []*queuedJob
+	running   int
+	completed int
+	failed    int
+}
+
+// JobQueueCoordinator runs jobs in the background on named queues. At most
+// maxWorkers jobs run at once across all queues (0 for no limit). A job that
+// fails is retried until it has been tried maxAttempts times, then it is
+// dead-lettered: kept aside, and handed to onDeadLetter, until RetryJob.
+type JobQueueCoordinator struct {
+	mu           sync.Mutex
+	queues       map[string]*jobQueue
+	maxWorkers   int
+	maxAttempts  int
+	running      int
+	nextID       int
+	jobs         map[string]*queuedJob
+	finished     []string
+	deadLetters  []string
+	logger       func(format string, v ...interface{})
+	onDeadLetter func()
+	// onFinish is told about each job that succeeds or is dead-lettered.
+	onFinish func(*JobDetails)
+}
+
+// finishedJobsKept is how many finished jobs keep their details around.
+const finishedJobsKept = 100
+
+func NewJobQueueCoordinator(queues []QueueConfig, maxWorkers, maxAttempts int) *JobQueueCoordinator {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	c := &JobQueueCoordinator{
+		queues:       map[string]*jobQueue{},
+		maxWorkers:   maxWorkers,
+		maxAttempts:  maxAttempts,
+		jobs:         map[string]*queuedJob{},
+		logger:       func(string, ...interface{}) {},
+		onDeadLetter: func() {},
+		onFinish:     func(*JobDetails) {},
+	}
+	for _, q := range queues {
+		c.queues[q.Name] = &jobQueue{QueueConfig: q}
+	}
+	return c
+}
+
+// Enqueue adds a job to the named queue and returns its id.
+func (c *JobQueueCoordinator) Enqueue(queue, name string, run JobFunc) (string, error) {
+	return c.EnqueueTraced("", queue, name, run)
+}
+
+// EnqueueTraced is Enqueue for a job started by a request, which keeps the
+// request's trace id so the job's details and logs can be tied back to it.
+func (c *JobQueueCoordinator) EnqueueTraced(trace, queue, name string, run JobFunc) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	q, ok := c.queues[queue]
+	if !ok {
+		return "", fmt.Errorf("no job queue named %q", queue)
+	}
+	c.nextID++
+	job := &queuedJob{
+		id:         strconv.Itoa(c.nextID),
+		name:       name,
+		queue:      queue,
+		trace:      trace,
+		run:        run,
+		progress:   &JobProgress{trace: trace},
+		state:      JobPending,
+		enqueuedAt: time.Now(),
+	}
+	c.jobs[job.id] = job
+	q.pending = append(q.pending, job)
+	c.dispatch()
+	return job.id, nil
+}
+
+// dispatch starts as many pending jobs as the worker limits allow, highest
+// priority queues first. c.mu must be held.
+func (c *JobQueueCoordinator) dispatch() {
+	for _, q := range c.byPriority() {
+		for len(q.pending) > 0 && q.running < q.Workers && (c.maxWorkers == 0 || c.running < c.maxWorkers) {
+			job := q.pending[0]
+			q.pending = q.pending[1:]
+			q.running++
+			c.running++
+			job.state = JobRunning
+			job.attempts++
+			job.progress = &JobProgress{trace: job.trace}
+			job.startedAt = time.Now()
+			go c.execute(q, job)
+		}
+	}
+}
+
+// runJob runs a job, turning a panic into an error like any other failure,
+// so that a job that panics is retried and then dead-lettered rather than
+// taking the wiki down with it.
+func runJob(job *queuedJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panicked: %v", r)
+		}
+	}()
+	return job.run(job.progress)
+}
+
+func (c *JobQueueCoordinator) execute(q *jobQueue, job *queuedJob) {
+	err := runJob(job)
+
+	c.mu.Lock()
+	q.running--
+	c.running--
+	job.finishedAt = time.Now()
+	job.err = err
+	deadLettered := false
+	switch {
+	case err == nil:
+		job.state = JobSucceeded
+		q.completed++
+		c.finish(job)
+	case job.attempts < c.maxAttempts:
+		c.logger("Job %s (%s)%s failed, will retry: %s", job.id, job.name, traceSuffix(job.trace), err.Error())
+		job.state = JobPending
+		q.pending = append(q.pending, job)
+	default:
+		c.logger("Job %s (%s)%s failed %d times, giving up: %s", job.id, job.name, traceSuffix(job.trace), job.attempts, err.Error())
+		job.state = JobDeadLettered
+		q.failed++
+		c.deadLetters = append(c.deadLetters, job.id)
+		deadLettered = true
+	}
+	var details *JobDetails
+	if job.state != JobPending {
+		details = job.details()
+	}
+	c.dispatch()
+	c.mu.Unlock()
+
+	if deadLettered {
+		c.onDeadLetter()
+	}
+	if details != nil {
+		c.onFinish(details)
+	}
+}
+
+// finish keeps the details of the most recently finished jobs. c.mu must be
+// held.
+func (c *JobQueueCoordinator) finish(job *queuedJob) {
+	c.finished = append(c.finished, job.id)
+	if len(c.finished) > finishedJobsKept {
+		delete(c.jobs, c.finished[0])
+		c.finished = c.finished[1:]
+	}
+}
+
+// Retry puts a dead-lettered job back on its queue for another maxAttempts
+// tries.
+func (c *JobQueueCoordinator) Retry(id string) error {
+	c.mu.Lock()
+	job, ok := c.jobs[id]
+	if !ok || job.state != JobDeadLettered {
+		c.mu.Unlock()
+		return fmt.Errorf("job %s is not dead-lettered", id)
+	}
+	for i, deadID := range c.deadLetters {
+		if deadID == id {
+			c.deadLetters = append(c.deadLetters[:i], c.deadLetters[i+1:]...)
+			break
+		}
+	}
+	q := c.queues[job.queue]
+	q.failed--
+	job.attempts = 0
+	job.err = nil
+	job.state = JobPending
+	job.enqueuedAt = time.Now()
+	q.pending = append(q.pending, job)
+	c.dispatch()
+	c.mu.Unlock()
+
+	c.onDeadLetter()
+	return nil
+}
+
+func (c *JobQueueCoordinator) byPriority() []*jobQueue {
+	queues := make([]*jobQueue, 0, len(c.queues))
+	for _, q := range c.queues {
+		queues = append(queues, q)
+	}
+	sort.Slice(queues, func(i, j int) bool {
+		if queues[i].Priority != queues[j].Priority {
+			return queues[i].Priority > queues[j].Priority
+		}
+		return queues[i].Name < queues[j].Name
+	})
+	return queues
+}
+
+// Status reports on every queue, highest priority first.
+func (c *JobQueueCoordinator) Status() []QueueStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	statuses := []QueueStatus{}
+	for _, q := range c.byPriority() {
+		statuses = append(statuses, QueueStatus{
+			QueueConfig: q.QueueConfig,
+			Pending:     len(q.pending),
+			Running:     q.running,
+			Completed:   q.completed,
+			Failed:      q.failed,
+		})
+	}
+	return statuses
+}
+
+// jobs returns the site's coordinator, setting up the default queues the
+// first time it is needed.
+func (s *Site) jobs() *JobQueueCoordinator {
+	s.jobsOnce.Do(func() {
+		if s.Jobs == nil {
+			s.Jobs = NewJobQueueCoordinator(DefaultQueues, 0, 1)
+		}
+		if s.Logger != nil {
+			s.Jobs.logger = s.Logger.Error
+		}
+		s.Jobs.onDeadLetter = func() {
+			if err := s.writeDeadLetterReport(); err != nil && s.Logger != nil {
+				s.Logger.Error("Could not write the dead letter report: %s", err.Error())
+			}
+		}
+		s.Jobs.onFinish = func(details *JobDetails) {
+			s.webhooks().Publish(JobCompletedEvent, details)
+		}
+	})
+	return s.Jobs
+}
+
+// scheduleEvery enqueues a background job every interval until the process
+// exits.
+func (s *Site) scheduleEvery(interval time.Duration, name string, run JobFunc) {
+	go func() {
+		for range time.Tick(interval) {
+			if _, err := s.jobs().Enqueue(BackgroundQueue, name, run); err != nil {
+				s.Logger.Error("Could not schedule %s: %s", name, err.Error())
+			}
+		}
+	}()
+}
+
+func (s *Site) handleJobStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "queues": s.jobs().Status()})
+}
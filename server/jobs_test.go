@@ -0,0 +1,215 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseQueueConfig(t *testing.T) {
+	queue, err := ParseQueueConfig("imports:5:3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queue.Name != "imports" || queue.Priority != 5 || queue.Workers != 3 {
+		t.Errorf("Did not parse queue: %v", queue)
+	}
+
+	for _, bad := range []string{"imports", "imports:high:3", "imports:5:0", ":5:1"} {
+		if _, err := ParseQueueConfig(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestJobQueuePriority(t *testing.T) {
+	c := NewJobQueueCoordinator(DefaultQueues, 1, 1)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	c.Enqueue(BackgroundQueue, "blocker", func(*JobProgress) error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	wg.Add(2)
+	record := func(name string) JobFunc {
+		return func(*JobProgress) error {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			wg.Done()
+			return nil
+		}
+	}
+	c.Enqueue(BackgroundQueue, "reindex", record("reindex"))
+	c.Enqueue(UserQueue, "import", record("import"))
+
+	for _, status := range c.Status() {
+		if status.Name == BackgroundQueue && (status.Pending != 1 || status.Running != 1) {
+			t.Errorf("Expected one pending and one running background job: %v", status)
+		}
+	}
+
+	close(release)
+	wg.Wait()
+
+	if len(order) != 2 || order[0] != "import" {
+		t.Errorf("Expected the user queue to go first, got %v", order)
+	}
+}
+
+func TestEnqueueUnknownQueue(t *testing.T) {
+	c := NewJobQueueCoordinator(DefaultQueues, 0, 1)
+	if _, err := c.Enqueue("nope", "job", func(*JobProgress) error { return nil }); err == nil {
+		t.Error("Expected an error for an unknown queue")
+	}
+}
+
+func TestJobDetails(t *testing.T) {
+	c := NewJobQueueCoordinator(DefaultQueues, 0, 1)
+	done := make(chan struct{})
+	id, err := c.Enqueue(UserQueue, "import", func(progress *JobProgress) error {
+		defer close(done)
+		progress.SetTotal(2)
+		progress.Record("row 1", time.Now(), nil)
+		progress.Record("row 2", time.Now(), errors.New("missing identifier"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	var details *JobDetails
+	for i := 0; i < 100; i++ {
+		details, err = c.Details(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if details.State == JobSucceeded {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if details.State != JobSucceeded {
+		t.Fatalf("Expected the job to finish, got %v", details.State)
+	}
+	if details.Total != 2 || details.Processed != 2 || details.Failures != 1 {
+		t.Errorf("Unexpected progress: %+v", details)
+	}
+	if details.Records[1].Error != "missing identifier" {
+		t.Errorf("Did not keep the error: %+v", details.Records[1])
+	}
+
+	if _, err := c.Details("nope"); err == nil {
+		t.Error("Expected an error for an unknown job")
+	}
+}
+
+func TestDeadLetterAndRetry(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), Jobs: NewJobQueueCoordinator(DefaultQueues, 0, 2)}
+	c := s.jobs()
+
+	var mu sync.Mutex
+	attempts := 0
+	succeed := false
+	done := make(chan struct{}, 10)
+	id, _ := c.Enqueue(BackgroundQueue, "backup", func(*JobProgress) error {
+		mu.Lock()
+		defer mu.Unlock()
+		defer func() { done <- struct{}{} }()
+		attempts++
+		if succeed {
+			return nil
+		}
+		return errors.New("disk full {{.Title}}")
+	})
+	<-done
+	<-done
+
+	waitForState := func(state string) {
+		for i := 0; i < 100; i++ {
+			if details, _ := c.Details(id); details.State == state {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatalf("Job never got to %s", state)
+	}
+	waitForState(JobDeadLettered)
+
+	if dead := c.DeadLetters(); len(dead) != 1 || dead[0].Attempts != 2 || dead[0].Error != "disk full {{.Title}}" {
+		t.Errorf("Expected one dead letter after two attempts, got %+v", dead)
+	}
+	// the report is written just after the job is dead-lettered
+	text := ""
+	for i := 0; i < 100 && !strings.Contains(text, "disk full"); i++ {
+		time.Sleep(time.Millisecond)
+		text = s.Open(deadLetterReportIdentifier).Text.GetCurrent()
+	}
+	if !strings.Contains(text, `disk full {{"{{"}}.Title}}`) {
+		t.Errorf("Dead letter report does not mention the failure, escaped: %s", text)
+	}
+
+	mu.Lock()
+	succeed = true
+	mu.Unlock()
+	if err := c.Retry(id); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	waitForState(JobSucceeded)
+	if dead := c.DeadLetters(); len(dead) != 0 {
+		t.Errorf("Expected no dead letters after retry, got %+v", dead)
+	}
+	if err := c.Retry(id); err == nil {
+		t.Error("Should not retry a job that isn't dead-lettered")
+	}
+}
+
+func TestPanickingJobIsRetried(t *testing.T) {
+	c := NewJobQueueCoordinator(DefaultQueues, 0, 3)
+	var mu sync.Mutex
+	attempts := 0
+	id, _ := c.Enqueue(BackgroundQueue, "flaky", func(*JobProgress) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			var missing map[string]int
+			missing["boom"]++
+		}
+		return nil
+	})
+	for i := 0; i < 100; i++ {
+		if details, _ := c.Details(id); details.State == JobSucceeded {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	details, _ := c.Details(id)
+	if details.State != JobSucceeded || details.Attempts != 2 {
+		t.Errorf("Expected the panic to count as a failed attempt and be retried, got %+v", details)
+	}
+
+	id, _ = c.Enqueue(BackgroundQueue, "broken", func(*JobProgress) error {
+		panic("always")
+	})
+	for i := 0; i < 100; i++ {
+		if details, _ := c.Details(id); details.State == JobDeadLettered {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if details, _ := c.Details(id); details.State != JobDeadLettered || details.Error != "panicked: always" {
+		t.Errorf("Expected a job that always panics to be dead-lettered, got %+v", details)
+	}
+}
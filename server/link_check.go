@@ -0,0 +1,217 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const brokenLinksReportIdentifier = "broken_links"
+
+// linkCheckFile keeps the last link check's results, as JSON, for the
+// system status.
+const linkCheckFile = "link_check.table"
+
+// linkCheckWorkers is how many external links are checked at once.
+const linkCheckWorkers = 4
+
+// wikiRoutes are the links into the wiki that aren't pages.
+var wikiRoutes = map[string]bool{"ls": true, "metrics": true, "calendar.ics": true, "sitemap.xml": true, "favicon.ico": true, "login": true}
+
+var rUploadLink = regexp.MustCompile(`/uploads/(sha256-[A-Za-z0-9]+)`)
+
+var rExternalLink = regexp.MustCompile(`https?://[^\s<>()\[\]"'` + "`" + `]+`)
+
+// BrokenLink is a link that goes nowhere and why.
+type BrokenLink struct {
+	Page     string `json:"page"`
+	Link     string `json:"link"`
+	External bool   `json:"external"`
+	Problem  string `json:"problem"`
+}
+
+// LinkCheckCounts says how many broken links the last check found.
+type LinkCheckCounts struct {
+	CheckedAt       time.Time `json:"checked_at"`
+	Internal        int       `json:"internal"`
+	External        int       `json:"external"`
+	ExternalChecked bool      `json:"external_checked"`
+}
+
+// LinkCheck is the result of checking every page's links.
+type LinkCheck struct {
+	LinkCheckCounts
+	Broken []BrokenLink `json:"broken"`
+}
+
+// checkExternalLink HEADs the URL, falling back to GET for servers that
+// don't allow HEAD.
+func checkExternalLink(client *http.Client, link string) string {
+	resp, err := client.Head(link)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		resp, err = client.Get(link)
+	}
+	if err != nil {
+		return err.Error()
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return resp.Status
+	}
+	return ""
+}
+
+// CheckLinks finds links to pages that don't exist, and uploads that don't,
+// in every page. With external it also checks that every http link answers.
+func (s *Site) CheckLinks(external bool) LinkCheck {
+	check := LinkCheck{LinkCheckCounts: LinkCheckCounts{CheckedAt: time.Now(), ExternalChecked: external}, Broken: []BrokenLink{}}
+	externalLinks := map[string][]string{}
+	for _, identifier := range s.PageIdentifiers() {
+		text := s.Open(identifier).Text.GetCurrent()
+		matter, body, _, err := SplitFrontmatter(text)
+		if err != nil {
+			matter, body = map[string]interface{}{}, text
+		}
+		for link := range pageLinks(body, matter) {
+			if wikiRoutes[link] || s.pageExists(link) {
+				continue
+			}
+			if _, ok := s.lookupIdentifier(link); ok {
+				continue
+			}
+			check.Broken = append(check.Broken, BrokenLink{Page: identifier, Link: link, Problem: "no such page"})
+		}
+		for _, match := range rUploadLink.FindAllStringSubmatch(body, -1) {
+			if !exists(s.uploadPath(match[1])) {
+				check.Broken = append(check.Broken, BrokenLink{Page: identifier, Link: "/uploads/" + match[1], Problem: "no such upload"})
+			}
+		}
+		if external {
+			for _, link := range rExternalLink.FindAllString(body, -1) {
+				link = strings.TrimRight(link, ".,;:!?")
+				externalLinks[link] = append(externalLinks[link], identifier)
+			}
+		}
+	}
+	check.Internal = len(check.Broken)
+
+	if external {
+		client := &http.Client{Timeout: 10 * time.Second}
+		links := make(chan string)
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for i := 0; i < linkCheckWorkers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for link := range links {
+					problem := checkExternalLink(client, link)
+					if problem == "" {
+						continue
+					}
+					mu.Lock()
+					for _, page := range externalLinks[link] {
+						check.Broken = append(check.Broken, BrokenLink{Page: page, Link: link, External: true, Problem: problem})
+						check.External++
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+		for link := range externalLinks {
+			links <- link
+		}
+		close(links)
+		wg.Wait()
+	}
+
+	sort.Slice(check.Broken, func(i, j int) bool {
+		if check.Broken[i].Page != check.Broken[j].Page {
+			return check.Broken[i].Page < check.Broken[j].Page
+		}
+		return check.Broken[i].Link < check.Broken[j].Link
+	})
+	return check
+}
+
+// LastLinkCheck returns the counts from the last link check, if there was
+// one.
+func (s *Site) LastLinkCheck() (LinkCheckCounts, bool) {
+	var counts LinkCheckCounts
+	data, err := ioutil.ReadFile(path.Join(s.PathToData, linkCheckFile))
+	if err != nil {
+		return counts, false
+	}
+	return counts, json.Unmarshal(data, &counts) == nil
+}
+
+// writeBrokenLinksReport rewrites the page listing broken links and keeps
+// the counts for the system status.
+func (s *Site) writeBrokenLinksReport(check LinkCheck) error {
+	data, err := json.MarshalIndent(check.LinkCheckCounts, "", " ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path.Join(s.PathToData, linkCheckFile), data, 0644); err != nil {
+		return err
+	}
+
+	text := "+++\nidentifier = \"" + brokenLinksReportIdentifier + "\"\ntitle = \"Broken Links\"\n+++\n\n# Broken Links\n\n"
+	text += "_Checked " + check.CheckedAt.Format("Mon Jan 2 15:04:05 MST 2006")
+	if !check.ExternalChecked {
+		text += "; links to other sites weren't checked"
+	}
+	text += ". Fix the links on the pages themselves._\n"
+	if len(check.Broken) == 0 {
+		text += "\nNone.\n"
+	}
+	page := ""
+	for _, broken := range check.Broken {
+		if broken.Page != page {
+			page = broken.Page
+			text += "\n## [[" + page + "]]\n\n"
+		}
+		// Code spans so the broken links aren't links themselves.
+		text += fmt.Sprintf("  - `%s`: %s\n", broken.Link, broken.Problem)
+	}
+	return s.Open(brokenLinksReportIdentifier).Update(text)
+}
+
+func (s *Site) linkCheckJob(progress *JobProgress) error {
+	started := time.Now()
+	check := s.CheckLinks(s.CheckExternalLinks)
+	progress.SetTotal(len(check.Broken))
+	for _, broken := range check.Broken {
+		progress.Record(broken.Page+": "+broken.Link, started, fmt.Errorf("%s", broken.Problem))
+	}
+	return s.writeBrokenLinksReport(check)
+}
+
+func (s *Site) handleCheckLinks(c *gin.Context) {
+	type QueryJSON struct {
+		External bool `json:"external"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	check := s.CheckLinks(json.External)
+	if err := s.writeBrokenLinksReport(check); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "check": check, "page": brokenLinksReportIdentifier})
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckLinks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	s := &Site{PathToData: t.TempDir()}
+	for _, p := range []*Page{
+		newTestPage(s, "furnace", "See [[thermostat]] and [[humidifier]]. Manual at "+server.URL+"/manual and "+server.URL+"/gone.\n"),
+		newTestPage(s, "thermostat", "Wiring diagram: [photo](/uploads/sha256-MISSING?filename=wiring.jpg). Back to [[furnace]], or [all pages](/ls).\n"),
+	} {
+		if err := p.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check := s.CheckLinks(false)
+	if check.Internal != 2 || check.External != 0 || len(check.Broken) != 2 {
+		t.Fatalf("got %+v", check)
+	}
+	if check.Broken[0].Page != "furnace" || check.Broken[0].Link != "humidifier" {
+		t.Errorf("got %+v", check.Broken[0])
+	}
+	if check.Broken[1].Page != "thermostat" || check.Broken[1].Link != "/uploads/sha256-MISSING" {
+		t.Errorf("got %+v", check.Broken[1])
+	}
+
+	check = s.CheckLinks(true)
+	if check.Internal != 2 || check.External != 1 {
+		t.Fatalf("got %+v", check)
+	}
+	if err := s.writeBrokenLinksReport(check); err != nil {
+		t.Fatal(err)
+	}
+	report := s.Open(brokenLinksReportIdentifier).Text.GetCurrent()
+	if !strings.Contains(report, "`"+server.URL+"/gone`: 404 Not Found") || strings.Contains(report, "/manual") {
+		t.Errorf("got %s", report)
+	}
+	counts, ok := s.LastLinkCheck()
+	if !ok || counts.External != 1 || !counts.ExternalChecked {
+		t.Errorf("got %+v", counts)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// systemdFirstFD is the first file descriptor systemd passes for socket
+// activation.
+const systemdFirstFD = 3
+
+// systemdListenFDs is how many sockets systemd passed this process, from
+// LISTEN_FDS; none if they were meant for another process.
+func systemdListenFDs() int {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return 0
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 0 {
+		return 0
+	}
+	return fds
+}
+
+// CheckListen checks a --listen setting: empty for host:port over TCP, or
+// the socket systemd passed if there is one; unix:/path/to.sock for a unix
+// socket; or systemd, which must have passed a socket.
+func CheckListen(listen string) error {
+	switch {
+	case listen == "":
+		return nil
+	case listen == "systemd":
+		if systemdListenFDs() == 0 {
+			return fmt.Errorf("listen systemd needs a socket from systemd socket activation, and LISTEN_FDS is unset")
+		}
+		return nil
+	case strings.HasPrefix(listen, "unix:"):
+		if strings.TrimPrefix(listen, "unix:") == "" {
+			return fmt.Errorf("listen %q needs the socket's path, e.g. unix:/run/simple_wiki.sock", listen)
+		}
+		return nil
+	}
+	return fmt.Errorf("listen %q should be unix:/path/to.sock or systemd", listen)
+}
+
+// listener makes the main listener for a --listen setting, listening on
+// addr over TCP if it doesn't say otherwise.
+func listener(listen, addr string) (net.Listener, error) {
+	if err := CheckListen(listen); err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(listen, "unix:") {
+		path := strings.TrimPrefix(listen, "unix:")
+		// a socket left by a server that didn't shut down cleanly
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		return net.Listen("unix", path)
+	}
+	if fds := systemdListenFDs(); fds > 0 {
+		// unset, so processes started from here don't take them too
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+		if fds > 1 {
+			return nil, fmt.Errorf("systemd passed %d sockets; give the wiki's socket unit one ListenStream", fds)
+		}
+		file := os.NewFile(systemdFirstFD, "systemd socket")
+		defer file.Close()
+		return net.FileListener(file)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// unixSocketKey marks, in a request's context, that it came over a unix
+// socket, so from the reverse proxy in front of it.
+type unixSocketKey struct{}
+
+// viaUnixSocket is whether the request came over a unix socket.
+func viaUnixSocket(r *http.Request) bool {
+	return r.Context().Value(unixSocketKey{}) != nil
+}
+
+// forwardedFor gives requests that came over a unix socket the address of
+// the client the reverse proxy says it forwarded them for, so rate limits
+// and edit locks still tell clients apart. Only the proxy can reach the
+// socket, so its headers are taken on trust.
+func forwardedFor(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := strings.TrimSpace(r.Header.Get("X-Real-IP"))
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			// the proxy adds the address it got the request from last
+			hops := strings.Split(forwarded, ",")
+			client = strings.TrimSpace(hops[len(hops)-1])
+		}
+		r = r.WithContext(context.WithValue(r.Context(), unixSocketKey{}, true))
+		if net.ParseIP(client) != nil {
+			r.RemoteAddr = net.JoinHostPort(client, "0")
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
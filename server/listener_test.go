@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestCheckListen(t *testing.T) {
+	os.Unsetenv("LISTEN_FDS")
+	for _, listen := range []string{"", "unix:/run/wiki.sock"} {
+		if err := CheckListen(listen); err != nil {
+			t.Errorf("Expected %q to be taken, got %v", listen, err)
+		}
+	}
+	for _, listen := range []string{"unix:", "systemd", "tcp:8050", "/run/wiki.sock"} {
+		if err := CheckListen(listen); err == nil {
+			t.Errorf("Expected %q to be refused", listen)
+		}
+	}
+}
+
+func TestListenOnUnixSocket(t *testing.T) {
+	socket := path.Join(t.TempDir(), "wiki.sock")
+	// a socket left behind by an earlier run
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	remoteAddrs := make(chan string, 2)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddrs <- r.RemoteAddr
+		w.Write([]byte("hello"))
+	})
+	go listenAndServe("unix:"+socket, "", handler, TLSOptions{})
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	var resp *http.Response
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if resp, err = client.Get("http://wiki/"); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello" {
+		t.Errorf("Expected the handler's answer over the socket, got %q", body)
+	}
+	<-remoteAddrs
+
+	req, _ := http.NewRequest(http.MethodGet, "http://wiki/", nil)
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 192.0.2.7")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if addr := <-remoteAddrs; addr != "192.0.2.7:0" {
+		t.Errorf("Expected the address the proxy forwarded for, got %q", addr)
+	}
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// liveSearchChunk is how many pages a live search ranks between sending the
+// best it has so far and checking whether its query was revised.
+const liveSearchChunk = 500
+
+// LiveSearchResults are the best results so far for a revision of a live
+// search's query.
+type LiveSearchResults struct {
+	Revision int                `json:"revision"`
+	Query    string             `json:"query"`
+	Results  []PageSearchResult `json:"results"`
+	// Done is whether every page has been ranked.
+	Done bool `json:"done"`
+}
+
+// liveSearch is a search whose query is revised as it's typed, each
+// revision superseding the one before, searched or not.
+type liveSearch struct {
+	mu       sync.Mutex
+	revision int
+	query    string
+	revised  chan struct{}
+}
+
+// revise replaces the query, returning the revision number it's given.
+func (l *liveSearch) revise(query string) int {
+	l.mu.Lock()
+	l.revision++
+	l.query = query
+	revision := l.revision
+	l.mu.Unlock()
+	select {
+	case l.revised <- struct{}{}:
+	default: // already told, and the newest query is what's searched
+	}
+	return revision
+}
+
+// latest is the newest revision of the query.
+func (l *liveSearch) latest() (int, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.revision, l.query
+}
+
+// SearchPagesLive ranks pages as SearchPages does, a chunk at a time,
+// sending the best so far after each chunk that changed them and once
+// every page is ranked. It stops early, returning false, once stop says
+// to.
+func (s *Site) SearchPagesLive(query string, limit int, send func(results []PageSearchResult, done bool), stop func() bool) bool {
+	documents, frequency := s.searchDocuments()
+	queryTerms := s.searchAnalyzer().queryTerms(query)
+	if len(queryTerms) == 0 {
+		send([]PageSearchResult{}, true)
+		return true
+	}
+
+	weight := func(term string) float64 { return idf(documents, frequency, term) }
+	now := time.Now()
+	best := []PageSearchResult{}
+	for start := 0; start < len(documents); start += liveSearchChunk {
+		if stop() {
+			return false
+		}
+		end := start + liveSearchChunk
+		if end > len(documents) {
+			end = len(documents)
+		}
+		found := false
+		for _, doc := range documents[start:end] {
+			if score := doc.score(queryTerms, weight, now); score > 0 {
+				doc.result.Score = score
+				best = append(best, doc.result)
+				found = true
+			}
+		}
+		best = sortSearchResults(best, limit)
+		if found && end < len(documents) {
+			send(append([]PageSearchResult{}, best...), false)
+		}
+	}
+	send(best, true)
+	return true
+}
+
+// handleLiveSearch streams a live search as server-sent events: ready with
+// the search's id, then results for each revision of its query, made with
+// /search/live/revise. Revisions that come in while one is being searched
+// stop it, and only the newest is searched next.
+func (s *Site) handleLiveSearch(c *gin.Context) {
+	type QueryJSON struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+		FragmentOptions
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	if json.Limit <= 0 {
+		json.Limit = 20
+	}
+	id := RandStringBytesMaskImprSrc(16)
+	search := &liveSearch{revised: make(chan struct{}, 1)}
+	s.liveSearchesMut.Lock()
+	if s.liveSearches == nil {
+		s.liveSearches = map[string]*liveSearch{}
+	}
+	s.liveSearches[id] = search
+	s.liveSearchesMut.Unlock()
+	defer func() {
+		s.liveSearchesMut.Lock()
+		delete(s.liveSearches, id)
+		s.liveSearchesMut.Unlock()
+	}()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.SSEvent("ready", gin.H{"id": id})
+	c.Writer.Flush()
+	if strings.TrimSpace(json.Query) != "" {
+		search.revise(json.Query)
+	}
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-search.revised:
+		}
+		revision, query := search.latest()
+		s.SearchPagesLive(query, json.Limit, func(results []PageSearchResult, done bool) {
+			c.SSEvent("results", LiveSearchResults{Revision: revision, Query: query, Results: withFragments(results, query, s.searchAnalyzer(), json.FragmentOptions), Done: done})
+			c.Writer.Flush()
+		}, func() bool {
+			latest, _ := search.latest()
+			return latest != revision || ctx.Err() != nil
+		})
+	}
+}
+
+func (s *Site) handleReviseLiveSearch(c *gin.Context) {
+	type QueryJSON struct {
+		ID    string `json:"id"`
+		Query string `json:"query"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	s.liveSearchesMut.Lock()
+	search, ok := s.liveSearches[json.ID]
+	s.liveSearchesMut.Unlock()
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "No live search " + json.ID})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "revision": search.revise(json.Query)})
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/jcelliott/lumber"
+)
+
+func TestSearchPagesLive(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	for i := 0; i < 2*liveSearchChunk+10; i++ {
+		text := "Nothing much here.\n"
+		if i%100 == 0 {
+			text = "The furnace filter.\n"
+		}
+		newTestPage(s, fmt.Sprintf("page%04d", i), text)
+	}
+
+	sent := [][]PageSearchResult{}
+	finished := s.SearchPagesLive("furnace", 20, func(results []PageSearchResult, done bool) {
+		if done != (len(sent) == 2) {
+			t.Errorf("Expected only the last results to be done")
+		}
+		sent = append(sent, results)
+	}, func() bool { return false })
+	if !finished || len(sent) != 3 || len(sent[0]) != 5 || len(sent[2]) != 11 {
+		t.Errorf("Expected results to grow a chunk at a time, got %v", sent)
+	}
+	if whole := s.SearchPages("furnace", 20); fmt.Sprint(whole) != fmt.Sprint(sent[2]) {
+		t.Errorf("Expected the last results to be SearchPages', got %v and %v", sent[2], whole)
+	}
+
+	sent = nil
+	chunks := 0
+	if s.SearchPagesLive("furnace", 20, func(results []PageSearchResult, done bool) {
+		sent = append(sent, results)
+	}, func() bool { chunks++; return chunks > 1 }) || len(sent) != 1 {
+		t.Errorf("Expected a stopped search to send what it had and stop, got %v", sent)
+	}
+}
+
+func TestLiveSearch(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), SessionStore: cookie.NewStore([]byte("secret")), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	newTestPage(s, "furnace", "Change the furnace filter every month.\n")
+	newTestPage(s, "garden", "Water the tomatoes every morning.\n")
+	server := httptest.NewServer(s.Router())
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/search/live", "application/json", strings.NewReader(`{"query": "furn"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	events := bufio.NewReader(resp.Body)
+	next := func(expected string, into interface{}) {
+		var event string
+		for {
+			line, err := events.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Expected %s, got %v", expected, err)
+			}
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "event:") {
+				event = strings.TrimPrefix(line, "event:")
+			} else if strings.HasPrefix(line, "data:") {
+				if event != expected {
+					t.Fatalf("Expected %s, got %s", expected, event)
+				}
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), into)
+				return
+			}
+		}
+	}
+
+	var ready struct{ ID string }
+	next("ready", &ready)
+	var results LiveSearchResults
+	next("results", &results)
+	if results.Revision != 1 || !results.Done || len(results.Results) != 0 {
+		t.Errorf("Expected nothing for the first revision, got %+v", results)
+	}
+
+	revise, err := http.Post(server.URL+"/search/live/revise", "application/json", strings.NewReader(`{"id": "`+ready.ID+`", "query": "furnace"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var revised struct {
+		Success  bool
+		Revision int
+	}
+	json.NewDecoder(revise.Body).Decode(&revised)
+	revise.Body.Close()
+	if !revised.Success || revised.Revision != 2 {
+		t.Errorf("Expected the query to be revised, got %+v", revised)
+	}
+	next("results", &results)
+	if results.Revision != 2 || !results.Done || len(results.Results) != 1 || results.Results[0].Identifier != "furnace" {
+		t.Errorf("Expected the furnace for the second revision, got %+v", results)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/search/live/revise", strings.NewReader(`{"id": "nope", "query": "x"}`))
+	s.Router().ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `"success":false`) {
+		t.Errorf("Expected an unknown live search to be refused, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maintenanceReportIdentifier = "maintenance_report"
+
+// warrantyWarningDays is how far ahead expiring warranties are reported.
+const warrantyWarningDays = 30
+
+// MaintenanceStatus is an inventory item's purchase, warranty and
+// maintenance dates, from inventory.purchase_date, warranty_expires,
+// maintenance_interval and last_maintained. Dates are YYYY-MM-DD; the
+// maintenance is due an interval after it was last done, or after it was
+// bought if it never has been.
+type MaintenanceStatus struct {
+	Identifier          string `json:"identifier"`
+	PurchaseDate        string `json:"purchase_date,omitempty"`
+	WarrantyExpires     string `json:"warranty_expires,omitempty"`
+	MaintenanceInterval string `json:"maintenance_interval,omitempty"`
+	LastMaintained      string `json:"last_maintained,omitempty"`
+	MaintenanceDue      string `json:"maintenance_due,omitempty"`
+}
+
+// MaintenanceReport lists the warranties running out within
+// warrantyWarningDays and the maintenance that is due.
+type MaintenanceReport struct {
+	ExpiringWarranties []MaintenanceStatus `json:"expiring_warranties"`
+	OverdueMaintenance []MaintenanceStatus `json:"overdue_maintenance"`
+}
+
+// maintenanceDate reads one of the date fields, which may be a TOML date or
+// a string.
+func maintenanceDate(v interface{}) string {
+	if t, _, ok := calendarDate(v); ok {
+		return t.Format(loanDateLayout)
+	}
+	return ""
+}
+
+// addInterval adds a maintenance_interval: a number of days, or a count of
+// days, weeks, months or years such as "90d", "2w", "6m" or "1y".
+func addInterval(date time.Time, interval interface{}) (time.Time, bool) {
+	if days, ok := frontmatterNumber(interval); ok {
+		return date.AddDate(0, 0, int(days)), days > 0
+	}
+	text := strings.TrimSpace(frontmatterString(interval))
+	if text == "" {
+		return date, false
+	}
+	n, err := strconv.Atoi(text[:len(text)-1])
+	if err != nil || n <= 0 {
+		return date, false
+	}
+	switch text[len(text)-1] {
+	case 'd':
+		return date.AddDate(0, 0, n), true
+	case 'w':
+		return date.AddDate(0, 0, 7*n), true
+	case 'm':
+		return date.AddDate(0, n, 0), true
+	case 'y':
+		return date.AddDate(n, 0, 0), true
+	}
+	return date, false
+}
+
+func maintenanceStatus(identifier string, matter map[string]interface{}) (MaintenanceStatus, bool) {
+	inventory, ok := frontmatterTable(matter, "inventory", false)
+	if !ok {
+		return MaintenanceStatus{}, false
+	}
+	status := MaintenanceStatus{
+		Identifier:          identifier,
+		PurchaseDate:        maintenanceDate(inventory["purchase_date"]),
+		WarrantyExpires:     maintenanceDate(inventory["warranty_expires"]),
+		MaintenanceInterval: frontmatterString(inventory["maintenance_interval"]),
+		LastMaintained:      maintenanceDate(inventory["last_maintained"]),
+	}
+	if days, ok := frontmatterNumber(inventory["maintenance_interval"]); ok {
+		status.MaintenanceInterval = formatQuantity(days) + "d"
+	}
+	since := status.LastMaintained
+	if since == "" {
+		since = status.PurchaseDate
+	}
+	if start, err := time.Parse(loanDateLayout, since); err == nil {
+		if due, ok := addInterval(start, inventory["maintenance_interval"]); ok {
+			status.MaintenanceDue = due.Format(loanDateLayout)
+		}
+	}
+	tracked := status.PurchaseDate != "" || status.WarrantyExpires != "" || status.MaintenanceInterval != ""
+	return status, tracked
+}
+
+// MaintenanceStatus reads an item's purchase, warranty and maintenance
+// dates.
+func (s *Site) MaintenanceStatus(identifier string) (MaintenanceStatus, error) {
+	matter, err := s.ReadFrontMatter(identifier)
+	if err != nil {
+		return MaintenanceStatus{}, err
+	}
+	normalizeFrontmatter(matter)
+	status, _ := maintenanceStatus(strings.ToLower(identifier), matter)
+	return status, nil
+}
+
+// MaintenanceReport finds the warranties expiring within warrantyWarningDays
+// of now and the maintenance due by today, each soonest first.
+func (s *Site) MaintenanceReport(now time.Time) MaintenanceReport {
+	today := now.Format(loanDateLayout)
+	warningEnds := now.AddDate(0, 0, warrantyWarningDays).Format(loanDateLayout)
+	report := MaintenanceReport{ExpiringWarranties: []MaintenanceStatus{}, OverdueMaintenance: []MaintenanceStatus{}}
+	s.EachFrontmatter(func(identifier string, matter map[string]interface{}) {
+		status, ok := maintenanceStatus(identifier, matter)
+		if !ok {
+			return
+		}
+		// YYYY-MM-DD sorts the same as the dates it represents.
+		if status.WarrantyExpires != "" && status.WarrantyExpires >= today && status.WarrantyExpires <= warningEnds {
+			report.ExpiringWarranties = append(report.ExpiringWarranties, status)
+		}
+		if status.MaintenanceDue != "" && status.MaintenanceDue <= today {
+			report.OverdueMaintenance = append(report.OverdueMaintenance, status)
+		}
+	})
+	sort.Slice(report.ExpiringWarranties, func(i, j int) bool {
+		return report.ExpiringWarranties[i].WarrantyExpires < report.ExpiringWarranties[j].WarrantyExpires
+	})
+	sort.Slice(report.OverdueMaintenance, func(i, j int) bool {
+		return report.OverdueMaintenance[i].MaintenanceDue < report.OverdueMaintenance[j].MaintenanceDue
+	})
+	return report
+}
+
+// MarkMaintained records that the item's maintenance was done on date, a
+// YYYY-MM-DD date or empty for today.
+func (p *Page) MarkMaintained(date string, now time.Time) error {
+	if date == "" {
+		date = now.Format(loanDateLayout)
+	}
+	if _, err := time.Parse(loanDateLayout, date); err != nil {
+		return fmt.Errorf("maintenance date must look like %s", loanDateLayout)
+	}
+	return p.UpdateFrontmatter(func(matter map[string]interface{}) error {
+		inventory, _ := frontmatterTable(matter, "inventory", true)
+		inventory["last_maintained"] = date
+		return nil
+	})
+}
+
+const maintenanceReportTemplate = `## Warranties expiring in the next {{.Days}} days
+{{range .Report.ExpiringWarranties}}
+  - {{LinkTo .Identifier}}: warranty expires {{.WarrantyExpires}}
+{{else}}
+	No warranties are about to expire
+{{end}}
+
+## Maintenance due
+{{range .Report.OverdueMaintenance}}
+  - {{LinkTo .Identifier}}: due {{.MaintenanceDue}} (every {{.MaintenanceInterval}})
+{{else}}
+	No maintenance is due
+{{end}}
+`
+
+func renderMaintenanceReport(site *Site, linkTo func(string) string, now time.Time) string {
+	tmpl, err := template.New("content").Funcs(template.FuncMap{"LinkTo": linkTo}).Parse(maintenanceReportTemplate)
+	if err != nil {
+		return err.Error()
+	}
+	buf := &bytes.Buffer{}
+	err = tmpl.Execute(buf, map[string]interface{}{"Days": warrantyWarningDays, "Report": site.MaintenanceReport(now)})
+	if err != nil {
+		return err.Error()
+	}
+	return buf.String()
+}
+
+func BuildShowMaintenanceReport(site *Site) func() string {
+	linkTo := BuildLinkTo(site)
+	return func() string {
+		return renderMaintenanceReport(site, linkTo, time.Now())
+	}
+}
+
+// BuildShowMaintenanceOf summarizes an item's warranty and maintenance for
+// its own page, linking to the report.
+func BuildShowMaintenanceOf(site *Site) func(string) string {
+	return func(identifier string) string {
+		status, err := site.MaintenanceStatus(identifier)
+		if err != nil {
+			return "Not Setup for Inventory"
+		}
+		tmplString := `{{if .PurchaseDate}}  - Purchased {{.PurchaseDate}}
+{{end}}{{if .WarrantyExpires}}  - Warranty until {{.WarrantyExpires}}
+{{end}}{{if .MaintenanceDue}}  - Maintenance every {{.MaintenanceInterval}}, next due {{.MaintenanceDue}}{{if .LastMaintained}} (last done {{.LastMaintained}}){{end}}
+{{end}}
+See the [Maintenance Report](/` + maintenanceReportIdentifier + `) for everything due.
+`
+		tmpl, err := template.New("content").Parse(tmplString)
+		if err != nil {
+			return err.Error()
+		}
+		buf := &bytes.Buffer{}
+		err = tmpl.Execute(buf, status)
+		if err != nil {
+			return err.Error()
+		}
+		return buf.String()
+	}
+}
+
+// RefreshMaintenanceReport regenerates the Maintenance Report page.
+func (s *Site) RefreshMaintenanceReport(now time.Time) error {
+	text := "+++\nidentifier = \"" + maintenanceReportIdentifier + "\"\ntitle = \"Maintenance Report\"\n+++\n\n# Maintenance Report\n\n"
+	text += "_Generated " + now.Format("Mon Jan 2 15:04:05 MST 2006") + ". Edits here will be overwritten; record maintenance on the items themselves._\n\n"
+	text += renderMaintenanceReport(s, BuildLinkTo(s), now)
+	return s.Open(maintenanceReportIdentifier).Update(text)
+}
+
+func (s *Site) maintenanceReportJob(*JobProgress) error {
+	return s.RefreshMaintenanceReport(time.Now())
+}
+
+func (s *Site) handleMaintenanceReport(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "report": s.MaintenanceReport(time.Now())})
+}
+
+func (s *Site) handleMarkMaintained(c *gin.Context) {
+	type QueryJSON struct {
+		Page string `json:"page"`
+		Date string `json:"date"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	p, ok := s.openInventoryItem(c, json.Page)
+	if !ok {
+		return
+	}
+	if err := p.MarkMaintained(json.Date, time.Now()); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Maintenance recorded"})
+}
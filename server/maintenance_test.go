@@ -0,0 +1,52 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceReport(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	for _, p := range []*Page{
+		newTestPage(s, "furnace", "+++\nidentifier = \"furnace\"\n[inventory]\npurchase_date = 2021-01-15\nmaintenance_interval = \"6m\"\nlast_maintained = \"2021-09-01\"\n+++\n"),
+		newTestPage(s, "fridge", "+++\nidentifier = \"fridge\"\n[inventory]\nwarranty_expires = \"2022-04-01\"\nmaintenance_interval = 365\npurchase_date = \"2021-06-01\"\n+++\n"),
+		newTestPage(s, "tv", "+++\nidentifier = \"tv\"\n[inventory]\nwarranty_expires = \"2023-01-01\"\n+++\n"),
+	} {
+		if err := p.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Date(2022, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	report := s.MaintenanceReport(now)
+	if len(report.ExpiringWarranties) != 1 || report.ExpiringWarranties[0].Identifier != "fridge" {
+		t.Errorf("Expected only the fridge's warranty to be expiring, got %+v", report.ExpiringWarranties)
+	}
+	if len(report.OverdueMaintenance) != 1 || report.OverdueMaintenance[0].MaintenanceDue != "2022-03-01" {
+		t.Errorf("Expected the furnace to be due 6 months after it was last done, got %+v", report.OverdueMaintenance)
+	}
+
+	furnace := s.Open("furnace")
+	if err := furnace.MarkMaintained("last week", now); err == nil {
+		t.Error("Expected a date that isn't YYYY-MM-DD to be refused")
+	}
+	if err := furnace.MarkMaintained("", now); err != nil {
+		t.Fatal(err)
+	}
+	if report := s.MaintenanceReport(now); len(report.OverdueMaintenance) != 0 {
+		t.Errorf("Expected nothing due once the furnace was maintained, got %+v", report.OverdueMaintenance)
+	}
+
+	fridge := BuildShowMaintenanceOf(s)("fridge")
+	if !strings.Contains(fridge, "Maintenance every 365d, next due 2022-06-01") || !strings.Contains(fridge, "/maintenance_report") {
+		t.Errorf("Expected the fridge's maintenance and a link to the report, got %q", fridge)
+	}
+
+	if err := s.RefreshMaintenanceReport(now); err != nil {
+		t.Fatal(err)
+	}
+	if text := s.Open(maintenanceReportIdentifier).Text.GetCurrent(); !strings.Contains(text, "warranty expires 2022-04-01") {
+		t.Errorf("Expected the report page to list the fridge, got %q", text)
+	}
+}
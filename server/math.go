@@ -0,0 +1,82 @@
+package server
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// rMathOrCode finds code, which math is never looked for in, and math:
+// $$display$$ or $inline$, where inline math can't start or end with a
+// space, so prices like $5 and $10 aren't taken for math.
+var rMathOrCode = regexp.MustCompile("(?s)```.*?```|`[^`\\n]*`|\\$\\$(.+?)\\$\\$|\\$([^\\s$](?:[^$\\n]*[^\\s$\\\\])?)\\$")
+
+// mathPlaceholder stands in for a piece of math while the markdown is
+// rendered and sanitized, neither of which touches letters and digits.
+const mathPlaceholder = "MATHf6c1d0"
+
+var rMathPlaceholder = regexp.MustCompile(mathPlaceholder + `(\d+)Z`)
+
+// CheckMath checks --math: plain, or the http URL of a MathJax script.
+func CheckMath(spec string) error {
+	if spec == "" || spec == "plain" {
+		return nil
+	}
+	u, err := url.Parse(spec)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("math %q should be plain, or the http URL of a MathJax script to typeset it with", spec)
+	}
+	return nil
+}
+
+// mathScript is the script pages load to typeset their math, "" for none.
+func (s *Site) mathScript() string {
+	if s == nil || s.Math == "plain" || CheckMath(s.Math) != nil {
+		return ""
+	}
+	return s.Math
+}
+
+// protectMath swaps the math in markdown for placeholders, returning the
+// math to put back with restoreMath once the markdown is HTML.
+func protectMath(markdown string) (string, []string) {
+	maths := []string{}
+	var b strings.Builder
+	last := 0
+	for _, m := range rMathOrCode.FindAllStringSubmatchIndex(markdown, -1) {
+		start, end := m[0], m[1]
+		if markdown[start] == '`' ||
+			(start > 0 && markdown[start-1] == '\\') ||
+			(m[4] >= 0 && end < len(markdown) && markdown[end] >= '0' && markdown[end] <= '9') {
+			continue
+		}
+		b.WriteString(markdown[last:start])
+		fmt.Fprintf(&b, "%s%dZ", mathPlaceholder, len(maths))
+		maths = append(maths, markdown[start:end])
+		last = end
+	}
+	b.WriteString(markdown[last:])
+	return b.String(), maths
+}
+
+// restoreMath puts the math back, escaped and marked as inline or display
+// math, with its delimiters kept for whatever typesets it.
+func restoreMath(rendered []byte, maths []string) []byte {
+	if len(maths) == 0 {
+		return rendered
+	}
+	return rMathPlaceholder.ReplaceAllFunc(rendered, func(placeholder []byte) []byte {
+		var i int
+		fmt.Sscanf(string(rMathPlaceholder.FindSubmatch(placeholder)[1]), "%d", &i)
+		if i >= len(maths) {
+			return placeholder
+		}
+		class := "math inline"
+		if strings.HasPrefix(maths[i], "$$") {
+			class = "math display"
+		}
+		return []byte(`<span class="` + class + `">` + html.EscapeString(maths[i]) + `</span>`)
+	})
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMath(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), Math: "plain"}
+	p := newTestPage(s, "physics", "Energy is $E = mc^2$ and *mass* is $m_1 * m_2$.\n\n"+
+		"$$\\int_0^1 x_i \\, dx < 2$$\n\n"+
+		"It costs $5 and $10, not \\$x$.\n\n`$not_math$`\n\n```\n$$also_not$$\n```\n")
+	p.Render()
+	html := string(p.RenderedPage)
+	for _, expected := range []string{
+		`<span class="math inline">$E = mc^2$</span>`,
+		`<span class="math inline">$m_1 * m_2$</span>`,
+		`<span class="math display">$$\int_0^1 x_i \, dx &lt; 2$$</span>`,
+		`<em>mass</em>`,
+		`It costs $5 and $10`,
+		`<code>$not_math$</code>`,
+		`$$also_not$$`,
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("Expected %s in %s", expected, html)
+		}
+	}
+	if strings.Count(html, `class="math`) != 3 {
+		t.Errorf("Expected only the three pieces of math marked, got %s", html)
+	}
+
+	s = &Site{PathToData: t.TempDir()}
+	p = newTestPage(s, "physics", "$a_1 * b_1 * c$")
+	p.Render()
+	if strings.Contains(string(p.RenderedPage), "math") {
+		t.Errorf("Expected math left to markdown without --math, got %s", p.RenderedPage)
+	}
+
+	if CheckMath("https://cdn.example/mathjax/tex-chtml.js") != nil || CheckMath("katex") == nil {
+		t.Error("Expected plain and URLs to be the only settings")
+	}
+}
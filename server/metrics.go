@@ -0,0 +1,414 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// wikiCounters are the counters WikiMetricsRecorder keeps, in the order they
+// are exposed.
+var wikiCounters = []struct{ name, help string }{
+	{"wiki_page_views_total", "Pages served by the page handler."},
+	{"wiki_page_saves_total", "Pages written to disk."},
+	{"wiki_uploads_total", "Files uploaded."},
+	{"wiki_render_cache_hits_total", "Pages served from the render cache."},
+	{"wiki_render_cache_misses_total", "Pages rendered because they weren't in the render cache."},
+	{"wiki_rate_limited_total", "Requests refused for going over a rate limit, by category."},
+	{"wiki_ip_filtered_total", "Requests refused for coming from an address the IP filter doesn't allow."},
+}
+
+// wikiHistograms are the histograms WikiMetricsRecorder keeps.
+var wikiHistograms = []struct{ name, help string }{
+	{"wiki_http_request_duration_seconds", "Time taken to answer HTTP requests, by method and route."},
+	{"wiki_index_rebuild_duration_seconds", "Time taken to build an index from the pages."},
+}
+
+// latencyBuckets are the upper bounds, in seconds, of the latency histogram
+// buckets; the same as Prometheus' defaults.
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	counts []uint64 // per bucket, with one more for anything slower than the last
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(value float64) {
+	i := sort.SearchFloat64s(latencyBuckets, value)
+	h.counts[i]++
+	h.count++
+	h.sum += value
+}
+
+// quantile estimates the q quantile by interpolating within the bucket it
+// falls in, the way Prometheus' histogram_quantile does.
+func (h *histogram) quantile(q float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+	rank := q * float64(h.count)
+	seen := 0.0
+	for i, n := range h.counts {
+		if seen+float64(n) >= rank && n > 0 {
+			if i == len(latencyBuckets) {
+				return latencyBuckets[len(latencyBuckets)-1]
+			}
+			lower := 0.0
+			if i > 0 {
+				lower = latencyBuckets[i-1]
+			}
+			return lower + (latencyBuckets[i]-lower)*(rank-seen)/float64(n)
+		}
+		seen += float64(n)
+	}
+	return latencyBuckets[len(latencyBuckets)-1]
+}
+
+// WikiMetricsRecorder counts what the wiki does and how long it takes. The
+// metrics, along with the job queues and Go runtime stats, are served at
+// /metrics in the Prometheus text format, so no collector is needed in
+// between.
+type WikiMetricsRecorder struct {
+	mu         sync.Mutex
+	started    time.Time
+	counters   map[string]map[string]float64 // name to formatted labels to value
+	histograms map[string]map[string]*histogram
+	requests   map[string]*RequestStats // by method and route
+	pageViews  map[string]float64
+}
+
+func NewWikiMetricsRecorder() *WikiMetricsRecorder {
+	return &WikiMetricsRecorder{
+		started:    time.Now(),
+		counters:   map[string]map[string]float64{},
+		histograms: map[string]map[string]*histogram{},
+		requests:   map[string]*RequestStats{},
+		pageViews:  map[string]float64{},
+	}
+}
+
+// Inc adds one to a counter. labels are name, value pairs.
+func (m *WikiMetricsRecorder) Inc(name string, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.counters[name] == nil {
+		m.counters[name] = map[string]float64{}
+	}
+	m.counters[name][formatLabels(labels...)]++
+}
+
+// Counter returns the current value of a counter.
+func (m *WikiMetricsRecorder) Counter(name string, labels ...string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[name][formatLabels(labels...)]
+}
+
+// Observe records a duration in a histogram. labels are name, value pairs.
+func (m *WikiMetricsRecorder) Observe(name string, d time.Duration, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.histograms[name] == nil {
+		m.histograms[name] = map[string]*histogram{}
+	}
+	l := formatLabels(labels...)
+	h, ok := m.histograms[name][l]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets)+1)}
+		m.histograms[name][l] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// LatencySummary is the percentiles of one histogram's durations.
+type LatencySummary struct {
+	Name   string        `json:"name"`
+	Labels string        `json:"labels"`
+	Count  uint64        `json:"count"`
+	P50    time.Duration `json:"p50"`
+	P90    time.Duration `json:"p90"`
+	P99    time.Duration `json:"p99"`
+}
+
+// LatencySummaries estimates the p50, p90 and p99 of every histogram, most
+// used first.
+func (m *WikiMetricsRecorder) LatencySummaries() []LatencySummary {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	summaries := []LatencySummary{}
+	seconds := func(s float64) time.Duration { return time.Duration(s * float64(time.Second)) }
+	for name, byLabels := range m.histograms {
+		for labels, h := range byLabels {
+			summaries = append(summaries, LatencySummary{
+				Name:   name,
+				Labels: labels,
+				Count:  h.count,
+				P50:    seconds(h.quantile(.5)),
+				P90:    seconds(h.quantile(.9)),
+				P99:    seconds(h.quantile(.99)),
+			})
+		}
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Count != summaries[j].Count {
+			return summaries[i].Count > summaries[j].Count
+		}
+		return summaries[i].Labels < summaries[j].Labels
+	})
+	return summaries
+}
+
+// formatLabels renders name, value pairs as `{name="value",...}`.
+func formatLabels(labels ...string) string {
+	if len(labels) < 2 {
+		return ""
+	}
+	pairs := []string{}
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+`="`+escape.Replace(labels[i+1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel adds one more label to formatted labels.
+func withLabel(labels, name, value string) string {
+	if labels == "" {
+		return formatLabels(name, value)
+	}
+	return strings.TrimSuffix(labels, "}") + "," + strings.TrimPrefix(formatLabels(name, value), "{")
+}
+
+type metricWriter struct {
+	w io.Writer
+}
+
+func (w metricWriter) family(name, kind, help string) {
+	fmt.Fprintf(w.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (w metricWriter) sample(name, labels string, value float64) {
+	fmt.Fprintf(w.w, "%s%s %s\n", name, labels, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// WritePrometheus writes every metric in the Prometheus text format.
+func (s *Site) WritePrometheus(out io.Writer) {
+	w := metricWriter{out}
+	m := s.metrics()
+
+	m.mu.Lock()
+	for _, counter := range wikiCounters {
+		w.family(counter.name, "counter", counter.help)
+		samples := m.counters[counter.name]
+		if len(samples) == 0 {
+			w.sample(counter.name, "", 0)
+		}
+		labels := make([]string, 0, len(samples))
+		for l := range samples {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+		for _, l := range labels {
+			w.sample(counter.name, l, samples[l])
+		}
+	}
+	for _, metric := range wikiHistograms {
+		w.family(metric.name, "histogram", metric.help)
+		samples := m.histograms[metric.name]
+		labels := make([]string, 0, len(samples))
+		for l := range samples {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+		for _, l := range labels {
+			h := samples[l]
+			cumulative := uint64(0)
+			for i, bound := range latencyBuckets {
+				cumulative += h.counts[i]
+				w.sample(metric.name+"_bucket", withLabel(l, "le", strconv.FormatFloat(bound, 'g', -1, 64)), float64(cumulative))
+			}
+			w.sample(metric.name+"_bucket", withLabel(l, "le", "+Inf"), float64(h.count))
+			w.sample(metric.name+"_sum", l, h.sum)
+			w.sample(metric.name+"_count", l, float64(h.count))
+		}
+	}
+	breakdown := m.requestBreakdown()
+	w.family("wiki_http_requests_total", "counter", "HTTP requests, by method and route.")
+	for _, stats := range breakdown {
+		w.sample("wiki_http_requests_total", formatLabels("method", stats.Method, "route", stats.Route), stats.Requests)
+	}
+	w.family("wiki_http_request_errors_total", "counter", "HTTP requests answered with a 4xx or 5xx, by method and route.")
+	for _, stats := range breakdown {
+		w.sample("wiki_http_request_errors_total", formatLabels("method", stats.Method, "route", stats.Route), stats.Errors)
+	}
+	m.mu.Unlock()
+
+	w.family("wiki_pages", "gauge", "Pages in the data directory.")
+	w.sample("wiki_pages", "", float64(len(s.PageIdentifiers())))
+
+	indexes := s.IndexHealth()
+	w.family("wiki_index_entries", "gauge", "Entries in an index.")
+	for _, index := range indexes {
+		w.sample("wiki_index_entries", formatLabels("index", index.Index), float64(index.Entries))
+	}
+	w.family("wiki_index_last_rebuild_timestamp_seconds", "gauge", "When an index was last built, in seconds since the epoch.")
+	for _, index := range indexes {
+		if index.Built {
+			w.sample("wiki_index_last_rebuild_timestamp_seconds", formatLabels("index", index.Index), float64(index.LastRebuild.Unix()))
+		}
+	}
+
+	queues := s.jobs().Status()
+	for _, metric := range []struct {
+		name, kind, help string
+		value            func(QueueStatus) int
+	}{
+		{"wiki_job_queue_pending", "gauge", "Jobs waiting to run.", func(q QueueStatus) int { return q.Pending }},
+		{"wiki_job_queue_running", "gauge", "Jobs running.", func(q QueueStatus) int { return q.Running }},
+		{"wiki_jobs_completed_total", "counter", "Jobs that succeeded.", func(q QueueStatus) int { return q.Completed }},
+		{"wiki_jobs_dead_lettered", "gauge", "Jobs that failed every attempt.", func(q QueueStatus) int { return q.Failed }},
+	} {
+		w.family(metric.name, metric.kind, metric.help)
+		for _, q := range queues {
+			w.sample(metric.name, formatLabels("queue", q.Name), float64(metric.value(q)))
+		}
+	}
+
+	if disk, err := s.DiskUsage(); err == nil {
+		w.family("wiki_disk_usage_bytes", "gauge", "Bytes used in the data directory, by kind of file.")
+		w.sample("wiki_disk_usage_bytes", formatLabels("kind", "pages"), float64(disk.Pages))
+		w.sample("wiki_disk_usage_bytes", formatLabels("kind", "uploads"), float64(disk.Uploads))
+		w.sample("wiki_disk_usage_bytes", formatLabels("kind", "other"), float64(disk.Other))
+		w.sample("wiki_disk_usage_bytes", formatLabels("kind", "trash"), float64(disk.Trash))
+		w.family("wiki_disk_warnings", "gauge", "Disk limits the data directory is over.")
+		w.sample("wiki_disk_warnings", "", float64(len(s.diskWarnings(disk))))
+	}
+	if s.DiskWarningMB > 0 {
+		w.family("wiki_disk_warning_bytes", "gauge", "Disk usage above which the wiki warns.")
+		w.sample("wiki_disk_warning_bytes", "", float64(s.DiskWarningMB)*megabyte)
+	}
+	if s.DiskQuotaMB > 0 {
+		w.family("wiki_disk_quota_bytes", "gauge", "Disk usage above which uploads are refused.")
+		w.sample("wiki_disk_quota_bytes", "", float64(s.DiskQuotaMB)*megabyte)
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	w.family("process_start_time_seconds", "gauge", "When the wiki started, in seconds since the epoch.")
+	w.sample("process_start_time_seconds", "", float64(m.started.Unix()))
+	w.family("go_goroutines", "gauge", "Goroutines that currently exist.")
+	w.sample("go_goroutines", "", float64(runtime.NumGoroutine()))
+	w.family("go_memstats_alloc_bytes", "gauge", "Bytes allocated and still in use.")
+	w.sample("go_memstats_alloc_bytes", "", float64(mem.Alloc))
+	w.family("go_memstats_sys_bytes", "gauge", "Bytes obtained from the system.")
+	w.sample("go_memstats_sys_bytes", "", float64(mem.Sys))
+	w.family("go_memstats_heap_objects", "gauge", "Allocated heap objects.")
+	w.sample("go_memstats_heap_objects", "", float64(mem.HeapObjects))
+	w.family("go_gc_cycles_total", "counter", "Completed garbage collection cycles.")
+	w.sample("go_gc_cycles_total", "", float64(mem.NumGC))
+	w.family("go_info", "gauge", "Information about the Go environment.")
+	w.sample("go_info", formatLabels("version", runtime.Version()), 1)
+}
+
+// metrics returns the site's recorder, making it the first time it is needed.
+func (s *Site) metrics() *WikiMetricsRecorder {
+	s.metricsOnce.Do(func() {
+		if s.Metrics == nil {
+			s.Metrics = NewWikiMetricsRecorder()
+		}
+		// checked first so a missing page isn't looked up as an alias, which
+		// records metrics of its own
+		if s.hasPageFile(metricsReportIdentifier, ".md") {
+			if matter, err := s.ReadFrontMatter(metricsReportIdentifier); err == nil {
+				normalizeFrontmatter(matter)
+				s.Metrics.restoreBreakdown(matter)
+			}
+		}
+	})
+	return s.Metrics
+}
+
+// recordLatency is middleware timing and counting every request by its
+// route, so slow and failing paths show up without a label per page.
+func (s *Site) recordLatency(c *gin.Context) {
+	started := time.Now()
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	defer func() {
+		// a panic is answered with a 500 by the recovery middleware, later
+		failed := recover()
+		s.metrics().Observe("wiki_http_request_duration_seconds", time.Since(started), "method", c.Request.Method, "route", route)
+		s.metrics().recordRequest(c.Request.Method, route, failed != nil || c.Writer.Status() >= 400 || len(c.Errors) > 0)
+		if failed != nil {
+			panic(failed)
+		}
+	}()
+	c.Next()
+}
+
+const metricsReportIdentifier = "wiki_metrics"
+
+// writeMetricsReport rewrites the page summarizing request latencies and the
+// busiest routes and pages. The counts are kept in its frontmatter. Page
+// names come from whatever URLs were asked for, so they're escaped.
+func (s *Site) writeMetricsReport() error {
+	m := s.metrics()
+	matter := map[string]interface{}{"identifier": metricsReportIdentifier, "title": "Wiki Metrics"}
+	m.breakdownFrontmatter(matter)
+
+	body := "\n# Wiki Metrics\n\n"
+	body += "_Request latencies since the wiki started " + m.started.Format(time.RFC1123) + ". Scrape `/metrics` for the full histograms._\n\n"
+	body += "| Request | Count | p50 | p90 | p99 |\n|---|---|---|---|---|\n"
+	for _, summary := range m.LatencySummaries() {
+		body += fmt.Sprintf("| `%s` | %d | %s | %s | %s |\n", strings.Trim(summary.Labels, "{}"), summary.Count,
+			summary.P50.Round(time.Microsecond), summary.P90.Round(time.Microsecond), summary.P99.Round(time.Microsecond))
+	}
+	body += "\n## Requests\n\n| Route | Requests | Errors |\n|---|---|---|\n"
+	for _, stats := range m.RequestBreakdown() {
+		body += fmt.Sprintf("| `%s %s` | %g | %g |\n", stats.Method, stats.Route, stats.Requests, stats.Errors)
+	}
+	body += "\n## Most Viewed Pages\n\n"
+	for _, page := range m.TopPages(topPagesReported) {
+		body += fmt.Sprintf("  - [[%s]]: %g\n", escapeTemplates(page.Identifier), page.Views)
+	}
+
+	text, err := JoinFrontmatter(matter, body, false)
+	if err != nil {
+		return err
+	}
+	return s.Open(metricsReportIdentifier).Update(text)
+}
+
+func (s *Site) metricsReportJob(progress *JobProgress) error {
+	return s.writeMetricsReport()
+}
+
+// handleMetricsSummary answers with the latencies, requests and most viewed
+// pages the metrics report has. It only reads them, as a read-only route
+// must; the metrics_report job writes the report page.
+func (s *Site) handleMetricsSummary(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"latencies": s.metrics().LatencySummaries(),
+		"requests":  s.metrics().RequestBreakdown(),
+		"pages":     s.metrics().TopPages(topPagesReported),
+		"page":      metricsReportIdentifier,
+	})
+}
+
+func (s *Site) handleMetrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	s.WritePrometheus(c.Writer)
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"sort"
+	"strings"
+)
+
+// topPagesReported is how many of the most viewed pages are listed on the
+// metrics page and in the metrics summary. They aren't in /metrics, which
+// anyone can scrape without the access code, as page names can be private.
+const topPagesReported = 20
+
+// RequestStats counts the requests to one route, and how many of them failed
+// (answered with a 4xx or 5xx).
+type RequestStats struct {
+	Method   string  `json:"method"`
+	Route    string  `json:"route"`
+	Requests float64 `json:"requests"`
+	Errors   float64 `json:"errors"`
+}
+
+// PageViews is how often a page has been viewed.
+type PageViews struct {
+	Identifier string  `json:"identifier"`
+	Views      float64 `json:"views"`
+}
+
+func (m *WikiMetricsRecorder) recordRequest(method, route string, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := method + " " + route
+	stats, ok := m.requests[key]
+	if !ok {
+		stats = &RequestStats{Method: method, Route: route}
+		m.requests[key] = stats
+	}
+	stats.Requests++
+	if failed {
+		stats.Errors++
+	}
+}
+
+func (m *WikiMetricsRecorder) recordPageView(identifier string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pageViews[strings.ToLower(identifier)]++
+}
+
+// RequestBreakdown lists the routes, busiest first.
+func (m *WikiMetricsRecorder) RequestBreakdown() []RequestStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.requestBreakdown()
+}
+
+func (m *WikiMetricsRecorder) requestBreakdown() []RequestStats {
+	breakdown := []RequestStats{}
+	for _, stats := range m.requests {
+		breakdown = append(breakdown, *stats)
+	}
+	sort.Slice(breakdown, func(i, j int) bool {
+		if breakdown[i].Requests != breakdown[j].Requests {
+			return breakdown[i].Requests > breakdown[j].Requests
+		}
+		return breakdown[i].Method+breakdown[i].Route < breakdown[j].Method+breakdown[j].Route
+	})
+	return breakdown
+}
+
+// TopPages lists the n most viewed pages, most viewed first.
+func (m *WikiMetricsRecorder) TopPages(n int) []PageViews {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.topPages(n)
+}
+
+func (m *WikiMetricsRecorder) topPages(n int) []PageViews {
+	top := []PageViews{}
+	for identifier, views := range m.pageViews {
+		top = append(top, PageViews{Identifier: identifier, Views: views})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Views != top[j].Views {
+			return top[i].Views > top[j].Views
+		}
+		return top[i].Identifier < top[j].Identifier
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// breakdownFrontmatter is how the breakdown is kept in the metrics page's
+// frontmatter:
+//
+//	[requests."GET /:page/*command"]
+//	requests = 120
+//	errors = 3
+//
+//	[page_views]
+//	drill = 14
+func (m *WikiMetricsRecorder) breakdownFrontmatter(matter map[string]interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	requests := map[string]interface{}{}
+	for _, stats := range m.requestBreakdown() {
+		requests[stats.Method+" "+stats.Route] = map[string]interface{}{
+			"requests": frontmatterNumberValue(stats.Requests),
+			"errors":   frontmatterNumberValue(stats.Errors),
+		}
+	}
+	matter["requests"] = requests
+	views := map[string]interface{}{}
+	for _, page := range m.topPages(pageViewsKept) {
+		views[page.Identifier] = frontmatterNumberValue(page.Views)
+	}
+	matter["page_views"] = views
+}
+
+// restoreBreakdown picks up the counts kept in the metrics page, so they
+// carry on across restarts.
+func (m *WikiMetricsRecorder) restoreBreakdown(matter map[string]interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if requests, ok := frontmatterTable(matter, "requests", false); ok {
+		for key, v := range requests {
+			parts := strings.SplitN(key, " ", 2)
+			stats, ok := v.(map[string]interface{})
+			if len(parts) != 2 || !ok {
+				continue
+			}
+			count, _ := frontmatterNumber(stats["requests"])
+			errors, _ := frontmatterNumber(stats["errors"])
+			m.requests[key] = &RequestStats{Method: parts[0], Route: parts[1], Requests: count, Errors: errors}
+		}
+	}
+	if views, ok := frontmatterTable(matter, "page_views", false); ok {
+		for identifier, v := range views {
+			if count, ok := frontmatterNumber(v); ok {
+				m.pageViews[identifier] = count
+			}
+		}
+	}
+}
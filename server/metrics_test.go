@@ -0,0 +1,139 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-contrib/sessions/cookie"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "drill", "# Drill")
+	router := s.Router()
+
+	req, _ := http.NewRequest("GET", "/drill/view", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	w := httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("Unexpected response %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	for _, expected := range []string{
+		"# TYPE wiki_page_views_total counter\nwiki_page_views_total 1\n",
+		"wiki_page_saves_total 1\n",
+		"wiki_pages 1\n",
+		`wiki_job_queue_pending{queue="user"} 0`,
+		"# TYPE go_goroutines gauge\n",
+	} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("Expected %q in\n%s", expected, w.Body.String())
+		}
+	}
+	if strings.Contains(w.Body.String(), "drill") {
+		t.Errorf("Expected no page names in metrics anyone can scrape, got\n%s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/metrics/summary", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"drill"`) || s.hasPageFile(metricsReportIdentifier, ".md") {
+		t.Errorf("Expected the summary to list the page without writing the report, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	if labels := formatLabels("route", "/x", "page", `say "hi"`); labels != `{route="/x",page="say \"hi\""}` {
+		t.Errorf("Unexpected labels %s", labels)
+	}
+	if labels := formatLabels(); labels != "" {
+		t.Errorf("Expected no labels, got %s", labels)
+	}
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	m := NewWikiMetricsRecorder()
+	for i := 0; i < 90; i++ {
+		m.Observe("wiki_http_request_duration_seconds", 3*time.Millisecond, "route", "/:page/*command")
+	}
+	for i := 0; i < 10; i++ {
+		m.Observe("wiki_http_request_duration_seconds", 2*time.Second, "route", "/:page/*command")
+	}
+
+	summaries := m.LatencySummaries()
+	if len(summaries) != 1 || summaries[0].Count != 100 {
+		t.Fatalf("Unexpected summaries %+v", summaries)
+	}
+	summary := summaries[0]
+	if summary.P50 <= 0 || summary.P50 > 5*time.Millisecond {
+		t.Errorf("Expected p50 in the first bucket, got %s", summary.P50)
+	}
+	if summary.P99 <= time.Second || summary.P99 > 2500*time.Millisecond {
+		t.Errorf("Expected p99 in the 1s-2.5s bucket, got %s", summary.P99)
+	}
+
+	s := &Site{PathToData: t.TempDir(), Metrics: m}
+	var out strings.Builder
+	s.WritePrometheus(&out)
+	for _, expected := range []string{
+		`wiki_http_request_duration_seconds_bucket{route="/:page/*command",le="0.005"} 90`,
+		`wiki_http_request_duration_seconds_bucket{route="/:page/*command",le="+Inf"} 100`,
+		`wiki_http_request_duration_seconds_count{route="/:page/*command"} 100`,
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected %q in\n%s", expected, out.String())
+		}
+	}
+
+	if err := s.writeMetricsReport(); err != nil {
+		t.Fatal(err)
+	}
+	if text := s.Open(metricsReportIdentifier).Text.GetCurrent(); !strings.Contains(text, "| 100 |") {
+		t.Errorf("Expected the report to list the requests: %s", text)
+	}
+}
+
+func TestRequestAndPageBreakdownPersists(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), SessionStore: cookie.NewStore([]byte("secret"))}
+	newTestPage(s, "drill", "# Drill")
+	router := s.Router()
+	for _, url := range []string{"/drill/view", "/drill/view", "/static/nope.css"} {
+		req, _ := http.NewRequest("GET", url, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	breakdown := s.metrics().RequestBreakdown()
+	if len(breakdown) != 1 || breakdown[0].Route != "/:page/*command" || breakdown[0].Requests != 3 || breakdown[0].Errors != 1 {
+		t.Errorf("Unexpected breakdown %+v", breakdown)
+	}
+	if top := s.metrics().TopPages(5); len(top) != 1 || top[0].Identifier != "drill" || top[0].Views != 2 {
+		t.Errorf("Unexpected top pages %+v", top)
+	}
+
+	if err := s.writeMetricsReport(); err != nil {
+		t.Fatal(err)
+	}
+	restarted := &Site{PathToData: s.PathToData}
+	if top := restarted.metrics().TopPages(5); len(top) != 1 || top[0].Views != 2 {
+		t.Errorf("Expected the page views to be restored, got %+v", top)
+	}
+	if breakdown := restarted.metrics().RequestBreakdown(); len(breakdown) != 1 || breakdown[0].Requests != 3 {
+		t.Errorf("Expected the requests to be restored, got %+v", breakdown)
+	}
+}
+
+func TestMetricsReportEscapesPageNames(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	s.metrics().recordPageView("drill {{.Title}}")
+	if err := s.writeMetricsReport(); err != nil {
+		t.Fatal(err)
+	}
+	if text := s.Open(metricsReportIdentifier).Text.GetCurrent(); !strings.Contains(text, `drill {{"{{"}}.title}}`) {
+		t.Errorf("Expected page names to be escaped rather than run as templates: %s", text)
+	}
+}
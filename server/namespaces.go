@@ -0,0 +1,168 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NamespaceSeparator separates the namespaces in an identifier such as
+// projects/alpha/notes. Identifiers without one are in the root namespace,
+// as every page was before namespaces.
+const NamespaceSeparator = "/"
+
+// pageCommands are what can follow a page's identifier in its URL, such as
+// /projects/alpha/notes/edit.
+var pageCommands = map[string]bool{"view": true, "edit": true, "read": true, "raw": true, "history": true, "erase": true, "frontmatter": true, "list": true}
+
+// splitPageRoute puts back together the identifier and command of a
+// namespaced page's URL, which the router splits after the first namespace.
+// If the URL doesn't end in a command it is all identifier and the command
+// is empty.
+func splitPageRoute(page, command string) (string, string) {
+	rest := strings.Trim(command, NamespaceSeparator)
+	if rest == "" {
+		return page, command
+	}
+	segments := strings.Split(rest, NamespaceSeparator)
+	last := segments[len(segments)-1]
+	if !pageCommands[last] {
+		return cleanIdentifier(page + NamespaceSeparator + rest), ""
+	}
+	if len(segments) == 1 {
+		return page, command
+	}
+	return cleanIdentifier(page + NamespaceSeparator + strings.Join(segments[:len(segments)-1], NamespaceSeparator)), "/" + last
+}
+
+// cleanIdentifier drops the empty namespaces from an identifier, as in
+// projects//alpha/.
+func cleanIdentifier(identifier string) string {
+	segments := []string{}
+	for _, segment := range strings.Split(identifier, NamespaceSeparator) {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return strings.Join(segments, NamespaceSeparator)
+}
+
+// NamespaceOf is the namespace an identifier is in, "" for the root.
+func NamespaceOf(identifier string) string {
+	if i := strings.LastIndex(identifier, NamespaceSeparator); i >= 0 {
+		return identifier[:i]
+	}
+	return ""
+}
+
+// resolveLink finds the page a [[link]] on the page from means. A link
+// starting with / is from the root namespace. Otherwise it is looked for in
+// from's namespace and then each namespace above it, so [[notes]] on
+// projects/alpha/plan is projects/alpha/notes if there is such a page. A
+// link to a page that doesn't exist anywhere is to a new page beside from.
+// Pages in the root namespace link exactly as they always have.
+func (s *Site) resolveLink(from, link string) string {
+	if strings.HasPrefix(link, NamespaceSeparator) {
+		return cleanIdentifier(link)
+	}
+	namespace := NamespaceOf(from)
+	if namespace == "" || s == nil {
+		return link
+	}
+	for ns := namespace; ns != ""; ns = NamespaceOf(ns) {
+		candidate := ns + NamespaceSeparator + link
+		if s.hasPageFile(candidate, ".json") {
+			return candidate
+		}
+		if _, ok := s.lookupIdentifier(strings.ToLower(candidate)); ok {
+			return candidate
+		}
+	}
+	if s.hasPageFile(link, ".json") {
+		return link
+	}
+	if _, ok := s.lookupIdentifier(strings.ToLower(link)); ok {
+		return link
+	}
+	return namespace + NamespaceSeparator + link
+}
+
+// Breadcrumb is one of the namespaces a page is in.
+type Breadcrumb struct {
+	Identifier string `json:"identifier"`
+	Name       string `json:"name"`
+}
+
+// Breadcrumbs lists the namespaces an identifier is in, outermost first,
+// ending with the page itself.
+func Breadcrumbs(identifier string) []Breadcrumb {
+	crumbs := []Breadcrumb{}
+	segments := strings.Split(identifier, NamespaceSeparator)
+	for i, segment := range segments {
+		crumbs = append(crumbs, Breadcrumb{Identifier: strings.Join(segments[:i+1], NamespaceSeparator), Name: segment})
+	}
+	return crumbs
+}
+
+// NamespaceChild is a namespace within another and how many pages are in
+// it, however deep.
+type NamespaceChild struct {
+	Namespace string `json:"namespace"`
+	Pages     int    `json:"pages"`
+}
+
+// NamespaceListing is what is directly in a namespace.
+type NamespaceListing struct {
+	Namespace  string           `json:"namespace"`
+	Pages      []string         `json:"pages"`
+	Namespaces []NamespaceChild `json:"namespaces"`
+}
+
+// ListNamespace lists the pages directly in a namespace, "" being the root,
+// and the namespaces within it. Archived pages are left out.
+func (s *Site) ListNamespace(namespace string) NamespaceListing {
+	namespace = cleanIdentifier(strings.ToLower(namespace))
+	listing := NamespaceListing{Namespace: namespace, Pages: []string{}, Namespaces: []NamespaceChild{}}
+	prefix := ""
+	if namespace != "" {
+		prefix = namespace + NamespaceSeparator
+	}
+	children := map[string]int{}
+	for _, identifier := range s.PageIdentifiers() {
+		identifier = strings.ToLower(identifier)
+		if !strings.HasPrefix(identifier, prefix) {
+			continue
+		}
+		if _, archived := s.ArchivedAt(identifier); archived {
+			continue
+		}
+		rest := strings.TrimPrefix(identifier, prefix)
+		if i := strings.Index(rest, NamespaceSeparator); i >= 0 {
+			children[prefix+rest[:i]]++
+		} else {
+			listing.Pages = append(listing.Pages, identifier)
+		}
+	}
+	for child, pages := range children {
+		listing.Namespaces = append(listing.Namespaces, NamespaceChild{Namespace: child, Pages: pages})
+	}
+	sort.Strings(listing.Pages)
+	sort.Slice(listing.Namespaces, func(i, j int) bool { return listing.Namespaces[i].Namespace < listing.Namespaces[j].Namespace })
+	return listing
+}
+
+func (s *Site) handleListNamespace(c *gin.Context) {
+	type QueryJSON struct {
+		Namespace string `json:"namespace"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "listing": s.ListNamespace(json.Namespace)})
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNamespacedIdentifiers(t *testing.T) {
+	if got := MungeIdentifier("Projects/Alpha Notes//"); got != "projects/alpha_notes" {
+		t.Errorf("got %q", got)
+	}
+	if got := MungeIdentifier("Alpha Notes"); got != "alpha_notes" {
+		t.Errorf("got %q", got)
+	}
+	for _, tc := range []struct{ page, command, wantPage, wantCommand string }{
+		{"notes", "/view", "notes", "/view"},
+		{"projects", "/alpha/notes/edit", "projects/alpha/notes", "/edit"},
+		{"projects", "/alpha/notes", "projects/alpha/notes", ""},
+		{"projects", "/alpha//notes/", "projects/alpha/notes", ""},
+	} {
+		page, command := splitPageRoute(tc.page, tc.command)
+		if page != tc.wantPage || command != tc.wantCommand {
+			t.Errorf("%s%s: got %q %q", tc.page, tc.command, page, command)
+		}
+	}
+	want := []Breadcrumb{{"projects", "projects"}, {"projects/alpha", "alpha"}, {"projects/alpha/notes", "notes"}}
+	if got := Breadcrumbs("projects/alpha/notes"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestNamespacedLinks(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	for _, p := range []*Page{
+		newTestPage(s, "projects/alpha/notes", "Alpha notes"),
+		newTestPage(s, "projects/overview", "All the projects"),
+		newTestPage(s, "notes", "Notes about everything"),
+		newTestPage(s, "home", "Home"),
+	} {
+		if err := p.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plan := newTestPage(s, "projects/alpha/plan", "[[notes]] [[overview]] [[home]] [[/notes]] [[todo]]")
+	for _, link := range []string{"[notes](/projects/alpha/notes/view)", "[overview](/projects/overview/view)", "[home](/home/view)", "[/notes](/notes/view)", "[todo](/projects/alpha/todo/view)"} {
+		if !strings.Contains(plan.Text.GetCurrent(), link) {
+			t.Errorf("expected %s in %s", link, plan.Text.GetCurrent())
+		}
+	}
+	if err := plan.Save(); err != nil {
+		t.Fatal(err)
+	}
+	flat := newTestPage(s, "home", "[[notes]] [[todo]]")
+	if !strings.Contains(flat.Text.GetCurrent(), "[notes](/notes/view) [todo](/todo/view)") {
+		t.Errorf("got %s", flat.Text.GetCurrent())
+	}
+
+	listing := s.ListNamespace("projects")
+	if !reflect.DeepEqual(listing.Pages, []string{"projects/overview"}) || !reflect.DeepEqual(listing.Namespaces, []NamespaceChild{{"projects/alpha", 2}}) {
+		t.Errorf("got %+v", listing)
+	}
+	root := s.ListNamespace("")
+	if !reflect.DeepEqual(root.Pages, []string{"home", "notes"}) || len(root.Namespaces) != 1 {
+		t.Errorf("got %+v", root)
+	}
+
+	if err := s.RenamePage("projects/alpha/notes", "projects/alpha/minutes"); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/projects/alpha/notes/raw", nil)
+	s.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/projects/alpha/minutes/raw" {
+		t.Errorf("got %d %s", w.Code, w.Header().Get("Location"))
+	}
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/projects/alpha/minutes", nil)
+	s.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/projects/alpha/minutes/view" {
+		t.Errorf("got %d %s", w.Code, w.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWatchPageBatchesNotifications(t *testing.T) {
+	received := make(chan PageChangeNotification, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var notification PageChangeNotification
+		json.NewDecoder(req.Body).Decode(&notification)
+		received <- notification
+	}))
+	defer webhook.Close()
+
+	s := &Site{PathToData: t.TempDir()}
+	s.Notifier = NewNotifier(s, 50*time.Millisecond)
+	p := newTestPage(s, "garden", "# Garden")
+
+	if _, err := s.WatchPage("garden", WebhookChannel, "ftp://example.com"); err == nil {
+		t.Error("Expected a webhook that isn't http to be rejected")
+	}
+	if _, err := s.WatchPage("garden", EmailChannel, "sam@example.com"); err == nil {
+		t.Error("Expected email to need an smtp server")
+	}
+	watch, err := s.WatchPage("garden", WebhookChannel, webhook.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.Update("# Garden\n\nPlant tomatoes.")
+	p.Update("# Garden\n\nPlant tomatoes and basil.")
+	p.Update("# Garden\n\nPlant tomatoes, basil and peppers.")
+
+	select {
+	case notification := <-received:
+		if notification.Page != "garden" || notification.Edits != 3 {
+			t.Errorf("Expected one notification of three edits, got %+v", notification)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watcher was never notified")
+	}
+	select {
+	case notification := <-received:
+		t.Errorf("Expected the edits to be batched, got another notification %+v", notification)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := s.UnwatchPage(watch.ID); err != nil {
+		t.Fatal(err)
+	}
+	p.Update("# Garden\n\nDone.")
+	select {
+	case notification := <-received:
+		t.Errorf("Expected no notification after unwatching, got %+v", notification)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
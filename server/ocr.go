@@ -0,0 +1,135 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// OCREngine reads the text in an image.
+type OCREngine interface {
+	ExtractText(filename string, image []byte) (string, error)
+}
+
+// tesseractOCR runs the tesseract command line tool.
+type tesseractOCR struct {
+	command string
+}
+
+func (t tesseractOCR) ExtractText(filename string, image []byte) (string, error) {
+	cmd := exec.Command(t.command, "stdin", "stdout")
+	cmd.Stdin = bytes.NewReader(image)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %v %s", t.command, err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// httpOCR posts the image to an OCR service, which answers with the text,
+// either as plain text or as {"text": "..."}.
+type httpOCR struct {
+	url    string
+	client *http.Client
+}
+
+func (h httpOCR) ExtractText(filename string, image []byte) (string, error) {
+	req, err := http.NewRequest("POST", h.url, bytes.NewReader(image))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", http.DetectContentType(image))
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("OCR service answered %s", resp.Status)
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var answer struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(body, &answer); err != nil {
+			return "", err
+		}
+		return answer.Text, nil
+	}
+	return string(body), nil
+}
+
+// NewOCREngine makes the engine named by --ocr: tesseract (optionally
+// tesseract:/path/to/tesseract) or the http URL of an OCR service.
+func NewOCREngine(spec string) (OCREngine, error) {
+	if spec == "tesseract" || strings.HasPrefix(spec, "tesseract:") {
+		command := strings.TrimPrefix(strings.TrimPrefix(spec, "tesseract"), ":")
+		if command == "" {
+			command = "tesseract"
+		}
+		return tesseractOCR{command: command}, nil
+	}
+	u, err := url.Parse(spec)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("ocr %q should be tesseract, tesseract:/path/to/tesseract, or the http URL of an OCR service", spec)
+	}
+	return httpOCR{url: spec, client: &http.Client{Timeout: time.Minute}}, nil
+}
+
+// ocr returns the site's OCR engine, or nil when there is none.
+func (s *Site) ocr() OCREngine {
+	s.ocrOnce.Do(func() {
+		if s.OCR != nil || s.OCRProvider == "" {
+			return
+		}
+		engine, err := NewOCREngine(s.OCRProvider)
+		if err != nil {
+			if s.Logger != nil {
+				s.Logger.Error("Can't read uploads: %v", err)
+			}
+			return
+		}
+		s.OCR = engine
+	})
+	return s.OCR
+}
+
+// OCRUpload reads the text in an uploaded image into its metadata. Failures
+// are kept in the metadata too, and returned so the job is retried.
+func (s *Site) OCRUpload(name string) error {
+	engine := s.ocr()
+	if engine == nil {
+		return fmt.Errorf("OCR needs the wiki to be started with --ocr")
+	}
+	metadata, err := s.UploadMetadata(name)
+	if err != nil {
+		return err
+	}
+	image, err := ioutil.ReadFile(s.uploadPath(name))
+	if err != nil {
+		return err
+	}
+	text, err := engine.ExtractText(metadata.Filename, image)
+	metadata.Text = strings.TrimSpace(text)
+	metadata.OCRError = ""
+	if err != nil {
+		metadata.OCRError = err.Error()
+	}
+	metadata.OCRAt = time.Now()
+	if writeErr := s.writeUploadMetadata(metadata); writeErr != nil {
+		return writeErr
+	}
+	return err
+}
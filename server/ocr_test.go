@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeOCR struct{}
+
+func (fakeOCR) ExtractText(filename string, image []byte) (string, error) {
+	return "  HARDWARE STORE\nWood glue  $4.99\n", nil
+}
+
+// pngHeader is enough of a PNG to be sniffed as one.
+const pngHeader = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+func TestOCRUploadedImages(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), OCR: fakeOCR{}}
+	link, err := s.saveUpload("receipt.png", []byte(pngHeader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.saveUpload("notes.txt", []byte("wood glue is in the garage")); err != nil {
+		t.Fatal(err)
+	}
+	name := strings.TrimPrefix(link[:strings.Index(link, "?")], "/uploads/")
+
+	var metadata UploadMetadata
+	for i := 0; i < 100; i++ {
+		if metadata, _ = s.UploadMetadata(name); metadata.Text != "" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if metadata.Text != "HARDWARE STORE\nWood glue  $4.99" || metadata.ContentType != "image/png" || metadata.Filename != "receipt.png" {
+		t.Fatalf("Expected the receipt's text in its metadata, got %+v", metadata)
+	}
+
+	uploads, err := s.SearchUploads("wood GLUE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uploads) != 1 || uploads[0].Name != name || uploads[0].URL() != link {
+		t.Errorf("Expected only the image's text to be searched, got %+v", uploads)
+	}
+	if uploads, _ := s.SearchUploads("receipt"); len(uploads) != 1 {
+		t.Errorf("Expected uploads to be found by file name too, got %+v", uploads)
+	}
+}
+
+func TestHTTPOCREngine(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"text": "Model 42 manual"}`))
+	}))
+	defer service.Close()
+
+	engine, err := NewOCREngine(service.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, err := engine.ExtractText("manual.jpg", []byte("jpeg")); err != nil || text != "Model 42 manual" {
+		t.Errorf("Expected the service's text, got %q %v", text, err)
+	}
+	if _, err := NewOCREngine("magic"); err == nil {
+		t.Error("Expected an unknown engine to be refused")
+	}
+}
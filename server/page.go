@@ -3,7 +3,7 @@ package server
 import (
 	"bytes"
 	"encoding/json"
-	"io/ioutil"
+	"fmt"
 	"net/http"
 	"os"
 	"path"
@@ -12,6 +12,7 @@ import (
 	"sort"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/adrg/frontmatter"
 	"github.com/schollz/versionedtext"
@@ -40,8 +41,11 @@ func (p Page) LastEditUnixTime() int64 {
 }
 
 func (s *Site) ReadFrontMatter(name string) (map[string]interface{}, error) {
-	content, err := ioutil.ReadFile(path.Join(s.PathToData, encodeToBase32(strings.ToLower(name))+".md"))
+	content, err := s.readPageFile(name, ".md")
 	if err != nil {
+		if target, ok := s.lookupIdentifier(name); ok {
+			return s.ReadFrontMatter(target)
+		}
 		return nil, err
 	}
 
@@ -60,8 +64,11 @@ func (s *Site) Open(name string) (p *Page) {
 	p.Identifier = name
 	p.Text = versionedtext.NewVersionedText("")
 	p.Render()
-	bJSON, err := ioutil.ReadFile(path.Join(s.PathToData, encodeToBase32(strings.ToLower(name))+".json"))
+	bJSON, err := s.readPageFile(name, ".json")
 	if err != nil {
+		if target, ok := s.lookupIdentifier(name); ok {
+			return s.Open(target)
+		}
 		return
 	}
 	err = json.Unmarshal(bJSON, &p)
@@ -72,7 +79,7 @@ func (s *Site) Open(name string) (p *Page) {
 }
 
 func (s *Site) OpenOrInit(identifier string, req *http.Request) (p *Page) {
-	bJSON, err := ioutil.ReadFile(path.Join(s.PathToData, encodeToBase32(strings.ToLower(identifier))+".json"))
+	bJSON, err := s.readPageFile(identifier, ".json")
 	if err != nil {
 		p = new(Page)
 		p.Site = s
@@ -94,6 +101,7 @@ func (s *Site) OpenOrInit(identifier string, req *http.Request) (p *Page) {
 
 [inventory]
 container= ""
+location_hint = ""
 items = [
 
 ]
@@ -109,6 +117,8 @@ items = [
 
 		if tmpl == "inv_item" {
 			initialText += "### Goes in: {{LinkTo .Inventory.Container }}\n"
+			initialText += "{{if .Inventory.LocationHint}}_{{ .Inventory.LocationHint }}_{{end}}\n"
+			initialText += "{{if .Inventory.Photo}}![{{or .Title .Identifier}}]({{ .Inventory.Photo }}){{end}}\n"
 		}
 
 		p.Text = versionedtext.NewVersionedText(initialText)
@@ -162,13 +172,18 @@ func (d DirectoryEntry) Sys() interface{} {
 	return nil
 }
 
+// DirectoryList lists the pages, leaving out archived ones.
 func (s *Site) DirectoryList() []os.FileInfo {
-	files, _ := ioutil.ReadDir(s.PathToData)
-	entries := make([]os.FileInfo, len(files))
+	names, _ := s.store().List("")
+	archived, _ := s.archive()
+	entries := make([]os.FileInfo, len(names))
 	found := -1
-	for _, f := range files {
-		if strings.HasSuffix(f.Name(), ".json") {
-			name := DecodeFileName(f.Name())
+	for _, file := range names {
+		if strings.HasSuffix(file, ".json") {
+			name := DecodeFileName(file)
+			if _, ok := archived[strings.ToLower(name)]; ok {
+				continue
+			}
 			p := s.Open(name)
 			found = found + 1
 			entries[found] = DirectoryEntry{
@@ -184,6 +199,40 @@ func (s *Site) DirectoryList() []os.FileInfo {
 	return entries
 }
 
+// PageIdentifiers lists the identifiers of every page in the data directory.
+func (s *Site) PageIdentifiers() []string {
+	names, _ := s.store().List("")
+	identifiers := []string{}
+	for _, name := range names {
+		if strings.HasSuffix(name, ".json") {
+			identifiers = append(identifiers, DecodeFileName(name))
+		}
+	}
+	return identifiers
+}
+
+// pageTitle is a page's title, or its identifier if it hasn't one.
+func (s *Site) pageTitle(identifier string) string {
+	if matter, err := s.ReadFrontMatter(identifier); err == nil {
+		if title := frontmatterString(matter["title"]); title != "" {
+			return title
+		}
+	}
+	return identifier
+}
+
+// EachFrontmatter calls fn with the frontmatter of every page that has some.
+func (s *Site) EachFrontmatter(fn func(identifier string, matter map[string]interface{})) {
+	for _, identifier := range s.PageIdentifiers() {
+		matter, err := s.ReadFrontMatter(identifier)
+		if err != nil || len(matter) == 0 {
+			continue
+		}
+		normalizeFrontmatter(matter)
+		fn(identifier, matter)
+	}
+}
+
 type UploadEntry struct {
 	os.FileInfo
 }
@@ -208,11 +257,24 @@ func DecodeFileName(s string) string {
 	return s2
 }
 
+// CheckDocumentSize refuses text longer than max-document-length, counted
+// in characters; 0 is no limit.
+func (s *Site) CheckDocumentSize(text string) error {
+	limit := s.Settings().MaxDocumentSize
+	if length := utf8.RuneCountInString(text); limit > 0 && uint(length) > limit {
+		return fmt.Errorf("the page is %d characters long, more than the %d allowed", length, limit)
+	}
+	return nil
+}
+
 // Update cleans the text and updates the versioned text
 // and generates a new render
 func (p *Page) Update(newText string) error {
 	// Trim space from end
 	newText = strings.TrimRight(newText, "\n\t ")
+	if err := p.Site.CheckDocumentSize(newText); err != nil {
+		return err
+	}
 
 	// Update the versioned text
 	p.Text.Update(newText)
@@ -229,40 +291,79 @@ func (p *Page) Render() {
 	// Convert [[page]] to [page](/page/view)
 	currentText := p.Text.GetCurrent()
 	for _, s := range rBracketPage.FindAllString(currentText, -1) {
-		currentText = strings.Replace(currentText, s, "["+s[2:len(s)-2]+"](/"+s[2:len(s)-2]+"/view)", 1)
+		link := s[2 : len(s)-2]
+		currentText = strings.Replace(currentText, s, "["+link+"](/"+p.Site.resolveLink(p.Identifier, link)+"/view)", 1)
 	}
 	p.Text.Update(currentText)
 
-	p.RenderedPage, p.FrontmatterJson = MarkdownToHtmlAndJsonFrontmatter(p.Text.GetCurrent(), true, p.Site)
+	html, matter, generation, ok := p.Site.cachedRender(p.Identifier, currentText)
+	if ok {
+		p.RenderedPage, p.FrontmatterJson = html, matter
+		return
+	}
+	deps := newRenderDependencies()
+	p.RenderedPage, p.FrontmatterJson = markdownToHtmlAndJsonFrontmatter(p.Site.RenderDiagrams(p.Text.GetCurrent()), true, p.Site, deps)
+	p.Site.cacheRender(p.Identifier, currentText, generation, deps, p.RenderedPage, p.FrontmatterJson)
 }
 
 func (p *Page) Save() error {
 	p.Site.saveMut.Lock()
 	defer p.Site.saveMut.Unlock()
+	aliases := p.aliases()
+	if err := p.Site.checkAliases(p.Identifier, aliases); err != nil {
+		return err
+	}
+	created := p.IsNew()
 	bJSON, err := json.MarshalIndent(p, "", " ")
 	if err != nil {
 		return err
 	}
 
-	err = ioutil.WriteFile(path.Join(p.Site.PathToData, encodeToBase32(strings.ToLower(p.Identifier))+".json"), bJSON, 0644)
+	err = p.Site.writePageFile(p.Identifier, ".json", bJSON)
 	if err != nil {
 		return err
 	}
 
 	// Write the current Markdown
-	return ioutil.WriteFile(path.Join(p.Site.PathToData, encodeToBase32(strings.ToLower(p.Identifier))+".md"), []byte(p.Text.CurrentText), 0644)
+	err = p.Site.writePageFile(p.Identifier, ".md", []byte(p.Text.CurrentText))
+	if err != nil {
+		return err
+	}
+	p.Site.indexAliases(p.Identifier, aliases)
+	p.Site.pageChangedForIndex(p.Identifier)
+	p.Site.pageChangedForRender(p.Identifier, aliases...)
+	if err := p.Site.reanchorAnnotations(strings.ToLower(p.Identifier), p.Text.CurrentText); err != nil {
+		p.Site.Logger.Error("Could not re-anchor the annotations on %s: %v", p.Identifier, err)
+	}
+	p.Site.notifier().PageChanged(p.Identifier, false, time.Now())
+	p.Site.pageSavedForTags(p.Identifier)
+	event := PageUpdatedEvent
+	if created {
+		event = PageCreatedEvent
+	}
+	p.Site.webhooks().Publish(event, map[string]interface{}{
+		"identifier": strings.ToLower(p.Identifier),
+		"url":        p.Site.AbsoluteURL(nil, "/"+strings.ToLower(p.Identifier)+"/view"),
+	})
+	p.Site.metrics().Inc("wiki_page_saves_total")
+	return nil
 }
 
 func (p *Page) IsNew() bool {
-	return !exists(path.Join(p.Site.PathToData, encodeToBase32(strings.ToLower(p.Identifier))+".json"))
+	return !p.Site.hasPageFile(p.Identifier, ".json")
 }
 
+// Erase moves the page to the trash.
 func (p *Page) Erase() error {
 	p.Site.Logger.Trace("Erasing " + p.Identifier)
 
-	err := os.Remove(path.Join(p.Site.PathToData, encodeToBase32(strings.ToLower(p.Identifier))+".json"))
-	if err != nil {
+	if err := p.Site.trash(p.Identifier); err != nil {
 		return err
 	}
-	return os.Remove(path.Join(p.Site.PathToData, encodeToBase32(strings.ToLower(p.Identifier))+".md"))
+	p.Site.indexAliases(p.Identifier, nil)
+	p.Site.pageChangedForIndex(p.Identifier)
+	p.Site.pageChangedForRender(p.Identifier)
+	p.Site.notifier().PageChanged(p.Identifier, true, time.Now())
+	p.Site.webhooks().Publish(PageDeletedEvent, map[string]interface{}{"identifier": strings.ToLower(p.Identifier)})
+	return p.Site.moveArchived(strings.ToLower(p.Identifier), "")
 }
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSitemapURLs is the most URLs one sitemap may list.
+const maxSitemapURLs = 50000
+
+// PageListing describes a page without its text.
+type PageListing struct {
+	Identifier   string    `json:"identifier"`
+	Title        string    `json:"title"`
+	LastModified time.Time `json:"last_modified"`
+	Tags         []string  `json:"tags"`
+	Size         int       `json:"size"`
+}
+
+// PageListOptions picks which pages ListPages returns and in what order.
+type PageListOptions struct {
+	// Sort is identifier, title, modified or size; a leading - reverses it.
+	// Pages are listed by identifier if it's empty.
+	Sort string `json:"sort"`
+	// Filter keeps only the pages whose frontmatter matches all of it.
+	Filter FrontmatterFilter `json:"filter"`
+	Offset int               `json:"offset"`
+	// Limit is how many pages to return, all of them if it is 0.
+	Limit int `json:"limit"`
+}
+
+// ListPages lists the pages that aren't archived, along with how many
+// there are before Offset and Limit are applied.
+func (s *Site) ListPages(options PageListOptions) ([]PageListing, int, error) {
+	descending := strings.HasPrefix(options.Sort, "-")
+	var less func(a, b PageListing) bool
+	switch strings.TrimPrefix(options.Sort, "-") {
+	case "", "identifier":
+		less = func(a, b PageListing) bool { return a.Identifier < b.Identifier }
+	case "title":
+		less = func(a, b PageListing) bool {
+			at, bt := strings.ToLower(a.Title), strings.ToLower(b.Title)
+			if at == bt {
+				return a.Identifier < b.Identifier
+			}
+			return at < bt
+		}
+	case "modified":
+		less = func(a, b PageListing) bool { return a.LastModified.Before(b.LastModified) }
+	case "size":
+		less = func(a, b PageListing) bool { return a.Size < b.Size }
+	default:
+		return nil, 0, fmt.Errorf("can't sort pages by %q; use identifier, title, modified or size", options.Sort)
+	}
+
+	pages := []PageListing{}
+	for _, identifier := range s.PageIdentifiers() {
+		if _, archived := s.ArchivedAt(identifier); archived {
+			continue
+		}
+		p := s.Open(identifier)
+		text := p.Text.GetCurrent()
+		if text == "" {
+			continue
+		}
+		matter, _, _, err := SplitFrontmatter(text)
+		if err != nil {
+			matter = map[string]interface{}{}
+		}
+		if !options.Filter.matchesAll(matter) {
+			continue
+		}
+		tags := []string{}
+		seen := map[string]bool{}
+		for _, tag := range pageTags(text) {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+		pages = append(pages, PageListing{
+			Identifier:   strings.ToLower(identifier),
+			Title:        frontmatterString(matter["title"]),
+			LastModified: p.LastEditTime(),
+			Tags:         tags,
+			Size:         len(text),
+		})
+	}
+	sort.SliceStable(pages, func(i, j int) bool {
+		if descending {
+			return less(pages[j], pages[i])
+		}
+		return less(pages[i], pages[j])
+	})
+
+	total := len(pages)
+	if options.Offset > 0 {
+		if options.Offset > len(pages) {
+			options.Offset = len(pages)
+		}
+		pages = pages[options.Offset:]
+	}
+	if options.Limit > 0 && options.Limit < len(pages) {
+		pages = pages[:options.Limit]
+	}
+	return pages, total, nil
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// WriteSitemap writes a sitemap of the pages, linking to them under baseURL.
+func WriteSitemap(w http.ResponseWriter, pages []PageListing, baseURL string) error {
+	set := sitemapURLSet{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	for _, page := range pages {
+		if len(set.URLs) == maxSitemapURLs {
+			break
+		}
+		set.URLs = append(set.URLs, sitemapURL{Loc: baseURL + "/" + page.Identifier + "/view", LastMod: page.LastModified.UTC().Format(time.RFC3339)})
+	}
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", " ")
+	return encoder.Encode(set)
+}
+
+func (s *Site) handleSitemap(c *gin.Context) {
+	pages, _, err := s.ListPages(PageListOptions{Sort: "-modified"})
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Header("Content-Type", "application/xml; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := WriteSitemap(c.Writer, pages, s.siteURL(c)); err != nil {
+		s.Logger.Error(err.Error())
+	}
+}
+
+func (s *Site) handleListPages(c *gin.Context) {
+	var json PageListOptions
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	pages, total, err := s.ListPages(json)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "pages": pages, "total": total})
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestListPages(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	for _, p := range []*Page{
+		newTestPage(s, "furnace", "+++\ntitle = \"Furnace\"\ntags = [\"hvac\"]\n\n[inventory]\ncontainer = \"basement\"\n+++\n\nFilter is 16x25. #maintenance\n"),
+		newTestPage(s, "thermostat", "+++\ntitle = \"Thermostat\"\n\n[inventory]\ncontainer = \"hallway\"\n+++\n"),
+		newTestPage(s, "basement", "+++\ntitle = \"Basement\"\n+++\n\nThe furnace, the water heater, the shelves full of paint cans and the boxes of old photographs.\n"),
+	} {
+		if err := p.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pages, total, err := s.ListPages(PageListOptions{Sort: "-size", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(pages) != 2 || pages[0].Identifier != "basement" || pages[1].Identifier != "furnace" {
+		t.Fatalf("got %d %+v", total, pages)
+	}
+	if strings.Join(pages[1].Tags, ",") != "hvac,maintenance" || pages[1].Title != "Furnace" {
+		t.Errorf("got %+v", pages[1])
+	}
+
+	pages, total, _ = s.ListPages(PageListOptions{Sort: "title", Offset: 1})
+	if total != 3 || len(pages) != 2 || pages[0].Identifier != "furnace" || pages[1].Identifier != "thermostat" {
+		t.Errorf("got %d %+v", total, pages)
+	}
+
+	pages, total, _ = s.ListPages(PageListOptions{Filter: FrontmatterFilter{"inventory.container": ""}})
+	if total != 2 || pages[0].Identifier != "furnace" || pages[1].Identifier != "thermostat" {
+		t.Errorf("got %d %+v", total, pages)
+	}
+
+	if _, _, err := s.ListPages(PageListOptions{Sort: "colour"}); err == nil {
+		t.Error("expected an error sorting by an unknown field")
+	}
+
+	w := httptest.NewRecorder()
+	pages, _, _ = s.ListPages(PageListOptions{})
+	if err := WriteSitemap(w, pages, "https://wiki.example"); err != nil {
+		t.Fatal(err)
+	}
+	sitemap := w.Body.String()
+	if !strings.Contains(sitemap, "<loc>https://wiki.example/furnace/view</loc>") || strings.Count(sitemap, "<url>") != 3 {
+		t.Errorf("got %s", sitemap)
+	}
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// PageStore keeps the page files: each page's .json history, .md text and
+// .annotations, and the trash. Keys are paths relative to the data directory,
+// like a page's base32 identifier and extension, or trash/<id>.json.
+// Uploads and the wiki's own tables stay in the data directory.
+type PageStore interface {
+	// Get reads a key; a missing key is an os.IsNotExist error.
+	Get(key string) ([]byte, error)
+	Put(key string, data []byte) error
+	// Delete removes a key; a missing key is not an error.
+	Delete(key string) error
+	Exists(key string) bool
+	// List names the keys directly under a prefix, "" or a directory like
+	// "trash/", without the prefix.
+	List(prefix string) ([]string, error)
+}
+
+// NewPageStore makes the --storage backend for a site's data directory:
+// files (the default), or s3://bucket/prefix for an S3-compatible bucket,
+// optionally with ?endpoint=https://host:port&region=name; credentials come
+// from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+func NewPageStore(spec, pathToData string) (PageStore, error) {
+	switch {
+	case spec == "" || spec == "files":
+		return &filePageStore{dir: pathToData}, nil
+	case strings.HasPrefix(spec, "s3://"):
+		return newS3PageStore(spec, pathToData)
+	case strings.HasPrefix(spec, "sqlite:"):
+		return nil, fmt.Errorf("storage %q: this build has no SQLite driver; use files or s3://", spec)
+	}
+	return nil, fmt.Errorf("storage %q should be files or s3://bucket/prefix", spec)
+}
+
+// store is the site's PageStore; it falls back to the data directory if the
+// site has none and its StorageBackend can't be made.
+func (s *Site) store() PageStore {
+	s.storeOnce.Do(func() {
+		if s.Store != nil {
+			return
+		}
+		store, err := NewPageStore(s.StorageBackend, s.PathToData)
+		if err != nil {
+			if s.Logger != nil {
+				s.Logger.Error("Could not use storage %q, using %s: %v", s.StorageBackend, s.PathToData, err)
+			}
+			store = &filePageStore{dir: s.PathToData}
+		}
+		s.Store = store
+	})
+	return s.Store
+}
+
+// pageKey is the PageStore key of one of a page's files.
+func pageKey(identifier, extension string) string {
+	return encodeToBase32(strings.ToLower(identifier)) + extension
+}
+
+// hasPageFile is whether a page has a file with the extension; a page
+// exists if it has a .json file.
+func (s *Site) hasPageFile(identifier, extension string) bool {
+	return s.store().Exists(pageKey(identifier, extension))
+}
+
+// moveKey moves a key in a PageStore; a missing key is an os.IsNotExist
+// error.
+func moveKey(store PageStore, from, to string) error {
+	data, err := store.Get(from)
+	if err != nil {
+		return err
+	}
+	if err := store.Put(to, data); err != nil {
+		return err
+	}
+	return store.Delete(from)
+}
+
+// filePageStore keeps page files in the data directory, one file per key.
+type filePageStore struct {
+	dir string
+}
+
+func (f *filePageStore) path(key string) string {
+	return path.Join(f.dir, path.Clean("/"+key))
+}
+
+func (f *filePageStore) Get(key string) ([]byte, error) {
+	return ioutil.ReadFile(f.path(key))
+}
+
+func (f *filePageStore) Put(key string, data []byte) error {
+	if err := os.MkdirAll(path.Dir(f.path(key)), 0755); err != nil {
+		return err
+	}
+	// written beside it and renamed over it, so it's never read half written
+	tmp, err := ioutil.TempFile(path.Dir(f.path(key)), ".put-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path(key))
+}
+
+func (f *filePageStore) Delete(key string) error {
+	if err := os.Remove(f.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (f *filePageStore) Exists(key string) bool {
+	return exists(f.path(key))
+}
+
+func (f *filePageStore) List(prefix string) ([]string, error) {
+	files, err := ioutil.ReadDir(f.path(prefix))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, file := range files {
+		if !file.IsDir() {
+			names = append(names, file.Name())
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jcelliott/lumber"
+)
+
+// fakeS3 is just enough of S3 for a PageStore: objects, and listing them
+// with a delimiter.
+func fakeS3(t *testing.T) *httptest.Server {
+	var mut sync.Mutex
+	objects := map[string][]byte{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mut.Lock()
+		defer mut.Unlock()
+		body, _ := ioutil.ReadAll(r.Body)
+		sum := sha256.Sum256(body)
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") ||
+			r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+			t.Errorf("Unsigned request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path == "/wiki" {
+			prefix := r.URL.Query().Get("prefix")
+			keys := []string{}
+			for key := range objects {
+				if strings.HasPrefix(key, prefix) && !strings.Contains(key[len(prefix):], "/") {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			fmt.Fprint(w, "<ListBucketResult>")
+			for _, key := range keys {
+				fmt.Fprintf(w, "<Contents><Key>%s</Key></Contents>", key)
+			}
+			fmt.Fprint(w, "<IsTruncated>false</IsTruncated></ListBucketResult>")
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/wiki/")
+		switch r.Method {
+		case http.MethodPut:
+			objects[key] = body
+		case http.MethodDelete:
+			delete(objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			data, ok := objects[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		}
+	}))
+}
+
+func TestFilePageStoreWritesWholeFiles(t *testing.T) {
+	dir := t.TempDir()
+	store := &filePageStore{dir: dir}
+	short, long := []byte("short"), []byte(strings.Repeat("long ", 100000))
+	if err := store.Put("page.json", short); err != nil {
+		t.Fatal(err)
+	}
+
+	// a page read while it's being saved is the old one or the new one,
+	// never half of the new one
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			if i%2 == 0 {
+				store.Put("page.json", long)
+			} else {
+				store.Put("page.json", short)
+			}
+		}
+	}()
+	for reading := true; reading; {
+		select {
+		case <-done:
+			reading = false
+		default:
+		}
+		if data, err := store.Get("page.json"); err != nil || (string(data) != string(short) && string(data) != string(long)) {
+			t.Fatalf("Read a page file half written: %d bytes, %v", len(data), err)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dir, "page.json")); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("Expected the page file readable as before, got %v %v", info, err)
+	}
+
+	// a write that fails leaves nothing half written behind
+	os.MkdirAll(filepath.Join(dir, "taken", "by a folder"), 0755)
+	if err := store.Put("taken", short); err == nil {
+		t.Error("Expected writing over a folder to fail")
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, ".put-*")); len(files) != 0 {
+		t.Errorf("Expected no temporary files left, got %v", files)
+	}
+}
+
+func TestS3PageStore(t *testing.T) {
+	server := fakeS3(t)
+	defer server.Close()
+	os.Setenv("AWS_ACCESS_KEY_ID", "key")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	dir := t.TempDir()
+	s := &Site{PathToData: dir, StorageBackend: "s3://wiki/pages?endpoint=" + server.URL, Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	newTestPage(s, "drill", "# Drill")
+	newTestPage(s, "saw", "# Saw")
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected nothing in the data directory, got %d files", len(files))
+	}
+	if got := s.Open("drill").Text.GetCurrent(); got != "# Drill" {
+		t.Errorf("Could not read a page back: %q", got)
+	}
+	identifiers := s.PageIdentifiers()
+	sort.Strings(identifiers)
+	if strings.Join(identifiers, ",") != "drill,saw" {
+		t.Errorf("Unexpected pages %v", identifiers)
+	}
+
+	if err := s.Open("saw").Erase(); err != nil {
+		t.Fatal(err)
+	}
+	trash, err := s.ListTrash()
+	if err != nil || len(trash) != 1 || s.hasPageFile("saw", ".json") {
+		t.Fatalf("Expected saw in the trash, got %+v %v", trash, err)
+	}
+	if _, err := s.RestoreFromTrash(trash[0].ID); err != nil || s.Open("saw").Text.GetCurrent() != "# Saw" {
+		t.Errorf("Could not restore saw: %v", err)
+	}
+
+	if _, err := NewPageStore("sqlite:wiki.db", dir); err == nil {
+		t.Error("Expected sqlite to be refused")
+	}
+	os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	if _, err := NewPageStore("s3://wiki", dir); err == nil {
+		t.Error("Expected s3 without credentials to be refused")
+	}
+}
+
+func TestS3Escape(t *testing.T) {
+	if got := s3Escape("pages/MZXW6===.json", true); got != "pages/MZXW6%3D%3D%3D.json" {
+		t.Errorf("Unexpected escaping %q", got)
+	}
+	if got := s3Escape("a/b c", false); got != "a%2Fb%20c" {
+		t.Errorf("Unexpected escaping %q", got)
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pageViewsKept is how many pages' view counts are kept across restarts on
+// the metrics page, the least viewed being forgotten first.
+const pageViewsKept = 1000
+
+const defaultPopularPages = 10
+
+// PopularPage is a page and how often it has been viewed.
+type PopularPage struct {
+	Identifier string  `json:"identifier"`
+	Title      string  `json:"title"`
+	Views      float64 `json:"views"`
+}
+
+// countPageView adds to a page's view count. Only the total is kept, never
+// who viewed it, and the users' own pages aren't counted at all.
+func (s *Site) countPageView(identifier string) {
+	if s.NoPageViewCounts || strings.HasPrefix(strings.ToLower(identifier), usersNamespace+NamespaceSeparator) {
+		return
+	}
+	s.metrics().recordPageView(identifier)
+}
+
+// GetPopularPages lists the most viewed pages, most viewed first, leaving
+// out those since deleted or archived.
+func (s *Site) GetPopularPages(limit int) []PopularPage {
+	if limit <= 0 {
+		limit = defaultPopularPages
+	}
+	popular := []PopularPage{}
+	for _, page := range s.metrics().TopPages(pageViewsKept) {
+		if len(popular) == limit {
+			break
+		}
+		if _, archived := s.ArchivedAt(page.Identifier); archived || !s.hasPageFile(page.Identifier, ".json") {
+			continue
+		}
+		popular = append(popular, PopularPage{Identifier: page.Identifier, Title: s.pageTitle(page.Identifier), Views: page.Views})
+	}
+	return popular
+}
+
+// BuildShowPopularPages lists the n most visited pages, for a "most
+// visited" block on a page.
+func BuildShowPopularPages(site *Site) func(int) string {
+	linkTo := BuildLinkTo(site)
+	return func(n int) string {
+		tmplString := `{{range .}}
+  - {{LinkTo .Identifier}}
+{{else}}
+	No page has been viewed yet
+{{end}}
+`
+		tmpl, err := template.New("content").Funcs(template.FuncMap{"LinkTo": linkTo}).Parse(tmplString)
+		if err != nil {
+			return err.Error()
+		}
+		buf := &bytes.Buffer{}
+		err = tmpl.Execute(buf, site.GetPopularPages(n))
+		if err != nil {
+			return err.Error()
+		}
+		return buf.String()
+	}
+}
+
+func (s *Site) handleGetPopularPages(c *gin.Context) {
+	type QueryJSON struct {
+		Limit int `json:"limit"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "pages": s.GetPopularPages(json.Limit)})
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetPopularPages(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	for _, p := range []*Page{
+		newTestPage(s, "furnace", "+++\nidentifier = \"furnace\"\ntitle = \"Furnace\"\n+++\n"),
+		newTestPage(s, "groceries", "Milk"),
+		newTestPage(s, "old_notes", "Notes"),
+	} {
+		if err := p.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, identifier := range []string{"groceries", "Furnace", "furnace", "old_notes", "old_notes", "old_notes", "deleted", "users/alice_example_com/pinned"} {
+		s.countPageView(identifier)
+	}
+	if err := s.ArchivePage("old_notes"); err != nil {
+		t.Fatal(err)
+	}
+
+	popular := s.GetPopularPages(0)
+	if len(popular) != 2 || popular[0].Identifier != "furnace" || popular[0].Title != "Furnace" || popular[0].Views != 2 || popular[1].Identifier != "groceries" {
+		t.Errorf("got %+v", popular)
+	}
+	for _, page := range s.metrics().TopPages(10) {
+		if strings.HasPrefix(page.Identifier, "users/") {
+			t.Errorf("expected the users' own pages not to be counted, got %+v", page)
+		}
+	}
+	if block := BuildShowPopularPages(s)(1); !strings.Contains(block, "[Furnace](/furnace)") || strings.Contains(block, "groceries") {
+		t.Errorf("got %s", block)
+	}
+
+	quiet := &Site{PathToData: t.TempDir(), NoPageViewCounts: true}
+	quiet.countPageView("furnace")
+	if top := quiet.metrics().TopPages(10); len(top) != 0 {
+		t.Errorf("expected no counts, got %+v", top)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PinnedPage is a page on a user's quick-access list.
+type PinnedPage struct {
+	Identifier string `json:"identifier"`
+	Title      string `json:"title"`
+}
+
+// pinnedPagesIdentifier is the system page holding a user's pins.
+func (s *Site) pinnedPagesIdentifier(identity string) string {
+	return s.userPageIdentifier(identity, "pinned")
+}
+
+func (s *Site) pinnedIdentifiers(identity string) []string {
+	matter, err := s.ReadFrontMatter(s.pinnedPagesIdentifier(identity))
+	if err != nil {
+		return []string{}
+	}
+	return frontmatterStrings(matter["pinned"])
+}
+
+// ListPinnedPages lists the pages a user has pinned, in the order they were
+// pinned. Pages that have since been deleted are left out.
+func (s *Site) ListPinnedPages(identity string) []PinnedPage {
+	pages := []PinnedPage{}
+	for _, identifier := range s.pinnedIdentifiers(identity) {
+		p := s.Open(identifier)
+		if p.IsNew() {
+			continue
+		}
+		pages = append(pages, PinnedPage{Identifier: identifier, Title: s.pageTitle(identifier)})
+	}
+	return pages
+}
+
+// PinPage adds a page to a user's pins, or with unpin takes it off. The
+// pins are kept in the frontmatter of the user's pinned page, whose text
+// lists them.
+func (s *Site) PinPage(identity, identifier string, unpin bool) error {
+	if identity == "" {
+		return errNoIdentity
+	}
+	identifier = strings.ToLower(identifier)
+	if !unpin && !s.pageExists(identifier) {
+		return fmt.Errorf("there is no page %q to pin", identifier)
+	}
+	s.pinsMut.Lock()
+	defer s.pinsMut.Unlock()
+	pinned := []string{}
+	for _, existing := range s.pinnedIdentifiers(identity) {
+		if existing != identifier {
+			pinned = append(pinned, existing)
+		}
+	}
+	if !unpin {
+		pinned = append(pinned, identifier)
+	}
+
+	id := s.pinnedPagesIdentifier(identity)
+	body := "\n# Pinned pages\n\n"
+	for _, page := range pinned {
+		body += "  - [" + page + "](/" + page + "/view)\n"
+	}
+	matter := map[string]interface{}{"identifier": id, "title": "Pinned pages for " + identity, "pinned": pinned}
+	text, err := JoinFrontmatter(matter, body, false)
+	if err != nil {
+		return err
+	}
+	return s.Open(id).Update(text)
+}
+
+func (s *Site) handlePinPage(c *gin.Context) {
+	type QueryJSON struct {
+		Page  string `json:"page"`
+		Unpin bool   `json:"unpin"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	identity := requestIdentity(c)
+	if err := s.PinPage(identity, json.Page, json.Unpin); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "pinned": s.ListPinnedPages(identity)})
+}
+
+func (s *Site) handleListPinnedPages(c *gin.Context) {
+	identity := requestIdentity(c)
+	if identity == "" {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": errNoIdentity.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "pinned": s.ListPinnedPages(identity)})
+}
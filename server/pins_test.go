@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/jcelliott/lumber"
+)
+
+func TestPinPage(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	for _, p := range []*Page{
+		newTestPage(s, "furnace", "+++\ntitle = \"Furnace\"\n+++\n"),
+		newTestPage(s, "groceries", "Milk"),
+	} {
+		if err := p.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.PinPage("alice@example.com", "groceries", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PinPage("alice@example.com", "Furnace", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PinPage("bob@example.com", "furnace", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PinPage("alice@example.com", "boiler", false); err == nil {
+		t.Error("expected an error pinning a page that doesn't exist")
+	}
+	if err := s.PinPage("", "furnace", false); err != errNoIdentity {
+		t.Errorf("got %v", err)
+	}
+
+	pinned := s.ListPinnedPages("alice@example.com")
+	if len(pinned) != 2 || pinned[0].Identifier != "groceries" || pinned[1].Title != "Furnace" {
+		t.Errorf("got %+v", pinned)
+	}
+	text := s.Open("users/alice_example_com/pinned").Text.GetCurrent()
+	if !strings.Contains(text, "[furnace](/furnace/view)") {
+		t.Errorf("got %s", text)
+	}
+
+	if err := s.PinPage("alice@example.com", "groceries", true); err != nil {
+		t.Fatal(err)
+	}
+	if pinned := s.ListPinnedPages("alice@example.com"); len(pinned) != 1 || pinned[0].Identifier != "furnace" {
+		t.Errorf("got %+v", pinned)
+	}
+	if pinned := s.ListPinnedPages("bob@example.com"); len(pinned) != 1 {
+		t.Errorf("got %+v", pinned)
+	}
+
+	s.SessionStore = cookie.NewStore([]byte("secret"))
+	s.Logger = lumber.NewConsoleLogger(lumber.WARN)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/pins/list", strings.NewReader("{}"))
+	req.Header.Set(defaultIdentityHeader, "Bob@Example.com")
+	s.Router().ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `"identifier":"furnace"`) {
+		t.Errorf("got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var printTemplate = template.Must(template.New("print.tmpl").Parse(PrintTemplate))
+
+// renderPrint lays out a page's HTML for printing, without the menus and
+// with a QR code of url in the footer, so a printed label or recipe leads
+// back to its page. Its stylesheet is under basePath.
+func renderPrint(title string, body []byte, url, basePath string, now time.Time) ([]byte, error) {
+	data := map[string]interface{}{
+		"BasePath": basePath,
+		"Title":    title,
+		"Body":     template.HTML(body),
+		"URL":      url,
+		"Date":     now.Format("Jan 2, 2006"),
+	}
+	// a URL too long for a QR code is still printed as text
+	if qr, err := NewQRCode(url); err == nil {
+		data["QRCode"] = template.HTML(qr.SVG())
+	}
+	buf := &bytes.Buffer{}
+	if err := printTemplate.Execute(buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// PrintPage renders a page for printing, linking to it under baseURL.
+func (s *Site) PrintPage(identifier, baseURL string) ([]byte, error) {
+	p := s.Open(identifier)
+	if p.IsNew() {
+		return nil, fmt.Errorf("there is no page %q", identifier)
+	}
+	p.Render()
+	return renderPrint(s.pageTitle(p.Identifier), s.linkUnderBasePath(p.RenderedPage), baseURL+"/"+p.Identifier+"/view", s.BasePath, time.Now())
+}
+
+func (s *Site) handleRenderPage(c *gin.Context) {
+	type QueryJSON struct {
+		Page string `json:"page"`
+		// Format is print for the page laid out for printing, or empty for
+		// just its HTML.
+		Format string `json:"format"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	var html []byte
+	switch json.Format {
+	case "print":
+		html, err = s.PrintPage(json.Page, s.siteURL(c))
+	case "":
+		p := s.Open(json.Page)
+		if p.IsNew() {
+			err = fmt.Errorf("there is no page %q", json.Page)
+		}
+		p.Render()
+		html = s.linkUnderBasePath(p.RenderedPage)
+	default:
+		err = fmt.Errorf("unknown format %q; use print, or leave it out", json.Format)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "html": string(html)})
+}
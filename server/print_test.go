@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+)
+
+func TestPrintPage(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), SessionStore: cookie.NewStore([]byte("secret"))}
+	p := newTestPage(s, "pancakes", "+++\ntitle = \"Pancakes\"\n+++\n# Pancakes\n\n- [ ] flour\n- [ ] eggs\n")
+	if err := p.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/pancakes/view?format=print", nil)
+	req.Host = "wiki.example"
+	s.Router().ServeHTTP(w, req)
+	html := w.Body.String()
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, html)
+	}
+	for _, want := range []string{"<title>Pancakes</title>", `<h1 id="pancakes">Pancakes</h1>`, "http://wiki.example/pancakes/view", `<div class="qr"><svg`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected %q in %s", want, html)
+		}
+	}
+	if strings.Contains(html, "pure-menu") {
+		t.Errorf("expected no menus when printing: %s", html)
+	}
+
+	printed, err := s.PrintPage("pancakes", "https://wiki.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(printed), "https://wiki.example/pancakes/view") {
+		t.Errorf("got %s", printed)
+	}
+	if _, err := s.PrintPage("waffles", "https://wiki.example"); err == nil {
+		t.Error("expected an error printing a page that doesn't exist")
+	}
+}
@@ -0,0 +1,435 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// QR codes are made here rather than with a library, just big enough for
+// page URLs: byte mode, error correction level M, versions 1 to 10.
+
+// qrBlocks is, for each version, the error correction codewords per block
+// and the data codewords of each block, at level M.
+var qrBlocks = [...]struct {
+	ecPerBlock int
+	data       []int
+}{
+	1:  {10, []int{16}},
+	2:  {16, []int{28}},
+	3:  {26, []int{44}},
+	4:  {18, []int{32, 32}},
+	5:  {24, []int{43, 43}},
+	6:  {16, []int{27, 27, 27, 27}},
+	7:  {18, []int{31, 31, 31, 31}},
+	8:  {22, []int{38, 38, 39, 39}},
+	9:  {22, []int{36, 36, 36, 37, 37}},
+	10: {26, []int{43, 43, 43, 43, 44}},
+}
+
+// qrAlignment is where each version's alignment patterns are centred.
+var qrAlignment = [...][]int{
+	2: {6, 18}, 3: {6, 22}, 4: {6, 26}, 5: {6, 30}, 6: {6, 34},
+	7: {6, 22, 38}, 8: {6, 24, 42}, 9: {6, 26, 46}, 10: {6, 28, 50},
+}
+
+// QRCode is a square of modules, true being dark.
+type QRCode struct {
+	Size    int
+	modules [][]bool
+	reserve [][]bool // function patterns, which data and masks leave alone
+}
+
+// Dark says whether the module at column x, row y is dark.
+func (q *QRCode) Dark(x, y int) bool {
+	return q.modules[y][x]
+}
+
+// NewQRCode encodes text in the smallest QR code that holds it.
+func NewQRCode(text string) (*QRCode, error) {
+	data := []byte(text)
+	version := 0
+	for v := 1; v < len(qrBlocks); v++ {
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+		capacity := 0
+		for _, n := range qrBlocks[v].data {
+			capacity += n
+		}
+		if 4+countBits+8*len(data) <= capacity*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("%d bytes is too long for a QR code", len(data))
+	}
+
+	q := &QRCode{Size: 17 + 4*version}
+	q.modules = make([][]bool, q.Size)
+	q.reserve = make([][]bool, q.Size)
+	for i := range q.modules {
+		q.modules[i] = make([]bool, q.Size)
+		q.reserve[i] = make([]bool, q.Size)
+	}
+	q.drawFunctionPatterns(version)
+	q.drawCodewords(qrCodewords(version, data))
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormatBits(mask)
+		if penalty := q.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		q.applyMask(mask) // masking twice undoes it
+	}
+	q.applyMask(best)
+	q.drawFormatBits(best)
+	return q, nil
+}
+
+func (q *QRCode) set(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.reserve[y][x] = true
+}
+
+func (q *QRCode) drawFunctionPatterns(version int) {
+	for i := 0; i < q.Size; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	// finder patterns, with their light separators
+	for _, centre := range [][2]int{{3, 3}, {q.Size - 4, 3}, {3, q.Size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := centre[0]+dx, centre[1]+dy
+				if x >= 0 && x < q.Size && y >= 0 && y < q.Size {
+					distance := qrMax(qrAbs(dx), qrAbs(dy))
+					q.set(x, y, distance != 2 && distance != 4)
+				}
+			}
+		}
+	}
+	positions := qrAlignment[version]
+	last := len(positions) - 1
+	for i, cx := range positions {
+		for j, cy := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue // under a finder pattern
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.set(cx+dx, cy+dy, qrMax(qrAbs(dx), qrAbs(dy)) != 1)
+				}
+			}
+		}
+	}
+	q.drawFormatBits(0) // reserves the format areas; drawn again once masked
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := (bits>>uint(i))&1 == 1
+			a, b := q.Size-11+i%3, i/3
+			q.set(a, b, dark)
+			q.set(b, a, dark)
+		}
+	}
+}
+
+func (q *QRCode) drawFormatBits(mask int) {
+	data := 0<<3 | mask // level M is 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>uint(i))&1 == 1 }
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.set(q.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.Size-15+i, bit(i))
+	}
+	q.set(8, q.Size-8, true)
+}
+
+// qrCodewords is the data, padded and split into blocks, with each block's
+// error correction, interleaved as they are laid out.
+func qrCodewords(version int, data []byte) []byte {
+	blocks := qrBlocks[version]
+	capacity := 0
+	for _, n := range blocks.data {
+		capacity += n
+	}
+
+	var bits []bool
+	put := func(value, length int) {
+		for i := length - 1; i >= 0; i-- {
+			bits = append(bits, (value>>uint(i))&1 == 1)
+		}
+	}
+	put(0x4, 4)
+	if version >= 10 {
+		put(len(data), 16)
+	} else {
+		put(len(data), 8)
+	}
+	for _, b := range data {
+		put(int(b), 8)
+	}
+	put(0, qrMin(4, capacity*8-len(bits)))
+	put(0, (8-len(bits)%8)%8)
+	codewords := make([]byte, 0, capacity)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for _, bit := range bits[i : i+8] {
+			b <<= 1
+			if bit {
+				b |= 1
+			}
+		}
+		codewords = append(codewords, b)
+	}
+	for pad := byte(0xEC); len(codewords) < capacity; pad ^= 0xEC ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+
+	divisor := qrDivisor(blocks.ecPerBlock)
+	dataBlocks := [][]byte{}
+	ecBlocks := [][]byte{}
+	for _, n := range blocks.data {
+		block := codewords[:n]
+		codewords = codewords[n:]
+		dataBlocks = append(dataBlocks, block)
+		ecBlocks = append(ecBlocks, qrRemainder(block, divisor))
+	}
+	result := []byte{}
+	for i := 0; i < blocks.data[len(blocks.data)-1]; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < blocks.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// qrMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func qrMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+// qrDivisor is the Reed-Solomon generator polynomial of the given degree,
+// leading coefficient left out.
+func qrDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = qrMultiply(result[j], root)
+			if j+1 < degree {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = qrMultiply(root, 0x02)
+	}
+	return result
+}
+
+func qrRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coefficient := range divisor {
+			result[i] ^= qrMultiply(coefficient, factor)
+		}
+	}
+	return result
+}
+
+// drawCodewords lays the codewords out in the zigzag from the bottom right,
+// two columns at a time, skipping the vertical timing pattern.
+func (q *QRCode) drawCodewords(codewords []byte) {
+	i := 0
+	for right := q.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < q.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if upward {
+					y = q.Size - 1 - vert
+				}
+				if !q.reserve[y][x] && i < len(codewords)*8 {
+					q.modules[y][x] = (codewords[i/8]>>uint(7-i%8))&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (q *QRCode) applyMask(mask int) {
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.reserve[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the code would be to scan, to pick the mask.
+func (q *QRCode) penalty() int {
+	penalty := 0
+	line := func(get func(i int) bool) {
+		run := 1
+		for i := 1; i <= q.Size; i++ {
+			if i < q.Size && get(i) == get(i-1) {
+				run++
+				continue
+			}
+			if run >= 5 {
+				penalty += 3 + run - 5
+			}
+			run = 1
+		}
+		// dark-light-dark-dark-dark-light-dark with four light on a side
+		finder := []bool{true, false, true, true, true, false, true}
+		for i := 0; i+7 <= q.Size; i++ {
+			match := true
+			for k, dark := range finder {
+				if get(i+k) != dark {
+					match = false
+					break
+				}
+			}
+			if !match {
+				continue
+			}
+			light := func(from, to int) bool {
+				for k := from; k < to; k++ {
+					if k >= 0 && k < q.Size && get(k) {
+						return false
+					}
+				}
+				return true
+			}
+			if light(i-4, i) || light(i+7, i+11) {
+				penalty += 40
+			}
+		}
+	}
+	for y := 0; y < q.Size; y++ {
+		line(func(x int) bool { return q.modules[y][x] })
+	}
+	for x := 0; x < q.Size; x++ {
+		line(func(y int) bool { return q.modules[y][x] })
+	}
+	dark := 0
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x+1 < q.Size && y+1 < q.Size {
+				c := q.modules[y][x]
+				if c == q.modules[y][x+1] && c == q.modules[y+1][x] && c == q.modules[y+1][x+1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+	total := q.Size * q.Size
+	penalty += ((qrAbs(dark*20-total*10)+total-1)/total - 1) * 10
+	return penalty
+}
+
+// SVG draws the code with a four module quiet zone, scaled to fit whatever
+// size it is given.
+func (q *QRCode) SVG() string {
+	border := 4
+	size := q.Size + 2*border
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, size, size)
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if q.modules[y][x] {
+				fmt.Fprintf(&b, "M%d,%dh1v1h-1z", x+border, y+border)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return b.String()
+}
+
+func qrAbs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func qrMax(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func qrMin(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestQRReedSolomon(t *testing.T) {
+	// "HELLO WORLD" at 1-M, from the worked example at thonky.com
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := qrRemainder(data, qrDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("got %v", got)
+	}
+}
+
+// readQRCode decodes what NewQRCode encodes, checking the format bits and
+// every block's error correction on the way.
+func readQRCode(t *testing.T, q *QRCode) string {
+	version := (q.Size - 17) / 4
+	format := 0
+	for i := 14; i >= 0; i-- {
+		format <<= 1
+		if q.Dark(q.Size-1-i, 8) && i < 8 || i >= 8 && q.Dark(8, q.Size-15+i) {
+			format |= 1
+		}
+	}
+	format ^= 0x5412
+	if format>>13 != 0 {
+		t.Fatalf("expected level M, got format %015b", format)
+	}
+	mask := format >> 10 & 7
+
+	unmasked := &QRCode{Size: q.Size, modules: make([][]bool, q.Size), reserve: make([][]bool, q.Size)}
+	for y := range unmasked.modules {
+		unmasked.modules[y] = append([]bool{}, q.modules[y]...)
+		unmasked.reserve[y] = make([]bool, q.Size)
+	}
+	unmasked.drawFunctionPatterns(version)
+	for y := range unmasked.modules {
+		copy(unmasked.modules[y], q.modules[y])
+	}
+	unmasked.applyMask(mask)
+
+	blocks := qrBlocks[version]
+	total := len(blocks.data) * blocks.ecPerBlock
+	for _, n := range blocks.data {
+		total += n
+	}
+	codewords := make([]byte, total)
+	i := 0
+	for right := q.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = q.Size - 1 - vert
+				}
+				if !unmasked.reserve[y][x] && i < total*8 {
+					if unmasked.modules[y][x] {
+						codewords[i/8] |= 1 << uint(7-i%8)
+					}
+					i++
+				}
+			}
+		}
+	}
+
+	dataBlocks := make([][]byte, len(blocks.data))
+	ecBlocks := make([][]byte, len(blocks.data))
+	k := 0
+	for i := 0; i < blocks.data[len(blocks.data)-1]; i++ {
+		for b, n := range blocks.data {
+			if i < n {
+				dataBlocks[b] = append(dataBlocks[b], codewords[k])
+				k++
+			}
+		}
+	}
+	for i := 0; i < blocks.ecPerBlock; i++ {
+		for b := range blocks.data {
+			ecBlocks[b] = append(ecBlocks[b], codewords[k])
+			k++
+		}
+	}
+	var data []byte
+	for b := range dataBlocks {
+		if !bytes.Equal(qrRemainder(dataBlocks[b], qrDivisor(blocks.ecPerBlock)), ecBlocks[b]) {
+			t.Fatalf("block %d's error correction doesn't match", b)
+		}
+		data = append(data, dataBlocks[b]...)
+	}
+
+	if data[0]>>4 != 4 {
+		t.Fatalf("expected byte mode, got %d", data[0]>>4)
+	}
+	bit := 4
+	read := func(n int) int {
+		v := 0
+		for ; n > 0; n-- {
+			v = v<<1 | int(data[bit/8]>>uint(7-bit%8)&1)
+			bit++
+		}
+		return v
+	}
+	count := read(8)
+	if version >= 10 {
+		count = count<<8 | read(8)
+	}
+	text := make([]byte, count)
+	for i := range text {
+		text[i] = byte(read(8))
+	}
+	return string(text)
+}
+
+func TestNewQRCode(t *testing.T) {
+	for _, text := range []string{
+		"hi",
+		"https://wiki.example/furnace/view",
+		"https://wiki.example/" + strings.Repeat("projects/alpha/", 6) + "notes/view",
+		strings.Repeat("x", 213),
+	} {
+		q, err := NewQRCode(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := readQRCode(t, q); got != text {
+			t.Errorf("got %q from a %dx%d code, want %q", got, q.Size, q.Size, text)
+		}
+	}
+	if q, _ := NewQRCode("https://wiki.example/furnace/view"); q.Size != 29 {
+		t.Errorf("expected version 3, got %dx%d", q.Size, q.Size)
+	}
+	if _, err := NewQRCode(strings.Repeat("x", 214)); err == nil {
+		t.Error("expected an error for text too long for version 10")
+	}
+
+	// the version information is the BCH code from the spec's table
+	q, _ := NewQRCode(strings.Repeat("x", 110))
+	version := 0
+	for i := 17; i >= 0; i-- {
+		version <<= 1
+		if q.Dark(q.Size-11+i%3, i/3) {
+			version |= 1
+		}
+	}
+	if q.Size != 45 || version != 0x07C94 {
+		t.Errorf("got %dx%d with version bits %x", q.Size, q.Size, version)
+	}
+
+	if svg := q.SVG(); !strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 53 53"`) {
+		t.Errorf("got %s", svg[:80])
+	}
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The categories requests are rate limited in.
+const (
+	RateLimitReads   = "reads"
+	RateLimitWrites  = "writes"
+	RateLimitUploads = "uploads"
+)
+
+// RateLimit lets each client make PerSecond requests in a category, in bursts
+// of up to Burst.
+type RateLimit struct {
+	Category  string  `json:"category"`
+	PerSecond float64 `json:"per_second"`
+	Burst     int     `json:"burst"`
+}
+
+// ParseRateLimit parses a `category=per_second:burst` rate limit, e.g.
+// `writes=2:20`.
+func ParseRateLimit(spec string) (RateLimit, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 {
+		return RateLimit{}, fmt.Errorf("rate limit %q should look like category=per_second:burst", spec)
+	}
+	category := parts[0]
+	if category != RateLimitReads && category != RateLimitWrites && category != RateLimitUploads {
+		return RateLimit{}, fmt.Errorf("rate limit %q: category should be %s, %s or %s", spec, RateLimitReads, RateLimitWrites, RateLimitUploads)
+	}
+	values := strings.SplitN(parts[1], ":", 2)
+	if len(values) != 2 {
+		return RateLimit{}, fmt.Errorf("rate limit %q should look like category=per_second:burst", spec)
+	}
+	perSecond, err := strconv.ParseFloat(values[0], 64)
+	if err != nil || perSecond <= 0 {
+		return RateLimit{}, fmt.Errorf("rate limit %q needs a positive rate", spec)
+	}
+	burst, err := strconv.Atoi(values[1])
+	if err != nil || burst < 1 {
+		return RateLimit{}, fmt.Errorf("rate limit %q needs a burst of at least 1", spec)
+	}
+	return RateLimit{Category: category, PerSecond: perSecond, Burst: burst}, nil
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter keeps a token bucket per category and client.
+type RateLimiter struct {
+	mu        sync.Mutex
+	limits    map[string]RateLimit
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func NewRateLimiter(limits []RateLimit) *RateLimiter {
+	r := &RateLimiter{limits: map[string]RateLimit{}, buckets: map[string]*tokenBucket{}}
+	for _, limit := range limits {
+		r.limits[limit.Category] = limit
+	}
+	return r
+}
+
+// Limits returns the limits in effect, by category.
+func (r *RateLimiter) Limits() []RateLimit {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	limits := []RateLimit{}
+	for _, category := range []string{RateLimitReads, RateLimitWrites, RateLimitUploads} {
+		if limit, ok := r.limits[category]; ok {
+			limits = append(limits, limit)
+		}
+	}
+	return limits
+}
+
+// SetLimits replaces the limits. Clients keep the tokens they have, up to the
+// new burst.
+func (r *RateLimiter) SetLimits(limits []RateLimit) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limits = map[string]RateLimit{}
+	for _, limit := range limits {
+		r.limits[limit.Category] = limit
+	}
+}
+
+// Allow takes a token from the client's bucket for the category. When there
+// are none left it says how long until there will be.
+func (r *RateLimiter) Allow(category, client string, now time.Time) (bool, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	limit, ok := r.limits[category]
+	if !ok {
+		return true, 0
+	}
+	r.sweep(now)
+
+	key := category + " " + client
+	bucket, ok := r.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		r.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(float64(limit.Burst), bucket.tokens+now.Sub(bucket.last).Seconds()*limit.PerSecond)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / limit.PerSecond * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// sweep forgets buckets that have filled up again, once a minute, so clients
+// that have gone away don't take up memory. r.mu must be held.
+func (r *RateLimiter) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < time.Minute {
+		return
+	}
+	r.lastSweep = now
+	for key, bucket := range r.buckets {
+		limit := r.limits[strings.SplitN(key, " ", 2)[0]]
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*limit.PerSecond >= float64(limit.Burst) {
+			delete(r.buckets, key)
+		}
+	}
+}
+
+func rateLimitCategory(c *gin.Context) string {
+	switch {
+	case c.Request.Method == http.MethodPost && c.FullPath() == "/uploads":
+		return RateLimitUploads
+	case c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead:
+		return RateLimitReads
+	}
+	return RateLimitWrites
+}
+
+// rateLimit is middleware answering 429 to clients, told apart by IP, that go
+// over their rate limit.
+func (s *Site) rateLimit(c *gin.Context) {
+	limiter := s.rateLimiter()
+	if limiter == nil {
+		return
+	}
+	category := rateLimitCategory(c)
+	allowed, retryAfter := limiter.Allow(category, c.ClientIP(), time.Now())
+	if !allowed {
+		s.metrics().Inc("wiki_rate_limited_total", "category", category)
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"success": false, "message": "Too many requests, slow down"})
+	}
+}
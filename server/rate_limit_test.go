@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	limit, err := ParseRateLimit("writes=0.5:10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit != (RateLimit{Category: RateLimitWrites, PerSecond: 0.5, Burst: 10}) {
+		t.Errorf("Did not parse the rate limit: %+v", limit)
+	}
+	for _, bad := range []string{"writes", "search=1:1", "reads=fast:1", "reads=1:0", "reads=0:5"} {
+		if _, err := ParseRateLimit(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	r := NewRateLimiter([]RateLimit{{Category: RateLimitWrites, PerSecond: 1, Burst: 2}})
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if ok, _ := r.Allow(RateLimitWrites, "10.0.0.1", now); !ok {
+			t.Fatal("The burst should be allowed")
+		}
+	}
+	ok, retryAfter := r.Allow(RateLimitWrites, "10.0.0.1", now)
+	if ok || retryAfter != time.Second {
+		t.Errorf("Expected to wait a second, got %v %s", ok, retryAfter)
+	}
+	if ok, _ := r.Allow(RateLimitWrites, "10.0.0.2", now); !ok {
+		t.Error("Another client has its own bucket")
+	}
+	if ok, _ := r.Allow(RateLimitReads, "10.0.0.1", now); !ok {
+		t.Error("Categories without a limit are not limited")
+	}
+	if ok, _ := r.Allow(RateLimitWrites, "10.0.0.1", now.Add(time.Second)); !ok {
+		t.Error("Expected a token after a second")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), RateLimiter: NewRateLimiter([]RateLimit{{Category: RateLimitWrites, PerSecond: 0.1, Burst: 1}})}
+	router := s.Router()
+
+	codes := []int{}
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/jobs/status", nil)
+		router.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "10" {
+			t.Errorf("Expected to be told to retry after 10s, got %q", w.Header().Get("Retry-After"))
+		}
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("Expected the second write to be throttled, got %v", codes)
+	}
+	if throttled := s.metrics().Counter("wiki_rate_limited_total", "category", RateLimitWrites); throttled != 1 {
+		t.Errorf("Expected one throttled request to be counted, got %v", throttled)
+	}
+}
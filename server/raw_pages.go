@@ -0,0 +1,135 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const mimeMarkdown = "text/markdown"
+
+// rawPageExtensions are the suffixes that ask for a page's source, or just
+// its rendered body, instead of the page, as in /garden/tomatoes.md.
+var rawPageExtensions = map[string]string{
+	".md":   mimeMarkdown,
+	".json": gin.MIMEJSON,
+	".html": gin.MIMEHTML,
+}
+
+// RawPage is a page's source as served to scripts: its frontmatter and the
+// markdown after it.
+type RawPage struct {
+	Identifier  string                 `json:"identifier"`
+	Frontmatter map[string]interface{} `json:"frontmatter"`
+	Markdown    string                 `json:"markdown"`
+}
+
+// rawPageRoute splits an extension asking for the source off a page, unless
+// there's a page by the whole name. The format is "" when it isn't asking.
+func (s *Site) rawPageRoute(page string) (string, string) {
+	for extension, format := range rawPageExtensions {
+		if !strings.HasSuffix(page, extension) || !s.Open(page).IsNew() {
+			continue
+		}
+		return strings.TrimSuffix(page, extension), format
+	}
+	return page, ""
+}
+
+// negotiatePageFormat is the format the Accept header asks for, "" for the
+// page as HTML.
+func negotiatePageFormat(c *gin.Context) string {
+	switch c.NegotiateFormat(gin.MIMEHTML, mimeMarkdown, gin.MIMEJSON) {
+	case mimeMarkdown:
+		return mimeMarkdown
+	case gin.MIMEJSON:
+		return gin.MIMEJSON
+	}
+	return ""
+}
+
+// GetRawPage is a page's source, following redirects and aliases. It is
+// false when there is no such page.
+func (s *Site) GetRawPage(identifier string) (RawPage, bool) {
+	if target, ok := s.Redirect(identifier); ok {
+		identifier = target
+	}
+	if target, ok := s.Alias(identifier); ok {
+		identifier = target
+	}
+	p := s.Open(identifier)
+	if p.IsNew() {
+		return RawPage{}, false
+	}
+	text := p.Text.GetCurrent()
+	matter, err := s.ReadFrontMatter(p.Identifier)
+	if err != nil || matter == nil {
+		matter = map[string]interface{}{}
+	}
+	return RawPage{Identifier: p.Identifier, Frontmatter: matter, Markdown: StripFrontmatter(text)}, true
+}
+
+func (s *Site) handleRawPage(c *gin.Context, identifier, format string) {
+	raw, ok := s.GetRawPage(identifier)
+	if !ok {
+		c.String(http.StatusNotFound, "No such page")
+		return
+	}
+	c.Header("Vary", "Accept")
+	if format == gin.MIMEJSON {
+		data, err := json.Marshal(raw)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		dataWithETag(c, gin.MIMEJSON+"; charset=utf-8", pageCacheControl, data)
+		return
+	}
+	// Markdown and HTML are served with Range support, so a very long page
+	// can be read a piece at a time, and are streamed rather than buffered.
+	p := s.Open(raw.Identifier)
+	content := []byte(p.Text.GetCurrent())
+	if format == gin.MIMEHTML {
+		p.Render()
+		content = s.linkUnderBasePath(p.RenderedPage)
+	}
+	c.Header("Content-Type", format+"; charset=utf-8")
+	c.Header("ETag", contentETag(content))
+	c.Header("Cache-Control", pageCacheControl)
+	http.ServeContent(c.Writer, c.Request, raw.Identifier, p.LastEditTime(), bytes.NewReader(content))
+}
+
+// ExportPages is the source of the pages ListPages lists with the options,
+// along with how many there are in all, for scripts copying the wiki.
+func (s *Site) ExportPages(options PageListOptions) ([]RawPage, int, error) {
+	listings, total, err := s.ListPages(options)
+	if err != nil {
+		return nil, 0, err
+	}
+	pages := []RawPage{}
+	for _, listing := range listings {
+		if raw, ok := s.GetRawPage(listing.Identifier); ok {
+			pages = append(pages, raw)
+		}
+	}
+	return pages, total, nil
+}
+
+func (s *Site) handleExportPages(c *gin.Context) {
+	var json PageListOptions
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	pages, total, err := s.ExportPages(json)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "pages": pages, "total": total})
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+)
+
+func TestRawPages(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), SessionStore: cookie.NewStore([]byte("secret"))}
+	newTestPage(s, "garden/tomatoes", "+++\ntitle = \"Tomatoes\"\n+++\n# Tomatoes\n").Save()
+	newTestPage(s, "notes.md", "# A page with a dot").Save()
+	newTestPage(s, "tomatoes", "# Tomatoes").Save()
+
+	get := func(url, accept string, headers ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		s.Router().ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/garden/tomatoes.md", "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/markdown") || !strings.Contains(w.Body.String(), "title = \"Tomatoes\"\n+++\n# Tomatoes") {
+		t.Errorf("Unexpected markdown: %d %s %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+
+	if w = get("/garden/tomatoes.md", "", "Range", "bytes=4-21"); w.Code != http.StatusPartialContent || w.Body.String() != "title = \"Tomatoes\"" {
+		t.Errorf("Expected a piece of the markdown, got %d %q", w.Code, w.Body.String())
+	}
+	if w = get("/garden/tomatoes.html", ""); !strings.Contains(w.Body.String(), "<h1") || strings.Contains(w.Body.String(), "<html") {
+		t.Errorf("Expected the rendered body alone, got %s", w.Body.String())
+	}
+
+	var raw RawPage
+	w = get("/garden/tomatoes.json", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw.Identifier != "garden/tomatoes" || raw.Frontmatter["title"] != "Tomatoes" || strings.TrimSpace(raw.Markdown) != "# Tomatoes" {
+		t.Errorf("Unexpected JSON: %+v", raw)
+	}
+
+	if w = get("/tomatoes", "text/markdown"); !strings.Contains(w.Body.String(), "# Tomatoes") || strings.Contains(w.Body.String(), "<html") {
+		t.Errorf("Expected markdown for Accept: text/markdown, got %s", w.Body.String())
+	}
+	if w = get("/garden/tomatoes/view", "application/json"); !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("Expected JSON for Accept: application/json, got %s", w.Header().Get("Content-Type"))
+	}
+	if w = get("/roses", "text/html,application/xhtml+xml,*/*;q=0.8"); w.Code != http.StatusFound {
+		t.Errorf("Expected browsers to be sent to the page, got %d", w.Code)
+	}
+
+	if w = get("/notes.md/view", ""); !strings.Contains(w.Body.String(), "A page with a dot") {
+		t.Errorf("Expected the page named with .md, got %s", w.Body.String())
+	}
+	if w = get("/missing.md", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing page, got %d", w.Code)
+	}
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRecentlyViewed is how many pages a user's recently viewed page keeps.
+const maxRecentlyViewed = 20
+
+// RecentlyViewedPage is a page a user viewed and when they last did.
+type RecentlyViewedPage struct {
+	Identifier string    `json:"identifier"`
+	Title      string    `json:"title"`
+	ViewedAt   time.Time `json:"viewed_at"`
+}
+
+// recentlyViewedIdentifier is the system page holding a user's history. It
+// only exists, with enabled set, for users who have opted in.
+func (s *Site) recentlyViewedIdentifier(identity string) string {
+	return s.userPageIdentifier(identity, "recently_viewed")
+}
+
+// recentlyViewed reads a user's history, most recent first, and whether
+// they have opted in to it.
+func (s *Site) recentlyViewed(identity string) ([]RecentlyViewedPage, bool) {
+	matter, err := s.ReadFrontMatter(s.recentlyViewedIdentifier(identity))
+	if err != nil || matter["enabled"] != true {
+		return nil, false
+	}
+	viewedAt, _ := frontmatterTable(matter, "viewed_at", false)
+	pages := []RecentlyViewedPage{}
+	for _, identifier := range frontmatterStrings(matter["viewed"]) {
+		at, _ := time.Parse(time.RFC3339, frontmatterString(viewedAt[identifier]))
+		pages = append(pages, RecentlyViewedPage{Identifier: identifier, ViewedAt: at})
+	}
+	return pages, true
+}
+
+// writeRecentlyViewed rewrites a user's history page.
+func (s *Site) writeRecentlyViewed(identity string, enabled bool, pages []RecentlyViewedPage) error {
+	id := s.recentlyViewedIdentifier(identity)
+	viewed := []string{}
+	viewedAt := map[string]interface{}{}
+	body := "\n# Recently viewed\n\n"
+	if !enabled {
+		body += "_Not kept; turn it on to have the pages you view listed here._\n"
+	}
+	for _, page := range pages {
+		viewed = append(viewed, page.Identifier)
+		viewedAt[page.Identifier] = page.ViewedAt.UTC().Format(time.RFC3339)
+		body += "  - [" + page.Identifier + "](/" + page.Identifier + "/view) " + page.ViewedAt.Format("Mon Jan 2 15:04") + "\n"
+	}
+	matter := map[string]interface{}{"identifier": id, "title": "Recently viewed by " + identity, "enabled": enabled, "viewed": viewed, "viewed_at": viewedAt}
+	text, err := JoinFrontmatter(matter, body, false)
+	if err != nil {
+		return err
+	}
+	return s.Open(id).Update(text)
+}
+
+// SetRecentlyViewedTracking opts a user in to keeping the pages they view,
+// or out, which also forgets the pages kept so far.
+func (s *Site) SetRecentlyViewedTracking(identity string, enabled bool) error {
+	if identity == "" {
+		return errNoIdentity
+	}
+	s.recentlyViewedMut.Lock()
+	defer s.recentlyViewedMut.Unlock()
+	pages, _ := s.recentlyViewed(identity)
+	if !enabled {
+		pages = nil
+	}
+	return s.writeRecentlyViewed(identity, enabled, pages)
+}
+
+// RecordView notes that a user viewed a page, if they have opted in. Views
+// of the users' own pages aren't kept, and neither is viewing the page at
+// the top of the list again.
+func (s *Site) RecordView(identity, identifier string, at time.Time) error {
+	identifier = strings.ToLower(identifier)
+	if identity == "" || strings.HasPrefix(identifier, usersNamespace+NamespaceSeparator) {
+		return nil
+	}
+	s.recentlyViewedMut.Lock()
+	defer s.recentlyViewedMut.Unlock()
+	pages, enabled := s.recentlyViewed(identity)
+	if !enabled || (len(pages) > 0 && pages[0].Identifier == identifier) {
+		return nil
+	}
+	updated := []RecentlyViewedPage{{Identifier: identifier, ViewedAt: at}}
+	for _, page := range pages {
+		if page.Identifier != identifier && len(updated) < maxRecentlyViewed {
+			updated = append(updated, page)
+		}
+	}
+	return s.writeRecentlyViewed(identity, true, updated)
+}
+
+// GetRecentlyViewed lists the pages a user viewed most recently, up to
+// limit, leaving out any since deleted. It is empty unless they opted in.
+func (s *Site) GetRecentlyViewed(identity string, limit int) []RecentlyViewedPage {
+	if limit <= 0 || limit > maxRecentlyViewed {
+		limit = maxRecentlyViewed
+	}
+	pages, _ := s.recentlyViewed(identity)
+	result := []RecentlyViewedPage{}
+	for _, page := range pages {
+		if len(result) == limit {
+			break
+		}
+		if !s.pageExists(page.Identifier) {
+			continue
+		}
+		page.Title = s.pageTitle(page.Identifier)
+		result = append(result, page)
+	}
+	return result
+}
+
+func (s *Site) handleGetRecentlyViewed(c *gin.Context) {
+	type QueryJSON struct {
+		Limit int `json:"limit"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	identity := requestIdentity(c)
+	if identity == "" {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": errNoIdentity.Error()})
+		return
+	}
+	_, enabled := s.recentlyViewed(identity)
+	c.JSON(http.StatusOK, gin.H{"success": true, "enabled": enabled, "pages": s.GetRecentlyViewed(identity, json.Limit)})
+}
+
+func (s *Site) handleTrackRecentlyViewed(c *gin.Context) {
+	type QueryJSON struct {
+		Enabled bool `json:"enabled"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	if err := s.SetRecentlyViewedTracking(requestIdentity(c), json.Enabled); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "enabled": json.Enabled})
+}
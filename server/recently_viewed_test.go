@@ -0,0 +1,75 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/jcelliott/lumber"
+)
+
+func TestRecentlyViewed(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), SessionStore: cookie.NewStore([]byte("secret")), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	for _, p := range []*Page{
+		newTestPage(s, "furnace", "+++\ntitle = \"Furnace\"\n+++\n"),
+		newTestPage(s, "groceries", "Milk"),
+	} {
+		if err := p.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+	if err := s.RecordView("alice@example.com", "furnace", now); err != nil {
+		t.Fatal(err)
+	}
+	if s.pageExists(s.recentlyViewedIdentifier("alice@example.com")) {
+		t.Error("expected nothing to be kept before opting in")
+	}
+
+	if err := s.SetRecentlyViewedTracking("alice@example.com", true); err != nil {
+		t.Fatal(err)
+	}
+	s.RecordView("alice@example.com", "furnace", now)
+	s.RecordView("alice@example.com", "groceries", now.Add(time.Minute))
+	s.RecordView("alice@example.com", "Furnace", now.Add(2*time.Minute))
+	s.RecordView("alice@example.com", "users/alice_example_com/pinned", now.Add(3*time.Minute))
+	viewed := s.GetRecentlyViewed("alice@example.com", 0)
+	if len(viewed) != 2 || viewed[0].Identifier != "furnace" || viewed[0].Title != "Furnace" || !viewed[0].ViewedAt.Equal(now.Add(2*time.Minute)) || viewed[1].Identifier != "groceries" {
+		t.Errorf("got %+v", viewed)
+	}
+	if viewed := s.GetRecentlyViewed("alice@example.com", 1); len(viewed) != 1 {
+		t.Errorf("got %+v", viewed)
+	}
+
+	for i := 0; i < maxRecentlyViewed+5; i++ {
+		identifier := "page_" + string(rune('a'+i))
+		newTestPage(s, identifier, "text").Save()
+		s.RecordView("alice@example.com", identifier, now)
+	}
+	if viewed := s.GetRecentlyViewed("alice@example.com", 100); len(viewed) != maxRecentlyViewed {
+		t.Errorf("expected the history to be capped, got %d", len(viewed))
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/groceries/view", nil)
+	req.Header.Set(defaultIdentityHeader, "alice@example.com")
+	s.Router().ServeHTTP(w, req)
+	if viewed := s.GetRecentlyViewed("alice@example.com", 1); len(viewed) != 1 || viewed[0].Identifier != "groceries" {
+		t.Errorf("expected viewing a page to record it, got %+v", viewed)
+	}
+
+	if err := s.SetRecentlyViewedTracking("alice@example.com", false); err != nil {
+		t.Fatal(err)
+	}
+	s.RecordView("alice@example.com", "furnace", now)
+	if viewed := s.GetRecentlyViewed("alice@example.com", 0); len(viewed) != 0 {
+		t.Errorf("expected opting out to forget the history, got %+v", viewed)
+	}
+	if text := s.Open(s.recentlyViewedIdentifier("alice@example.com")).Text.GetCurrent(); !strings.Contains(text, "enabled = false") {
+		t.Errorf("got %s", text)
+	}
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redirectsFile holds the redirect table, old identifier to new, as JSON. It
+// doesn't end in .json so it is never mistaken for a page.
+const redirectsFile = "redirects.table"
+
+func (s *Site) pageFile(identifier, extension string) string {
+	return path.Join(s.PathToData, encodeToBase32(strings.ToLower(identifier))+extension)
+}
+
+// Redirects returns the redirect table.
+func (s *Site) Redirects() (map[string]string, error) {
+	redirects := map[string]string{}
+	data, err := ioutil.ReadFile(path.Join(s.PathToData, redirectsFile))
+	if os.IsNotExist(err) {
+		return redirects, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &redirects)
+	return redirects, err
+}
+
+func (s *Site) saveRedirects(redirects map[string]string) error {
+	data, err := json.MarshalIndent(redirects, "", " ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(s.PathToData, redirectsFile), data, 0644)
+}
+
+// Redirect returns where a page that used to be at identifier lives now. A
+// page created at the old identifier since takes its place again.
+func (s *Site) Redirect(identifier string) (string, bool) {
+	identifier = strings.ToLower(identifier)
+	if s.hasPageFile(identifier, ".json") {
+		return "", false
+	}
+	redirects, err := s.Redirects()
+	if err != nil {
+		return "", false
+	}
+	target, ok := redirects[identifier]
+	return target, ok
+}
+
+// AddRedirect sends from to to. Redirects that pointed at from are pointed at
+// to as well, so there is never more than one hop to follow.
+func (s *Site) AddRedirect(from, to string) error {
+	from, to = strings.ToLower(from), strings.ToLower(to)
+	if from == to {
+		return errors.New("a page can't redirect to itself")
+	}
+	s.redirectsMut.Lock()
+	defer s.redirectsMut.Unlock()
+
+	redirects, err := s.Redirects()
+	if err != nil {
+		return err
+	}
+	for old, target := range redirects {
+		if target == from {
+			redirects[old] = to
+		}
+	}
+	delete(redirects, to)
+	redirects[from] = to
+	return s.saveRedirects(redirects)
+}
+
+// RenamePage moves a page to a new identifier and leaves a redirect behind,
+// so links, bookmarks and printed labels for the old one keep working.
+func (s *Site) RenamePage(from, to string) error {
+	from, to = strings.ToLower(strings.TrimSpace(from)), strings.ToLower(strings.TrimSpace(to))
+	if to == "" || from == to {
+		return errors.New("need a new identifier")
+	}
+	if !s.hasPageFile(from, ".json") {
+		return fmt.Errorf("there is no page %q", from)
+	}
+	if s.hasPageFile(to, ".json") {
+		return fmt.Errorf("there is already a page %q", to)
+	}
+	if err, ok := s.checkIdentifierCollision(to).(*IdentifierCollisionError); ok && err.Existing != from {
+		return err
+	}
+
+	p := s.Open(from)
+	if p.IsLocked {
+		return errors.New("page is locked")
+	}
+	// the page's aliases move with it
+	s.indexAliases(from, nil)
+	p.Identifier = to
+	matter, _, _, err := SplitFrontmatter(p.Text.GetCurrent())
+	if err == nil && matter["identifier"] != nil {
+		err = p.UpdateFrontmatter(func(matter map[string]interface{}) error {
+			matter["identifier"] = to
+			return nil
+		})
+	} else {
+		err = p.Save()
+	}
+	if err != nil {
+		s.indexAliases(from, p.aliases())
+		return err
+	}
+
+	if err := s.store().Delete(pageKey(from, ".json")); err != nil {
+		return err
+	}
+	if err := s.store().Delete(pageKey(from, ".md")); err != nil {
+		return err
+	}
+	if err := moveKey(s.store(), pageKey(from, ".annotations"), pageKey(to, ".annotations")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	s.pageChangedForIndex(from)
+	s.pageChangedForRender(from)
+	if err := s.moveWatches(from, to); err != nil {
+		return err
+	}
+	if err := s.moveArchived(from, to); err != nil {
+		return err
+	}
+	return s.AddRedirect(from, to)
+}
+
+func (s *Site) handleRenamePage(c *gin.Context) {
+	type QueryJSON struct {
+		Page          string `json:"page"`
+		NewIdentifier string `json:"new_identifier"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	if err := s.RenamePage(json.Page, json.NewIdentifier); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Renamed", "identifier": strings.ToLower(json.NewIdentifier)})
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRenamePageLeavesRedirect(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "drill", "+++\nidentifier = \"drill\"\ntitle = \"Drill\"\n+++\n# Drill")
+
+	if err := s.RenamePage("drill", "cordless_drill"); err != nil {
+		t.Fatal(err)
+	}
+	if exists(s.pageFile("drill", ".json")) {
+		t.Error("Expected the old page to be gone")
+	}
+	p := s.Open("drill")
+	if p.Identifier != "cordless_drill" || !strings.Contains(p.Text.GetCurrent(), `identifier = "cordless_drill"`) {
+		t.Errorf("Expected the old identifier to open the renamed page: %s %s", p.Identifier, p.Text.GetCurrent())
+	}
+	if matter, err := s.ReadFrontMatter("drill"); err != nil || matter["title"] != "Drill" {
+		t.Errorf("Expected the frontmatter through the redirect: %v %v", matter, err)
+	}
+
+	if err := s.RenamePage("cordless_drill", "power_drill"); err != nil {
+		t.Fatal(err)
+	}
+	redirects, _ := s.Redirects()
+	if redirects["drill"] != "power_drill" || redirects["cordless_drill"] != "power_drill" {
+		t.Errorf("Expected redirects to collapse to one hop: %v", redirects)
+	}
+
+	newTestPage(s, "drill", "a new drill")
+	if _, ok := s.Redirect("drill"); ok {
+		t.Error("Expected a new page to take the place of the redirect")
+	}
+	if err := s.RenamePage("power_drill", "drill"); err == nil {
+		t.Error("Should not rename over an existing page")
+	}
+}
+
+func TestRedirectIsServedAsMovedPermanently(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "drill", "# Drill")
+	if err := s.RenamePage("drill", "cordless_drill"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/drill/view?version=1", nil)
+	s.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/cordless_drill/view?version=1" {
+		t.Errorf("Expected a 301 to the new identifier, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How much each kind of relatedness counts; each score is from 0 to 1.
+const (
+	relatedTextWeight = 0.5
+	relatedTagsWeight = 0.25
+	relatedLinkWeight = 0.25
+)
+
+const defaultRelatedPages = 10
+
+// rPageLink matches markdown links to other pages, such as [x](/x/view)
+// which [[x]] becomes on save, and [[x]] itself.
+var rPageLink = regexp.MustCompile(`\]\(/([^)\s?#]+?)(?:/(?:view|read|edit|history|raw))?[?#)]|\[\[([^\]]+)\]\]`)
+
+// RelatedPage is a page related to another and why.
+type RelatedPage struct {
+	Identifier string   `json:"identifier"`
+	Title      string   `json:"title"`
+	Score      float64  `json:"score"`
+	Reasons    []string `json:"reasons"`
+}
+
+// pageLinks finds the pages a page links to, and for inventory the
+// container it is in and the items it holds.
+func pageLinks(body string, matter map[string]interface{}) map[string]bool {
+	links := map[string]bool{}
+	for _, match := range rPageLink.FindAllStringSubmatch(body, -1) {
+		link := match[1]
+		if link == "" {
+			link = match[2]
+		}
+		link = strings.ToLower(strings.TrimSpace(link))
+		if top := strings.SplitN(link, NamespaceSeparator, 2)[0]; top != "uploads" && top != "static" {
+			links[link] = true
+		}
+	}
+	if inventory, ok := frontmatterTable(matter, "inventory", false); ok {
+		if container := strings.ToLower(frontmatterString(inventory["container"])); container != "" {
+			links[container] = true
+		}
+		for _, item := range frontmatterStrings(inventory["items"]) {
+			links[strings.ToLower(item)] = true
+		}
+	}
+	return links
+}
+
+// GetRelatedPages ranks the other pages by how related they are to this one,
+// mixing how alike their text is (TF-IDF cosine similarity), how many tags
+// they share, and how close they are in the link graph: linked either way,
+// or both linked with a third page.
+func (s *Site) GetRelatedPages(identifier string, limit int) ([]RelatedPage, error) {
+	identifier = strings.ToLower(identifier)
+	if limit <= 0 {
+		limit = defaultRelatedPages
+	}
+	documents, frequency := s.searchDocuments()
+
+	vectors := map[string]map[string]float64{}
+	tags := map[string]map[string]bool{}
+	neighbours := map[string]map[string]bool{}
+	link := func(a, b string) {
+		if a == b {
+			return
+		}
+		if neighbours[a] == nil {
+			neighbours[a] = map[string]bool{}
+		}
+		neighbours[a][b] = true
+	}
+	var page *searchDocument
+	for i, doc := range documents {
+		id := doc.result.Identifier
+		if id == identifier {
+			page = &documents[i]
+		}
+		vector := map[string]float64{}
+		norm := 0.0
+		for term, count := range doc.counts {
+			weight := float64(count) * idf(documents, frequency, term)
+			vector[term] = weight
+			norm += weight * weight
+		}
+		if norm > 0 {
+			for term := range vector {
+				vector[term] /= math.Sqrt(norm)
+			}
+		}
+		vectors[id] = vector
+		tags[id] = map[string]bool{}
+		for _, tag := range pageTags(doc.result.body) {
+			tags[id][tag] = true
+		}
+		for _, tag := range frontmatterStrings(doc.matter["tags"]) {
+			tags[id][strings.ToLower(tag)] = true
+		}
+		for target := range pageLinks(doc.result.body, doc.matter) {
+			link(id, target)
+			link(target, id)
+		}
+	}
+	if page == nil {
+		return nil, fmt.Errorf("%s not found", identifier)
+	}
+
+	related := []RelatedPage{}
+	for _, doc := range documents {
+		other := doc.result.Identifier
+		if other == identifier {
+			continue
+		}
+		candidate := RelatedPage{Identifier: other, Title: doc.result.Title, Reasons: []string{}}
+
+		similarity := 0.0
+		for term, weight := range vectors[identifier] {
+			similarity += weight * vectors[other][term]
+		}
+		if similarity >= 0.1 {
+			candidate.Reasons = append(candidate.Reasons, fmt.Sprintf("%.0f%% similar text", similarity*100))
+		}
+
+		shared, union := []string{}, len(tags[identifier])
+		for tag := range tags[other] {
+			if tags[identifier][tag] {
+				shared = append(shared, tag)
+			} else {
+				union++
+			}
+		}
+		tagScore := 0.0
+		if len(shared) > 0 {
+			sort.Strings(shared)
+			tagScore = float64(len(shared)) / float64(union)
+			candidate.Reasons = append(candidate.Reasons, "shares #"+strings.Join(shared, ", #"))
+		}
+
+		linkScore := 0.0
+		if neighbours[identifier][other] {
+			linkScore = 1
+			candidate.Reasons = append(candidate.Reasons, "linked")
+		} else {
+			via := []string{}
+			for middle := range neighbours[identifier] {
+				if neighbours[middle][other] {
+					via = append(via, middle)
+				}
+			}
+			if len(via) > 0 {
+				sort.Strings(via)
+				linkScore = 0.5
+				candidate.Reasons = append(candidate.Reasons, "both linked with "+strings.Join(via, ", "))
+			}
+		}
+
+		candidate.Score = relatedTextWeight*similarity + relatedTagsWeight*tagScore + relatedLinkWeight*linkScore
+		if candidate.Score > 0.01 {
+			related = append(related, candidate)
+		}
+	}
+	sort.Slice(related, func(i, j int) bool {
+		if related[i].Score != related[j].Score {
+			return related[i].Score > related[j].Score
+		}
+		return related[i].Identifier < related[j].Identifier
+	})
+	if len(related) > limit {
+		related = related[:limit]
+	}
+	return related, nil
+}
+
+func (s *Site) handleRelatedPages(c *gin.Context) {
+	type QueryJSON struct {
+		Page  string `json:"page"`
+		Limit int    `json:"limit"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	related, err := s.GetRelatedPages(json.Page, json.Limit)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "related": related})
+}
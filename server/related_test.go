@@ -0,0 +1,51 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetRelatedPages(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	for _, p := range []*Page{
+		newTestPage(s, "furnace", "+++\ntags = [\"hvac\"]\n+++\n\nThe furnace filter is a 16x25 pleated filter. See [[thermostat]].\n"),
+		newTestPage(s, "air_filters", "Pleated filter sizes: the furnace takes 16x25, the purifier 12x12.\n"),
+		newTestPage(s, "thermostat", "+++\ntags = [\"hvac\"]\n+++\n\nProgrammed for 68 in winter. Wiring in [[wiring_diagram]].\n"),
+		newTestPage(s, "wiring_diagram", "Red wire to R, white to W.\n"),
+		newTestPage(s, "garden", "Tomatoes and basil.\n"),
+	} {
+		if err := p.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	related, err := s.GetRelatedPages("furnace", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]RelatedPage{}
+	order := []string{}
+	for _, page := range related {
+		got[page.Identifier] = page
+		order = append(order, page.Identifier)
+	}
+	if _, ok := got["garden"]; ok {
+		t.Errorf("Expected an unrelated page to be left out, got %v", order)
+	}
+	if reasons := strings.Join(got["thermostat"].Reasons, "; "); !strings.Contains(reasons, "linked") || !strings.Contains(reasons, "#hvac") {
+		t.Errorf("Expected the thermostat to be linked and share #hvac, got %q", reasons)
+	}
+	if reasons := strings.Join(got["air_filters"].Reasons, "; "); !strings.Contains(reasons, "similar text") {
+		t.Errorf("Expected the air filters to have similar text, got %q", reasons)
+	}
+	if reasons := strings.Join(got["wiring_diagram"].Reasons, "; "); reasons != "both linked with thermostat" {
+		t.Errorf("Expected the wiring diagram to be two links away, got %q", reasons)
+	}
+	if len(order) != 3 || order[0] != "thermostat" {
+		t.Errorf("Expected the thermostat, related every way, first, got %v", order)
+	}
+
+	if _, err := s.GetRelatedPages("nope", 0); err == nil {
+		t.Error("Expected a missing page to have no related pages")
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// remindersFile records which reminders have been sent, reminder key to
+// when, as JSON, so each is only sent once.
+const remindersFile = "reminders.table"
+
+const remindersIdentifier = "reminders"
+
+// Reminder is a calendar date that is close enough to be reminded of, as
+// asked for by the page's remind_before.
+type Reminder struct {
+	CalendarEvent
+	RemindAt time.Time `json:"remind_at"`
+}
+
+// key identifies the reminder, changing when the date does so a moved date
+// is reminded of again.
+func (r Reminder) key() string {
+	return r.Identifier + "|" + r.Kind + "|" + r.Start.Format(time.RFC3339)
+}
+
+// When says when the reminder is for, e.g. "is due on Mon Jan 2".
+func (r Reminder) When() string {
+	verb := "is on"
+	if r.Kind == "due_date" {
+		verb = "is due"
+	}
+	if r.AllDay {
+		return verb + " " + r.Start.Format("Mon Jan 2 2006")
+	}
+	return verb + " " + r.Start.Format("Mon Jan 2 2006 15:04 MST")
+}
+
+// parseRemindBefore reads a remind_before: a number of days, or a duration
+// in days ("7d"), weeks ("2w") or anything time.ParseDuration takes ("36h").
+func parseRemindBefore(v interface{}) (time.Duration, bool) {
+	if days, ok := frontmatterNumber(v); ok {
+		return time.Duration(days * float64(24*time.Hour)), days >= 0
+	}
+	text := strings.TrimSpace(frontmatterString(v))
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(text, suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSuffix(text, suffix), 64)
+			return time.Duration(n * float64(unit)), err == nil && n >= 0
+		}
+	}
+	d, err := time.ParseDuration(text)
+	return d, err == nil && d >= 0
+}
+
+// remindBefore finds how long before the page's date of the given kind to
+// remind: remind_before is either one value for every date on the page or a
+// table of them by date key.
+func remindBefore(matter map[string]interface{}, kind string) (time.Duration, bool) {
+	setting := matter["remind_before"]
+	if table, ok := setting.(map[string]interface{}); ok {
+		setting = table[kind]
+	}
+	if setting == nil {
+		return 0, false
+	}
+	return parseRemindBefore(setting)
+}
+
+// PendingReminders lists the dates whose reminder time has come and that
+// haven't passed, soonest first.
+func (s *Site) PendingReminders(now time.Time) []Reminder {
+	settings := map[string]map[string]interface{}{}
+	s.EachFrontmatter(func(identifier string, matter map[string]interface{}) {
+		if matter["remind_before"] != nil {
+			settings[identifier] = matter
+		}
+	})
+	reminders := []Reminder{}
+	for _, event := range s.CalendarEvents() {
+		matter, ok := settings[event.Identifier]
+		if !ok {
+			continue
+		}
+		before, ok := remindBefore(matter, event.Kind)
+		if !ok {
+			continue
+		}
+		ends := event.Start
+		if event.AllDay {
+			ends = ends.Add(24 * time.Hour)
+		}
+		reminder := Reminder{CalendarEvent: event, RemindAt: event.Start.Add(-before)}
+		if !now.Before(reminder.RemindAt) && now.Before(ends) {
+			reminders = append(reminders, reminder)
+		}
+	}
+	return reminders
+}
+
+func (s *Site) sentReminders() (map[string]time.Time, error) {
+	sent := map[string]time.Time{}
+	data, err := ioutil.ReadFile(path.Join(s.PathToData, remindersFile))
+	if os.IsNotExist(err) {
+		return sent, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &sent)
+	return sent, err
+}
+
+// SendReminders sends each pending reminder to its page's watchers once, and
+// rewrites the Reminders page with everything pending.
+func (s *Site) SendReminders(now time.Time) error {
+	pending := s.PendingReminders(now)
+
+	s.remindersMut.Lock()
+	sent, err := s.sentReminders()
+	if err != nil {
+		s.remindersMut.Unlock()
+		return err
+	}
+	stillPending := map[string]time.Time{}
+	for _, reminder := range pending {
+		key := reminder.key()
+		if at, ok := sent[key]; ok {
+			stillPending[key] = at
+			continue
+		}
+		s.notifier().Remind(reminder)
+		stillPending[key] = now
+	}
+	// Reminders that are no longer pending are dropped, keeping the table
+	// small.
+	data, err := json.MarshalIndent(stillPending, "", " ")
+	if err == nil {
+		err = ioutil.WriteFile(path.Join(s.PathToData, remindersFile), data, 0644)
+	}
+	s.remindersMut.Unlock()
+	if err != nil {
+		return err
+	}
+
+	text := "+++\nidentifier = \"" + remindersIdentifier + "\"\ntitle = \"Reminders\"\n+++\n\n# Reminders\n\n"
+	text += "_Generated " + now.Format("Mon Jan 2 15:04:05 MST 2006") + ". Edits here will be overwritten; change remind_before on the pages themselves._\n\n"
+	if len(pending) == 0 {
+		text += "Nothing coming up.\n"
+	}
+	for _, reminder := range pending {
+		text += fmt.Sprintf("  - [[%s]] %s\n", reminder.Identifier, reminder.When())
+	}
+	return s.Open(remindersIdentifier).Update(text)
+}
+
+func (s *Site) remindersJob(*JobProgress) error {
+	return s.SendReminders(time.Now())
+}
+
+func (s *Site) handlePendingReminders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "reminders": s.PendingReminders(time.Now())})
+}
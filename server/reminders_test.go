@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRemindBefore(t *testing.T) {
+	for setting, want := range map[interface{}]time.Duration{
+		int64(3): 3 * 24 * time.Hour,
+		"7d":     7 * 24 * time.Hour,
+		"2w":     14 * 24 * time.Hour,
+		"36h":    36 * time.Hour,
+	} {
+		if got, ok := parseRemindBefore(setting); !ok || got != want {
+			t.Errorf("Expected %v to be %v, got %v %v", setting, want, got, ok)
+		}
+	}
+	if _, ok := parseRemindBefore("soon"); ok {
+		t.Error("Expected an unreadable remind_before to be ignored")
+	}
+}
+
+func TestSendReminders(t *testing.T) {
+	received := make(chan Reminder, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var reminder Reminder
+		json.NewDecoder(req.Body).Decode(&reminder)
+		received <- reminder
+	}))
+	defer webhook.Close()
+
+	s := &Site{PathToData: t.TempDir()}
+	for _, p := range []*Page{
+		newTestPage(s, "furnace", "+++\nidentifier = \"furnace\"\ntitle = \"Furnace filter\"\ndue_date = 2022-03-13\nremind_before = \"7d\"\n+++\n"),
+		newTestPage(s, "warranty", "+++\nidentifier = \"warranty\"\nevent_date = 2022-05-01\n[remind_before]\nevent_date = 30\n+++\n"),
+		newTestPage(s, "tv", "+++\nidentifier = \"tv\"\ndue_date = 2022-03-11\n+++\n"),
+	} {
+		if err := p.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.WatchPage("furnace", WebhookChannel, webhook.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2022, 3, 10, 12, 0, 0, 0, time.UTC)
+	pending := s.PendingReminders(now)
+	if len(pending) != 1 || pending[0].Identifier != "furnace" {
+		t.Fatalf("Expected only the furnace to be within its reminder, got %+v", pending)
+	}
+	if len(s.PendingReminders(now.AddDate(0, 0, 26))) != 1 {
+		t.Error("Expected the warranty's own remind_before to apply")
+	}
+
+	if err := s.SendReminders(now); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case reminder := <-received:
+		if reminder.Identifier != "furnace" || reminder.Kind != "due_date" {
+			t.Errorf("Expected the furnace reminder, got %+v", reminder)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watcher was never reminded")
+	}
+
+	if err := s.SendReminders(now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case reminder := <-received:
+		t.Errorf("Expected each reminder to be sent once, got another %+v", reminder)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if text := s.Open(remindersIdentifier).Text.GetCurrent(); !strings.Contains(text, "furnace](/furnace/view) is due Sun Mar 13 2022") {
+		t.Errorf("Expected the Reminders page to list the furnace, got %q", text)
+	}
+}
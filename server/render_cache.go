@@ -0,0 +1,202 @@
+package server
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// templateDependency is what a page's render depends on when its template
+// calls a function.
+type templateDependency int
+
+const (
+	// dependsOnArgument is the page named by the function's argument.
+	dependsOnArgument templateDependency = iota
+	// dependsOnContents is the container named by the argument and
+	// everything in it, however deeply.
+	dependsOnContents
+	// dependsOnEveryPage is any page, since the function looks through them
+	// all.
+	dependsOnEveryPage
+	// dependsOnMoreThanPages is something no page save changes, like views,
+	// jobs, pins or what day it is, so the render isn't cached.
+	dependsOnMoreThanPages
+)
+
+// templateDependencies are the template functions' dependencies, by name.
+// Functions not listed aren't cached.
+var templateDependencies = map[string]templateDependency{
+	"LinkTo":                  dependsOnArgument,
+	"IsContainer":             dependsOnArgument,
+	"ShowChecklist":           dependsOnArgument,
+	"ShowMaintenanceOf":       dependsOnArgument,
+	"ShowInventoryContentsOf": dependsOnContents,
+	"ShowLowStock":            dependsOnEveryPage,
+	"ShowRecentChanges":       dependsOnEveryPage,
+	"ShowOpenChecklists":      dependsOnEveryPage,
+	"ShowInventoryRoots":      dependsOnEveryPage,
+	"ShowOverdueLoans":        dependsOnMoreThanPages,
+	"ShowMaintenanceReport":   dependsOnMoreThanPages,
+	"ShowPopularPages":        dependsOnMoreThanPages,
+	"ShowPinnedPages":         dependsOnMoreThanPages,
+	"ShowJobStatus":           dependsOnMoreThanPages,
+}
+
+// renderDependencies are the other pages a render showed, so saving one of
+// them drops it from the render cache.
+type renderDependencies struct {
+	pages       map[string]bool
+	everyPage   bool
+	uncacheable bool
+}
+
+func newRenderDependencies() *renderDependencies {
+	return &renderDependencies{pages: map[string]bool{}}
+}
+
+// addPage records a page, and the page it stands for if it's an alias or
+// redirect.
+func (d *renderDependencies) addPage(site *Site, identifier string) {
+	identifier = strings.ToLower(identifier)
+	d.pages[identifier] = true
+	if target, ok := site.lookupIdentifier(identifier); ok {
+		d.pages[strings.ToLower(target)] = true
+	}
+}
+
+// addContents records a container and everything in it.
+func (d *renderDependencies) addContents(site *Site, container string) {
+	if d.pages[strings.ToLower(container)] {
+		return // containers that (wrongly) contain themselves
+	}
+	d.addPage(site, container)
+	for _, item := range site.containerItems(container) {
+		d.addContents(site, item)
+	}
+}
+
+// wrap replaces the template functions with ones that record what they show
+// before calling the originals.
+func (d *renderDependencies) wrap(site *Site, funcs template.FuncMap) {
+	for name, fn := range funcs {
+		name, original := name, reflect.ValueOf(fn)
+		funcs[name] = reflect.MakeFunc(original.Type(), func(args []reflect.Value) []reflect.Value {
+			dependency, ok := templateDependencies[name]
+			argument := ""
+			if len(args) > 0 && args[0].Kind() == reflect.String {
+				argument = args[0].String()
+			}
+			switch {
+			case !ok || dependency == dependsOnMoreThanPages:
+				d.uncacheable = true
+			case dependency == dependsOnEveryPage:
+				d.everyPage = true
+			case dependency == dependsOnContents:
+				d.addContents(site, argument)
+			default:
+				d.addPage(site, argument)
+			}
+			return original.Call(args)
+		}).Interface()
+	}
+}
+
+// renderCache keeps the HTML of the pages rendered most recently. An entry
+// is used only for the same text, and is dropped when a page its template
+// showed is saved.
+type renderCache struct {
+	entries    map[string]*list.Element
+	order      *list.List // of *renderedPage, most recently used first
+	generation uint64     // counts page saves, to spot one during a render
+}
+
+type renderedPage struct {
+	identifier  string
+	hash        [sha256.Size]byte
+	deps        *renderDependencies
+	html        []byte
+	frontmatter []byte
+}
+
+// cachedRender is a page's cached HTML and frontmatter for its text, if
+// there is any, and the generation to cache a new render under.
+func (s *Site) cachedRender(identifier, text string) ([]byte, []byte, uint64, bool) {
+	if s.RenderCacheSize <= 0 || text == "" {
+		return nil, nil, 0, false
+	}
+	s.renderCacheMut.Lock()
+	defer s.renderCacheMut.Unlock()
+	if s.renders == nil {
+		s.renders = &renderCache{entries: map[string]*list.Element{}, order: list.New()}
+	}
+	element, ok := s.renders.entries[strings.ToLower(identifier)]
+	if ok && element.Value.(*renderedPage).hash == sha256.Sum256([]byte(text)) {
+		entry := element.Value.(*renderedPage)
+		s.renders.order.MoveToFront(element)
+		s.metrics().Inc("wiki_render_cache_hits_total")
+		return entry.html, entry.frontmatter, s.renders.generation, true
+	}
+	s.metrics().Inc("wiki_render_cache_misses_total")
+	return nil, nil, s.renders.generation, false
+}
+
+// cacheRender keeps a page's render, made at generation, dropping the least
+// recently used pages over RenderCacheSize.
+func (s *Site) cacheRender(identifier, text string, generation uint64, deps *renderDependencies, html, frontmatter []byte) {
+	if s.RenderCacheSize <= 0 || text == "" || deps.uncacheable {
+		return
+	}
+	s.renderCacheMut.Lock()
+	defer s.renderCacheMut.Unlock()
+	if s.renders == nil || generation != s.renders.generation {
+		return // a page was saved while rendering
+	}
+	identifier = strings.ToLower(identifier)
+	entry := &renderedPage{
+		identifier:  identifier,
+		hash:        sha256.Sum256([]byte(text)),
+		deps:        deps,
+		html:        html,
+		frontmatter: frontmatter,
+	}
+	if element, ok := s.renders.entries[identifier]; ok {
+		element.Value = entry
+		s.renders.order.MoveToFront(element)
+		return
+	}
+	s.renders.entries[identifier] = s.renders.order.PushFront(entry)
+	for s.renders.order.Len() > s.RenderCacheSize {
+		oldest := s.renders.order.Back()
+		s.renders.order.Remove(oldest)
+		delete(s.renders.entries, oldest.Value.(*renderedPage).identifier)
+	}
+}
+
+// pageChangedForRender drops a saved or erased page's render, and the
+// renders that showed it, or one of its aliases.
+func (s *Site) pageChangedForRender(identifier string, aliases ...string) {
+	s.renderCacheMut.Lock()
+	defer s.renderCacheMut.Unlock()
+	if s.renders == nil {
+		return
+	}
+	s.renders.generation++
+	changed := append([]string{identifier}, aliases...)
+	for element := s.renders.order.Front(); element != nil; {
+		next := element.Next()
+		entry := element.Value.(*renderedPage)
+		drop := entry.deps.everyPage
+		for _, name := range changed {
+			name = strings.ToLower(name)
+			drop = drop || entry.identifier == name || entry.deps.pages[name]
+		}
+		if drop {
+			s.renders.order.Remove(element)
+			delete(s.renders.entries, entry.identifier)
+		}
+		element = next
+	}
+}
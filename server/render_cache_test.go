@@ -0,0 +1,76 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestRenderCache(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), RenderCacheSize: 3}
+	newTestPage(s, "drill", "# Drill")
+	newTestPage(s, "shelf", "# Shelf\n\n{{LinkTo \"drill\"}}")
+	render := func(identifier string) string {
+		p := s.Open(identifier)
+		p.Render()
+		return string(p.RenderedPage)
+	}
+	hits := func() float64 {
+		return s.metrics().Counter("wiki_render_cache_hits_total")
+	}
+
+	first := render("drill")
+	if second := render("drill"); second != first {
+		t.Errorf("Expected the cached render to be the same, got %q and %q", first, second)
+	}
+	render("shelf")
+	render("shelf")
+	if hits() != 2 {
+		t.Errorf("Expected both pages to be served from the cache the second time, got %v hits", hits())
+	}
+
+	newTestPage(s, "hammer", "# Hammer")
+	render("drill")
+	render("shelf")
+	if hits() != 4 {
+		t.Errorf("Expected saving a page neither shows to leave them cached, got %v hits", hits())
+	}
+
+	newTestPage(s, "drill", "+++\ntitle = \"Cordless Drill\"\n+++\n# Drill")
+	if html := render("shelf"); hits() != 4 || html == "" {
+		t.Errorf("Expected saving the linked page to render the shelf again, got %v hits", hits())
+	}
+
+	newTestPage(s, "saw", "# Saw")
+	render("hammer")
+	render("saw")
+	render("drill") // evicts shelf, the least recently used
+	if _, ok := s.renders.entries["shelf"]; ok || hits() != 4 || s.renders.order.Len() != 3 {
+		t.Errorf("Expected the cache to hold three pages, got %v hits and %d pages", hits(), s.renders.order.Len())
+	}
+}
+
+func TestRenderCacheDependencies(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), RenderCacheSize: 10}
+	newTestPage(s, "toolbox", "+++\n[inventory]\nitems = [\"drawer\"]\n+++\n{{ShowInventoryContentsOf \"toolbox\"}}")
+	newTestPage(s, "drawer", "+++\n[inventory]\ncontainer = \"toolbox\"\nitems = [\"pliers\"]\n+++\n# Drawer")
+	newTestPage(s, "pliers", "# Pliers")
+	newTestPage(s, "recent", "{{ShowRecentChanges 5}}")
+	newTestPage(s, "jobs", "{{ShowJobStatus}}")
+	for _, identifier := range []string{"toolbox", "recent", "jobs"} {
+		p := s.Open(identifier)
+		p.Render()
+	}
+	cached := func(identifier string) bool {
+		s.renderCacheMut.Lock()
+		defer s.renderCacheMut.Unlock()
+		_, ok := s.renders.entries[identifier]
+		return ok
+	}
+	if !cached("toolbox") || !cached("recent") || cached("jobs") {
+		t.Fatalf("Expected the job status not to be cached: %v", s.renders.entries)
+	}
+
+	newTestPage(s, "pliers", "# Needle-nose Pliers")
+	if cached("toolbox") || cached("recent") {
+		t.Errorf("Expected saving something deep in the toolbox to drop its render and the recent changes")
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// minCompressedSize is the smallest response worth compressing; below it
+// gzip's header and the time taken outweigh the bytes saved.
+const minCompressedSize = 1024
+
+// compressedTypes are the media types compressed; images, uploads and
+// other already compressed types aren't, nor event streams.
+var compressedTypes = map[string]bool{
+	"text/html":              true,
+	"text/css":               true,
+	"text/plain":             true,
+	"text/markdown":          true,
+	"text/csv":               true,
+	"text/calendar":          true,
+	"text/xml":               true,
+	"application/json":       true,
+	"application/javascript": true,
+	"application/xml":        true,
+	"image/svg+xml":          true,
+}
+
+// acceptsGzip is whether an Accept-Encoding header takes gzip. Brotli isn't
+// offered; this build has no encoder for it.
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		for _, param := range fields[1:] {
+			if q := strings.TrimSpace(param); strings.HasPrefix(q, "q=") {
+				if weight, err := strconv.ParseFloat(q[2:], 64); err == nil && weight == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipWriter holds back the start of a response until it knows whether to
+// compress it: when it's of a compressed type, and at least
+// minCompressedSize long or still being written.
+type gzipWriter struct {
+	gin.ResponseWriter
+	decided bool
+	held    bytes.Buffer
+	gz      *gzip.Writer
+}
+
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		if w.gz != nil {
+			return w.gz.Write(data)
+		}
+		return w.ResponseWriter.Write(data)
+	}
+	if !w.compressible() {
+		w.decided = true
+		return w.ResponseWriter.Write(data)
+	}
+	w.held.Write(data)
+	if w.held.Len() >= minCompressedSize {
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// compressible is whether the response's status and headers allow
+// compressing it.
+func (w *gzipWriter) compressible() bool {
+	header := w.Header()
+	if w.Status() != http.StatusOK || header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	return compressedTypes[mediaType]
+}
+
+// start sends what was held back, compressed or not.
+func (w *gzipWriter) start(compress bool) error {
+	w.decided = true
+	w.Header().Add("Vary", "Accept-Encoding")
+	if compress {
+		header := w.Header()
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag) // the same content, but not the same bytes
+		}
+		w.gz, _ = gzip.NewWriterLevel(w.ResponseWriter, gzip.DefaultCompression)
+		_, err := w.gz.Write(w.held.Bytes())
+		return err
+	}
+	_, err := w.ResponseWriter.Write(w.held.Bytes())
+	return err
+}
+
+// Flush sends what's been written so far; a response being streamed is
+// compressed if it's of a compressed type, however short it is so far.
+func (w *gzipWriter) Flush() {
+	if !w.decided {
+		w.start(w.compressible())
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// close finishes the response, sending a short one as it is.
+func (w *gzipWriter) close() {
+	if !w.decided {
+		if w.held.Len() > 0 {
+			w.start(false)
+		}
+		return
+	}
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
+
+// compressResponses gzips text responses for clients that take it.
+func (s *Site) compressResponses(c *gin.Context) {
+	if c.Request.Method == http.MethodHead || c.GetHeader("Range") != "" || !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+		c.Next()
+		return
+	}
+	w := &gzipWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	defer func() {
+		w.close()
+		c.Writer = w.ResponseWriter
+	}()
+	c.Next()
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/jcelliott/lumber"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, accepts := range map[string]bool{
+		"gzip, deflate, br":    true,
+		"br;q=1.0, gzip;q=0.8": true,
+		"gzip;q=0":             false,
+		"*":                    true,
+		"identity":             false,
+		"":                     false,
+	} {
+		if acceptsGzip(header) != accepts {
+			t.Errorf("Expected %q to accept gzip: %v", header, accepts)
+		}
+	}
+}
+
+func TestCompressResponses(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), SessionStore: cookie.NewStore([]byte("secret")), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	newTestPage(s, "long", strings.Repeat("All the screws are in the second drawer.\n\n", 100))
+	newTestPage(s, "short", "Tiny")
+	router := s.Router()
+	get := func(url string, headers ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/long.md")
+	if w.Header().Get("Content-Encoding") != "gzip" || !strings.HasPrefix(w.Header().Get("ETag"), `W/"`) || !strings.Contains(strings.Join(w.Header().Values("Vary"), ","), "Accept-Encoding") {
+		t.Fatalf("Expected long markdown to be compressed, got %v", w.Header())
+	}
+	r, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(r)
+	if !strings.HasPrefix(string(body), "All the screws") || len(body) <= w.Body.Len() {
+		t.Errorf("Expected the markdown back, got %d bytes", len(body))
+	}
+	if w = get("/long.md", "If-None-Match", w.Header().Get("ETag")); w.Code != http.StatusNotModified {
+		t.Errorf("Expected the weak ETag to match, got %d", w.Code)
+	}
+
+	if w = get("/short.md"); w.Header().Get("Content-Encoding") != "" || w.Body.String() != "Tiny" {
+		t.Errorf("Expected a short page to be sent as it is, got %v %q", w.Header(), w.Body.String())
+	}
+	if w = get("/long.md", "Range", "bytes=0-9"); w.Header().Get("Content-Encoding") != "" || w.Body.String() != "All the sc" {
+		t.Errorf("Expected a range to be sent as it is, got %q", w.Body.String())
+	}
+	if w = get("/static/img/favicon/favicon.ico"); w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected images not to be compressed")
+	}
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The roles RoleMappings grant, each able to do what the ones before it
+// can: readers read and export, editors change pages and import, admins
+// do everything, like managing API tokens.
+const (
+	RoleReader = "reader"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+var roleRanks = map[string]int{RoleReader: 1, RoleEditor: 2, RoleAdmin: 3}
+
+// scopeRoles are the roles needed for requests needing each API token
+// scope; see requiredScope.
+var scopeRoles = map[string]string{
+	ScopeRead:   RoleReader,
+	ScopeExport: RoleReader,
+	ScopeWrite:  RoleEditor,
+	ScopeImport: RoleEditor,
+	ScopeAdmin:  RoleAdmin,
+}
+
+// defaultTailscaleSocket is where tailscaled's local API listens on Linux.
+const defaultTailscaleSocket = "/var/run/tailscale/tailscaled.sock"
+
+// whoIsCacheTime is how long what tailscaled says about an address is
+// believed, so a retagged device gets its new role within a minute.
+const whoIsCacheTime = time.Minute
+
+// roleKey is where the request's role is kept in the gin context.
+const roleKey = "role"
+
+// RoleMapping grants a role to tailnet devices with an ACL tag
+// (tag:wiki-editor), tailnet users or other identities by login
+// (user:alice@example.com), or peers granted an app capability
+// (cap:example.com/cap/wiki).
+type RoleMapping struct {
+	Kind string
+	Name string
+	Role string
+}
+
+// ParseRoleMapping parses a --role like tag:wiki-editor=editor.
+func ParseRoleMapping(spec string) (RoleMapping, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	subject := strings.SplitN(parts[0], ":", 2)
+	if len(parts) != 2 || len(subject) != 2 || subject[1] == "" {
+		return RoleMapping{}, fmt.Errorf("role %q should look like tag:wiki-editor=editor, user:alice@example.com=admin or cap:example.com/cap/wiki=editor", spec)
+	}
+	mapping := RoleMapping{Kind: strings.ToLower(subject[0]), Name: subject[1], Role: strings.ToLower(parts[1])}
+	if mapping.Kind != "tag" && mapping.Kind != "user" && mapping.Kind != "cap" {
+		return RoleMapping{}, fmt.Errorf("role %q: grant it to a tag:, user: or cap:", spec)
+	}
+	if mapping.Kind == "user" {
+		mapping.Name = strings.ToLower(mapping.Name)
+	}
+	if roleRanks[mapping.Role] == 0 {
+		return RoleMapping{}, fmt.Errorf("role %q: %s should be %s, %s or %s", spec, mapping.Role, RoleReader, RoleEditor, RoleAdmin)
+	}
+	return mapping, nil
+}
+
+// TailnetPeer is what tailscaled knows about the device at an address.
+type TailnetPeer struct {
+	// Login is the login name of the device's user; tagged devices have
+	// none.
+	Login        string
+	Node         string
+	Tags         []string
+	Capabilities []string
+}
+
+// TailnetWhoIs asks tailscale who is at a tailnet address.
+type TailnetWhoIs interface {
+	WhoIs(address string) (TailnetPeer, error)
+}
+
+// whoIsAnswer is what tailscaled said about an address, and when.
+type whoIsAnswer struct {
+	peer  TailnetPeer
+	err   error
+	asked time.Time
+}
+
+// whoIs returns the site's TailnetWhoIs, the local tailscaled unless it
+// was given another.
+func (s *Site) whoIs() TailnetWhoIs {
+	s.whoIsOnce.Do(func() {
+		if s.WhoIs == nil {
+			s.WhoIs = newTailscaleLocalAPI(s.TailscaleSocket)
+		}
+	})
+	return s.WhoIs
+}
+
+// tailnetPeer is who is at a tailnet address, asking tailscaled at most
+// once every whoIsCacheTime.
+func (s *Site) tailnetPeer(ip net.IP, now time.Time) (TailnetPeer, error) {
+	address := ip.String()
+	s.whoIsMut.Lock()
+	answer, ok := s.whoIsAnswers[address]
+	s.whoIsMut.Unlock()
+	if ok && now.Sub(answer.asked) < whoIsCacheTime {
+		return answer.peer, answer.err
+	}
+	peer, err := s.whoIs().WhoIs(address)
+	s.whoIsMut.Lock()
+	defer s.whoIsMut.Unlock()
+	if s.whoIsAnswers == nil || len(s.whoIsAnswers) >= maxActiveClients {
+		s.whoIsAnswers = map[string]whoIsAnswer{}
+	}
+	s.whoIsAnswers[address] = whoIsAnswer{peer: peer, err: err, asked: now}
+	return peer, err
+}
+
+// tailnet is tailscaleNetworks, parsed.
+var tailnet, _ = parseNetworks("tailnet", tailscaleNetworks)
+
+// fromVouchedProxy is whether the request came straight from a proxy that
+// was named as trusted, or over the unix socket only the proxy can reach.
+// Unlike fromTrustedProxy, not setting TrustedProxies trusts nobody: roles
+// are worth more than per-user pages, so anyone who can reach the wiki
+// mustn't be able to claim one by setting a header.
+func (s *Site) fromVouchedProxy(r *http.Request) bool {
+	if viaUnixSocket(r) {
+		return true
+	}
+	return len(s.TrustedProxies) > 0 && inNetworks(remoteIP(r), s.TrustedProxies)
+}
+
+// vouchedIdentity is who made the request, if that's known from something
+// better than a header anyone could set: a verified client certificate, or
+// a proxy fromVouchedProxy.
+func (s *Site) vouchedIdentity(c *gin.Context) string {
+	if state := c.Request.TLS; state != nil && len(state.VerifiedChains) > 0 {
+		return requestIdentity(c)
+	}
+	if s.fromVouchedProxy(c.Request) {
+		return requestIdentity(c)
+	}
+	return ""
+}
+
+// tailnetAddress is the tailnet address the request came from: the peer,
+// or, from a vouched for proxy like tailscale serve, who it was forwarded
+// for. It's nil if the request didn't come over the tailnet.
+func (s *Site) tailnetAddress(r *http.Request) net.IP {
+	candidates := []net.IP{remoteIP(r)}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" && s.fromVouchedProxy(r) {
+		hops := strings.Split(forwarded, ",")
+		candidates = append(candidates, net.ParseIP(strings.TrimSpace(hops[len(hops)-1])))
+	}
+	for _, ip := range candidates {
+		if inNetworks(ip, tailnet) {
+			return ip
+		}
+	}
+	return nil
+}
+
+// grantedRole is the highest role the mappings give an identity and a
+// tailnet peer.
+func grantedRole(mappings []RoleMapping, identity string, peer TailnetPeer) string {
+	role := ""
+	for _, mapping := range mappings {
+		granted := false
+		switch mapping.Kind {
+		case "user":
+			granted = mapping.Name == identity || (peer.Login != "" && mapping.Name == peer.Login)
+		case "tag":
+			granted = stringInSlice("tag:"+mapping.Name, peer.Tags)
+		case "cap":
+			granted = stringInSlice(mapping.Name, peer.Capabilities)
+		}
+		if granted && roleRanks[mapping.Role] > roleRanks[role] {
+			role = mapping.Role
+		}
+	}
+	return role
+}
+
+// resolveRoles works out the request's role from the RoleMappings, asking
+// tailscaled about requests from the tailnet, and refuses it if it needs a
+// higher one, when there are RoleMappings. Reading and exporting need no
+// role; API tokens go by their scopes instead. A tailnet user nobody else
+// vouched for is identified by their tailscale login, and identities only
+// a header says are given no role, see vouchedIdentity.
+func (s *Site) resolveRoles(c *gin.Context) {
+	if len(s.RoleMappings) == 0 || authenticatesItself(c.Request.URL.Path) {
+		return
+	}
+	var peer TailnetPeer
+	if ip := s.tailnetAddress(c.Request); ip != nil {
+		var err error
+		if peer, err = s.tailnetPeer(ip, time.Now()); err != nil {
+			s.Logger.Warn("Could not ask tailscale who %s is: %v", ip, err)
+		}
+	}
+	identity := s.vouchedIdentity(c)
+	if identity == "" && peer.Login != "" {
+		identity = peer.Login
+		c.Set(identityKey, identity)
+	}
+	role := grantedRole(s.RoleMappings, identity, peer)
+	if role != "" {
+		c.Set(roleKey, role)
+	}
+	if _, ok := c.Get(apiTokenKey); ok {
+		return
+	}
+	needed := scopeRoles[requiredScope(c)]
+	if needed == RoleReader || roleRanks[role] >= roleRanks[needed] {
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"success": false, "message": fmt.Sprintf("This needs the %s role, which you haven't been granted", needed)})
+}
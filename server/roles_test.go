@@ -0,0 +1,130 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/jcelliott/lumber"
+)
+
+func TestParseRoleMapping(t *testing.T) {
+	if mapping, err := ParseRoleMapping("tag:wiki-editor=editor"); err != nil || mapping != (RoleMapping{Kind: "tag", Name: "wiki-editor", Role: RoleEditor}) {
+		t.Errorf("Expected the tag's mapping, got %+v %v", mapping, err)
+	}
+	if mapping, err := ParseRoleMapping("user:Alice@Example.com=Admin"); err != nil || mapping != (RoleMapping{Kind: "user", Name: "alice@example.com", Role: RoleAdmin}) {
+		t.Errorf("Expected the user's mapping, got %+v %v", mapping, err)
+	}
+	for _, spec := range []string{"tag:wiki-editor", "wiki-editor=editor", "group:family=editor", "tag:wiki-editor=owner", "tag:=editor"} {
+		if _, err := ParseRoleMapping(spec); err == nil {
+			t.Errorf("Expected %q to be refused", spec)
+		}
+	}
+}
+
+func TestLocalAPIWhoIs(t *testing.T) {
+	tailscaled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("addr") {
+		case "100.64.0.1":
+			w.Write([]byte(`{"Node": {"Name": "laptop.tailnet.ts.net.", "Tags": null}, "UserProfile": {"LoginName": "Alice@Example.com"}, "CapMap": {"example.com/cap/wiki": [{}]}}`))
+		case "100.64.0.2":
+			w.Write([]byte(`{"Node": {"Name": "kiosk.tailnet.ts.net.", "Tags": ["tag:kiosk"]}, "UserProfile": {"LoginName": "tagged-devices"}}`))
+		default:
+			http.Error(w, "no match for IP:port", http.StatusNotFound)
+		}
+	}))
+	defer tailscaled.Close()
+	whoIs := tailscaleLocalAPI{client: tailscaled.Client(), baseURL: tailscaled.URL}
+
+	if peer, err := whoIs.WhoIs("100.64.0.1"); err != nil || peer.Login != "alice@example.com" || peer.Node != "laptop.tailnet.ts.net" || len(peer.Capabilities) != 1 {
+		t.Errorf("Expected alice's laptop, got %+v %v", peer, err)
+	}
+	if peer, err := whoIs.WhoIs("100.64.0.2"); err != nil || peer.Login != "" || peer.Tags[0] != "tag:kiosk" {
+		t.Errorf("Expected the tagged kiosk, without a user, got %+v %v", peer, err)
+	}
+	if _, err := whoIs.WhoIs("100.64.0.3"); err == nil {
+		t.Errorf("Expected an address tailscaled doesn't know to be an error")
+	}
+}
+
+type fakeWhoIs map[string]TailnetPeer
+
+func (f fakeWhoIs) WhoIs(address string) (TailnetPeer, error) {
+	return f[address], nil
+}
+
+func TestResolveRoles(t *testing.T) {
+	mappings := []RoleMapping{}
+	for _, spec := range []string{"tag:wiki-editor=editor", "user:bob@example.com=admin", "cap:example.com/cap/wiki=editor"} {
+		mapping, _ := ParseRoleMapping(spec)
+		mappings = append(mappings, mapping)
+	}
+	s := &Site{
+		PathToData:     t.TempDir(),
+		RoleMappings:   mappings,
+		TrustedProxies: []*net.IPNet{{IP: net.IPv4(127, 0, 0, 1), Mask: net.CIDRMask(32, 32)}},
+		WhoIs: fakeWhoIs{
+			"100.64.0.1": {Login: "alice@example.com"},
+			"100.64.0.2": {Tags: []string{"tag:wiki-editor"}},
+			"100.64.0.3": {Login: "carol@example.com", Capabilities: []string{"example.com/cap/wiki"}},
+		},
+		SessionStore: cookie.NewStore([]byte("secret")),
+		Logger:       lumber.NewConsoleLogger(lumber.WARN),
+	}
+	newTestPage(s, "notes", "some notes")
+	router := s.Router()
+	send := func(method, url, body, remoteAddr, identity string, forwardedFor ...string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		if identity != "" {
+			req.Header.Set(defaultIdentityHeader, identity)
+		}
+		if len(forwardedFor) > 0 {
+			req.Header.Set("X-Forwarded-For", strings.Join(forwardedFor, ", "))
+		}
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	edit := `{"page": "notes", "new_text": "more notes"}`
+
+	if code := send("GET", "/notes/view", "", "100.64.0.1:5000", ""); code != http.StatusOK {
+		t.Errorf("Expected anyone to read, got %d", code)
+	}
+	if code := send("POST", "/update", edit, "100.64.0.1:5000", ""); code != http.StatusForbidden {
+		t.Errorf("Expected a user without a role not to edit, got %d", code)
+	}
+	if code := send("POST", "/update", edit, "100.64.0.2:5000", ""); code != http.StatusOK {
+		t.Errorf("Expected a device tagged as an editor to edit, got %d", code)
+	}
+	if code := send("POST", "/update", edit, "100.64.0.3:5000", ""); code != http.StatusOK {
+		t.Errorf("Expected a user granted the capability to edit, got %d", code)
+	}
+	if code := send("POST", "/system/audit_log", `{}`, "100.64.0.3:5000", ""); code != http.StatusForbidden {
+		t.Errorf("Expected an editor not to reach admin pages, got %d", code)
+	}
+	// through tailscale serve, which says who and from where
+	if code := send("POST", "/system/audit_log", `{}`, "127.0.0.1:5000", "bob@example.com"); code != http.StatusOK {
+		t.Errorf("Expected bob, an admin, to reach admin pages, got %d", code)
+	}
+	if code := send("POST", "/update", edit, "192.168.1.20:5000", ""); code != http.StatusForbidden {
+		t.Errorf("Expected someone off the tailnet without a role not to edit, got %d", code)
+	}
+	// headers from anyone but the trusted proxy are forgeries
+	if code := send("POST", "/system/audit_log", `{}`, "192.168.1.20:5000", "bob@example.com"); code != http.StatusForbidden {
+		t.Errorf("Expected a forged identity header to get no role, got %d", code)
+	}
+	if code := send("POST", "/system/audit_log", `{}`, "100.64.0.1:5000", "bob@example.com"); code != http.StatusForbidden {
+		t.Errorf("Expected alice not to become bob with a header, got %d", code)
+	}
+	if code := send("POST", "/update", edit, "192.168.1.20:5000", "", "100.64.0.2"); code != http.StatusForbidden {
+		t.Errorf("Expected a forged X-Forwarded-For to get no role, got %d", code)
+	}
+	s.TrustedProxies = nil
+	if code := send("POST", "/system/audit_log", `{}`, "127.0.0.1:5000", "bob@example.com"); code != http.StatusForbidden {
+		t.Errorf("Expected identity headers not to grant roles without --trusted-proxy, got %d", code)
+	}
+}
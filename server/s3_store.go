@@ -0,0 +1,226 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3PageStore keeps page files as objects in an S3-compatible bucket, named
+// by the bucket prefix, the data directory and the key, so spaces sharing a
+// bucket don't collide. Requests are path-style and signed with AWS
+// Signature Version 4, which MinIO, Garage and the like accept too.
+type s3PageStore struct {
+	endpoint  string
+	bucket    string
+	prefix    string
+	region    string
+	accessKey string
+	secretKey string
+	token     string
+	client    *http.Client
+}
+
+func newS3PageStore(spec, pathToData string) (*s3PageStore, error) {
+	u, err := url.Parse(spec)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("storage %q should be s3://bucket/prefix", spec)
+	}
+	store := &s3PageStore{
+		bucket:    u.Host,
+		region:    u.Query().Get("region"),
+		endpoint:  strings.TrimSuffix(u.Query().Get("endpoint"), "/"),
+		accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:     os.Getenv("AWS_SESSION_TOKEN"),
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+	if store.region == "" {
+		store.region = os.Getenv("AWS_REGION")
+	}
+	if store.region == "" {
+		store.region = "us-east-1"
+	}
+	if store.endpoint == "" {
+		store.endpoint = "https://s3." + store.region + ".amazonaws.com"
+	}
+	if e, err := url.Parse(store.endpoint); err != nil || (e.Scheme != "http" && e.Scheme != "https") || e.Host == "" {
+		return nil, fmt.Errorf("storage %q: endpoint %q should be an http URL", spec, store.endpoint)
+	}
+	if store.accessKey == "" || store.secretKey == "" {
+		return nil, fmt.Errorf("storage %q needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY", spec)
+	}
+	for _, part := range []string{u.Path, pathToData} {
+		if part = strings.Trim(path.Clean("/"+part), "/"); part != "" {
+			store.prefix += part + "/"
+		}
+	}
+	return store, nil
+}
+
+// s3Escape is S3's URI encoding: everything but unreserved characters, and
+// slashes if keepSlashes.
+func s3Escape(s string, keepSlashes bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && keepSlashes:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// do makes a signed request for an object, or for the bucket if key is "".
+func (s *s3PageStore) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	uri := "/" + s.bucket
+	if key != "" {
+		uri += "/" + s3Escape(s.prefix+key, true)
+	}
+	keys := []string{}
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := []string{}
+	for _, k := range keys {
+		params = append(params, s3Escape(k, false)+"="+s3Escape(query.Get(k), false))
+	}
+	canonicalQuery := strings.Join(params, "&")
+
+	target := s.endpoint + uri
+	if canonicalQuery != "" {
+		target += "?" + canonicalQuery
+	}
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if s.token != "" {
+		req.Header.Set("X-Amz-Security-Token", s.token)
+		signed = append(signed, "x-amz-security-token")
+	}
+	headers := ""
+	for _, name := range signed {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		headers += name + ":" + strings.TrimSpace(value) + "\n"
+	}
+	canonical := strings.Join([]string{method, uri, canonicalQuery, headers, strings.Join(signed, ";"), hex.EncodeToString(payloadHash[:])}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	scope := day + "/" + s.region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+	signingKey := hmacSHA256(hmacSHA256(hmacSHA256(hmacSHA256([]byte("AWS4"+s.secretKey), day), s.region), "s3"), "aws4_request")
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/"+scope+
+		", SignedHeaders="+strings.Join(signed, ";")+", Signature="+hex.EncodeToString(hmacSHA256(signingKey, toSign)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound && key != "" {
+		resp.Body.Close()
+		return nil, &os.PathError{Op: strings.ToLower(method), Path: key, Err: os.ErrNotExist}
+	}
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s: %s %s", method, s.prefix+key, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+func (s *s3PageStore) Get(key string) ([]byte, error) {
+	resp, err := s.do(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (s *s3PageStore) Put(key string, data []byte) error {
+	resp, err := s.do(http.MethodPut, key, nil, data)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *s3PageStore) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *s3PageStore) Exists(key string) bool {
+	resp, err := s.do(http.MethodHead, key, nil, nil)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return true
+}
+
+func (s *s3PageStore) List(prefix string) ([]string, error) {
+	names := []string{}
+	query := url.Values{"list-type": {"2"}, "prefix": {s.prefix + prefix}, "delimiter": {"/"}}
+	for {
+		resp, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			names = append(names, strings.TrimPrefix(object.Key, s.prefix+prefix))
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return names, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// HTMLPolicies are the --html-policy levels rendered pages are sanitized
+// with; --allow-insecure-markup skips sanitizing altogether.
+var HTMLPolicies = map[string]string{
+	"strict":   "markdown formatting and links; images only from this wiki",
+	"standard": "strict, plus images from anywhere, data: images and <center>",
+	"embeds":   "standard, plus https iframes from the --iframe-host sites",
+}
+
+const defaultHTMLPolicy = "standard"
+
+// defaultIFrameHosts are the sites the embeds policy lets iframes show when
+// no --iframe-host is given.
+var defaultIFrameHosts = []string{"www.youtube-nocookie.com", "www.youtube.com", "player.vimeo.com", "www.openstreetmap.org"}
+
+// rHost is a host name, optionally with a port.
+var rHost = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]*[a-z0-9])?(:\d+)?$`)
+
+// rLocalURL is a URL on this wiki: a path, but not a //host/ one.
+var rLocalURL = regexp.MustCompile(`^/([^/]|$)`)
+
+// CheckHTMLPolicy checks --html-policy and --iframe-host.
+func CheckHTMLPolicy(level string, iframeHosts []string) error {
+	if level == "" {
+		level = defaultHTMLPolicy
+	}
+	if _, ok := HTMLPolicies[level]; !ok {
+		levels := []string{}
+		for name := range HTMLPolicies {
+			levels = append(levels, name)
+		}
+		sort.Strings(levels)
+		return fmt.Errorf("html policy %q should be one of %s", level, strings.Join(levels, ", "))
+	}
+	for _, host := range iframeHosts {
+		if !rHost.MatchString(strings.ToLower(host)) {
+			return fmt.Errorf("iframe host %q should be a host name like www.youtube.com", host)
+		}
+	}
+	return nil
+}
+
+// NewHTMLPolicy builds the sanitizer for a --html-policy level. Every level
+// only lets links and images use http, https and mailto URLs, or relative
+// ones, and drops scripts, styles, forms and event handlers.
+func NewHTMLPolicy(level string, iframeHosts []string) (*bluemonday.Policy, error) {
+	if err := CheckHTMLPolicy(level, iframeHosts); err != nil {
+		return nil, err
+	}
+	if level == "" {
+		level = defaultHTMLPolicy
+	}
+
+	p := ugcPolicyWithoutImages()
+	p.AllowAttrs("class").OnElements("a")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowAttrs("id").OnElements("a")
+	if level == "strict" {
+		p.AllowAttrs("alt").OnElements("img")
+		p.AllowAttrs("src").Matching(rLocalURL).OnElements("img")
+		return p, nil
+	}
+
+	p.AllowImages()
+	p.AllowElements("center")
+	p.AllowDataURIImages()
+	if level == "standard" {
+		return p, nil
+	}
+
+	if len(iframeHosts) == 0 {
+		iframeHosts = defaultIFrameHosts
+	}
+	quoted := []string{}
+	for _, host := range iframeHosts {
+		quoted = append(quoted, regexp.QuoteMeta(strings.ToLower(host)))
+	}
+	rIFrameSrc := regexp.MustCompile(`^https://(` + strings.Join(quoted, "|") + `)/`)
+	p.AllowAttrs("src").Matching(rIFrameSrc).OnElements("iframe")
+	p.AllowAttrs("width", "height").Matching(bluemonday.NumberOrPercent).OnElements("iframe")
+	p.AllowAttrs("title").OnElements("iframe")
+	p.AllowAttrs("allowfullscreen").Matching(regexp.MustCompile(`^(|allowfullscreen|true)$`)).OnElements("iframe")
+	p.AllowAttrs("loading").Matching(regexp.MustCompile(`^(lazy|eager)$`)).OnElements("iframe")
+	return p, nil
+}
+
+// ugcPolicyWithoutImages is bluemonday's UGCPolicy without AllowImages,
+// which can't be taken back once allowed.
+func ugcPolicyWithoutImages() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowStandardAttributes()
+	p.AllowStandardURLs()
+	p.AllowElements("article", "aside", "figure", "section", "summary", "hgroup")
+	p.AllowAttrs("open").Matching(regexp.MustCompile(`(?i)^(|open)$`)).OnElements("details")
+	p.AllowElements("h1", "h2", "h3", "h4", "h5", "h6")
+	p.AllowAttrs("cite").OnElements("blockquote")
+	p.AllowElements("br", "div", "hr", "p", "span", "wbr")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowElements("abbr", "acronym", "cite", "code", "dfn", "em",
+		"figcaption", "mark", "s", "samp", "strong", "sub", "sup", "var")
+	p.AllowAttrs("cite").OnElements("q")
+	p.AllowAttrs("datetime").Matching(bluemonday.ISO8601).OnElements("time")
+	p.AllowElements("b", "i", "pre", "small", "strike", "tt", "u")
+	p.AllowAttrs("dir").Matching(bluemonday.Direction).OnElements("bdi", "bdo")
+	p.AllowElements("rp", "rt", "ruby")
+	p.AllowLists()
+	p.AllowTables()
+	return p
+}
+
+// sanitizer is the site's HTML policy; it falls back to the standard one
+// if the site has none or its policy can't be built.
+func (s *Site) sanitizer() *bluemonday.Policy {
+	if s == nil {
+		p, _ := NewHTMLPolicy(defaultHTMLPolicy, nil)
+		return p
+	}
+	s.htmlPolicyOnce.Do(func() {
+		p, err := NewHTMLPolicy(s.HTMLPolicy, s.IFrameHosts)
+		if err != nil {
+			if s.Logger != nil {
+				s.Logger.Error("Could not build the %q html policy, using %s: %v", s.HTMLPolicy, defaultHTMLPolicy, err)
+			}
+			p, _ = NewHTMLPolicy(defaultHTMLPolicy, nil)
+		}
+		s.htmlPolicy = p
+	})
+	return s.htmlPolicy
+}
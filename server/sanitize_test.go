@@ -0,0 +1,49 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTMLPolicy(t *testing.T) {
+	page := `<script>alert(1)</script><a href="javascript:alert(1)">js</a><img src="x.png" onerror="alert(1)">
+<img src="https://tracker.example.com/pixel.gif" alt="pixel"> <img src="/uploads/sha256-abc.upload" alt="local">
+<iframe src="https://www.youtube-nocookie.com/embed/abc" width="560"></iframe><iframe src="https://evil.example.com/"></iframe>`
+
+	tests := []struct {
+		policy      string
+		contains    []string
+		notContains []string
+	}{
+		{"strict", []string{`src="/uploads/sha256-abc.upload"`}, []string{"tracker.example.com", "<iframe"}},
+		{"", []string{"tracker.example.com", `src="/uploads/sha256-abc.upload"`}, []string{"<iframe"}},
+		{"embeds", []string{`<iframe src="https://www.youtube-nocookie.com/embed/abc" width="560">`}, []string{"evil.example.com"}},
+	}
+	for _, test := range tests {
+		s := &Site{HTMLPolicy: test.policy}
+		html, _ := MarkdownToHtmlAndJsonFrontmatter(page, false, s)
+		got := string(html)
+		for _, bad := range []string{"<script", "javascript:", "onerror"} {
+			if strings.Contains(got, bad) {
+				t.Errorf("%q policy let %s through: %s", test.policy, bad, got)
+			}
+		}
+		for _, want := range test.contains {
+			if !strings.Contains(got, want) {
+				t.Errorf("%q policy should keep %s: %s", test.policy, want, got)
+			}
+		}
+		for _, unwanted := range test.notContains {
+			if strings.Contains(got, unwanted) {
+				t.Errorf("%q policy should drop %s: %s", test.policy, unwanted, got)
+			}
+		}
+	}
+
+	if err := CheckHTMLPolicy("lax", nil); err == nil {
+		t.Error("Expected an unknown policy to fail")
+	}
+	if err := CheckHTMLPolicy("embeds", []string{"https://www.youtube.com/"}); err == nil {
+		t.Error("Expected a URL for an iframe host to fail")
+	}
+}
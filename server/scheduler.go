@@ -0,0 +1,175 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SystemConfigurationIdentifier is the page whose frontmatter holds settings
+// that can be changed while the wiki is running, such as
+//
+//	[schedules]
+//	inventory_normalization = "0 3 * * *"
+const SystemConfigurationIdentifier = "system_configuration"
+
+// ScheduleEntry is one line of the schedule: a job, when it runs, and when it
+// will run next.
+type ScheduleEntry struct {
+	Job      string    `json:"job"`
+	Schedule string    `json:"schedule"`
+	NextRun  time.Time `json:"next_run"`
+	LastRun  time.Time `json:"last_run"`
+	Error    string    `json:"error,omitempty"`
+}
+
+type schedulableJob struct {
+	queue string
+	run   JobFunc
+}
+
+// JobScheduler enqueues registered jobs on the cron schedules given in the
+// system configuration page. The page is re-read every minute, so schedules
+// can be changed without restarting.
+type JobScheduler struct {
+	site    *Site
+	mu      sync.Mutex
+	jobs    map[string]schedulableJob
+	entries map[string]*ScheduleEntry
+}
+
+func NewJobScheduler(site *Site) *JobScheduler {
+	return &JobScheduler{
+		site:    site,
+		jobs:    map[string]schedulableJob{},
+		entries: map[string]*ScheduleEntry{},
+	}
+}
+
+// Register makes a job available to be named in the schedule.
+func (j *JobScheduler) Register(name, queue string, run JobFunc) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jobs[name] = schedulableJob{queue: queue, run: run}
+}
+
+// Start checks the schedule every minute until the process exits.
+func (j *JobScheduler) Start() {
+	go func() {
+		j.Tick(time.Now())
+		for now := range time.Tick(time.Minute) {
+			j.Tick(now)
+		}
+	}()
+}
+
+// Tick re-reads the schedule and enqueues any job that is due.
+func (j *JobScheduler) Tick(now time.Time) {
+	schedules := j.readSchedules()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for name := range j.entries {
+		if _, ok := schedules[name]; !ok {
+			delete(j.entries, name)
+		}
+	}
+
+	for name, expression := range schedules {
+		entry, ok := j.entries[name]
+		if !ok || entry.Schedule != expression {
+			entry = &ScheduleEntry{Job: name, Schedule: expression}
+			j.entries[name] = entry
+		}
+
+		job, ok := j.jobs[name]
+		if !ok {
+			entry.Error = "no such job"
+			continue
+		}
+		cron, err := ParseCron(expression)
+		if err != nil {
+			entry.Error = err.Error()
+			continue
+		}
+
+		if entry.NextRun.IsZero() {
+			entry.NextRun = cron.Next(now)
+			continue
+		}
+		if now.Before(entry.NextRun) {
+			continue
+		}
+		if _, err := j.site.jobs().Enqueue(job.queue, name, job.run); err != nil {
+			entry.Error = err.Error()
+		} else {
+			entry.Error = ""
+		}
+		entry.LastRun = now
+		entry.NextRun = cron.Next(now)
+	}
+}
+
+func (j *JobScheduler) readSchedules() map[string]string {
+	schedules := map[string]string{}
+	matter, err := j.site.ReadFrontMatter(SystemConfigurationIdentifier)
+	if err != nil {
+		return schedules
+	}
+	normalizeFrontmatter(matter)
+	table, _ := frontmatterTable(matter, "schedules", false)
+	for name, expression := range table {
+		if expression := frontmatterString(expression); expression != "" {
+			schedules[name] = expression
+		}
+	}
+	return schedules
+}
+
+// Schedule lists every scheduled job, soonest first.
+func (j *JobScheduler) Schedule() []ScheduleEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries := []ScheduleEntry{}
+	for _, entry := range j.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, k int) bool {
+		// entries that will never run go last
+		if entries[i].NextRun.IsZero() != entries[k].NextRun.IsZero() {
+			return entries[k].NextRun.IsZero()
+		}
+		if !entries[i].NextRun.Equal(entries[k].NextRun) {
+			return entries[i].NextRun.Before(entries[k].NextRun)
+		}
+		return entries[i].Job < entries[k].Job
+	})
+	return entries
+}
+
+// scheduler returns the site's scheduler, registering the jobs that can be
+// scheduled the first time it is needed.
+func (s *Site) scheduler() *JobScheduler {
+	s.schedulerOnce.Do(func() {
+		s.Scheduler = NewJobScheduler(s)
+		s.Scheduler.Register("inventory_normalization", BackgroundQueue, s.inventoryNormalizationJob)
+		s.Scheduler.Register("shopping_list", BackgroundQueue, s.shoppingListJob)
+		s.Scheduler.Register("identifier_collisions", BackgroundQueue, s.identifierCollisionsJob)
+		s.Scheduler.Register("metrics_report", BackgroundQueue, s.metricsReportJob)
+		s.Scheduler.Register("trash_purge", BackgroundQueue, s.trashPurgeJob)
+		s.Scheduler.Register("reminders", BackgroundQueue, s.remindersJob)
+		s.Scheduler.Register("maintenance_report", BackgroundQueue, s.maintenanceReportJob)
+		s.Scheduler.Register("duplicate_pages", BackgroundQueue, s.duplicatePagesJob)
+		s.Scheduler.Register("link_check", BackgroundQueue, s.linkCheckJob)
+	})
+	return s.Scheduler
+}
+
+func (s *Site) handleJobSchedule(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "schedule": s.scheduler().Schedule()})
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// searchStopWords are too common to say anything about what a page is about.
+var searchStopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "was": true, "what": true,
+	"where": true, "when": true, "how": true, "who": true, "which": true, "does": true,
+	"did": true, "with": true, "this": true, "that": true, "from": true, "have": true,
+	"has": true, "our": true, "you": true, "your": true, "can": true, "should": true,
+	"there": true, "their": true, "they": true, "into": true, "about": true, "any": true,
+}
+
+// searchTerms splits text into lower case words, dropping short and stop
+// words, as DefaultSearchAnalyzer does.
+func searchTerms(text string) []string {
+	return DefaultSearchAnalyzer.terms(text)
+}
+
+// PageSearchResult is a page that matched a search, with its markdown.
+type PageSearchResult struct {
+	Identifier string  `json:"identifier"`
+	Title      string  `json:"title"`
+	Score      float64 `json:"score"`
+	// Fragments are the parts of the page that matched, highlighted; see
+	// SearchFragments. Only searches through the API have them.
+	Fragments []string `json:"fragments,omitempty"`
+	body      string
+}
+
+// searchDocument is a page broken into the words it is searched by.
+type searchDocument struct {
+	result PageSearchResult
+	matter map[string]interface{}
+	counts map[string]int
+	length int
+	// modified and halfLife are when the page was last edited and the
+	// RecencyHalfLife it was indexed with; see score.
+	modified time.Time
+	halfLife time.Duration
+}
+
+// score is how well the document matches the query's words, decayed by
+// how long ago the page was edited.
+func (doc searchDocument) score(queryTerms []string, weight func(string) float64, now time.Time) float64 {
+	return searchScore(queryTerms, doc.counts, doc.length, weight) * recencyDecay(doc.halfLife, doc.modified, now)
+}
+
+// countSearchTerms counts the words of a page as DefaultSearchBoosts and
+// DefaultSearchAnalyzer say.
+// It returns the counts and their total.
+func countSearchTerms(identifier, title, body string) (map[string]int, int) {
+	return countBoostedTerms(identifier, title, body, nil, DefaultSearchBoosts, DefaultSearchAnalyzer)
+}
+
+// idf weighs a word by how rare it is among the documents.
+func idf(documents []searchDocument, frequency map[string]int, term string) float64 {
+	return inverseFrequency(len(documents), frequency[term])
+}
+
+func inverseFrequency(documents, containing int) float64 {
+	return math.Log(1 + float64(documents)/float64(containing))
+}
+
+// searchScore is how well a page with the word counts matches the query's
+// words, given how each word is weighted.
+func searchScore(queryTerms []string, counts map[string]int, length int, weight func(string) float64) float64 {
+	score := 0.0
+	for _, term := range queryTerms {
+		if count := counts[term]; count > 0 {
+			score += float64(count) / float64(length) * weight(term)
+		}
+	}
+	return score
+}
+
+// sortSearchResults puts the best matches first, and limits them to limit
+// unless it is 0.
+func sortSearchResults(results []PageSearchResult, limit int) []PageSearchResult {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Identifier < results[j].Identifier
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// SearchPages ranks the pages that aren't archived by how well they match
+// the query's words, weighting each word by how rare it is (TF-IDF) and
+// counting words in the title and identifier three times. It returns up to
+// limit pages, best first.
+func (s *Site) SearchPages(query string, limit int) []PageSearchResult {
+	documents, frequency := s.searchDocuments()
+	queryTerms := s.searchAnalyzer().queryTerms(query)
+	if len(queryTerms) == 0 {
+		return []PageSearchResult{}
+	}
+
+	weight := func(term string) float64 { return idf(documents, frequency, term) }
+	now := time.Now()
+	results := []PageSearchResult{}
+	for _, doc := range documents {
+		if score := doc.score(queryTerms, weight, now); score > 0 {
+			doc.result.Score = score
+			results = append(results, doc.result)
+		}
+	}
+	return sortSearchResults(results, limit)
+}
+
+// SearchIndex is the words of a set of pages, kept so they can be searched
+// the way SearchPages does without the wiki, as the snapshot command does.
+type SearchIndex struct {
+	Pages []IndexedPage `json:"pages"`
+	// Frequency is how many of the pages each word appears in.
+	Frequency map[string]int `json:"frequency"`
+}
+
+// IndexedPage is a page's words in a SearchIndex.
+type IndexedPage struct {
+	Identifier string         `json:"identifier"`
+	Title      string         `json:"title"`
+	Counts     map[string]int `json:"counts"`
+	Length     int            `json:"length"`
+}
+
+// NewSearchIndex makes an empty index.
+func NewSearchIndex() *SearchIndex {
+	return &SearchIndex{Pages: []IndexedPage{}, Frequency: map[string]int{}}
+}
+
+// Add indexes a page's markdown, without its frontmatter.
+func (i *SearchIndex) Add(identifier, title, body string) {
+	page := IndexedPage{Identifier: strings.ToLower(identifier), Title: title}
+	page.Counts, page.Length = countSearchTerms(identifier, title, body)
+	for term := range page.Counts {
+		i.Frequency[term]++
+	}
+	i.Pages = append(i.Pages, page)
+}
+
+// Search ranks the indexed pages as SearchPages does, returning up to limit
+// of them, best first.
+func (i *SearchIndex) Search(query string, limit int) []PageSearchResult {
+	queryTerms := searchTerms(query)
+	results := []PageSearchResult{}
+	if len(queryTerms) == 0 {
+		return results
+	}
+	weight := func(term string) float64 { return inverseFrequency(len(i.Pages), i.Frequency[term]) }
+	for _, page := range i.Pages {
+		if score := searchScore(queryTerms, page.Counts, page.Length, weight); score > 0 {
+			results = append(results, PageSearchResult{Identifier: page.Identifier, Title: page.Title, Score: score})
+		}
+	}
+	return sortSearchResults(results, limit)
+}
+
+func (s *Site) handleSearchPages(c *gin.Context) {
+	type QueryJSON struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+		FragmentOptions
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	if json.Limit <= 0 {
+		json.Limit = 20
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "results": withFragments(s.SearchPages(json.Query, json.Limit), json.Query, s.searchAnalyzer(), json.FragmentOptions)})
+}
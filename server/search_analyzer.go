@@ -0,0 +1,178 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// SearchAnalyzer is how text is broken into the words pages are searched
+// by. It's read from the search table of the system configuration page
+// when the search index is built, which saving the page with another one
+// does again:
+//
+//	[search]
+//	language = "german"
+//	stemming = true
+//	stop_words = ["bitte", "danke"]
+//	[search.synonyms]
+//	auto = ["wagen", "pkw"]
+type SearchAnalyzer struct {
+	// Language is one of searchLanguages, whose stop words are left out
+	// and whose word endings stemming takes off.
+	Language string
+	// Stemming searches words by their stems, so filters finds filter.
+	Stemming bool
+	// StopWords are left out as well as the language's.
+	StopWords map[string]bool
+	// Synonyms are searched for too when a query has the word.
+	Synonyms map[string][]string
+}
+
+// searchLanguage is a language's stop words and stemmer.
+type searchLanguage struct {
+	stopWords map[string]bool
+	stem      func(word string) string
+}
+
+// searchLanguages are the languages a SearchAnalyzer knows; none has no
+// stop words and stems nothing.
+var searchLanguages = map[string]searchLanguage{
+	"english": {searchStopWords, stemEnglish},
+	"german": {wordSet("und oder aber der die das den dem des ein eine einer einem einen nicht mit von für auf aus bei ist sind war wie was wer wann auch noch nur sich sie ihr ihre wir uns zum zur über unter nach vor durch"),
+		stemSuffixes("ern", "em", "en", "er", "es", "e", "s", "n")},
+	"french": {wordSet("les des une est sont pas pour par avec dans sur qui que quoi comment aux ces cette son ses leur leurs nous vous ils elles mais ou donc car été être avoir fait"),
+		stemSuffixes("es", "s", "x", "e")},
+	"spanish": {wordSet("los las una unos unas del por para con sin que como cuando donde quien está son fue ser hay pero sus les nos este esta estos estas muy más"),
+		stemSuffixes("es", "s", "a", "o", "e")},
+	"none": {map[string]bool{}, func(word string) string { return word }},
+}
+
+// DefaultSearchAnalyzer is English without stemming, which is how pages
+// were always searched.
+var DefaultSearchAnalyzer = &SearchAnalyzer{Language: "english"}
+
+func wordSet(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
+
+// stemSuffixes stems by taking off the first of the suffixes a word ends
+// in, as long as three letters are left.
+func stemSuffixes(suffixes ...string) func(string) string {
+	return func(word string) string {
+		for _, suffix := range suffixes {
+			if strings.HasSuffix(word, suffix) && len([]rune(word))-len([]rune(suffix)) >= 3 {
+				return strings.TrimSuffix(word, suffix)
+			}
+		}
+		return word
+	}
+}
+
+// stemEnglish takes off plurals, -ing, -ed and a final e, so change,
+// changes, changed and changing are all chang.
+func stemEnglish(word string) string {
+	trim := func(suffix, replacement string) bool {
+		if strings.HasSuffix(word, suffix) && len(word)-len(suffix)+len(replacement) >= 3 {
+			word = strings.TrimSuffix(word, suffix) + replacement
+			return true
+		}
+		return false
+	}
+	switch {
+	case trim("ies", "y"), trim("sses", "ss"):
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"), strings.HasSuffix(word, "is"):
+	default:
+		trim("s", "")
+	}
+	if !trim("ing", "") {
+		trim("ed", "")
+	}
+	trim("e", "")
+	return word
+}
+
+// language is the analyzer's language, English if it doesn't know it.
+func (a *SearchAnalyzer) language() searchLanguage {
+	if language, ok := searchLanguages[a.Language]; ok {
+		return language
+	}
+	return searchLanguages["english"]
+}
+
+// term is the word as it's searched by, or "" if it's too short or a stop
+// word. The word must already be lower case.
+func (a *SearchAnalyzer) term(word string) string {
+	language := a.language()
+	if len(word) < 3 || language.stopWords[word] || a.StopWords[word] {
+		return ""
+	}
+	if a.Stemming {
+		return language.stem(word)
+	}
+	return word
+}
+
+// terms splits text into the words it's searched by; see term.
+func (a *SearchAnalyzer) terms(text string) []string {
+	terms := []string{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if term := a.term(word); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// queryTerms are the terms of a query and of the synonyms of its words.
+func (a *SearchAnalyzer) queryTerms(query string) []string {
+	terms := a.terms(query)
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		for _, synonym := range a.Synonyms[word] {
+			terms = append(terms, a.terms(synonym)...)
+		}
+	}
+	return terms
+}
+
+// configuredSearchAnalyzer reads the analyzer from the system configuration
+// page; DefaultSearchAnalyzer if it doesn't give one.
+func (s *Site) configuredSearchAnalyzer() *SearchAnalyzer {
+	table, ok := s.searchConfiguration()
+	if !ok {
+		return DefaultSearchAnalyzer
+	}
+	analyzer := &SearchAnalyzer{Language: strings.ToLower(frontmatterString(table["language"])), StopWords: map[string]bool{}, Synonyms: map[string][]string{}}
+	if _, known := searchLanguages[analyzer.Language]; !known {
+		analyzer.Language = DefaultSearchAnalyzer.Language
+	}
+	analyzer.Stemming, _ = table["stemming"].(bool)
+	for _, word := range frontmatterStrings(table["stop_words"]) {
+		analyzer.StopWords[strings.ToLower(word)] = true
+	}
+	synonyms, _ := frontmatterTable(table, "synonyms", false)
+	for word, v := range synonyms {
+		analyzer.Synonyms[strings.ToLower(word)] = frontmatterStrings(v)
+	}
+	if reflect.DeepEqual(analyzer, &SearchAnalyzer{Language: DefaultSearchAnalyzer.Language, StopWords: map[string]bool{}, Synonyms: map[string][]string{}}) {
+		return DefaultSearchAnalyzer
+	}
+	return analyzer
+}
+
+// searchAnalyzer is the analyzer the search index was built with, to
+// analyze queries the same way.
+func (s *Site) searchAnalyzer() *SearchAnalyzer {
+	s.searchIndexMut.Lock()
+	defer s.searchIndexMut.Unlock()
+	if s.searchDocs == nil {
+		return s.configuredSearchAnalyzer()
+	}
+	return s.searchDocs.analyzer
+}
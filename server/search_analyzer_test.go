@@ -0,0 +1,57 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStemEnglish(t *testing.T) {
+	for word, stem := range map[string]string{
+		"change":    "chang",
+		"changes":   "chang",
+		"changed":   "chang",
+		"changing":  "chang",
+		"filters":   "filter",
+		"batteries": "battery",
+		"glasses":   "glass",
+		"status":    "status",
+		"bus":       "bus",
+		"red":       "red",
+	} {
+		if got := stemEnglish(word); got != stem {
+			t.Errorf("Expected %s to stem to %s, got %s", word, stem, got)
+		}
+	}
+}
+
+func TestSearchAnalyzer(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "heizung", "Den Filter der Heizung jeden Monat wechseln.\n")
+	newTestPage(s, "garten", "Die Tomaten im Garten jeden Morgen gießen.\n")
+	newTestPage(s, "auto", "Der Wagen steht in der Garage.\n")
+	if analyzer := s.configuredSearchAnalyzer(); analyzer != DefaultSearchAnalyzer {
+		t.Errorf("Expected the default analyzer without a system configuration, got %+v", analyzer)
+	}
+	if results := s.SearchPages("heizungen", 10); len(results) != 0 {
+		t.Errorf("Expected no stemming by default, got %+v", results)
+	}
+
+	newTestPage(s, SystemConfigurationIdentifier, "+++\n[search]\nlanguage = \"German\"\nstemming = true\nstop_words = [\"jeden\"]\n[search.synonyms]\nauto = [\"Wagen\"]\n+++\n")
+	analyzer := s.configuredSearchAnalyzer()
+	if analyzer.Language != "german" || !analyzer.Stemming || !analyzer.StopWords["jeden"] || len(analyzer.Synonyms["auto"]) != 1 {
+		t.Fatalf("Expected the configured analyzer, got %+v", analyzer)
+	}
+	if results := s.SearchPages("Heizungen", 10); len(results) != 1 || results[0].Identifier != "heizung" {
+		t.Errorf("Expected the index to be rebuilt with stemming, got %+v", results)
+	}
+	if results := s.SearchPages("jeden", 10); len(results) != 0 {
+		t.Errorf("Expected stop words to be left out, got %+v", results)
+	}
+	if results := s.SearchPages("auto", 10); len(results) != 1 {
+		t.Errorf("Expected the synonym to find the page, got %+v", results)
+	}
+	fragments := SearchFragments("Den Filter der Heizung wechseln.", "heizungen filtern", analyzer, FragmentOptions{})
+	if len(fragments) != 1 || !strings.Contains(fragments[0], "<mark>Filter</mark> der <mark>Heizung</mark>") {
+		t.Errorf("Expected stemmed words to be highlighted, got %q", fragments)
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SearchBoosts are how many times the words in each part of a page count
+// toward it matching a search, and how quickly pages fall behind once they
+// haven't been edited in a while. They're read from the search table of
+// the system configuration page when the search index is built, which
+// saving the page with different ones does again:
+//
+//	[search]
+//	title_boost = 4
+//	tags_boost = 3
+//	headings_boost = 2
+//	body_boost = 1
+//	recency_half_life = "4320h"
+type SearchBoosts struct {
+	// Title counts for the title and identifier, Tags for the frontmatter
+	// tags and hashtags, Headings for markdown headings and Body for the
+	// rest; 0 leaves that part out.
+	Title    int
+	Tags     int
+	Headings int
+	Body     int
+	// RecencyHalfLife is how long after its last edit a page's score is
+	// halved; 0 leaves scores alone.
+	RecencyHalfLife time.Duration
+}
+
+// DefaultSearchBoosts are the boosts when the system configuration doesn't
+// give them.
+var DefaultSearchBoosts = SearchBoosts{Title: 3, Tags: 2, Headings: 2, Body: 1}
+
+// rHeading matches a markdown heading line.
+var rHeading = regexp.MustCompile(`^\s{0,3}#{1,6}\s`)
+
+// searchConfiguration is the search table of the system configuration
+// page, if it has one.
+func (s *Site) searchConfiguration() (map[string]interface{}, bool) {
+	if !s.hasPageFile(SystemConfigurationIdentifier, ".md") {
+		return nil, false
+	}
+	matter, err := s.ReadFrontMatter(SystemConfigurationIdentifier)
+	if err != nil {
+		return nil, false
+	}
+	normalizeFrontmatter(matter)
+	return frontmatterTable(matter, "search", false)
+}
+
+// configuredSearchBoosts reads the boosts from the system configuration
+// page, keeping the defaults for any it doesn't give or that make no sense.
+func (s *Site) configuredSearchBoosts() SearchBoosts {
+	boosts := DefaultSearchBoosts
+	table, ok := s.searchConfiguration()
+	if !ok {
+		return boosts
+	}
+	for key, boost := range map[string]*int{
+		"title_boost":    &boosts.Title,
+		"tags_boost":     &boosts.Tags,
+		"headings_boost": &boosts.Headings,
+		"body_boost":     &boosts.Body,
+	} {
+		if n, ok := frontmatterNumber(table[key]); ok && n >= 0 {
+			*boost = int(math.Round(n))
+		}
+	}
+	if halfLife, err := time.ParseDuration(frontmatterString(table["recency_half_life"])); err == nil && halfLife >= 0 {
+		boosts.RecencyHalfLife = halfLife
+	}
+	return boosts
+}
+
+// countBoostedTerms counts the words of a page, as the analyzer has them,
+// each as many times as the boost for the part it's in, returning the
+// counts and their total. Words hashtagged on a line count as tags there.
+func countBoostedTerms(identifier, title, body string, tags []string, boosts SearchBoosts, analyzer *SearchAnalyzer) (map[string]int, int) {
+	counts := map[string]int{}
+	length := 0
+	add := func(term string, boost int) {
+		if boost > 0 {
+			counts[term] += boost
+			length += boost
+		}
+	}
+	for _, line := range strings.Split(body, "\n") {
+		boost := boosts.Body
+		if rHeading.MatchString(line) {
+			boost = boosts.Headings
+		}
+		hashtagged := map[string]bool{}
+		for _, tag := range rHashtag.FindAllStringSubmatch(line, -1) {
+			for _, term := range analyzer.terms(tag[1]) {
+				hashtagged[term] = true
+			}
+		}
+		for _, term := range analyzer.terms(line) {
+			if hashtagged[term] && boosts.Tags > boost {
+				add(term, boosts.Tags)
+			} else {
+				add(term, boost)
+			}
+		}
+	}
+	for _, term := range analyzer.terms(strings.Join(tags, " ")) {
+		add(term, boosts.Tags)
+	}
+	for _, term := range analyzer.terms(title + " " + strings.Replace(identifier, "_", " ", -1)) {
+		add(term, boosts.Title)
+	}
+	return counts, length
+}
+
+// recencyDecay is how much a score is kept for a page last edited at
+// modified: all of it without a RecencyHalfLife, else half for each
+// half-life since.
+func recencyDecay(halfLife time.Duration, modified, now time.Time) float64 {
+	if halfLife <= 0 || modified.IsZero() || !now.After(modified) {
+		return 1
+	}
+	return math.Pow(0.5, float64(now.Sub(modified))/float64(halfLife))
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSearchBoosts(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "basement", "# Furnace\n\nChange the filter every month.\n")
+	newTestPage(s, "chores", "Check the furnace, change the filter monthly.\n")
+	newTestPage(s, "heating", "+++\ntags = [\"furnace\"]\n+++\n\nChange the filter every month.\n")
+	if boosts := s.configuredSearchBoosts(); boosts != DefaultSearchBoosts {
+		t.Errorf("Expected the default boosts without a system configuration, got %+v", boosts)
+	}
+
+	results := s.SearchPages("furnace", 10)
+	if len(results) != 3 || results[2].Identifier != "chores" {
+		t.Errorf("Expected a passing mention to rank below a heading and a tag, got %+v", results)
+	}
+
+	newTestPage(s, SystemConfigurationIdentifier, "+++\n[search]\nheadings_boost = 5\ntags_boost = 0\nbody_boost = 1.2\nrecency_half_life = \"720h\"\n+++\n")
+	boosts := s.configuredSearchBoosts()
+	if boosts != (SearchBoosts{Title: 3, Tags: 0, Headings: 5, Body: 1, RecencyHalfLife: 720 * time.Hour}) {
+		t.Errorf("Expected the configured boosts, got %+v", boosts)
+	}
+	results = s.SearchPages("furnace", 10)
+	if len(results) != 2 || results[0].Identifier != "basement" {
+		t.Errorf("Expected the index to be rebuilt with the new boosts, got %+v", results)
+	}
+	s.searchIndexMut.Lock()
+	if s.searchDocs == nil || s.searchDocs.boosts != boosts {
+		t.Errorf("Expected the index to have been built with the new boosts")
+	}
+	s.searchIndexMut.Unlock()
+}
+
+func TestRecencyDecay(t *testing.T) {
+	now := time.Now()
+	if decay := recencyDecay(0, now.Add(-1000*time.Hour), now); decay != 1 {
+		t.Errorf("Expected no decay without a half-life, got %v", decay)
+	}
+	if decay := recencyDecay(24*time.Hour, now.Add(-48*time.Hour), now); math.Abs(decay-0.25) > 1e-9 {
+		t.Errorf("Expected a quarter after two half-lives, got %v", decay)
+	}
+	if decay := recencyDecay(24*time.Hour, now.Add(time.Hour), now); decay != 1 {
+		t.Errorf("Expected no decay for a page edited since, got %v", decay)
+	}
+}
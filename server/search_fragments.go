@@ -0,0 +1,203 @@
+package server
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// defaultSearchFragments and defaultFragmentLength are how many fragments
+// of each result's page a search shows, and about how many characters
+// long each is, unless it asks for others.
+const (
+	defaultSearchFragments = 3
+	defaultFragmentLength  = 160
+)
+
+// FragmentOptions say what fragments of the pages found a search shows.
+type FragmentOptions struct {
+	// Fragments is how many, best first; 0 for defaultSearchFragments, and
+	// less than 0 for none.
+	Fragments int `json:"fragments"`
+	// Length is about how many characters each is; 0 for
+	// defaultFragmentLength.
+	Length int `json:"fragment_length"`
+}
+
+// searchSentences splits a page's markdown into sentences: each line, split
+// after full stops, question and exclamation marks, without the markers
+// headings, quotes and list items start with.
+func searchSentences(body string) [][]rune {
+	sentences := [][]rune{}
+	add := func(sentence []rune) {
+		if trimmed := strings.TrimSpace(string(sentence)); trimmed != "" {
+			sentences = append(sentences, []rune(trimmed))
+		}
+	}
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimLeft(strings.TrimSpace(line), "#>*-+ ")
+		runes := []rune(line)
+		start := 0
+		for i, r := range runes {
+			if (r == '.' || r == '!' || r == '?') && (i+1 == len(runes) || unicode.IsSpace(runes[i+1])) {
+				add(runes[start : i+1])
+				start = i + 1
+			}
+		}
+		add(runes[start:])
+	}
+	return sentences
+}
+
+// searchMatches are where in a sentence the words matching the terms, as
+// the analyzer has them, are, each from its first rune to just after its
+// last.
+func searchMatches(sentence []rune, terms map[string]bool, analyzer *SearchAnalyzer) [][2]int {
+	matches := [][2]int{}
+	for i := 0; i < len(sentence); {
+		if !unicode.IsLetter(sentence[i]) && !unicode.IsNumber(sentence[i]) {
+			i++
+			continue
+		}
+		end := i
+		for end < len(sentence) && (unicode.IsLetter(sentence[end]) || unicode.IsNumber(sentence[end])) {
+			end++
+		}
+		if term := analyzer.term(strings.ToLower(string(sentence[i:end]))); term != "" && terms[term] {
+			matches = append(matches, [2]int{i, end})
+		}
+		i = end
+	}
+	return matches
+}
+
+// highlightFragment escapes a fragment of a sentence for HTML, marking the
+// matches in it; matches with only spaces between them are marked as one.
+func highlightFragment(sentence []rune, from, to int, matches [][2]int) string {
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	at := from
+	for i := 0; i < len(matches); i++ {
+		start, end := matches[i][0], matches[i][1]
+		if start < from || end > to {
+			continue
+		}
+		for i+1 < len(matches) && matches[i+1][1] <= to && strings.TrimSpace(string(sentence[end:matches[i+1][0]])) == "" {
+			i++
+			end = matches[i][1]
+		}
+		b.WriteString(html.EscapeString(string(sentence[at:start])))
+		b.WriteString("<mark>" + html.EscapeString(string(sentence[start:end])) + "</mark>")
+		at = end
+	}
+	b.WriteString(html.EscapeString(string(sentence[at:to])))
+	if to < len(sentence) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// fragmentWindow is the part of a sentence, about length runes long and
+// cut between words, to show around its first match.
+func fragmentWindow(sentence []rune, matches [][2]int, length int) (int, int) {
+	if len(sentence) <= length {
+		return 0, len(sentence)
+	}
+	from := matches[0][0] - length/4
+	if from < 0 {
+		from = 0
+	}
+	to := from + length
+	if to > len(sentence) {
+		to, from = len(sentence), len(sentence)-length
+	}
+	for from > 0 && !unicode.IsSpace(sentence[from-1]) && from < matches[0][0] {
+		from++
+	}
+	for to < len(sentence) && !unicode.IsSpace(sentence[to]) && to > matches[len(matches)-1][1] {
+		to--
+	}
+	return from, to
+}
+
+// withFragments adds to each result the fragments of its page that best
+// match the query; see SearchFragments.
+func withFragments(results []PageSearchResult, query string, analyzer *SearchAnalyzer, options FragmentOptions) []PageSearchResult {
+	for i := range results {
+		results[i].Fragments = SearchFragments(results[i].body, query, analyzer, options)
+	}
+	return results
+}
+
+// SearchFragments are the sentences of a page's markdown that best match
+// the query, analyzed by the analyzer, in the order they're in on the page, escaped for HTML with
+// the words that matched in <mark>. Sentences next to each other are shown
+// together when they fit in one fragment; longer ones are cut down around
+// their matches.
+func SearchFragments(body, query string, analyzer *SearchAnalyzer, options FragmentOptions) []string {
+	fragments := []string{}
+	count, length := options.Fragments, options.Length
+	if count == 0 {
+		count = defaultSearchFragments
+	}
+	if length <= 0 {
+		length = defaultFragmentLength
+	}
+	terms := map[string]bool{}
+	for _, term := range analyzer.queryTerms(query) {
+		terms[term] = true
+	}
+	if count < 0 || len(terms) == 0 {
+		return fragments
+	}
+
+	type candidate struct {
+		index   int
+		matches [][2]int
+		score   int
+	}
+	sentences := searchSentences(body)
+	candidates := []candidate{}
+	for i, sentence := range sentences {
+		matches := searchMatches(sentence, terms, analyzer)
+		if len(matches) == 0 {
+			continue
+		}
+		distinct := map[string]bool{}
+		for _, match := range matches {
+			distinct[analyzer.term(strings.ToLower(string(sentence[match[0]:match[1]])))] = true
+		}
+		candidates = append(candidates, candidate{index: i, matches: matches, score: len(distinct)*100 + len(matches)})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+	if len(candidates) > count {
+		candidates = candidates[:count]
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].index < candidates[j].index })
+
+	for i := 0; i < len(candidates); i++ {
+		sentence, matches := sentences[candidates[i].index], candidates[i].matches
+		last := candidates[i].index
+		// the next sentence, if it was picked too, joins this one while
+		// they fit
+		for i+1 < len(candidates) && candidates[i+1].index == last+1 {
+			next := sentences[last+1]
+			if len(sentence)+1+len(next) > length {
+				break
+			}
+			offset := len(sentence) + 1
+			for _, match := range candidates[i+1].matches {
+				matches = append(matches, [2]int{match[0] + offset, match[1] + offset})
+			}
+			sentence = append(append(append([]rune{}, sentence...), ' '), next...)
+			last++
+			i++
+		}
+		from, to := fragmentWindow(sentence, matches, length)
+		fragments = append(fragments, highlightFragment(sentence, from, to, matches))
+	}
+	return fragments
+}
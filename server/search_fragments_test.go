@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/jcelliott/lumber"
+)
+
+func TestSearchFragments(t *testing.T) {
+	body := "# Furnace\n\nThe furnace is in the basement. It heats the house.\n\n" +
+		"- Change the furnace filter every month. Filters are in the garage.\n" +
+		"The water heater is next to it, and has nothing to do with <any> of this.\n" +
+		"Call the furnace company if the pilot light goes out; their number is on the fridge, under the magnet shaped like a lighthouse, next to the takeout menus and the school calendar, which nobody has looked at since the furnace was last serviced.\n"
+
+	fragments := SearchFragments(body, "furnace filter", DefaultSearchAnalyzer, FragmentOptions{})
+	expected := []string{
+		"<mark>Furnace</mark>",
+		"Change the <mark>furnace filter</mark> every month.",
+		"Call the <mark>furnace</mark> company",
+	}
+	if len(fragments) != len(expected) {
+		t.Fatalf("Expected %d fragments, got %q", len(expected), fragments)
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(fragments[i], prefix) {
+			t.Errorf("Expected fragment %d to start %q, got %q", i, prefix, fragments[i])
+		}
+	}
+	if !strings.HasSuffix(fragments[2], "…") || len([]rune(fragments[2])) > defaultFragmentLength+40 {
+		t.Errorf("Expected a long sentence to be cut down, got %q", fragments[2])
+	}
+
+	fragments = SearchFragments(body, "basement heats", DefaultSearchAnalyzer, FragmentOptions{Fragments: 2})
+	if len(fragments) != 1 || fragments[0] != "The furnace is in the <mark>basement</mark>. It <mark>heats</mark> the house." {
+		t.Errorf("Expected sentences next to each other to be shown together, got %q", fragments)
+	}
+	fragments = SearchFragments(body, "water nothing", DefaultSearchAnalyzer, FragmentOptions{Length: 30})
+	if len(fragments) != 1 || !strings.HasPrefix(fragments[0], "The <mark>water</mark>") || strings.Contains(fragments[0], "<any>") {
+		t.Errorf("Expected a short, escaped fragment, got %q", fragments)
+	}
+	if fragments := SearchFragments(body, "furnace", DefaultSearchAnalyzer, FragmentOptions{Fragments: -1}); len(fragments) != 0 {
+		t.Errorf("Expected no fragments when none are asked for, got %q", fragments)
+	}
+}
+
+func TestSearchPagesFragments(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), SessionStore: cookie.NewStore([]byte("secret")), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	newTestPage(s, "furnace", "Change the furnace filter every month.\n")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/search", strings.NewReader(`{"query": "filter", "fragments": 1, "fragment_length": 20}`))
+	s.Router().ServeHTTP(w, req)
+	var response struct {
+		Results []PageSearchResult
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if len(response.Results) != 1 || len(response.Results[0].Fragments) != 1 || !strings.Contains(response.Results[0].Fragments[0], "<mark>filter</mark>") {
+		t.Errorf("Expected the result to have a fragment, got %s", w.Body.String())
+	}
+}
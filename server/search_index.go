@@ -0,0 +1,283 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// searchIndexWindow is how long saved pages wait to be reindexed, so a burst
+// of saves, like an import, is reindexed together in one background job.
+const searchIndexWindow = 2 * time.Second
+
+// searchIndex is the search documents of every page, built from the files
+// when first searched and then kept up to date a page at a time.
+type searchIndex struct {
+	documents map[string]searchDocument
+	frequency map[string]int
+	// pending are the pages saved or erased since they were last indexed.
+	pending map[string]bool
+	timer   *time.Timer
+	// boosts and analyzer are what the documents were counted with.
+	boosts    SearchBoosts
+	analyzer  *SearchAnalyzer
+	built     time.Time
+	buildTook time.Duration
+}
+
+// indexSearchDocument reads a page into a search document, counting its
+// words with the index's boosts and analyzer; false if there is no such
+// page.
+func (s *Site) indexSearchDocument(identifier string, index *searchIndex) (searchDocument, bool) {
+	if !s.hasPageFile(identifier, ".json") {
+		return searchDocument{}, false
+	}
+	p := s.Open(identifier)
+	text := p.Text.GetCurrent()
+	if text == "" {
+		return searchDocument{}, false
+	}
+	matter, body, _, err := SplitFrontmatter(text)
+	if err != nil {
+		matter, body = map[string]interface{}{}, text
+	}
+	title := frontmatterString(matter["title"])
+	doc := searchDocument{
+		result:   PageSearchResult{Identifier: strings.ToLower(identifier), Title: title, body: body},
+		matter:   matter,
+		modified: p.LastEditTime(),
+		halfLife: index.boosts.RecencyHalfLife,
+	}
+	doc.counts, doc.length = countBoostedTerms(identifier, title, body, frontmatterStrings(matter["tags"]), index.boosts, index.analyzer)
+	return doc, true
+}
+
+// setSearchDocument replaces a page's document in the index, keeping the
+// word frequencies in step. Call it with searchIndexMut held.
+func (i *searchIndex) setSearchDocument(identifier string, doc searchDocument, ok bool) {
+	if old, had := i.documents[identifier]; had {
+		for term := range old.counts {
+			if i.frequency[term]--; i.frequency[term] <= 0 {
+				delete(i.frequency, term)
+			}
+		}
+		delete(i.documents, identifier)
+	}
+	if !ok {
+		return
+	}
+	for term := range doc.counts {
+		i.frequency[term]++
+	}
+	i.documents[identifier] = doc
+}
+
+// readSearchIndex reads the pages into a new index, spreading them over a
+// worker per CPU, and calls progress, if it isn't nil, as each is read.
+func (s *Site) readSearchIndex(pages []string, progress func(identifier string, started time.Time)) *searchIndex {
+	started := time.Now()
+	index := &searchIndex{documents: map[string]searchDocument{}, frequency: map[string]int{}, pending: map[string]bool{}, boosts: s.configuredSearchBoosts(), analyzer: s.configuredSearchAnalyzer()}
+	identifiers := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for identifier := range identifiers {
+				read := time.Now()
+				doc, ok := s.indexSearchDocument(identifier, index)
+				mu.Lock()
+				index.setSearchDocument(strings.ToLower(identifier), doc, ok)
+				if progress != nil {
+					progress(identifier, read)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, identifier := range pages {
+		identifiers <- identifier
+	}
+	close(identifiers)
+	wg.Wait()
+	index.built = time.Now()
+	index.buildTook = index.built.Sub(started)
+	s.metrics().Observe("wiki_index_rebuild_duration_seconds", index.buildTook, "index", "search")
+	return index
+}
+
+// buildSearchIndex reads every page into the index. Call it with
+// searchIndexMut held.
+func (s *Site) buildSearchIndex() {
+	s.searchDocs = s.readSearchIndex(s.PageIdentifiers(), nil)
+}
+
+// BuildSearchIndex queues a background job to build the search index, so
+// the first search after starting doesn't wait for every page to be read.
+// Its progress is recorded on the job and logged.
+func (s *Site) BuildSearchIndex() (string, error) {
+	return s.jobs().Enqueue(BackgroundQueue, "build search index", s.buildSearchIndexJob)
+}
+
+func (s *Site) buildSearchIndexJob(progress *JobProgress) error {
+	s.searchIndexMut.Lock()
+	if s.searchDocs != nil || s.searchBuilding != nil {
+		s.searchIndexMut.Unlock()
+		return nil
+	}
+	s.searchBuilding = map[string]bool{} // the pages saved while building
+	s.searchIndexMut.Unlock()
+
+	pages := s.PageIdentifiers()
+	total := len(pages)
+	progress.SetTotal(total)
+	s.logInfo("Building the search index of %d pages in %s", total, s.PathToData)
+	done, logged := 0, 0
+	index := s.readSearchIndex(pages, func(identifier string, started time.Time) {
+		progress.Record(identifier, started, nil)
+		done++
+		if total > 0 && done*10/total > logged {
+			logged = done * 10 / total
+			s.logInfo("Indexed %d of %d pages in %s", done, total, s.PathToData)
+		}
+	})
+
+	s.searchIndexMut.Lock()
+	defer s.searchIndexMut.Unlock()
+	if s.searchDocs == nil { // unless a search built it meanwhile
+		index.pending = s.searchBuilding
+		s.searchDocs = index
+	}
+	s.searchBuilding = nil
+	s.logInfo("Built the search index of %s in %v", s.PathToData, index.buildTook)
+	return nil
+}
+
+func (s *Site) logInfo(format string, args ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Info(format, args...)
+	}
+}
+
+// reindexPending reindexes the pages saved since they were last indexed, and
+// returns how many there were. Call it with searchIndexMut held.
+func (s *Site) reindexPending() int {
+	if s.searchDocs == nil {
+		return 0
+	}
+	pending := s.searchDocs.pending
+	s.searchDocs.pending = map[string]bool{}
+	for identifier := range pending {
+		doc, ok := s.indexSearchDocument(identifier, s.searchDocs)
+		s.searchDocs.setSearchDocument(identifier, doc, ok)
+	}
+	return len(pending)
+}
+
+// pageChangedForIndex queues a saved or erased page to be reindexed. The
+// first page queued starts a window; when it's over, a background job
+// reindexes every page queued by then. Searches reindex whatever is still
+// queued first, so they never see a page as it was before a save. Saving
+// the system configuration with other SearchBoosts or another
+// SearchAnalyzer rebuilds the whole index instead.
+func (s *Site) pageChangedForIndex(identifier string) {
+	if strings.ToLower(identifier) == SystemConfigurationIdentifier && s.searchConfigurationChanged() {
+		s.invalidateSearchIndex()
+		if _, err := s.BuildSearchIndex(); err != nil {
+			s.Logger.Error("Could not rebuild the search index with the new search configuration: %v", err)
+		}
+		return
+	}
+	s.searchIndexMut.Lock()
+	defer s.searchIndexMut.Unlock()
+	if s.searchDocs == nil {
+		if s.searchBuilding != nil {
+			s.searchBuilding[strings.ToLower(identifier)] = true
+		}
+		return // built from the files when first searched
+	}
+	s.searchDocs.pending[strings.ToLower(identifier)] = true
+	if s.searchDocs.timer != nil {
+		return
+	}
+	s.searchDocs.timer = time.AfterFunc(searchIndexWindow, func() {
+		s.searchIndexMut.Lock()
+		if s.searchDocs != nil {
+			s.searchDocs.timer = nil
+		}
+		s.searchIndexMut.Unlock()
+		_, err := s.jobs().Enqueue(BackgroundQueue, "reindex saved pages", func(progress *JobProgress) error {
+			started := time.Now()
+			s.searchIndexMut.Lock()
+			reindexed := s.reindexPending()
+			s.searchIndexMut.Unlock()
+			progress.SetTotal(1)
+			progress.Record(fmt.Sprintf("%d pages", reindexed), started, nil)
+			return nil
+		})
+		if err != nil {
+			s.Logger.Error("Could not reindex saved pages: %v", err)
+		}
+	})
+}
+
+// searchConfigurationChanged is whether the system configuration gives
+// other SearchBoosts or another SearchAnalyzer than the index was built
+// with.
+func (s *Site) searchConfigurationChanged() bool {
+	boosts, analyzer := s.configuredSearchBoosts(), s.configuredSearchAnalyzer()
+	s.searchIndexMut.Lock()
+	defer s.searchIndexMut.Unlock()
+	return s.searchDocs != nil && (s.searchDocs.boosts != boosts || !reflect.DeepEqual(s.searchDocs.analyzer, analyzer))
+}
+
+// invalidateSearchIndex drops the index, to be built again from the files
+// when next searched, for when many files changed behind its back.
+func (s *Site) invalidateSearchIndex() {
+	s.searchIndexMut.Lock()
+	defer s.searchIndexMut.Unlock()
+	if s.searchDocs != nil && s.searchDocs.timer != nil {
+		s.searchDocs.timer.Stop()
+	}
+	s.searchDocs = nil
+}
+
+// searchDocuments is every page that isn't archived, in file name order,
+// along with how many of them each word appears in.
+func (s *Site) searchDocuments() ([]searchDocument, map[string]int) {
+	s.searchIndexMut.Lock()
+	if s.searchDocs == nil {
+		s.buildSearchIndex()
+	} else {
+		s.reindexPending()
+	}
+	documents := make([]searchDocument, 0, len(s.searchDocs.documents))
+	for _, doc := range s.searchDocs.documents {
+		documents = append(documents, doc)
+	}
+	frequency := map[string]int{}
+	for term, count := range s.searchDocs.frequency {
+		frequency[term] = count
+	}
+	s.searchIndexMut.Unlock()
+
+	sort.Slice(documents, func(i, j int) bool {
+		return pageKey(documents[i].result.Identifier, "") < pageKey(documents[j].result.Identifier, "")
+	})
+	kept := documents[:0]
+	for _, doc := range documents {
+		if _, archived := s.ArchivedAt(doc.result.Identifier); archived {
+			for term := range doc.counts {
+				frequency[term]--
+			}
+			continue
+		}
+		kept = append(kept, doc)
+	}
+	return kept, frequency
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBuildSearchIndexJob(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	for i := 0; i < 20; i++ {
+		newTestPage(s, fmt.Sprintf("bin_%d", i), fmt.Sprintf("# Bin %d\n\nscrews", i))
+	}
+	progress := &JobProgress{}
+	s.searchIndexMut.Lock()
+	s.searchBuilding = map[string]bool{}
+	s.searchIndexMut.Unlock()
+	if err := s.buildSearchIndexJob(progress); err != nil || s.searchDocs != nil {
+		t.Fatalf("Expected a build already under way not to be started again: %v", err)
+	}
+	s.searchBuilding = nil
+
+	if err := s.buildSearchIndexJob(progress); err != nil {
+		t.Fatal(err)
+	}
+	if progress.total != 20 || len(progress.records) != 20 {
+		t.Errorf("Expected every page to be recorded on the job, got %d of %d", len(progress.records), progress.total)
+	}
+	if search := s.IndexHealth()[1]; !search.Built || search.Entries != 20 || search.Pending != 0 {
+		t.Errorf("Expected the search index to be built: %+v", search)
+	}
+	if results := s.SearchPages("screws", 100); len(results) != 20 {
+		t.Errorf("Expected every bin to be found, got %d", len(results))
+	}
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReloadableSettings are the settings that can change while the server is
+// running, without a restart.
+type ReloadableSettings struct {
+	Debounce        int         `json:"debounce"`
+	MaxUploadSize   uint        `json:"max_upload_mb"`
+	MaxDocumentSize uint        `json:"max_document_length"`
+	RateLimits      []RateLimit `json:"rate_limits"`
+	LogLevel        int         `json:"log_level"`
+}
+
+// Settings returns the reloadable settings in effect.
+func (s *Site) Settings() ReloadableSettings {
+	s.settingsMut.RLock()
+	defer s.settingsMut.RUnlock()
+	settings := ReloadableSettings{
+		Debounce:        s.Debounce,
+		MaxUploadSize:   s.MaxUploadSize,
+		MaxDocumentSize: s.MaxDocumentSize,
+		RateLimits:      []RateLimit{},
+	}
+	if s.RateLimiter != nil {
+		settings.RateLimits = s.RateLimiter.Limits()
+	}
+	if s.Logger != nil {
+		settings.LogLevel = s.Logger.GetLevel()
+	}
+	return settings
+}
+
+// ApplySettings puts new settings into effect and records the ones that
+// changed in the audit log as a config_changed event. It returns the names
+// of those that changed.
+func (s *Site) ApplySettings(settings ReloadableSettings) []string {
+	old := s.Settings()
+	changes := map[string]interface{}{}
+	changed := func(name string, from, to interface{}) {
+		if !reflect.DeepEqual(from, to) {
+			changes[name] = map[string]interface{}{"old": from, "new": to}
+		}
+	}
+	if settings.RateLimits == nil {
+		settings.RateLimits = []RateLimit{}
+	}
+	changed("debounce", old.Debounce, settings.Debounce)
+	changed("max_upload_mb", old.MaxUploadSize, settings.MaxUploadSize)
+	changed("max_document_length", old.MaxDocumentSize, settings.MaxDocumentSize)
+	changed("rate_limits", old.RateLimits, settings.RateLimits)
+	changed("log_level", old.LogLevel, settings.LogLevel)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	s.settingsMut.Lock()
+	s.Debounce = settings.Debounce
+	s.MaxUploadSize = settings.MaxUploadSize
+	s.MaxDocumentSize = settings.MaxDocumentSize
+	if s.RateLimiter == nil {
+		s.RateLimiter = NewRateLimiter(settings.RateLimits)
+	} else {
+		s.RateLimiter.SetLimits(settings.RateLimits)
+	}
+	if s.Logger != nil {
+		s.Logger.Level(settings.LogLevel)
+	}
+	s.settingsMut.Unlock()
+
+	names := []string{}
+	for name := range changes {
+		names = append(names, name)
+	}
+	if err := s.Audit("config_changed", changes); err != nil {
+		s.Logger.Error("Could not record the config change: %v", err)
+	}
+	s.Logger.Info("Applied new settings: %v", names)
+	return names
+}
+
+// applySettingsFrom applies each settings sent to every site, until the
+// channel is closed.
+func applySettingsFrom(settings <-chan ReloadableSettings, sites []*Site) {
+	for next := range settings {
+		for _, site := range sites {
+			site.ApplySettings(next)
+		}
+	}
+}
+
+func (s *Site) rateLimiter() *RateLimiter {
+	s.settingsMut.RLock()
+	defer s.settingsMut.RUnlock()
+	return s.RateLimiter
+}
+
+func (s *Site) handleSettings(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "settings": s.Settings()})
+}
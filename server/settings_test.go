@@ -0,0 +1,58 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jcelliott/lumber"
+)
+
+func TestApplySettings(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), Debounce: 500, MaxDocumentSize: 100, Logger: lumber.NewConsoleLogger(lumber.WARN)}
+
+	next := s.Settings()
+	next.Debounce = 900
+	next.RateLimits = []RateLimit{{Category: RateLimitWrites, PerSecond: 1, Burst: 1}}
+	changed := s.ApplySettings(next)
+	if len(changed) != 2 {
+		t.Errorf("Expected debounce and rate limits to change, got %v", changed)
+	}
+	if s.Settings().Debounce != 900 {
+		t.Errorf("Expected the new debounce, got %d", s.Settings().Debounce)
+	}
+	if allowed, _ := s.rateLimiter().Allow(RateLimitWrites, "me", time.Now()); !allowed {
+		t.Error("Expected the first write to be allowed")
+	}
+	if allowed, _ := s.rateLimiter().Allow(RateLimitWrites, "me", time.Now()); allowed {
+		t.Error("Expected the new rate limit to apply")
+	}
+
+	if changed := s.ApplySettings(s.Settings()); len(changed) != 0 {
+		t.Errorf("Expected nothing to change, got %v", changed)
+	}
+
+	events, err := s.AuditLog(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Event != "config_changed" {
+		t.Fatalf("Expected one config_changed event, got %+v", events)
+	}
+	if _, ok := events[0].Details["debounce"]; !ok {
+		t.Errorf("Expected the event to record the debounce change, got %v", events[0].Details)
+	}
+}
+
+func TestMaxDocumentSize(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), MaxDocumentSize: 10, Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	if err := newTestPage(s, "short", "# Straße!!").Save(); err != nil {
+		t.Errorf("Expected ten characters to fit, however many bytes: %v", err)
+	}
+	p := s.Open("short")
+	if err := p.Update("# Straße!!!"); err == nil {
+		t.Error("Expected eleven characters to be refused")
+	}
+	if s.Open("short").Text.GetCurrent() != "# Straße!!" {
+		t.Error("Expected the refused text not to be saved")
+	}
+}
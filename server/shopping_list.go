@@ -0,0 +1,115 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const shoppingListIdentifier = "shopping_list"
+const shoppingTag = "shopping"
+const anyStore = "Anywhere"
+
+type shoppingListEntry struct {
+	text   string
+	source string
+}
+
+// ShoppingList gathers the unchecked `#shopping` checklist items from every
+// page, plus low stock inventory, grouped by store. An item's store is its
+// first tag other than #shopping, or inventory.store for low stock items.
+func (s *Site) ShoppingList() map[string][]shoppingListEntry {
+	stores := map[string][]shoppingListEntry{}
+	add := func(store string, entry shoppingListEntry) {
+		if store == "" {
+			store = anyStore
+		}
+		stores[store] = append(stores[store], entry)
+	}
+
+	for _, identifier := range s.PageIdentifiers() {
+		if identifier == shoppingListIdentifier {
+			continue
+		}
+		for _, item := range ParseChecklist(s.Open(identifier).Text.GetCurrent()) {
+			if item.Checked || !item.HasTag(shoppingTag) {
+				continue
+			}
+			store := ""
+			for _, tag := range item.Tags {
+				if tag != shoppingTag {
+					store = tag
+					break
+				}
+			}
+			add(store, shoppingListEntry{text: item.Text, source: identifier})
+		}
+	}
+
+	for _, item := range s.LowStockItems() {
+		add(strings.ToLower(item.Store), shoppingListEntry{
+			text:   fmt.Sprintf("%s (%s of %s %s left)", item.Identifier, formatQuantity(item.Quantity), formatQuantity(item.MinQuantity), item.Unit),
+			source: item.Identifier,
+		})
+	}
+
+	return stores
+}
+
+// RefreshShoppingList regenerates the Shopping List page. The items and the
+// pages they came from are escaped, so one that looks like a template isn't
+// run as one there.
+func (s *Site) RefreshShoppingList(now time.Time) error {
+	stores := s.ShoppingList()
+	names := make([]string, 0, len(stores))
+	for store := range stores {
+		names = append(names, store)
+	}
+	sort.Strings(names)
+
+	text := "+++\nidentifier = \"" + shoppingListIdentifier + "\"\ntitle = \"Shopping List\"\n+++\n\n# Shopping List\n\n"
+	text += "_Generated " + now.Format("Mon Jan 2 15:04:05 MST 2006") + ". Edits here will be overwritten; check things off where they came from._\n"
+	if len(names) == 0 {
+		text += "\nNothing to buy.\n"
+	}
+	for _, store := range names {
+		text += "\n## " + escapeTemplates(store) + "\n\n"
+		for _, entry := range stores[store] {
+			text += "  - " + escapeTemplates(entry.text) + " ([[" + escapeTemplates(entry.source) + "]])\n"
+		}
+	}
+
+	return s.Open(shoppingListIdentifier).Update(text)
+}
+
+// ScheduleNightlyShoppingList refreshes the Shopping List page on the
+// background queue every night at midnight until the process exits.
+func (s *Site) ScheduleNightlyShoppingList() {
+	go func() {
+		for {
+			now := time.Now()
+			midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+			time.Sleep(midnight.Sub(now))
+			_, err := s.jobs().Enqueue(BackgroundQueue, "shopping list", s.shoppingListJob)
+			if err != nil {
+				s.Logger.Error("Could not schedule the shopping list: %s", err.Error())
+			}
+		}
+	}()
+}
+
+func (s *Site) shoppingListJob(*JobProgress) error {
+	return s.RefreshShoppingList(time.Now())
+}
+
+func (s *Site) handleRefreshShoppingList(c *gin.Context) {
+	if err := s.RefreshShoppingList(time.Now()); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Refreshed", "page": shoppingListIdentifier})
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestBaseURL is the scheme and host the request was made to, for
+// links that have to be absolute.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// TailnetURL is where the wiki is served over HTTPS at its tailnet name,
+// like https://wiki.tail1234.ts.net, or "" if it isn't; see
+// --tailscale-https-port.
+func (s *Site) TailnetURL() string {
+	if s.tailnetHTTPS == nil {
+		return ""
+	}
+	domain := s.tailnetHTTPS.serving()
+	if domain == "" {
+		return ""
+	}
+	return "https://" + domain + s.tailnetHTTPS.portSuffix()
+}
+
+// AbsoluteURL is the URL of a path in the wiki, like /home/view, for
+// links that leave the browser: QR codes, sitemaps, calendars, webhooks
+// and emails. It's at the tailnet name over HTTPS once that's served, or
+// else where the request was made to, or, outside a request, at Address.
+// BasePath goes before the path.
+func (s *Site) AbsoluteURL(r *http.Request, path string) string {
+	base := s.TailnetURL()
+	if base == "" && r != nil {
+		base = requestBaseURL(r)
+	}
+	if base == "" {
+		address := s.Address
+		if address == "" {
+			address = "localhost:8050"
+		}
+		base = "http://" + address
+	}
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return base + s.BasePath + path
+}
+
+// siteURL is the wiki's URL for absolute links made for a request; see
+// AbsoluteURL.
+func (s *Site) siteURL(c *gin.Context) string {
+	return s.AbsoluteURL(c.Request, "")
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAbsoluteURL(t *testing.T) {
+	s := &Site{BasePath: "/wiki", Address: "wiki.lan:8050"}
+
+	if url := s.AbsoluteURL(nil, "/home/view"); url != "http://wiki.lan:8050/wiki/home/view" {
+		t.Errorf("Expected the address outside a request, got %q", url)
+	}
+	r := httptest.NewRequest("GET", "http://192.168.1.5:8050/wiki/home/view", nil)
+	if url := s.AbsoluteURL(r, "home/view"); url != "http://192.168.1.5:8050/wiki/home/view" {
+		t.Errorf("Expected where the request was made to, got %q", url)
+	}
+	r.Header.Set("X-Forwarded-Proto", "https")
+	if url := s.AbsoluteURL(r, ""); url != "https://192.168.1.5:8050/wiki" {
+		t.Errorf("Expected https behind a proxy that says so, got %q", url)
+	}
+
+	s.tailnetHTTPS = &tailscaleHTTPS{}
+	if url := s.AbsoluteURL(nil, "/home/view"); url != "http://wiki.lan:8050/wiki/home/view" || s.TailnetURL() != "" {
+		t.Errorf("Expected the address until the tailnet name is served, got %q", url)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	s.tailnetHTTPS.domain, s.tailnetHTTPS.listener = "wiki.tail1234.ts.net", listener
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	expected := "https://wiki.tail1234.ts.net:" + port + "/wiki/home/view"
+	if url := s.AbsoluteURL(r, "/home/view"); url != expected {
+		t.Errorf("Expected %q once the tailnet name is served, got %q", expected, url)
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// spacePrefix starts the path of every request to a space that isn't
+// reached by its hostname, e.g. /spaces/work/home.
+const spacePrefix = "/spaces/"
+
+var spaceName = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// Space is another wiki served alongside the main one, with its own data
+// folder and so its own pages, indexes, job queues and metrics.
+type Space struct {
+	Name       string
+	PathToData string
+	// Hosts are hostnames that reach the space at the root, as well as at
+	// /spaces/<name>/.
+	Hosts []string
+}
+
+// ParseSpace parses a `name=data_folder` space, optionally followed by
+// `@host,host` for the hostnames that reach it, e.g.
+// `work=/srv/work-wiki@work.example.com`.
+func ParseSpace(spec string) (Space, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return Space{}, fmt.Errorf("space %q should look like name=data_folder or name=data_folder@host", spec)
+	}
+	space := Space{Name: strings.ToLower(parts[0]), PathToData: parts[1]}
+	if !spaceName.MatchString(space.Name) {
+		return Space{}, fmt.Errorf("space %q: names are letters, numbers, - and _", spec)
+	}
+	if at := strings.LastIndex(space.PathToData, "@"); at >= 0 {
+		for _, host := range strings.Split(space.PathToData[at+1:], ",") {
+			if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+				space.Hosts = append(space.Hosts, host)
+			}
+		}
+		space.PathToData = space.PathToData[:at]
+	}
+	return space, nil
+}
+
+// SpaceRouter sends each request to the wiki it is for: a space whose host it
+// was made to, a space named in its /spaces/<name>/ prefix, or else the main
+// wiki.
+type SpaceRouter struct {
+	main     http.Handler
+	byName   map[string]http.Handler
+	byHost   map[string]http.Handler
+	prefixed map[string]http.Handler
+}
+
+func NewSpaceRouter(main http.Handler) *SpaceRouter {
+	return &SpaceRouter{
+		main:     main,
+		byName:   map[string]http.Handler{},
+		byHost:   map[string]http.Handler{},
+		prefixed: map[string]http.Handler{},
+	}
+}
+
+// Add serves a space with handler. Names and hosts can only be used once.
+func (r *SpaceRouter) Add(space Space, handler http.Handler) error {
+	if _, ok := r.byName[space.Name]; ok {
+		return fmt.Errorf("there are two spaces named %q", space.Name)
+	}
+	for _, host := range space.Hosts {
+		if _, ok := r.byHost[host]; ok {
+			return fmt.Errorf("host %s is used by two spaces", host)
+		}
+	}
+	r.byName[space.Name] = handler
+	r.prefixed[space.Name] = http.StripPrefix(strings.TrimSuffix(spacePrefix, "/")+"/"+space.Name, handler)
+	for _, host := range space.Hosts {
+		r.byHost[host] = handler
+	}
+	return nil
+}
+
+func (r *SpaceRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	host := strings.ToLower(req.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if handler, ok := r.byHost[host]; ok {
+		handler.ServeHTTP(w, req)
+		return
+	}
+	if strings.HasPrefix(req.URL.Path, spacePrefix) {
+		name := strings.SplitN(strings.TrimPrefix(req.URL.Path, spacePrefix), "/", 2)[0]
+		if handler, ok := r.prefixed[name]; ok {
+			if req.URL.Path == spacePrefix+name {
+				http.Redirect(w, req, spacePrefix+name+"/", http.StatusMovedPermanently)
+				return
+			}
+			handler.ServeHTTP(w, req)
+			return
+		}
+	}
+	r.main.ServeHTTP(w, req)
+}
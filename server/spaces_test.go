@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseSpace(t *testing.T) {
+	space, err := ParseSpace("Work=/srv/work@work.example.com, wiki.work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Space{Name: "work", PathToData: "/srv/work", Hosts: []string{"work.example.com", "wiki.work"}}
+	if !reflect.DeepEqual(space, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, space)
+	}
+
+	for _, bad := range []string{"work", "work=", "my work=/srv/work"} {
+		if _, err := ParseSpace(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestSpaceRouter(t *testing.T) {
+	wiki := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte(name + " " + req.URL.Path))
+		})
+	}
+	router := NewSpaceRouter(wiki("main"))
+	if err := router.Add(Space{Name: "work", Hosts: []string{"work.example.com"}}, wiki("work")); err != nil {
+		t.Fatal(err)
+	}
+	if err := router.Add(Space{Name: "work"}, wiki("other")); err == nil {
+		t.Error("Expected a second space with the same name to be rejected")
+	}
+
+	for _, test := range []struct{ host, path, expected string }{
+		{"wiki.example.com", "/home", "main /home"},
+		{"wiki.example.com", "/spaces/work/home", "work /home"},
+		{"wiki.example.com", "/spaces/nope/home", "main /spaces/nope/home"},
+		{"work.example.com:8050", "/home", "work /home"},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", test.path, nil)
+		req.Host = test.host
+		router.ServeHTTP(w, req)
+		if w.Body.String() != test.expected {
+			t.Errorf("%s%s: expected %q, got %q", test.host, test.path, test.expected, w.Body.String())
+		}
+	}
+}
@@ -1,6 +1,10 @@
 "use strict";
 var oulipo = false;
 
+$.ajaxSetup({
+    headers: { 'X-CSRF-Token': window.simple_wiki.csrfToken }
+});
+
 $(window).load(function() {
     // Returns a function, that, as long as it continues to be invoked, will not
     // be triggered. The function will be called after it stops being called for
@@ -51,7 +55,7 @@ $(window).load(function() {
         }
         latestUpload = $.ajax({
             type: 'POST',
-            url: '/update',
+            url: window.simple_wiki.basePath + '/update',
             data: JSON.stringify({
                 new_text: $('#userInput').val(),
                 page: window.simple_wiki.pageName,
@@ -89,7 +93,7 @@ $(window).load(function() {
     function lockPage(passphrase) {
         $.ajax({
             type: 'POST',
-            url: '/lock',
+            url: window.simple_wiki.basePath + '/lock',
             data: JSON.stringify({
                 page: window.simple_wiki.pageName,
                 passphrase: passphrase
@@ -103,10 +107,10 @@ $(window).load(function() {
                 }
                 $('#saveEditButton').text(data.message);
                 if (data.success == true && $('#lockPage').text() == "Lock") {
-                    window.location = "/" + window.simple_wiki.pageName + "/view";
+                    window.location = window.simple_wiki.basePath + "/" + window.simple_wiki.pageName + "/view";
                 }
                 if (data.success == true && $('#lockPage').text() == "Unlock") {
-                    window.location = "/" + window.simple_wiki.pageName + "/edit";
+                    window.location = window.simple_wiki.basePath + "/" + window.simple_wiki.pageName + "/edit";
                 }
             },
             error: function(xhr, error) {
@@ -119,11 +123,121 @@ $(window).load(function() {
         });
     }
 
+    // Warn when someone else is editing the page too. The lock is renewed
+    // while the page is open and lapses on its own if the tab goes away.
+    function acquireEditLock() {
+        $.ajax({
+            type: 'POST',
+            url: window.simple_wiki.basePath + '/edit_lock/acquire',
+            data: JSON.stringify({
+                page: window.simple_wiki.pageName,
+                ttl_seconds: 120
+            }),
+            success: function(data) {
+                if (data.success == false && data.lock) {
+                    $('#saveEditButton').removeClass()
+                    $('#saveEditButton').addClass("failure");
+                    $('#saveEditButton').text(data.message);
+                }
+            },
+            contentType: "application/json",
+            dataType: 'json'
+        });
+    }
+
+    if ($('body').hasClass('EditPage')) {
+        acquireEditLock();
+        setInterval(acquireEditLock, 60000);
+        $(window).on('beforeunload', function() {
+            // keepalive outlives the page like a beacon, but can send the CSRF token
+            if (window.fetch) {
+                fetch(window.simple_wiki.basePath + '/edit_lock/release', {
+                    method: 'POST',
+                    keepalive: true,
+                    credentials: 'same-origin',
+                    headers: {
+                        'Content-Type': 'application/json',
+                        'X-CSRF-Token': window.simple_wiki.csrfToken
+                    },
+                    body: JSON.stringify({
+                        page: window.simple_wiki.pageName
+                    })
+                });
+            }
+        });
+    }
+
+    // Fill in the pages related to this one, ranked by the server.
+    if ($('#related').length) {
+        $.ajax({
+            type: 'POST',
+            url: window.simple_wiki.basePath + '/related',
+            data: JSON.stringify({
+                page: window.simple_wiki.pageName,
+                limit: 5
+            }),
+            success: function(data) {
+                if (data.success == false || data.related.length == 0) {
+                    return;
+                }
+                var list = $('<ul></ul>');
+                $.each(data.related, function(i, page) {
+                    var link = $('<a></a>').attr('href', window.simple_wiki.basePath + '/' + page.identifier + '/view').text(page.title || page.identifier);
+                    list.append($('<li></li>').append(link).attr('title', page.reasons.join('; ')));
+                });
+                $('#related').append($('<h4>Related</h4>')).append(list);
+            },
+            contentType: "application/json",
+            dataType: 'json'
+        });
+    }
+
+    // Save checking off a task straight away, putting the box back if the
+    // page couldn't be saved.
+    $(document).on('change', 'input.task-item', function() {
+        var box = $(this);
+        $.ajax({
+            type: 'POST',
+            url: window.simple_wiki.basePath + '/tasks/toggle',
+            data: JSON.stringify({
+                page: box.data('page') || window.simple_wiki.pageName,
+                id: box.data('task-id'),
+                checked: box.is(':checked')
+            }),
+            success: function(data) {
+                if (data.success == false) {
+                    box.prop('checked', !box.is(':checked'));
+                    alert(data.message);
+                }
+            },
+            error: function() {
+                box.prop('checked', !box.is(':checked'));
+            },
+            contentType: "application/json",
+            dataType: 'json'
+        });
+    });
+
     $("#erasePage").click(function(e) {
         e.preventDefault();
         var r = confirm("Are you sure you want to erase?");
         if (r == true) {
-            window.location = "/" + window.simple_wiki.pageName + "/erase";
+            $.ajax({
+                type: 'POST',
+                url: window.simple_wiki.basePath + '/erase',
+                data: JSON.stringify({
+                    page: window.simple_wiki.pageName
+                }),
+                success: function(data) {
+                    if (data.success == true) {
+                        window.location = window.simple_wiki.basePath + "/";
+                    } else {
+                        alert(data.message);
+                    }
+                },
+                contentType: "application/json",
+                dataType: 'json'
+            });
         } else {
             x = "You pressed Cancel!";
         }
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var rLocalLink = regexp.MustCompile(`(href|src)="(/[^"/][^"]*)"`)
+
+var staticPageTemplate = template.Must(template.New("static").Parse(`<!DOCTYPE html>
+<html>
+    <head>
+        <meta http-equiv="content-type" content="text/html; charset=UTF-8">
+        <meta name="viewport" content="width=device-width, initial-scale=1">
+        <title>{{ .Title }}</title>
+        <link rel="stylesheet" type="text/css" href="{{ .Root }}static/css/github-markdown.css">
+        <style>body { margin: 0 auto; max-width: 50em; padding: 1em; } nav { font-size: 0.9em; margin-bottom: 1em; }</style>
+    </head>
+    <body>
+        <nav><a href="{{ .Root }}index.html">All pages</a></nav>
+        <div class="markdown-body">
+            {{ .Body }}
+        </div>
+    </body>
+</html>
+`))
+
+// staticExportWriter is where a static export's files go: a directory, or
+// a zip file.
+type staticExportWriter interface {
+	Write(name string, data []byte) error
+	Close() error
+}
+
+type dirExportWriter string
+
+func (dir dirExportWriter) Write(name string, data []byte) error {
+	target := filepath.Join(string(dir), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(target, data, 0644)
+}
+
+func (dir dirExportWriter) Close() error {
+	return nil
+}
+
+type zipExportWriter struct {
+	file *os.File
+	zip  *zip.Writer
+}
+
+func (z zipExportWriter) Write(name string, data []byte) error {
+	w, err := z.zip.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (z zipExportWriter) Close() error {
+	if err := z.zip.Close(); err != nil {
+		z.file.Close()
+		return err
+	}
+	return z.file.Close()
+}
+
+// staticExportPages lists the pages a static export includes: everything
+// but drafts, archived pages and the users' own pages.
+func (s *Site) staticExportPages() map[string]bool {
+	pages := map[string]bool{}
+	for _, identifier := range s.PageIdentifiers() {
+		identifier = strings.ToLower(identifier)
+		if strings.HasPrefix(identifier, usersNamespace+NamespaceSeparator) {
+			continue
+		}
+		if _, archived := s.ArchivedAt(identifier); archived {
+			continue
+		}
+		if matter, err := s.ReadFrontMatter(identifier); err == nil && matter["draft"] == true {
+			continue
+		}
+		pages[identifier] = true
+	}
+	return pages
+}
+
+// rewriteStaticLinks points a page's links at the exported files, relative
+// to the page so the export works from any directory. It adds the uploads,
+// static files and diagrams linked to, which have to be copied too. Links to
+// pages that aren't exported are left alone.
+func rewriteStaticLinks(html, root string, pages map[string]bool, uploads map[string]string, static map[string]bool) string {
+	return rLocalLink.ReplaceAllStringFunc(html, func(match string) string {
+		parts := rLocalLink.FindStringSubmatch(match)
+		link, err := url.Parse(parts[2])
+		if err != nil {
+			return match
+		}
+		fragment := ""
+		if link.Fragment != "" {
+			fragment = "#" + link.Fragment
+		}
+		segments := strings.SplitN(strings.TrimPrefix(link.Path, "/"), "/", 2)
+		switch segments[0] {
+		case "uploads":
+			if len(segments) < 2 {
+				return match
+			}
+			name := path.Base(segments[1])
+			file := "uploads/" + name + path.Ext(link.Query().Get("filename"))
+			uploads[name] = file
+			return parts[1] + `="` + root + file + `"`
+		case diagramsDir:
+			if len(segments) < 2 || !rDiagramFile.MatchString(segments[1]) {
+				return match
+			}
+			static[strings.TrimPrefix(link.Path, "/")] = true
+			return parts[1] + `="` + root + strings.TrimPrefix(link.Path, "/") + `"`
+		case "static":
+			static[strings.TrimPrefix(link.Path, "/")] = true
+			return parts[1] + `="` + root + strings.TrimPrefix(link.Path, "/") + `"`
+		}
+		command := ""
+		if len(segments) == 2 {
+			command = "/" + segments[1]
+		}
+		page, _ := splitPageRoute(segments[0], command)
+		page = strings.ToLower(page)
+		if !pages[page] {
+			return match
+		}
+		return parts[1] + `="` + root + page + ".html" + fragment + `"`
+	})
+}
+
+// exportsDir is the folder in the data folder static exports are written to.
+const exportsDir = "exports"
+
+// ExportStaticSite renders every page that isn't a draft, archived or a
+// user's own to HTML under target, with links between them that work
+// without the wiki, and copies the uploads and styles they use. target is
+// a directory, or a .zip file, in the exports folder of the data folder.
+// The export runs on the user job queue, one job record per page. trace is
+// the id of the request asking for it.
+func (s *Site) ExportStaticSite(trace, target string) (string, error) {
+	if target == "" {
+		return "", fmt.Errorf("no target to export to")
+	}
+	target, err := s.confinedPath(exportsDir, target)
+	if err != nil {
+		return "", err
+	}
+	return s.jobs().EnqueueTraced(trace, UserQueue, "static export", func(progress *JobProgress) error {
+		var out staticExportWriter = dirExportWriter(target)
+		if strings.HasSuffix(strings.ToLower(target), ".zip") {
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			file, err := os.Create(target)
+			if err != nil {
+				return err
+			}
+			out = zipExportWriter{file: file, zip: zip.NewWriter(file)}
+		}
+
+		pages := s.staticExportPages()
+		identifiers := []string{}
+		for identifier := range pages {
+			identifiers = append(identifiers, identifier)
+		}
+		sort.Strings(identifiers)
+		progress.SetTotal(len(identifiers))
+
+		uploads := map[string]string{}
+		static := map[string]bool{"static/css/github-markdown.css": true}
+		index := "# All pages\n\n"
+		for _, identifier := range identifiers {
+			started := time.Now()
+			root := strings.Repeat("../", strings.Count(identifier, NamespaceSeparator))
+			p := s.Open(identifier)
+			p.Render()
+			title := s.pageTitle(identifier)
+			body := rewriteStaticLinks(string(p.RenderedPage), root, pages, uploads, static)
+			buf := &bytes.Buffer{}
+			err := staticPageTemplate.Execute(buf, map[string]interface{}{"Title": title, "Root": root, "Body": template.HTML(body)})
+			if err == nil {
+				err = out.Write(identifier+".html", buf.Bytes())
+			}
+			progress.Record(identifier, started, err)
+			index += "  - [" + title + "](" + identifier + ".html)\n"
+		}
+
+		buf := &bytes.Buffer{}
+		err := staticPageTemplate.Execute(buf, map[string]interface{}{"Title": "All pages", "Root": "", "Body": template.HTML(GithubMarkdownToHTML(index))})
+		if err == nil {
+			err = out.Write("index.html", buf.Bytes())
+		}
+		for name, file := range uploads {
+			data, readErr := ioutil.ReadFile(s.uploadPath(name))
+			if readErr == nil && err == nil {
+				err = out.Write(file, data)
+			}
+		}
+		for file := range static {
+			var data []byte
+			var readErr error
+			if strings.HasPrefix(file, diagramsDir+"/") {
+				data, readErr = ioutil.ReadFile(path.Join(s.PathToData, file))
+			} else {
+				data, readErr = StaticContent.ReadFile(file)
+			}
+			if readErr == nil && err == nil {
+				err = out.Write(file, data)
+			}
+		}
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	})
+}
+
+func (s *Site) handleExportStaticSite(c *gin.Context) {
+	type QueryJSON struct {
+		Target string `json:"target"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	id, err := s.ExportStaticSite(requestTrace(c), json.Target)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Exporting", "job_id": id})
+}
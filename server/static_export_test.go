@@ -0,0 +1,61 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportStaticSite(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "garden/tomatoes", "+++\nidentifier = \"garden/tomatoes\"\n+++\nSee [roses](/roses/view#pruning) and [notes](/notes).\n![plan](/uploads/abc123?filename=plan.png)\n").Save()
+	newTestPage(s, "roses", "Roses are [tomatoes](/garden/tomatoes/view)'s neighbours.\n").Save()
+	newTestPage(s, "notes", "+++\ndraft = true\n+++\nNot done yet.\n").Save()
+	os.MkdirAll(filepath.Dir(s.uploadPath("abc123")), 0755)
+	ioutil.WriteFile(s.uploadPath("abc123"), []byte("png"), 0644)
+
+	for _, outside := range []string{"../elsewhere", "site/../../elsewhere", t.TempDir(), ""} {
+		if _, err := s.ExportStaticSite("", outside); err == nil {
+			t.Errorf("Expected exporting to %q to be refused", outside)
+		}
+	}
+	id, err := s.ExportStaticSite("", "site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(s.PathToData, exportsDir, "site")
+	for i := 0; i < 1000; i++ {
+		if details, _ := s.jobs().Details(id); details.State == JobSucceeded {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	tomatoes, err := ioutil.ReadFile(filepath.Join(target, "garden", "tomatoes.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{`href="../roses.html#pruning"`, `href="/notes"`, `src="../uploads/abc123.png"`, `href="../static/css/github-markdown.css"`} {
+		if !strings.Contains(string(tomatoes), expected) {
+			t.Errorf("Expected %s in %s", expected, tomatoes)
+		}
+	}
+	if roses, _ := ioutil.ReadFile(filepath.Join(target, "roses.html")); !strings.Contains(string(roses), `href="garden/tomatoes.html"`) {
+		t.Errorf("Link to the namespaced page not rewritten: %s", roses)
+	}
+	if _, err := os.Stat(filepath.Join(target, "notes.html")); err == nil {
+		t.Error("Should not export drafts")
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(target, "uploads", "abc123.png")); string(data) != "png" {
+		t.Errorf("Upload not copied: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(target, "static", "css", "github-markdown.css")); err != nil {
+		t.Error(err)
+	}
+	if index, _ := ioutil.ReadFile(filepath.Join(target, "index.html")); !strings.Contains(string(index), "garden/tomatoes.html") {
+		t.Errorf("Index does not list the pages: %s", index)
+	}
+}
@@ -0,0 +1,355 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// summaryPrompt is what the page's markdown is given to the LLM with.
+const summaryPrompt = "Summarize this wiki page in two or three sentences. Answer with the summary only.\n\n"
+
+// maxSummarySource keeps very long manuals within what models accept; the
+// start of a page is usually what says what it is.
+const maxSummarySource = 24000
+
+// LLMProvider completes a prompt with a language model.
+type LLMProvider interface {
+	Complete(prompt string) (string, error)
+}
+
+// LLMStreamer is an LLMProvider that can hand over its answer as it is
+// written.
+type LLMStreamer interface {
+	Stream(prompt string, emit func(chunk string) error) error
+}
+
+// ollamaProvider uses a model served by Ollama.
+type ollamaProvider struct {
+	url    string
+	model  string
+	client *http.Client
+}
+
+func (o ollamaProvider) Complete(prompt string) (string, error) {
+	var answer struct {
+		Response string `json:"response"`
+	}
+	err := postLLM(o.client, o.url+"/api/generate", nil, map[string]interface{}{
+		"model":  o.model,
+		"prompt": prompt,
+		"stream": false,
+	}, &answer)
+	return answer.Response, err
+}
+
+// Stream reads Ollama's answer, a JSON object per line.
+func (o ollamaProvider) Stream(prompt string, emit func(chunk string) error) error {
+	return streamLLM(o.client, o.url+"/api/generate", nil, map[string]interface{}{
+		"model":  o.model,
+		"prompt": prompt,
+		"stream": true,
+	}, func(line string) (bool, error) {
+		var chunk struct {
+			Response string `json:"response"`
+			Done     bool   `json:"done"`
+		}
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			return false, err
+		}
+		if chunk.Response != "" {
+			if err := emit(chunk.Response); err != nil {
+				return false, err
+			}
+		}
+		return chunk.Done, nil
+	})
+}
+
+// openAIProvider uses the OpenAI chat completions API, or any server that
+// speaks it.
+type openAIProvider struct {
+	url    string
+	model  string
+	key    string
+	client *http.Client
+}
+
+func (o openAIProvider) Complete(prompt string) (string, error) {
+	var answer struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	headers := map[string]string{}
+	if o.key != "" {
+		headers["Authorization"] = "Bearer " + o.key
+	}
+	err := postLLM(o.client, o.url+"/chat/completions", headers, map[string]interface{}{
+		"model":    o.model,
+		"messages": []map[string]string{{"role": "user", "content": prompt}},
+	}, &answer)
+	if err != nil {
+		return "", err
+	}
+	if len(answer.Choices) == 0 {
+		return "", errors.New("the model gave no answer")
+	}
+	return answer.Choices[0].Message.Content, nil
+}
+
+// Stream reads OpenAI's server-sent events, ending with [DONE].
+func (o openAIProvider) Stream(prompt string, emit func(chunk string) error) error {
+	headers := map[string]string{}
+	if o.key != "" {
+		headers["Authorization"] = "Bearer " + o.key
+	}
+	return streamLLM(o.client, o.url+"/chat/completions", headers, map[string]interface{}{
+		"model":    o.model,
+		"messages": []map[string]string{{"role": "user", "content": prompt}},
+		"stream":   true,
+	}, func(line string) (bool, error) {
+		if !strings.HasPrefix(line, "data:") {
+			return false, nil
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			return true, nil
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return false, err
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			return false, emit(chunk.Choices[0].Delta.Content)
+		}
+		return false, nil
+	})
+}
+
+func newLLMRequest(url string, headers map[string]string, request interface{}) (*http.Request, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	return req, nil
+}
+
+// streamLLM posts the request and hands each line of the answer to read
+// until it says the answer is done.
+func streamLLM(client *http.Client, url string, headers map[string]string, request interface{}, read func(line string) (bool, error)) error {
+	req, err := newLLMRequest(url, headers, request)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("LLM answered %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		done, err := read(line)
+		if err != nil || done {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func postLLM(client *http.Client, url string, headers map[string]string, request interface{}, answer interface{}) error {
+	req, err := newLLMRequest(url, headers, request)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("LLM answered %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return json.Unmarshal(data, answer)
+}
+
+// NewLLMProvider makes the provider named by --llm: ollama:<model> or
+// openai:<model>, optionally followed by @<url> of the server. OpenAI's key
+// comes from OPENAI_API_KEY.
+func NewLLMProvider(spec string) (LLMProvider, error) {
+	kind, model := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, model = spec[:i], spec[i+1:]
+	}
+	server := ""
+	if i := strings.Index(model, "@"); i >= 0 {
+		model, server = model[:i], model[i+1:]
+	}
+	if model == "" {
+		return nil, fmt.Errorf("llm %q should be ollama:<model> or openai:<model>, optionally with @<server url>", spec)
+	}
+	if server != "" {
+		if u, err := url.Parse(server); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("llm server %q should be an http URL", server)
+		}
+	}
+	client := &http.Client{Timeout: 2 * time.Minute}
+	switch kind {
+	case "ollama":
+		if server == "" {
+			server = "http://localhost:11434"
+		}
+		return ollamaProvider{url: strings.TrimSuffix(server, "/"), model: model, client: client}, nil
+	case "openai":
+		if server == "" {
+			server = "https://api.openai.com/v1"
+		}
+		return openAIProvider{url: strings.TrimSuffix(server, "/"), model: model, key: os.Getenv("OPENAI_API_KEY"), client: client}, nil
+	}
+	return nil, fmt.Errorf("llm %q should be ollama:<model> or openai:<model>, optionally with @<server url>", spec)
+}
+
+// llm returns the site's LLM provider, or nil when there is none.
+func (s *Site) llm() LLMProvider {
+	s.llmOnce.Do(func() {
+		if s.LLM != nil || s.LLMProvider == "" {
+			return
+		}
+		provider, err := NewLLMProvider(s.LLMProvider)
+		if err != nil {
+			if s.Logger != nil {
+				s.Logger.Error("Can't summarize pages: %v", err)
+			}
+			return
+		}
+		s.LLM = provider
+	})
+	return s.LLM
+}
+
+// PageSummary is a page's summary and whether it came from the frontmatter
+// cache.
+type PageSummary struct {
+	Identifier  string    `json:"identifier"`
+	Summary     string    `json:"summary"`
+	Cached      bool      `json:"cached"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// SummarizePage asks the LLM for a short summary of the page's markdown.
+// With cache the summary is kept in the frontmatter's [summary] table, along
+// with a hash of the markdown, and reused until the markdown changes.
+func (s *Site) SummarizePage(identifier string, cache bool) (PageSummary, error) {
+	p := s.Open(identifier)
+	if p.IsNew() {
+		return PageSummary{}, fmt.Errorf("%s not found", identifier)
+	}
+	matter, body, _, err := SplitFrontmatter(p.Text.GetCurrent())
+	if err != nil {
+		return PageSummary{}, err
+	}
+	sum := sha256.Sum256([]byte(body))
+	source := encodeBytesToBase32(sum[:])
+	summary := PageSummary{Identifier: p.Identifier}
+
+	if cached, ok := frontmatterTable(matter, "summary", false); ok && frontmatterString(cached["source"]) == source {
+		summary.Summary = frontmatterString(cached["text"])
+		summary.Cached = true
+		summary.GeneratedAt, _ = time.Parse(time.RFC3339, frontmatterString(cached["generated_at"]))
+		return summary, nil
+	}
+
+	provider := s.llm()
+	if provider == nil {
+		return PageSummary{}, errors.New("summaries need the wiki to be started with --llm")
+	}
+	if strings.TrimSpace(body) == "" {
+		return PageSummary{}, fmt.Errorf("%s has nothing to summarize", identifier)
+	}
+	if len(body) > maxSummarySource {
+		body = strings.ToValidUTF8(body[:maxSummarySource], "")
+	}
+	text, err := provider.Complete(summaryPrompt + body)
+	if err != nil {
+		return PageSummary{}, err
+	}
+	summary.Summary = strings.TrimSpace(text)
+	summary.GeneratedAt = time.Now()
+
+	if cache {
+		err = p.UpdateFrontmatter(func(matter map[string]interface{}) error {
+			matter["summary"] = map[string]interface{}{
+				"text":         summary.Summary,
+				"source":       source,
+				"generated_at": summary.GeneratedAt.Format(time.RFC3339),
+			}
+			return nil
+		})
+	}
+	return summary, err
+}
+
+func (s *Site) handleSummarizePage(c *gin.Context) {
+	type QueryJSON struct {
+		Page  string `json:"page"`
+		Cache bool   `json:"cache"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	p := s.Open(json.Page)
+	if json.Cache && pageIsLocked(p, c) {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Locked, must unlock first"})
+		return
+	}
+	summary, err := s.SummarizePage(json.Page, json.Cache)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "summary": summary})
+}
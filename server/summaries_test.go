@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeLLM struct {
+	prompts []string
+}
+
+func (f *fakeLLM) Complete(prompt string) (string, error) {
+	f.prompts = append(f.prompts, prompt)
+	return " A manual for the furnace. \n", nil
+}
+
+func TestSummarizePage(t *testing.T) {
+	llm := &fakeLLM{}
+	s := &Site{PathToData: t.TempDir(), LLM: llm}
+	p := newTestPage(s, "furnace", "+++\nidentifier = \"furnace\"\n+++\n\n# Furnace\n\nChange the filter monthly.\n")
+	if err := p.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := s.SummarizePage("furnace", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Summary != "A manual for the furnace." || summary.Cached {
+		t.Errorf("Expected a fresh summary, got %+v", summary)
+	}
+	if len(llm.prompts) != 1 || strings.Contains(llm.prompts[0], "identifier") || !strings.Contains(llm.prompts[0], "Change the filter") {
+		t.Errorf("Expected the markdown without frontmatter to be summarized, got %q", llm.prompts)
+	}
+
+	summary, err = s.SummarizePage("furnace", true)
+	if err != nil || !summary.Cached || len(llm.prompts) != 1 {
+		t.Errorf("Expected the summary cached in frontmatter to be reused, got %+v %v", summary, err)
+	}
+
+	p = s.Open("furnace")
+	matter, body, _, _ := SplitFrontmatter(p.Text.GetCurrent())
+	text, _ := JoinFrontmatter(matter, body+"\nReplace the igniter every 5 years.\n", false)
+	p.Update(text)
+	if summary, _ := s.SummarizePage("furnace", false); summary.Cached || len(llm.prompts) != 2 {
+		t.Errorf("Expected a changed page to be summarized again, got %+v", summary)
+	}
+
+	if _, err := s.SummarizePage("nope", false); err == nil {
+		t.Error("Expected a missing page not to be summarized")
+	}
+}
+
+func TestLLMProviders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var request map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&request)
+		switch stream, _ := request["stream"].(bool); {
+		case stream && req.URL.Path == "/api/generate":
+			w.Write([]byte("{\"response\": \"ollama \"}\n{\"response\": \"streams\", \"done\": true}\n"))
+		case stream:
+			w.Write([]byte("data: {\"choices\": [{\"delta\": {\"content\": \"openai \"}}]}\n\ndata: {\"choices\": [{\"delta\": {\"content\": \"streams\"}}]}\n\ndata: [DONE]\n\n"))
+		case req.URL.Path == "/api/generate":
+			w.Write([]byte(`{"response": "ollama says ` + request["model"].(string) + `"}`))
+		case req.URL.Path == "/v1/chat/completions":
+			w.Write([]byte(`{"choices": [{"message": {"content": "openai says ` + request["model"].(string) + `"}}]}`))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	for spec, want := range map[string]string{
+		"ollama:llama3@" + server.URL:           "ollama says llama3",
+		"openai:gpt-mini@" + server.URL + "/v1": "openai says gpt-mini",
+	} {
+		provider, err := NewLLMProvider(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if answer, err := provider.Complete("hi"); err != nil || answer != want {
+			t.Errorf("Expected %q from %s, got %q %v", want, spec, answer, err)
+		}
+		streamed := ""
+		err = provider.(LLMStreamer).Stream("hi", func(chunk string) error {
+			streamed += chunk
+			return nil
+		})
+		if want := strings.Fields(want)[0] + " streams"; err != nil || streamed != want {
+			t.Errorf("Expected %q streamed from %s, got %q %v", want, spec, streamed, err)
+		}
+	}
+	for _, spec := range []string{"ollama", "mystery:model", "openai:gpt@ftp://x"} {
+		if _, err := NewLLMProvider(spec); err == nil {
+			t.Errorf("Expected %q to be refused", spec)
+		}
+	}
+}
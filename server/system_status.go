@@ -0,0 +1,105 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DiskUsage is how many bytes the data directory uses.
+type DiskUsage struct {
+	Pages   int64 `json:"pages"`
+	Uploads int64 `json:"uploads"`
+	Other   int64 `json:"other"`
+	Trash   int64 `json:"trash"`
+	Total   int64 `json:"total"`
+}
+
+// DiskUsage adds up the sizes of the files in the data directory and its
+// trash.
+func (s *Site) DiskUsage() (DiskUsage, error) {
+	usage := DiskUsage{}
+	files, err := ioutil.ReadDir(s.PathToData)
+	if err != nil {
+		return usage, err
+	}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		switch name := f.Name(); {
+		case strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".md"):
+			usage.Pages += f.Size()
+		case strings.HasSuffix(name, ".upload"):
+			usage.Uploads += f.Size()
+		default:
+			usage.Other += f.Size()
+		}
+		usage.Total += f.Size()
+	}
+	trash, _ := ioutil.ReadDir(path.Join(s.PathToData, trashDir))
+	for _, f := range trash {
+		usage.Trash += f.Size()
+		usage.Total += f.Size()
+	}
+	return usage, nil
+}
+
+// SystemStatus is everything an admin wants to know about the running wiki
+// at a glance.
+type SystemStatus struct {
+	StartedAt time.Time     `json:"started_at"`
+	Uptime    time.Duration `json:"uptime"`
+	Pages     int           `json:"pages"`
+	Indexes   []IndexHealth `json:"indexes"`
+	Queues    []QueueStatus `json:"queues"`
+	Disk      DiskUsage     `json:"disk"`
+	Warnings  []string      `json:"warnings"`
+	// Links is what the last link check found, if there was one.
+	Links *LinkCheckCounts `json:"links,omitempty"`
+	// Tailscale is where tailscaled was found, for --role.
+	Tailscale TailscaleDetection `json:"tailscale"`
+	// TailnetURL is where the wiki is served at its tailnet name, if it
+	// is; see --tailscale-https-port.
+	TailnetURL string `json:"tailnet_url,omitempty"`
+}
+
+// SystemStatus gathers the status of the wiki's parts.
+func (s *Site) SystemStatus() (SystemStatus, error) {
+	started := s.metrics().started
+	disk, err := s.DiskUsage()
+	if err != nil {
+		return SystemStatus{}, err
+	}
+	status := SystemStatus{
+		StartedAt:  started,
+		Uptime:     time.Since(started),
+		Pages:      len(s.PageIdentifiers()),
+		Indexes:    s.IndexHealth(),
+		Queues:     s.jobs().Status(),
+		Disk:       disk,
+		Warnings:   s.diskWarnings(disk),
+		Tailscale:  detectTailscale(s.TailscaleSocket),
+		TailnetURL: s.TailnetURL(),
+	}
+	if len(s.RoleMappings) > 0 && status.Tailscale.Socket == "" {
+		status.Warnings = append(status.Warnings, "Roles are only granted by user, not tag or capability: "+status.Tailscale.Error)
+	}
+	if links, ok := s.LastLinkCheck(); ok {
+		status.Links = &links
+	}
+	return status, nil
+}
+
+func (s *Site) handleSystemStatus(c *gin.Context) {
+	status, err := s.SystemStatus()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "status": status})
+}
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"io/ioutil"
+	"path"
+	"testing"
+)
+
+func TestSystemStatus(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "drill", "# Drill")
+	ioutil.WriteFile(path.Join(s.PathToData, "sha256-abc.upload"), make([]byte, 1000), 0644)
+
+	status, err := s.SystemStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Pages != 1 || len(status.Queues) != len(DefaultQueues) || len(status.Indexes) != 2 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	if status.Disk.Uploads != 1000 || status.Disk.Pages == 0 || status.Disk.Total != status.Disk.Pages+status.Disk.Uploads+status.Disk.Other {
+		t.Errorf("Unexpected disk usage %+v", status.Disk)
+	}
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tagSuggestionsFile keeps the last suggestions made for each page, page
+// identifier to suggestions, as JSON.
+const tagSuggestionsFile = "tag_suggestions.table"
+
+// maxTagVocabulary is how many of the most used tags the LLM is shown.
+const maxTagVocabulary = 100
+
+// maxSuggestedTags is how many tags are suggested for a page.
+const maxSuggestedTags = 5
+
+// tagSuggestionDelay is how long after a page's last save its tags are
+// suggested, so autosave doesn't ask the LLM on every pause in typing.
+const tagSuggestionDelay = time.Minute
+
+var rTagCharacters = regexp.MustCompile(`[^\w-]+`)
+
+// TagSuggestion is a tag proposed for a page; Existing says whether another
+// page already uses it.
+type TagSuggestion struct {
+	Tag      string `json:"tag"`
+	Existing bool   `json:"existing"`
+}
+
+// TagSuggestions are the tags proposed for a page at a time. They are never
+// applied; that is up to whoever edits the page.
+type TagSuggestions struct {
+	Page        string          `json:"page"`
+	Tags        []TagSuggestion `json:"tags"`
+	SuggestedAt time.Time       `json:"suggested_at"`
+}
+
+// pageTags lists a page's tags: those in its frontmatter and its hashtags.
+func pageTags(text string) []string {
+	matter, body, _, err := SplitFrontmatter(text)
+	if err != nil {
+		body = text
+	}
+	tags := []string{}
+	for _, tag := range frontmatterStrings(matter["tags"]) {
+		tags = append(tags, strings.ToLower(tag))
+	}
+	for _, tag := range rHashtag.FindAllStringSubmatch(body, -1) {
+		tags = append(tags, strings.ToLower(tag[1]))
+	}
+	return tags
+}
+
+// TagVocabulary counts how many pages use each tag.
+func (s *Site) TagVocabulary() map[string]int {
+	vocabulary := map[string]int{}
+	for _, identifier := range s.PageIdentifiers() {
+		seen := map[string]bool{}
+		for _, tag := range pageTags(s.Open(identifier).Text.GetCurrent()) {
+			if !seen[tag] {
+				seen[tag] = true
+				vocabulary[tag]++
+			}
+		}
+	}
+	return vocabulary
+}
+
+// normalizeTag makes an LLM's answer into a hashtag: lower case, words
+// joined by dashes.
+func normalizeTag(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(tag), "#-*0123456789. ")))
+	tag = rTagCharacters.ReplaceAllString(strings.Join(strings.Fields(tag), "-"), "")
+	return strings.Trim(tag, "-")
+}
+
+// SuggestTags asks the LLM for tags that fit the page, preferring the ones
+// other pages already use. Tags the page already has aren't suggested.
+func (s *Site) SuggestTags(identifier string) (TagSuggestions, error) {
+	provider := s.llm()
+	if provider == nil {
+		return TagSuggestions{}, errors.New("tag suggestions need the wiki to be started with --llm")
+	}
+	p := s.Open(identifier)
+	if p.IsNew() {
+		return TagSuggestions{}, fmt.Errorf("%s not found", identifier)
+	}
+	text := p.Text.GetCurrent()
+	_, body, _, err := SplitFrontmatter(text)
+	if err != nil {
+		body = text
+	}
+	if len(body) > maxSummarySource {
+		body = strings.ToValidUTF8(body[:maxSummarySource], "")
+	}
+
+	vocabulary := s.TagVocabulary()
+	common := make([]string, 0, len(vocabulary))
+	for tag := range vocabulary {
+		common = append(common, tag)
+	}
+	sort.Slice(common, func(i, j int) bool {
+		if vocabulary[common[i]] != vocabulary[common[j]] {
+			return vocabulary[common[i]] > vocabulary[common[j]]
+		}
+		return common[i] < common[j]
+	})
+	if len(common) > maxTagVocabulary {
+		common = common[:maxTagVocabulary]
+	}
+
+	prompt := fmt.Sprintf("Suggest up to %d tags for this wiki page. Prefer tags the wiki already uses where they fit: %s. Answer with the tags only, separated by commas.\n\n%s",
+		maxSuggestedTags, strings.Join(common, ", "), body)
+	answer, err := provider.Complete(prompt)
+	if err != nil {
+		return TagSuggestions{}, err
+	}
+
+	has := map[string]bool{}
+	for _, tag := range pageTags(text) {
+		has[tag] = true
+	}
+	suggestions := TagSuggestions{Page: p.Identifier, Tags: []TagSuggestion{}, SuggestedAt: time.Now()}
+	for _, tag := range strings.FieldsFunc(answer, func(r rune) bool { return r == ',' || r == '\n' }) {
+		tag = normalizeTag(tag)
+		if tag == "" || has[tag] || len(suggestions.Tags) == maxSuggestedTags {
+			continue
+		}
+		has[tag] = true
+		suggestions.Tags = append(suggestions.Tags, TagSuggestion{Tag: tag, Existing: vocabulary[tag] > 0})
+	}
+	return suggestions, s.saveTagSuggestions(suggestions)
+}
+
+func (s *Site) tagSuggestions() (map[string]TagSuggestions, error) {
+	suggestions := map[string]TagSuggestions{}
+	data, err := ioutil.ReadFile(path.Join(s.PathToData, tagSuggestionsFile))
+	if os.IsNotExist(err) {
+		return suggestions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &suggestions)
+	return suggestions, err
+}
+
+func (s *Site) saveTagSuggestions(suggestions TagSuggestions) error {
+	s.tagSuggestionsMut.Lock()
+	defer s.tagSuggestionsMut.Unlock()
+	all, err := s.tagSuggestions()
+	if err != nil {
+		return err
+	}
+	all[strings.ToLower(suggestions.Page)] = suggestions
+	data, err := json.MarshalIndent(all, "", " ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(s.PathToData, tagSuggestionsFile), data, 0644)
+}
+
+// LastTagSuggestions returns what was last suggested for the page, by
+// SuggestTags or on save.
+func (s *Site) LastTagSuggestions(identifier string) (TagSuggestions, bool) {
+	s.tagSuggestionsMut.Lock()
+	defer s.tagSuggestionsMut.Unlock()
+	all, err := s.tagSuggestions()
+	if err != nil {
+		return TagSuggestions{}, false
+	}
+	suggestions, ok := all[strings.ToLower(identifier)]
+	return suggestions, ok
+}
+
+// pageSavedForTags suggests tags for the page on the background queue a
+// while after it was last saved, when SuggestTagsOnSave is on.
+func (s *Site) pageSavedForTags(identifier string) {
+	if !s.SuggestTagsOnSave || s.llm() == nil {
+		return
+	}
+	identifier = strings.ToLower(identifier)
+	s.tagSuggestionsMut.Lock()
+	defer s.tagSuggestionsMut.Unlock()
+	if s.tagTimers == nil {
+		s.tagTimers = map[string]*time.Timer{}
+	}
+	if timer, ok := s.tagTimers[identifier]; ok {
+		timer.Reset(tagSuggestionDelay)
+		return
+	}
+	s.tagTimers[identifier] = time.AfterFunc(tagSuggestionDelay, func() {
+		s.tagSuggestionsMut.Lock()
+		delete(s.tagTimers, identifier)
+		s.tagSuggestionsMut.Unlock()
+		_, err := s.jobs().Enqueue(BackgroundQueue, "suggest tags for "+identifier, func(progress *JobProgress) error {
+			started := time.Now()
+			_, err := s.SuggestTags(identifier)
+			progress.Record(identifier, started, err)
+			return err
+		})
+		if err != nil {
+			s.Logger.Error("Could not suggest tags for %s: %v", identifier, err)
+		}
+	})
+}
+
+// handleSuggestTags suggests tags for a page now, or with last returns what
+// was suggested when it was saved.
+func (s *Site) handleSuggestTags(c *gin.Context) {
+	type QueryJSON struct {
+		Page string `json:"page"`
+		Last bool   `json:"last"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	if json.Last {
+		suggestions, ok := s.LastTagSuggestions(json.Page)
+		if !ok {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": "No tags have been suggested for " + json.Page})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true, "suggestions": suggestions})
+		return
+	}
+	suggestions, err := s.SuggestTags(json.Page)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "suggestions": suggestions})
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+type answeringLLM string
+
+func (a answeringLLM) Complete(prompt string) (string, error) {
+	return string(a), nil
+}
+
+func TestSuggestTags(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), LLM: answeringLLM("#Kitchen, appliances\n2. Home Repair, KITCHEN, warranty, manuals, extra")}
+	for _, p := range []*Page{
+		newTestPage(s, "dishwasher", "+++\ntags = [\"appliances\"]\n+++\n\nThe dishwasher's manual and warranty. #manuals\n"),
+		newTestPage(s, "fridge", "+++\ntags = [\"appliances\", \"kitchen\"]\n+++\n\nFridge.\n"),
+		newTestPage(s, "stove", "Stove. #kitchen\n"),
+	} {
+		if err := p.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if vocabulary := s.TagVocabulary(); vocabulary["kitchen"] != 2 || vocabulary["appliances"] != 2 || vocabulary["manuals"] != 1 {
+		t.Errorf("Expected frontmatter tags and hashtags counted once per page, got %v", vocabulary)
+	}
+
+	suggestions, err := s.SuggestTags("dishwasher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, suggestion := range suggestions.Tags {
+		got = append(got, suggestion.Tag)
+	}
+	if strings.Join(got, " ") != "kitchen home-repair warranty extra" {
+		t.Errorf("Expected new, normalized tags only, got %v", got)
+	}
+	if !suggestions.Tags[0].Existing || suggestions.Tags[1].Existing {
+		t.Errorf("Expected tags other pages use to be marked existing, got %+v", suggestions.Tags)
+	}
+	if text := s.Open("dishwasher").Text.GetCurrent(); strings.Contains(text, "kitchen") {
+		t.Errorf("Expected suggestions not to be applied, got %q", text)
+	}
+	if last, ok := s.LastTagSuggestions("dishwasher"); !ok || len(last.Tags) != 4 {
+		t.Errorf("Expected the suggestions to be kept, got %+v", last)
+	}
+}
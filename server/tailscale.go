@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// tailscaleSockets are where tailscaled's local API is looked for, in
+// order, when --tailscale-socket doesn't say, after TS_SOCKET.
+var tailscaleSockets = []string{
+	defaultTailscaleSocket,           // Linux packages
+	"/run/tailscale/tailscaled.sock", // the same, where /var/run isn't /run
+	"/var/run/tailscaled.socket",     // macOS, tailscaled built from source
+	"/tmp/tailscaled.sock",           // userspace networking, as in tailscale's container image
+}
+
+// TailscaleDetection is where tailscaled's local API was looked for, and
+// the socket it answered on.
+type TailscaleDetection struct {
+	// Socket is where it was found; empty if it wasn't.
+	Socket string   `json:"socket,omitempty"`
+	Tried  []string `json:"tried"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// detectTailscale looks for tailscaled: only at the configured socket if
+// there is one, or else at TS_SOCKET and tailscaleSockets, taking the
+// first that's a socket something answers on.
+func detectTailscale(configured string) TailscaleDetection {
+	candidates := []string{configured}
+	if configured == "" {
+		candidates = tailscaleSockets
+		if env := os.Getenv("TS_SOCKET"); env != "" {
+			candidates = append([]string{env}, tailscaleSockets...)
+		}
+	}
+	detection := TailscaleDetection{Tried: []string{}}
+	var lastErr error
+	for _, socket := range candidates {
+		detection.Tried = append(detection.Tried, socket)
+		info, err := os.Stat(socket)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if info.Mode()&os.ModeSocket == 0 {
+			lastErr = fmt.Errorf("%s isn't a socket", socket)
+			continue
+		}
+		conn, err := net.DialTimeout("unix", socket, time.Second)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		conn.Close()
+		detection.Socket = socket
+		return detection
+	}
+	if configured != "" {
+		detection.Error = fmt.Sprintf("tailscaled isn't answering at %s: %v", configured, lastErr)
+	} else {
+		detection.Error = "tailscaled isn't answering at any of the usual sockets; give --tailscale-socket"
+	}
+	return detection
+}
+
+// tailscaleLocalAPI asks tailscaled about the tailnet through its local
+// API.
+type tailscaleLocalAPI struct {
+	client  *http.Client
+	baseURL string
+}
+
+// newTailscaleLocalAPI asks the tailscaled at the socket, or wherever
+// detectTailscale finds one, looking again each time it connects.
+func newTailscaleLocalAPI(socket string) tailscaleLocalAPI {
+	transport := &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+		detection := detectTailscale(socket)
+		if detection.Socket == "" {
+			return nil, fmt.Errorf("%s", detection.Error)
+		}
+		return (&net.Dialer{}).DialContext(ctx, "unix", detection.Socket)
+	}}
+	return tailscaleLocalAPI{client: &http.Client{Transport: transport}, baseURL: "http://local-tailscaled.sock"}
+}
+
+// get asks the local API for a path, giving it as long as timeout to
+// answer.
+func (l tailscaleLocalAPI) get(path string, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tailscaled answered %s for %s: %s", resp.Status, path, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+func (l tailscaleLocalAPI) WhoIs(address string) (TailnetPeer, error) {
+	body, err := l.get("/localapi/v0/whois?addr="+url.QueryEscape(address), 5*time.Second)
+	if err != nil {
+		return TailnetPeer{}, err
+	}
+	var answer struct {
+		Node struct {
+			Name string
+			Tags []string
+		}
+		UserProfile struct {
+			LoginName string
+		}
+		CapMap map[string]json.RawMessage
+	}
+	if err := json.Unmarshal(body, &answer); err != nil {
+		return TailnetPeer{}, err
+	}
+	peer := TailnetPeer{Node: strings.TrimSuffix(answer.Node.Name, "."), Tags: answer.Node.Tags}
+	if len(peer.Tags) == 0 {
+		peer.Login = strings.ToLower(answer.UserProfile.LoginName)
+	}
+	for capability := range answer.CapMap {
+		peer.Capabilities = append(peer.Capabilities, capability)
+	}
+	return peer, nil
+}
+
+// tailscaleStatus is what the wiki needs of tailscaled's status.
+type tailscaleStatus struct {
+	// BackendState is Running once the device is on the tailnet.
+	BackendState string
+	// CertDomains are the names tailscaled can get HTTPS certificates
+	// for; none until HTTPS is turned on for the tailnet.
+	CertDomains []string
+	// MagicDNSSuffix is the suffix of the tailnet's MagicDNS names, like
+	// tail1234.ts.net.
+	MagicDNSSuffix string
+}
+
+func (l tailscaleLocalAPI) Status() (tailscaleStatus, error) {
+	var status tailscaleStatus
+	body, err := l.get("/localapi/v0/status?peers=false", 5*time.Second)
+	if err != nil {
+		return status, err
+	}
+	err = json.Unmarshal(body, &status)
+	return status, err
+}
+
+// Certificate gets a certificate for one of the CertDomains, which can
+// take a while the first time, while tailscaled has it issued.
+func (l tailscaleLocalAPI) Certificate(domain string) (*tls.Certificate, error) {
+	pair, err := l.get("/localapi/v0/cert/"+url.PathEscape(domain)+"?type=pair", 2*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	// the key and certificate come together, and each is picked out of it
+	certificate, err := tls.X509KeyPair(pair, pair)
+	if err != nil {
+		return nil, err
+	}
+	return &certificate, nil
+}
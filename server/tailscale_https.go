@@ -0,0 +1,144 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jcelliott/lumber"
+)
+
+// tailscaleWatchInterval is how often tailscaled is checked on until the
+// wiki is served over HTTPS through it.
+const tailscaleWatchInterval = 30 * time.Second
+
+// tailscaleCertificateAge is how long a certificate from tailscaled is
+// used before asking for it again; tailscaled renews it well before it
+// expires.
+const tailscaleCertificateAge = time.Hour
+
+// tailscaleHTTPS serves the wiki over HTTPS at its tailnet name, with
+// tailscaled's certificates, from whenever tailscaled is running with
+// HTTPS certificates turned on: the wiki can start before tailscaled does,
+// or before HTTPS is turned on in the admin console, without a restart.
+type tailscaleHTTPS struct {
+	api     tailscaleLocalAPI
+	addr    string
+	handler http.Handler
+	logger  *lumber.ConsoleLogger
+
+	mu          sync.Mutex
+	domain      string
+	listener    net.Listener
+	certificate *tls.Certificate
+	fetched     time.Time
+}
+
+func newTailscaleHTTPS(socket, addr string, handler http.Handler, logger *lumber.ConsoleLogger) *tailscaleHTTPS {
+	return &tailscaleHTTPS{api: newTailscaleLocalAPI(socket), addr: addr, handler: handler, logger: logger}
+}
+
+// watch checks on tailscaled every interval until the wiki is served over
+// HTTPS.
+func (t *tailscaleHTTPS) watch(interval time.Duration) {
+	for !t.check() {
+		time.Sleep(interval)
+	}
+}
+
+// check starts serving over HTTPS if tailscaled can give a certificate,
+// and is whether it's served.
+func (t *tailscaleHTTPS) check() bool {
+	if t.serving() != "" {
+		return true
+	}
+	status, err := t.api.Status()
+	if err != nil || status.BackendState != "Running" || len(status.CertDomains) == 0 {
+		return false
+	}
+	domain := status.CertDomains[0]
+	certificate, err := t.api.Certificate(domain)
+	if err != nil {
+		t.logger.Warn("Tailscale is up, but can't give a certificate for %s yet: %v", domain, err)
+		return false
+	}
+	listener, err := net.Listen("tcp", t.addr)
+	if err != nil {
+		t.logger.Error("Can't serve HTTPS for %s on %s: %v", domain, t.addr, err)
+		return false
+	}
+	t.mu.Lock()
+	t.domain, t.listener, t.certificate, t.fetched = domain, listener, certificate, time.Now()
+	t.mu.Unlock()
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12, CipherSuites: defaultCipherSuites, GetCertificate: t.getCertificate, NextProtos: []string{"h2", "http/1.1"}}
+	server := &http.Server{Handler: t.handler, TLSConfig: config}
+	go func() {
+		t.logger.Error("Stopped serving HTTPS for %s: %v", domain, server.ServeTLS(listener, "", ""))
+	}()
+	t.logger.Info("Tailscale is up; serving https://%s%s", domain, t.portSuffix())
+	return true
+}
+
+// serving is the tailnet name the wiki is served over HTTPS at, or "" if
+// it isn't yet.
+func (t *tailscaleHTTPS) serving() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.domain
+}
+
+// portSuffix is the :port of the HTTPS listener, or nothing for 443.
+func (t *tailscaleHTTPS) portSuffix() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.listener == nil {
+		return ""
+	}
+	_, port, _ := net.SplitHostPort(t.listener.Addr().String())
+	if port == "443" {
+		return ""
+	}
+	return ":" + port
+}
+
+// getCertificate is the certificate from tailscaled, asked for again once
+// it's tailscaleCertificateAge old; the old one is kept, for another
+// minute, if that fails.
+func (t *tailscaleHTTPS) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	t.mu.Lock()
+	domain, certificate, fetched := t.domain, t.certificate, t.fetched
+	t.mu.Unlock()
+	if time.Since(fetched) < tailscaleCertificateAge {
+		return certificate, nil
+	}
+	renewed, err := t.api.Certificate(domain)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		t.logger.Warn("Can't renew the certificate for %s, keeping the last one: %v", domain, err)
+		t.fetched = time.Now().Add(time.Minute - tailscaleCertificateAge)
+		return certificate, nil
+	}
+	t.certificate, t.fetched = renewed, time.Now()
+	return renewed, nil
+}
+
+// redirect sends plain HTTP requests for the tailnet name to HTTPS, once
+// it's served there; requests by IP address or another name are left be.
+func (t *tailscaleHTTPS) redirect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if domain := t.serving(); r.TLS == nil && domain != "" && strings.EqualFold(host, domain) {
+			http.Redirect(w, r, "https://"+domain+t.portSuffix()+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
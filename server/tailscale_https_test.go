@@ -0,0 +1,87 @@
+package server
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jcelliott/lumber"
+)
+
+func TestTailscaleHTTPS(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t, "wiki.tail1234.ts.net")
+	cert, _ := ioutil.ReadFile(certFile)
+	key, _ := ioutil.ReadFile(keyFile)
+
+	var mu sync.Mutex
+	state := "Starting"
+	tailscaled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/localapi/v0/status" && state == "Running":
+			w.Write([]byte(`{"BackendState": "Running", "CertDomains": ["wiki.tail1234.ts.net"]}`))
+		case r.URL.Path == "/localapi/v0/status":
+			w.Write([]byte(`{"BackendState": "` + state + `"}`))
+		case r.URL.Path == "/localapi/v0/cert/wiki.tail1234.ts.net" && state == "Running":
+			w.Write(append(key, cert...))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer tailscaled.Close()
+
+	wiki := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("wiki"))
+	})
+	https := &tailscaleHTTPS{
+		api:     tailscaleLocalAPI{client: tailscaled.Client(), baseURL: tailscaled.URL},
+		addr:    "127.0.0.1:0",
+		handler: wiki,
+		logger:  lumber.NewConsoleLogger(lumber.WARN),
+	}
+	redirect := https.redirect(wiki)
+
+	if https.check() {
+		t.Fatalf("Expected no HTTPS before tailscaled is running")
+	}
+	w := httptest.NewRecorder()
+	redirect.ServeHTTP(w, httptest.NewRequest("GET", "http://wiki.tail1234.ts.net/home", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected no redirect before HTTPS is served, got %d", w.Code)
+	}
+
+	mu.Lock()
+	state = "Running"
+	mu.Unlock()
+	if !https.check() {
+		t.Fatalf("Expected HTTPS once tailscaled is running")
+	}
+	defer https.listener.Close()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + https.listener.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "wiki" || resp.TLS.PeerCertificates[0].Subject.CommonName != "wiki.tail1234.ts.net" {
+		t.Errorf("Expected the wiki with tailscaled's certificate, got %q", body)
+	}
+
+	w = httptest.NewRecorder()
+	redirect.ServeHTTP(w, httptest.NewRequest("GET", "http://wiki.tail1234.ts.net:8050/home?a=b", nil))
+	if location := w.Header().Get("Location"); w.Code != http.StatusTemporaryRedirect || !strings.HasPrefix(location, "https://wiki.tail1234.ts.net:") || !strings.HasSuffix(location, "/home?a=b") {
+		t.Errorf("Expected a redirect to HTTPS, got %d to %q", w.Code, location)
+	}
+	w = httptest.NewRecorder()
+	redirect.ServeHTTP(w, httptest.NewRequest("GET", "http://100.64.0.1:8050/home", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected requests by address not to be redirected, got %d", w.Code)
+	}
+}
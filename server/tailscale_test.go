@@ -0,0 +1,46 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestDetectTailscale(t *testing.T) {
+	dir := t.TempDir()
+	socket := path.Join(dir, "tailscaled.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	notASocket := path.Join(dir, "tailscaled.txt")
+	ioutil.WriteFile(notASocket, []byte("hello"), 0600)
+
+	if detection := detectTailscale(socket); detection.Socket != socket || detection.Error != "" {
+		t.Errorf("Expected the configured socket, got %+v", detection)
+	}
+	if detection := detectTailscale(notASocket); detection.Socket != "" || detection.Error == "" || len(detection.Tried) != 1 {
+		t.Errorf("Expected only the configured path tried, and not taken, got %+v", detection)
+	}
+
+	os.Setenv("TS_SOCKET", socket)
+	defer os.Unsetenv("TS_SOCKET")
+	if detection := detectTailscale(""); detection.Socket != socket || detection.Tried[0] != socket {
+		t.Errorf("Expected TS_SOCKET tried first, got %+v", detection)
+	}
+
+	saved := tailscaleSockets
+	defer func() { tailscaleSockets = saved }()
+	tailscaleSockets = []string{path.Join(dir, "missing.sock"), notASocket, socket}
+	os.Unsetenv("TS_SOCKET")
+	if detection := detectTailscale(""); detection.Socket != socket || len(detection.Tried) != 3 {
+		t.Errorf("Expected the usual places tried in turn, got %+v", detection)
+	}
+	listener.Close()
+	if detection := detectTailscale(""); detection.Socket != "" || detection.Error == "" {
+		t.Errorf("Expected tailscaled not found once it's gone, got %+v", detection)
+	}
+}
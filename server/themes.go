@@ -0,0 +1,219 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultTheme is the theme used when neither the user nor the wiki has
+// picked one. It only adds a dark variant to the built in styles.
+const DefaultTheme = "default"
+
+// customTheme is the --css file, as a theme.
+const customTheme = "custom"
+
+// themesNamespace holds themes written as pages, such as themes/ocean. A
+// theme page has a ```css block for the light styles and a ```css dark
+// block for the dark ones, either of which may be left out. A page takes
+// the place of an embedded theme of the same name.
+const themesNamespace = "themes"
+
+var rThemeBlock = regexp.MustCompile("(?s)```css( dark)?[ \t]*\n(.*?)```")
+
+// Theme is CSS added after the built in styles, with a variant for when the
+// browser prefers a dark color scheme.
+type Theme struct {
+	Name  string `json:"name"`
+	Light string `json:"light"`
+	Dark  string `json:"dark"`
+}
+
+// CSS is the theme's stylesheet, the dark styles applying only when the
+// browser prefers them.
+func (t Theme) CSS() string {
+	css := t.Light
+	if t.Dark != "" {
+		css += "\n@media (prefers-color-scheme: dark) {\n" + t.Dark + "\n}\n"
+	}
+	return css
+}
+
+// embeddedThemes lists the themes in static/themes, where each theme is
+// name.css and name.dark.css, either of which may be missing.
+func embeddedThemes() map[string]Theme {
+	themes := map[string]Theme{DefaultTheme: {Name: DefaultTheme}}
+	files, _ := fs.ReadDir(StaticContent, "static/themes")
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), ".css")
+		dark := strings.HasSuffix(name, ".dark")
+		name = strings.TrimSuffix(name, ".dark")
+		data, err := StaticContent.ReadFile(path.Join("static/themes", file.Name()))
+		if err != nil {
+			continue
+		}
+		theme := themes[name]
+		theme.Name = name
+		if dark {
+			theme.Dark = string(data)
+		} else {
+			theme.Light = string(data)
+		}
+		themes[name] = theme
+	}
+	return themes
+}
+
+// ThemeNames lists the themes that can be picked.
+func (s *Site) ThemeNames() []string {
+	names := []string{}
+	for name := range embeddedThemes() {
+		names = append(names, name)
+	}
+	if len(s.Css) > 0 {
+		names = append(names, customTheme)
+	}
+	for _, identifier := range s.ListNamespace(themesNamespace).Pages {
+		name := strings.TrimPrefix(identifier, themesNamespace+NamespaceSeparator)
+		if !stringInSlice(name, names) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetTheme finds a theme by name.
+func (s *Site) GetTheme(name string) (Theme, error) {
+	name = strings.ToLower(name)
+	p := s.Open(themesNamespace + NamespaceSeparator + name)
+	if !p.IsNew() {
+		theme := Theme{Name: name}
+		for _, block := range rThemeBlock.FindAllStringSubmatch(p.Text.GetCurrent(), -1) {
+			if block[1] != "" {
+				theme.Dark += block[2]
+			} else {
+				theme.Light += block[2]
+			}
+		}
+		return theme, nil
+	}
+	if name == customTheme && len(s.Css) > 0 {
+		return Theme{Name: customTheme, Light: string(s.Css)}, nil
+	}
+	if theme, ok := embeddedThemes()[name]; ok {
+		return theme, nil
+	}
+	return Theme{}, fmt.Errorf("there is no theme %q", name)
+}
+
+// preferencesIdentifier is the system page holding a user's preferences.
+func (s *Site) preferencesIdentifier(identity string) string {
+	return s.userPageIdentifier(identity, "preferences")
+}
+
+// siteTheme is the theme the wiki uses, set by theme in the system
+// configuration's frontmatter.
+func (s *Site) siteTheme() string {
+	matter, err := s.ReadFrontMatter(SystemConfigurationIdentifier)
+	if err == nil {
+		if theme := frontmatterString(matter["theme"]); theme != "" {
+			return theme
+		}
+	}
+	return DefaultTheme
+}
+
+// ThemeFor is the theme someone sees: the one they picked, or else the
+// wiki's.
+func (s *Site) ThemeFor(identity string) string {
+	if identity != "" {
+		if matter, err := s.ReadFrontMatter(s.preferencesIdentifier(identity)); err == nil {
+			if theme := frontmatterString(matter["theme"]); theme != "" {
+				return theme
+			}
+		}
+	}
+	return s.siteTheme()
+}
+
+// SetTheme picks a theme for a user or, if identity is empty, for the wiki.
+// An empty name goes back to the wiki's theme, or for the wiki to the
+// default.
+func (s *Site) SetTheme(identity, name string) error {
+	name = strings.ToLower(name)
+	if name != "" {
+		if _, err := s.GetTheme(name); err != nil {
+			return err
+		}
+	}
+	identifier := SystemConfigurationIdentifier
+	if identity != "" {
+		identifier = s.preferencesIdentifier(identity)
+	}
+	p := s.Open(identifier)
+	if p.IsNew() {
+		p.Text.Update("+++\nidentifier = \"" + identifier + "\"\n+++\n")
+	}
+	return p.UpdateFrontmatter(func(matter map[string]interface{}) error {
+		if name == "" {
+			delete(matter, "theme")
+		} else {
+			matter["theme"] = name
+		}
+		return nil
+	})
+}
+
+// handleThemeCSS serves /static/css/theme.css, the stylesheet of the
+// theme named by ?name= or else the requester's.
+func (s *Site) handleThemeCSS(c *gin.Context) {
+	name := c.Query("name")
+	if name == "" {
+		name = s.ThemeFor(requestIdentity(c))
+	}
+	theme, err := s.GetTheme(name)
+	if err != nil {
+		c.String(http.StatusNotFound, err.Error())
+		return
+	}
+	dataWithETag(c, "text/css; charset=utf-8", pageCacheControl, []byte(theme.CSS()))
+}
+
+func (s *Site) handleGetTheme(c *gin.Context) {
+	identity := requestIdentity(c)
+	c.JSON(http.StatusOK, gin.H{"success": true, "theme": s.ThemeFor(identity), "site_theme": s.siteTheme(), "themes": s.ThemeNames()})
+}
+
+func (s *Site) handleSetTheme(c *gin.Context) {
+	type QueryJSON struct {
+		Theme string `json:"theme"`
+		// Site sets the wiki's theme rather than the requester's.
+		Site bool `json:"site"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	identity := ""
+	if !json.Site {
+		if identity = requestIdentity(c); identity == "" {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": errNoIdentity.Error()})
+			return
+		}
+	}
+	if err := s.SetTheme(identity, json.Theme); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "theme": s.ThemeFor(identity)})
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/jcelliott/lumber"
+)
+
+func TestThemes(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), Css: []byte("body { color: red; }"), SessionStore: cookie.NewStore([]byte("secret")), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	ocean := newTestPage(s, "themes/ocean", "Blue.\n\n```css\nbody { background: #e0f0ff; }\n```\n\n```css dark\nbody { background: #001a33; }\n```\n")
+	if err := ocean.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := strings.Join(s.ThemeNames(), ","); names != "custom,default,ocean,sepia" {
+		t.Errorf("got %s", names)
+	}
+	theme, err := s.GetTheme("Ocean")
+	if err != nil {
+		t.Fatal(err)
+	}
+	css := theme.CSS()
+	if !strings.Contains(css, "#e0f0ff") || !strings.Contains(css, "@media (prefers-color-scheme: dark) {\nbody { background: #001a33; }") {
+		t.Errorf("got %s", css)
+	}
+	if theme, _ := s.GetTheme("default"); theme.Light != "" || theme.Dark == "" {
+		t.Errorf("expected the default theme to only add dark styles, got %+v", theme)
+	}
+	if _, err := s.GetTheme("neon"); err == nil {
+		t.Error("expected an error for a theme that doesn't exist")
+	}
+
+	if s.ThemeFor("alice@example.com") != DefaultTheme {
+		t.Error("expected the default theme before any is picked")
+	}
+	if err := s.SetTheme("", "sepia"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetTheme("alice@example.com", "ocean"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetTheme("alice@example.com", "neon"); err == nil {
+		t.Error("expected an error picking a theme that doesn't exist")
+	}
+	if s.ThemeFor("alice@example.com") != "ocean" || s.ThemeFor("bob@example.com") != "sepia" || s.ThemeFor("") != "sepia" {
+		t.Errorf("got %s %s", s.ThemeFor("alice@example.com"), s.ThemeFor("bob@example.com"))
+	}
+	if err := s.SetTheme("alice@example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	if s.ThemeFor("alice@example.com") != "sepia" {
+		t.Errorf("expected alice to go back to the wiki's theme, got %s", s.ThemeFor("alice@example.com"))
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/static/css/theme.css", nil)
+	s.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "#f4ecd8") || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/css") {
+		t.Errorf("got %d %s %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// TLSOptions have the server answer HTTPS itself rather than behind a proxy
+// like tailscale serve. With no CertFile it answers plain HTTP.
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	// MinVersion is the oldest TLS version taken: 1.2 or 1.3; empty is 1.2.
+	MinVersion string
+	// CipherSuites are the TLS 1.2 cipher suites offered, by Go's names;
+	// none for defaultCipherSuites. TLS 1.3's aren't configurable.
+	CipherSuites []string
+	// NoHTTP2 keeps clients to HTTP/1.1.
+	NoHTTP2 bool
+	// ClientCAFile is a PEM bundle of the CAs whose client certificates are
+	// required; empty for no client certificates. The certificate says who
+	// the user is, see certificateIdentity.
+	ClientCAFile string
+}
+
+// tlsVersions are the MinVersion settings taken; older versions are broken.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// defaultCipherSuites are the TLS 1.2 suites offered unless others are
+// named: forward secret, authenticated encryption only.
+var defaultCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// Config checks the options and loads the certificate, returning nil for
+// plain HTTP.
+func (o TLSOptions) Config() (*tls.Config, error) {
+	if o.CertFile == "" && o.KeyFile == "" {
+		if o.MinVersion != "" || len(o.CipherSuites) > 0 || o.NoHTTP2 || o.ClientCAFile != "" {
+			return nil, fmt.Errorf("tls-min-version, tls-cipher, no-http2 and tls-client-ca need tls-cert and tls-key")
+		}
+		return nil, nil
+	}
+	if o.CertFile == "" || o.KeyFile == "" {
+		return nil, fmt.Errorf("tls-cert and tls-key go together")
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12, CipherSuites: defaultCipherSuites}
+	if o.MinVersion != "" {
+		version, ok := tlsVersions[o.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("tls-min-version %q should be 1.2 or 1.3", o.MinVersion)
+		}
+		config.MinVersion = version
+	}
+	if len(o.CipherSuites) > 0 {
+		if config.MinVersion == tls.VersionTLS13 {
+			return nil, fmt.Errorf("tls-cipher only applies to TLS 1.2, which tls-min-version 1.3 turns off")
+		}
+		secure := map[string]uint16{}
+		names := []string{}
+		for _, suite := range tls.CipherSuites() {
+			if !strings.HasPrefix(suite.Name, "TLS_ECDHE_") {
+				continue // no forward secrecy
+			}
+			for _, version := range suite.SupportedVersions {
+				if version == tls.VersionTLS12 {
+					secure[suite.Name] = suite.ID
+					names = append(names, suite.Name)
+				}
+			}
+		}
+		sort.Strings(names)
+		config.CipherSuites = nil
+		for _, name := range o.CipherSuites {
+			id, ok := secure[name]
+			if !ok {
+				return nil, fmt.Errorf("tls-cipher %q should be one of %s", name, strings.Join(names, ", "))
+			}
+			config.CipherSuites = append(config.CipherSuites, id)
+		}
+	}
+	certificate, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls-cert and tls-key: %v", err)
+	}
+	config.Certificates = []tls.Certificate{certificate}
+	if o.ClientCAFile != "" {
+		bundle, err := ioutil.ReadFile(o.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls-client-ca: %v", err)
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("tls-client-ca %s has no PEM certificates", o.ClientCAFile)
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	config.NextProtos = []string{"h2", "http/1.1"}
+	if o.NoHTTP2 {
+		config.NextProtos = []string{"http/1.1"}
+	}
+	return config, nil
+}
+
+// listenAndServe answers HTTP, or HTTPS if the options have a certificate,
+// on the listener for the --listen setting or addr.
+func listenAndServe(listen, addr string, handler http.Handler, options TLSOptions) error {
+	config, err := options.Config()
+	if err != nil {
+		return err
+	}
+	l, err := listener(listen, addr)
+	if err != nil {
+		return err
+	}
+	if l.Addr().Network() == "unix" {
+		handler = forwardedFor(handler)
+	}
+	server := &http.Server{Handler: handler, TLSConfig: config}
+	if config == nil {
+		return server.Serve(l)
+	}
+	if options.NoHTTP2 {
+		// a non-nil, empty map is how net/http is told not to do HTTP/2
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	return server.ServeTLS(l, "", "")
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func writeTestCertificate(t *testing.T, commonName string, emails ...string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(1),
+		Subject:        pkix.Name{CommonName: commonName},
+		EmailAddresses: emails,
+		NotBefore:      time.Now(),
+		NotAfter:       time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := path.Join(dir, "cert.pem"), path.Join(dir, "key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func TestTLSOptions(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t, "wiki.example")
+
+	if config, err := (TLSOptions{}).Config(); config != nil || err != nil {
+		t.Errorf("Expected plain HTTP without a certificate, got %v %v", config, err)
+	}
+	config, err := TLSOptions{CertFile: certFile, KeyFile: keyFile}.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.MinVersion != tls.VersionTLS12 || len(config.CipherSuites) != len(defaultCipherSuites) || config.NextProtos[0] != "h2" || len(config.Certificates) != 1 {
+		t.Errorf("Expected secure defaults with HTTP/2, got %+v", config)
+	}
+	config, err = TLSOptions{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.2", CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}, NoHTTP2: true}.Config()
+	if err != nil || len(config.CipherSuites) != 1 || len(config.NextProtos) != 1 || config.NextProtos[0] != "http/1.1" {
+		t.Errorf("Expected the one cipher suite without HTTP/2, got %+v %v", config, err)
+	}
+
+	for name, options := range map[string]TLSOptions{
+		"an old version":                  {CertFile: certFile, KeyFile: keyFile, MinVersion: "1.0"},
+		"a suite without forward secrecy": {CertFile: certFile, KeyFile: keyFile, CipherSuites: []string{"TLS_RSA_WITH_AES_128_GCM_SHA256"}},
+		"a made up suite":                 {CertFile: certFile, KeyFile: keyFile, CipherSuites: []string{"TLS_ROT13"}},
+		"suites with TLS 1.3 only":        {CertFile: certFile, KeyFile: keyFile, MinVersion: "1.3", CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}},
+		"a key without a certificate":     {KeyFile: keyFile},
+		"settings without a certificate":  {MinVersion: "1.3"},
+		"a certificate that isn't one":    {CertFile: keyFile, KeyFile: keyFile},
+	} {
+		if _, err := options.Config(); err == nil {
+			t.Errorf("Expected %s to be refused", name)
+		}
+	}
+}
+
+func TestClientCertificates(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t, "wiki.example")
+	aliceCert, aliceKey := writeTestCertificate(t, "Alice", "Alice@Example.com")
+	bobCert, bobKey := writeTestCertificate(t, "bob")
+	bundle := path.Join(t.TempDir(), "ca.pem")
+	alice, _ := ioutil.ReadFile(aliceCert)
+	bob, _ := ioutil.ReadFile(bobCert)
+	ioutil.WriteFile(bundle, append(alice, bob...), 0600)
+	config, err := TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientCAFile: bundle}.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Site{IdentityHeaders: []string{"X-Forwarded-User"}}
+	router := gin.New()
+	router.Use(s.identifyUser)
+	router.GET("/whoami", func(c *gin.Context) { c.String(http.StatusOK, requestIdentity(c)) })
+	server := httptest.NewUnstartedServer(router)
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	whoami := func(certFile, keyFile string) (string, error) {
+		clientConfig := &tls.Config{InsecureSkipVerify: true}
+		if certFile != "" {
+			certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			clientConfig.Certificates = []tls.Certificate{certificate}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+		req, _ := http.NewRequest("GET", server.URL+"/whoami", nil)
+		req.Header.Set("X-Forwarded-User", "mallory")
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body), nil
+	}
+
+	if identity, err := whoami(aliceCert, aliceKey); err != nil || identity != "alice@example.com" {
+		t.Errorf("Expected the certificate's email address, got %q %v", identity, err)
+	}
+	if identity, err := whoami(bobCert, bobKey); err != nil || identity != "bob" {
+		t.Errorf("Expected the certificate's common name, got %q %v", identity, err)
+	}
+	if _, err := whoami("", ""); err == nil {
+		t.Errorf("Expected a client without a certificate to be turned away")
+	}
+	if _, err := whoami(certFile, keyFile); err == nil {
+		t.Errorf("Expected a certificate from another CA to be turned away")
+	}
+}
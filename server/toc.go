@@ -0,0 +1,106 @@
+package server
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultTOCDepth is how many levels of headings a table of contents lists
+// without max_depth.
+const defaultTOCDepth = 3
+
+// rTOCMacro finds {{< toc >}} or {{< toc max_depth=2 >}} on a line of its
+// own. It has to be swapped out before the page's template is run, which
+// would take it for an action.
+var rTOCMacro = regexp.MustCompile(`(?m)^[ \t]*\{\{<\s*toc(?:\s+max_depth=(\d+))?\s*>\}\}[ \t]*$`)
+
+// tocPlaceholder stands in for a table of contents until the headings it
+// lists are rendered.
+const tocPlaceholder = "TOCf6c1d0"
+
+var rTOCPlaceholder = regexp.MustCompile(`(?:<p>)?` + tocPlaceholder + `(\d+)Z(?:</p>)?`)
+
+var rRenderedHeading = regexp.MustCompile(`(?s)<h([1-6]) id="([^"]+)">(.*?)</h[1-6]>`)
+
+var rTags = regexp.MustCompile(`<[^>]*>`)
+
+// protectTOC swaps the table of contents macros for placeholders that carry
+// their max_depth.
+func protectTOC(markdown string) string {
+	return rTOCMacro.ReplaceAllStringFunc(markdown, func(macro string) string {
+		depth := defaultTOCDepth
+		if d := rTOCMacro.FindStringSubmatch(macro)[1]; d != "" {
+			depth, _ = strconv.Atoi(d)
+		}
+		return fmt.Sprintf("%s%dZ", tocPlaceholder, depth)
+	})
+}
+
+type tocHeading struct {
+	level int
+	id    string
+	text  string
+}
+
+// buildTOC lists the headings as nested lists, down to depth levels below
+// the highest heading on the page.
+func buildTOC(headings []tocHeading, depth int) string {
+	if len(headings) == 0 || depth < 1 {
+		return ""
+	}
+	top := 6
+	for _, h := range headings {
+		if h.level < top {
+			top = h.level
+		}
+	}
+	var b strings.Builder
+	b.WriteString(`<nav class="toc">`)
+	open := 0
+	for _, h := range headings {
+		level := h.level - top + 1
+		if level > depth {
+			continue
+		}
+		if level > open {
+			for ; open < level; open++ {
+				b.WriteString("<ul>")
+				if open+1 < level {
+					b.WriteString("<li>")
+				}
+			}
+		} else {
+			b.WriteString("</li>")
+			for ; open > level; open-- {
+				b.WriteString("</ul></li>")
+			}
+		}
+		b.WriteString(`<li><a href="#` + h.id + `">` + h.text + `</a>`)
+	}
+	for ; open > 0; open-- {
+		b.WriteString("</li></ul>")
+	}
+	b.WriteString("</nav>")
+	return b.String()
+}
+
+// renderTOC replaces the placeholders in rendered HTML with tables of
+// contents of its headings.
+func renderTOC(rendered []byte) []byte {
+	if !rTOCPlaceholder.Match(rendered) {
+		return rendered
+	}
+	headings := []tocHeading{}
+	for _, m := range rRenderedHeading.FindAllSubmatch(rendered, -1) {
+		level, _ := strconv.Atoi(string(m[1]))
+		text := html.EscapeString(html.UnescapeString(rTags.ReplaceAllString(string(m[3]), "")))
+		headings = append(headings, tocHeading{level: level, id: html.EscapeString(string(m[2])), text: text})
+	}
+	return rTOCPlaceholder.ReplaceAllFunc(rendered, func(placeholder []byte) []byte {
+		depth, _ := strconv.Atoi(string(rTOCPlaceholder.FindSubmatch(placeholder)[1]))
+		return []byte(buildTOC(headings, depth))
+	})
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTableOfContents(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	p := newTestPage(s, "manual", "+++\ntitle = \"Manual\"\n+++\n{{< toc >}}\n\n## Setup\n\n### Parts & tools\n\n#### Screws\n\n## Use\n\nText for {{ .Title }}.\n")
+	p.Render()
+	html := string(p.RenderedPage)
+	for _, expected := range []string{
+		`<h2 id="setup">Setup</h2>`,
+		`<nav class="toc"><ul><li><a href="#setup">Setup</a><ul><li><a href="#parts-tools">Parts &amp; tools</a><ul><li><a href="#screws">Screws</a></li></ul></li></ul></li><li><a href="#use">Use</a></li></ul></nav>`,
+		"Text for Manual.",
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("Expected %s in %s", expected, html)
+		}
+	}
+
+	p = newTestPage(s, "manual", "{{< toc max_depth=1 >}}\n\n## Setup\n\n### Parts\n")
+	p.Render()
+	if html := string(p.RenderedPage); !strings.Contains(html, `<nav class="toc"><ul><li><a href="#setup">Setup</a></li></ul></nav>`) {
+		t.Errorf("Expected only the top level, got %s", html)
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+const traceKey = "trace"
+
+// rTraceparent matches a W3C traceparent header, capturing the trace id.
+var rTraceparent = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-[0-9a-f]{16}-[0-9a-f]{2}$`)
+var rRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// traceRequests is middleware giving every request a trace id: the trace id of
+// an incoming traceparent header, else an incoming X-Request-ID, else a new
+// one. It is sent back as X-Request-ID and carried into jobs the request
+// enqueues, so a job can be followed back to the request that started it.
+func traceRequests(c *gin.Context) {
+	trace := ""
+	if match := rTraceparent.FindStringSubmatch(c.GetHeader("traceparent")); match != nil {
+		trace = match[1]
+	} else if id := c.GetHeader("X-Request-ID"); rRequestID.MatchString(id) {
+		trace = id
+	} else {
+		trace = newTraceID()
+	}
+	c.Set(traceKey, trace)
+	c.Header("X-Request-ID", trace)
+	c.Next()
+}
+
+// requestTrace returns the trace id traceRequests gave the request.
+func requestTrace(c *gin.Context) string {
+	return c.GetString(traceKey)
+}
+
+func newTraceID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// traceSuffix is how a trace id is added to log lines.
+func traceSuffix(trace string) string {
+	if trace == "" {
+		return ""
+	}
+	return " [trace " + trace + "]"
+}
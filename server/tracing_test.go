@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTraceRequests(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(traceRequests)
+	router.GET("/", func(c *gin.Context) { c.String(http.StatusOK, requestTrace(c)) })
+
+	for header, expected := range map[string]string{
+		"traceparent":  "4bf92f3577b34da6a3ce929d0e0e4736",
+		"X-Request-ID": "abc-123",
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		value := expected
+		if header == "traceparent" {
+			value = "00-" + expected + "-00f067aa0ba902b7-01"
+		}
+		req.Header.Set(header, value)
+		router.ServeHTTP(w, req)
+		if w.Body.String() != expected || w.Header().Get("X-Request-ID") != expected {
+			t.Errorf("Expected trace %q from %s, got %q", expected, header, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "not allowed\n")
+	router.ServeHTTP(w, req)
+	if len(w.Body.String()) != 32 {
+		t.Errorf("Expected a new trace id, got %q", w.Body.String())
+	}
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// trashedExtensions are the files of a page that go to the trash with it.
+// Only the .json is sure to exist.
+var trashedExtensions = []string{".json", ".md", ".annotations"}
+
+// trashDir is the folder in the data folder erased pages are moved to. Each
+// page's files are named <erased at, in unix nanoseconds>-<base32
+// identifier>, which is also its id in the trash.
+const trashDir = "trash"
+
+// TrashedPage is an erased page waiting to be purged.
+type TrashedPage struct {
+	ID         string    `json:"id"`
+	Identifier string    `json:"identifier"`
+	TrashedAt  time.Time `json:"trashed_at"`
+	// ExpiresAt is when the purge job will delete it for good; zero when
+	// the trash is kept forever.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func trashKey(id, extension string) string {
+	return trashDir + "/" + id + extension
+}
+
+func (s *Site) trashedPage(id string) (TrashedPage, error) {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 {
+		return TrashedPage{}, fmt.Errorf("%q isn't in the trash", id)
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return TrashedPage{}, fmt.Errorf("%q isn't in the trash", id)
+	}
+	identifier, err := decodeFromBase32(parts[1])
+	if err != nil {
+		return TrashedPage{}, fmt.Errorf("%q isn't in the trash", id)
+	}
+	page := TrashedPage{ID: id, Identifier: identifier, TrashedAt: time.Unix(0, nanos)}
+	if s.TrashRetention > 0 {
+		page.ExpiresAt = page.TrashedAt.Add(s.TrashRetention)
+	}
+	return page, nil
+}
+
+// trash moves a page's files into the trash.
+func (s *Site) trash(identifier string) error {
+	identifier = strings.ToLower(identifier)
+	id := strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + encodeToBase32(identifier)
+	for _, extension := range trashedExtensions {
+		err := moveKey(s.store(), pageKey(identifier, extension), trashKey(id, extension))
+		if err != nil && (extension == ".json" || !os.IsNotExist(err)) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListTrash lists the erased pages, most recently erased first.
+func (s *Site) ListTrash() ([]TrashedPage, error) {
+	pages := []TrashedPage{}
+	names, err := s.store().List(trashDir + "/")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		if page, err := s.trashedPage(strings.TrimSuffix(name, ".json")); err == nil {
+			pages = append(pages, page)
+		}
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].TrashedAt.After(pages[j].TrashedAt) })
+	return pages, nil
+}
+
+// RestoreFromTrash puts an erased page back where it was, unless another page
+// has been made there since.
+func (s *Site) RestoreFromTrash(id string) (string, error) {
+	page, err := s.trashedPage(id)
+	if err != nil {
+		return "", err
+	}
+	if !s.store().Exists(trashKey(id, ".json")) {
+		return "", fmt.Errorf("%q isn't in the trash", id)
+	}
+	if s.hasPageFile(page.Identifier, ".json") {
+		return "", fmt.Errorf("there is a page %q again; rename it first", page.Identifier)
+	}
+	for _, extension := range trashedExtensions {
+		err := moveKey(s.store(), trashKey(id, extension), pageKey(page.Identifier, extension))
+		if err != nil && (extension == ".json" || !os.IsNotExist(err)) {
+			return "", err
+		}
+	}
+	if matter, err := s.ReadFrontMatter(page.Identifier); err == nil {
+		s.indexAliases(page.Identifier, pageAliases(matter))
+	}
+	s.pageChangedForIndex(page.Identifier)
+	s.pageChangedForRender(page.Identifier)
+	return page.Identifier, nil
+}
+
+// PurgeTrash deletes the pages erased before the given time for good, and
+// returns how many there were.
+func (s *Site) PurgeTrash(before time.Time) (int, error) {
+	pages, err := s.ListTrash()
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, page := range pages {
+		if !page.TrashedAt.Before(before) {
+			continue
+		}
+		for _, extension := range trashedExtensions {
+			if err := s.store().Delete(trashKey(page.ID, extension)); err != nil {
+				return purged, err
+			}
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+func (s *Site) trashPurgeJob(progress *JobProgress) error {
+	if s.TrashRetention <= 0 {
+		return nil
+	}
+	started := time.Now()
+	purged, err := s.PurgeTrash(started.Add(-s.TrashRetention))
+	progress.Record(fmt.Sprintf("purged %d pages", purged), started, err)
+	return err
+}
+
+// ScheduleTrashPurge purges the trash of pages older than TrashRetention
+// every night.
+func (s *Site) ScheduleTrashPurge() {
+	go func() {
+		for {
+			now := time.Now()
+			midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+			time.Sleep(midnight.Sub(now))
+			_, err := s.jobs().Enqueue(BackgroundQueue, "trash purge", s.trashPurgeJob)
+			if err != nil {
+				s.Logger.Error("Could not schedule the trash purge: %s", err.Error())
+			}
+		}
+	}()
+}
+
+func (s *Site) handleListTrash(c *gin.Context) {
+	pages, err := s.ListTrash()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "pages": pages})
+}
+
+func (s *Site) handleRestoreFromTrash(c *gin.Context) {
+	type QueryJSON struct {
+		ID string `json:"id"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	identifier, err := s.RestoreFromTrash(json.ID)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Restored", "identifier": identifier})
+}
+
+// handlePurgeTrash purges the pages past their retention, or, with all, the
+// whole trash.
+func (s *Site) handlePurgeTrash(c *gin.Context) {
+	type QueryJSON struct {
+		All bool `json:"all"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	if !json.All && s.TrashRetention <= 0 {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "The trash is kept forever; purge all of it instead"})
+		return
+	}
+	before := time.Now().Add(-s.TrashRetention)
+	if json.All {
+		before = time.Now().Add(time.Second)
+	}
+	purged, err := s.PurgeTrash(before)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": fmt.Sprintf("Purged %d pages", purged), "purged": purged})
+}
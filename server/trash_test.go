@@ -0,0 +1,57 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jcelliott/lumber"
+)
+
+func TestTrash(t *testing.T) {
+	s := &Site{PathToData: t.TempDir(), TrashRetention: time.Hour, Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	newTestPage(s, "drill", "+++\naliases = [\"power drill\"]\n+++\n# Drill")
+
+	if err := s.Open("drill").Erase(); err != nil {
+		t.Fatal(err)
+	}
+	if s.pageExists("drill") {
+		t.Error("Expected the page to be gone")
+	}
+	if _, ok := s.Alias("power drill"); ok {
+		t.Error("Expected the alias to go with the page")
+	}
+	trash, err := s.ListTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].Identifier != "drill" || trash[0].ExpiresAt.Sub(trash[0].TrashedAt) != time.Hour {
+		t.Fatalf("Expected the page in the trash for an hour, got %+v", trash)
+	}
+	if usage, _ := s.DiskUsage(); usage.Trash == 0 || usage.Pages != 0 {
+		t.Errorf("Expected the trash to be counted apart from pages, got %+v", usage)
+	}
+
+	if identifier, err := s.RestoreFromTrash(trash[0].ID); err != nil || identifier != "drill" {
+		t.Fatalf("Could not restore: %v %v", identifier, err)
+	}
+	if !s.pageExists("drill") {
+		t.Error("Expected the page to be back")
+	}
+	if target, ok := s.Alias("power drill"); !ok || target != "drill" {
+		t.Error("Expected the alias to come back with the page")
+	}
+	if _, err := s.RestoreFromTrash(trash[0].ID); err == nil {
+		t.Error("Expected restoring twice to fail")
+	}
+
+	s.Open("drill").Erase()
+	if purged, _ := s.PurgeTrash(time.Now().Add(-time.Minute)); purged != 0 {
+		t.Errorf("Expected nothing old enough to purge, purged %d", purged)
+	}
+	if purged, _ := s.PurgeTrash(time.Now().Add(time.Second)); purged != 1 {
+		t.Errorf("Expected to purge the page, purged %d", purged)
+	}
+	if trash, _ := s.ListTrash(); len(trash) != 0 {
+		t.Errorf("Expected an empty trash, got %+v", trash)
+	}
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UploadMetadata describes an upload, kept beside it in <name>.meta. Text is
+// what OCR read from it, for images.
+type UploadMetadata struct {
+	Name        string    `json:"name"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	UploadedAt  time.Time `json:"uploaded_at"`
+	Text        string    `json:"text,omitempty"`
+	OCRError    string    `json:"ocr_error,omitempty"`
+	OCRAt       time.Time `json:"ocr_at,omitempty"`
+}
+
+// URL is where the upload can be linked.
+func (m UploadMetadata) URL() string {
+	return "/uploads/" + m.Name + "?filename=" + url.QueryEscape(m.Filename)
+}
+
+func (s *Site) uploadPath(name string) string {
+	return path.Join(s.PathToData, path.Base(name)+".upload")
+}
+
+// UploadMetadata reads an upload's metadata, by its sha256-... name.
+func (s *Site) UploadMetadata(name string) (UploadMetadata, error) {
+	var metadata UploadMetadata
+	data, err := ioutil.ReadFile(path.Join(s.PathToData, path.Base(name)+".meta"))
+	if err != nil {
+		return metadata, err
+	}
+	err = json.Unmarshal(data, &metadata)
+	return metadata, err
+}
+
+func (s *Site) writeUploadMetadata(metadata UploadMetadata) error {
+	data, err := json.MarshalIndent(metadata, "", " ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(s.PathToData, metadata.Name+".meta"), data, 0644)
+}
+
+// recordUpload writes the metadata of a new upload and, for images, queues
+// OCR of it. Uploading the same file again keeps what was already read.
+func (s *Site) recordUpload(name, filename string) error {
+	info, err := os.Stat(s.uploadPath(name))
+	if err != nil {
+		return err
+	}
+	metadata, err := s.UploadMetadata(name)
+	if err == nil {
+		return nil
+	}
+	sniffed, err := s.sniffContentType(path.Base(name) + ".upload")
+	if err != nil {
+		sniffed = "application/octet-stream" // e.g. empty
+	}
+	metadata = UploadMetadata{
+		Name:        name,
+		Filename:    filename,
+		ContentType: sniffed,
+		Size:        info.Size(),
+		UploadedAt:  time.Now(),
+	}
+	if err := s.writeUploadMetadata(metadata); err != nil {
+		return err
+	}
+	if s.ocr() != nil && strings.HasPrefix(metadata.ContentType, "image/") {
+		_, err = s.jobs().Enqueue(BackgroundQueue, "ocr "+filename, func(progress *JobProgress) error {
+			started := time.Now()
+			err := s.OCRUpload(name)
+			progress.Record(filename, started, err)
+			return err
+		})
+	}
+	return err
+}
+
+// SearchUploads finds the uploads whose name or OCR text contains every
+// word of the query, newest first.
+func (s *Site) SearchUploads(query string) ([]UploadMetadata, error) {
+	words := strings.Fields(strings.ToLower(query))
+	files, err := ioutil.ReadDir(s.PathToData)
+	if err != nil {
+		return nil, err
+	}
+	matches := []UploadMetadata{}
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".meta") {
+			continue
+		}
+		metadata, err := s.UploadMetadata(strings.TrimSuffix(f.Name(), ".meta"))
+		if err != nil {
+			continue
+		}
+		text := strings.ToLower(metadata.Filename + "\n" + metadata.Text)
+		matched := len(words) > 0
+		for _, word := range words {
+			if !strings.Contains(text, word) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			matches = append(matches, metadata)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].UploadedAt.After(matches[j].UploadedAt) })
+	return matches, nil
+}
+
+func (s *Site) handleUploadMetadata(c *gin.Context) {
+	type QueryJSON struct {
+		Name string `json:"name"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	metadata, err := s.UploadMetadata(json.Name)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": json.Name + " has no metadata"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "metadata": metadata})
+}
+
+func (s *Site) handleSearchUploads(c *gin.Context) {
+	type QueryJSON struct {
+		Query string `json:"query"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	uploads, err := s.SearchUploads(json.Query)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "uploads": uploads})
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultIdentityHeader is the header tailscale serve sets to the login
+// name of the tailnet user making the request, and the one trusted unless
+// IdentityHeaders say otherwise.
+const defaultIdentityHeader = "Tailscale-User-Login"
+
+// identityKey is where who made a request is kept in the gin context.
+const identityKey = "identity"
+
+// usersNamespace holds a system page per user.
+const usersNamespace = "users"
+
+var errNoIdentity = errors.New("can't tell who you are; per-user pages need the wiki served through a proxy that says, like tailscale serve")
+
+// ParseTrustedProxies parses --trusted-proxy addresses; see parseNetworks.
+func ParseTrustedProxies(specs []string) ([]*net.IPNet, error) {
+	return parseNetworks("trusted-proxy", specs)
+}
+
+// fromTrustedProxy is whether the request came straight from a proxy whose
+// identity headers are believed: any, if TrustedProxies are not set, as
+// when the wiki is only reachable through tailscale serve.
+func (s *Site) fromTrustedProxy(r *http.Request) bool {
+	if len(s.TrustedProxies) == 0 || viaUnixSocket(r) {
+		return true
+	}
+	return inNetworks(remoteIP(r), s.TrustedProxies)
+}
+
+// certificateIdentity is who a verified client certificate says the user
+// is: its first email address, or else its common name.
+func certificateIdentity(certificate *x509.Certificate) string {
+	if len(certificate.EmailAddresses) > 0 {
+		return strings.ToLower(certificate.EmailAddresses[0])
+	}
+	return strings.ToLower(strings.TrimSpace(certificate.Subject.CommonName))
+}
+
+// identifyUser works out who made the request, for requestIdentity: from
+// the client certificate it was made with, or else the first of the
+// IdentityHeaders a trusted proxy set.
+func (s *Site) identifyUser(c *gin.Context) {
+	if state := c.Request.TLS; state != nil && len(state.VerifiedChains) > 0 {
+		if identity := certificateIdentity(state.VerifiedChains[0][0]); identity != "" {
+			c.Set(identityKey, identity)
+		}
+	} else if s.fromTrustedProxy(c.Request) {
+		headers := s.IdentityHeaders
+		if len(headers) == 0 {
+			headers = []string{defaultIdentityHeader}
+		}
+		for _, header := range headers {
+			if identity := strings.ToLower(strings.TrimSpace(c.GetHeader(header))); identity != "" {
+				c.Set(identityKey, identity)
+				break
+			}
+		}
+	}
+	c.Next()
+}
+
+// requireIdentityToChange refuses requests that would change the wiki
+// unless they're from someone vouched for, see vouchedIdentity, or carry an
+// API token, when AnonymousReadOnly. Which requests change things is decided as it is
+// for API token scopes, see requiredScope; exports only read. Routes that
+// authenticate themselves are left alone.
+func (s *Site) requireIdentityToChange(c *gin.Context) {
+	if !s.AnonymousReadOnly || s.vouchedIdentity(c) != "" {
+		return
+	}
+	if authenticatesItself(c.Request.URL.Path) {
+		return
+	}
+	if _, ok := c.Get(apiTokenKey); ok {
+		return
+	}
+	if scope := requiredScope(c); scope == ScopeRead || scope == ScopeExport {
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Anonymous visitors can only read this wiki; sign in to change it"})
+}
+
+// authenticatesItself is whether a route has its own way of letting people
+// in: entering the access code, and mailing the inbox with its tokens.
+func authenticatesItself(route string) bool {
+	return route == "/login/" || route == "/api/inbox"
+}
+
+// requestIdentity is who made the request, "" if it isn't known.
+func requestIdentity(c *gin.Context) string {
+	return c.GetString(identityKey)
+}
+
+// userPageIdentifier is one of a user's system pages, such as
+// users/alice_example_com/pinned.
+func (s *Site) userPageIdentifier(identity, name string) string {
+	return usersNamespace + NamespaceSeparator + s.identifierProfile().Munge(strings.Replace(identity, NamespaceSeparator, " ", -1)) + NamespaceSeparator + name
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"github.com/jcelliott/lumber"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.7", "fd00::1"})
+	if err != nil || len(proxies) != 3 || proxies[1].String() != "192.0.2.7/32" || proxies[2].String() != "fd00::1/128" {
+		t.Errorf("Expected the CIDR and the two addresses, got %v %v", proxies, err)
+	}
+	for _, spec := range []string{"proxy.example", "10.0.0.0/33"} {
+		if _, err := ParseTrustedProxies([]string{spec}); err == nil {
+			t.Errorf("Expected %q to be refused", spec)
+		}
+	}
+}
+
+func TestIdentifyUser(t *testing.T) {
+	identify := func(s *Site, remoteAddr string, headers map[string]string) string {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request, _ = http.NewRequest("GET", "/", nil)
+		c.Request.RemoteAddr = remoteAddr
+		for name, value := range headers {
+			c.Request.Header.Set(name, value)
+		}
+		s.identifyUser(c)
+		return requestIdentity(c)
+	}
+
+	s := &Site{}
+	if identity := identify(s, "203.0.113.5:4000", map[string]string{defaultIdentityHeader: " Alice@Example.com "}); identity != "alice@example.com" {
+		t.Errorf("Expected tailscale serve's header to be believed by default, got %q", identity)
+	}
+	if identity := identify(s, "203.0.113.5:4000", map[string]string{"X-Forwarded-User": "mallory"}); identity != "" {
+		t.Errorf("Expected other headers to be ignored by default, got %q", identity)
+	}
+
+	proxies, _ := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	s = &Site{IdentityHeaders: []string{"X-Forwarded-User", "X-Forwarded-Email"}, TrustedProxies: proxies}
+	if identity := identify(s, "10.1.2.3:4000", map[string]string{"X-Forwarded-Email": "bob@example.com"}); identity != "bob@example.com" {
+		t.Errorf("Expected the second header from a trusted proxy, got %q", identity)
+	}
+	if identity := identify(s, "10.1.2.3:4000", map[string]string{"X-Forwarded-User": "bob", "X-Forwarded-Email": "bob@example.com"}); identity != "bob" {
+		t.Errorf("Expected the first header to win, got %q", identity)
+	}
+	if identity := identify(s, "203.0.113.5:4000", map[string]string{"X-Forwarded-User": "mallory"}); identity != "" {
+		t.Errorf("Expected headers from outside the trusted proxies to be ignored, got %q", identity)
+	}
+	if identity := identify(s, "10.1.2.3:4000", map[string]string{defaultIdentityHeader: "mallory"}); identity != "" {
+		t.Errorf("Expected tailscale serve's header to be ignored once others are set, got %q", identity)
+	}
+}
+
+func TestAnonymousReadOnly(t *testing.T) {
+	proxies, _ := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	s := &Site{PathToData: t.TempDir(), AnonymousReadOnly: true, TrustedProxies: proxies, SessionStore: cookie.NewStore([]byte("secret")), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	newTestPage(s, "notes", "some notes")
+	router := s.Router()
+	send := func(method, url, body, identity string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.RemoteAddr = "10.1.2.3:4000"
+		if identity != "" {
+			req.Header.Set(defaultIdentityHeader, identity)
+		}
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := send("GET", "/notes/view", "", ""); code != http.StatusOK {
+		t.Errorf("Expected anonymous visitors to read, got %d", code)
+	}
+	if code := send("POST", "/search", `{"query": "notes"}`, ""); code != http.StatusOK {
+		t.Errorf("Expected anonymous visitors to search, got %d", code)
+	}
+	if code := send("POST", "/update", `{"page": "notes", "new_text": "defaced"}`, ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected anonymous visitors not to edit, got %d", code)
+	}
+	if code := send("POST", "/erase", `{"page": "notes"}`, ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected anonymous visitors not to erase, got %d", code)
+	}
+	send("GET", "/notes/erase", "", "")
+	if text := s.Open("notes").Text.GetCurrent(); text != "some notes" {
+		t.Errorf("Expected the page unchanged, got %q", text)
+	}
+	forged := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/update", strings.NewReader(`{"page": "notes", "new_text": "defaced"}`))
+	req.RemoteAddr = "203.0.113.5:4000"
+	req.Header.Set(defaultIdentityHeader, "mallory@example.com")
+	router.ServeHTTP(forged, req)
+	if forged.Code != http.StatusUnauthorized {
+		t.Errorf("Expected an identity header from outside the trusted proxies not to let visitors edit, got %d", forged.Code)
+	}
+	s.TrustedProxies = nil
+	req, _ = http.NewRequest("POST", "/update", strings.NewReader(`{"page": "notes", "new_text": "defaced"}`))
+	req.Header.Set(defaultIdentityHeader, "mallory@example.com")
+	forged = httptest.NewRecorder()
+	router.ServeHTTP(forged, req)
+	if forged.Code != http.StatusUnauthorized {
+		t.Errorf("Expected an identity header not to let visitors edit without trusted proxies, got %d", forged.Code)
+	}
+	s.TrustedProxies = proxies
+	if code := send("POST", "/update", `{"page": "notes", "new_text": "more notes"}`, "alice@example.com"); code != http.StatusOK {
+		t.Errorf("Expected a signed in user to edit, got %d", code)
+	}
+	if text := s.Open("notes").Text.GetCurrent(); text != "more notes" {
+		t.Errorf("Expected the page edited, got %q", text)
+	}
+
+	s = &Site{PathToData: t.TempDir(), SessionStore: cookie.NewStore([]byte("secret")), Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	router = s.Router()
+	if code := send("POST", "/update", `{"page": "notes", "new_text": "notes"}`, ""); code != http.StatusOK {
+		t.Errorf("Expected anonymous visitors to edit without the policy, got %d", code)
+	}
+}
@@ -5,17 +5,18 @@ import (
 	"encoding/base32"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"math/rand"
 	"mime"
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"text/template"
 	"time"
 
 	"github.com/adrg/frontmatter"
-	"github.com/microcosm-cc/bluemonday"
 	"github.com/russross/blackfriday/v2"
 	"github.com/shurcooL/github_flavored_markdown"
 	"golang.org/x/crypto/bcrypt"
@@ -146,6 +147,17 @@ func exists(path string) bool {
 	return !os.IsNotExist(err)
 }
 
+// confinedPath is where name is in the dir folder of the data folder. Names
+// that are absolute or climb out of it with .. are refused, so a path a
+// request gives can't reach anything else on the server.
+func (s *Site) confinedPath(dir, name string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(name))
+	if name == "" || filepath.IsAbs(cleaned) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%q must be a path inside the %s folder of the data folder", name, dir)
+	}
+	return filepath.Join(s.PathToData, dir, cleaned), nil
+}
+
 type DoesntMatter struct{}
 
 func StripFrontmatter(s string) string {
@@ -155,6 +167,12 @@ func StripFrontmatter(s string) string {
 }
 
 func MarkdownToHtmlAndJsonFrontmatter(s string, handleFrontMatter bool, site *Site) ([]byte, []byte) {
+	return markdownToHtmlAndJsonFrontmatter(s, handleFrontMatter, site, nil)
+}
+
+// markdownToHtmlAndJsonFrontmatter renders markdown, recording in deps, if
+// it isn't nil, what the page's template showed.
+func markdownToHtmlAndJsonFrontmatter(s string, handleFrontMatter bool, site *Site, deps *renderDependencies) ([]byte, []byte) {
 	var unsafe []byte
 	var err error
 	var matterBytes []byte
@@ -167,38 +185,42 @@ func MarkdownToHtmlAndJsonFrontmatter(s string, handleFrontMatter bool, site *Si
 		}
 		matterBytes, _ = json.Marshal(matter)
 
-		unsafe, err = ExecuteTemplate(string(unsafe), matterBytes, site)
+		unsafe, err = executeTemplate(protectTOC(string(unsafe)), matterBytes, site, deps)
 		if err != nil {
 			return []byte(err.Error()), nil
 		}
 	} else {
-		unsafe = []byte(s)
+		unsafe = []byte(protectTOC(s))
 	}
 
+	var maths []string
+	if site != nil && site.Math != "" {
+		var protected string
+		protected, maths = protectMath(string(unsafe))
+		unsafe = []byte(protected)
+	}
+	unsafe = []byte(protectTaskItems(string(unsafe)))
+
 	r := blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
-		Flags: blackfriday.CommonHTMLFlags, //& blackfriday.Smartypants,
+		Flags: blackfriday.CommonHTMLFlags | blackfriday.FootnoteReturnLinks, //& blackfriday.Smartypants,
 	})
-	unsafe = blackfriday.Run(unsafe, blackfriday.WithRenderer(r))
+	unsafe = blackfriday.Run(unsafe, blackfriday.WithRenderer(r), blackfriday.WithExtensions(blackfriday.CommonExtensions|blackfriday.AutoHeadingIDs|blackfriday.Footnotes))
 	if allowInsecureHtml {
-		return unsafe, matterBytes
+		return renderTOC(renderTaskItems(restoreMath(unsafe, maths))), matterBytes
 	}
 
-	pClean := bluemonday.UGCPolicy()
-	pClean.AllowElements("img")
-	pClean.AllowElements("center")
-	pClean.AllowAttrs("alt").OnElements("img")
-	pClean.AllowAttrs("src").OnElements("img")
-	pClean.AllowAttrs("class").OnElements("a")
-	pClean.AllowAttrs("href").OnElements("a")
-	pClean.AllowAttrs("id").OnElements("a")
-	pClean.AllowDataURIImages()
-	html := pClean.SanitizeBytes(unsafe)
-	return html, matterBytes
+	html := site.sanitizer().SanitizeBytes(unsafe)
+	return renderTOC(renderTaskItems(restoreMath(html, maths))), matterBytes
 }
 
 type InventoryFrontmatter struct {
-	Container string   `json:"container"`
-	Items     []string `json:"items"`
+	Container    string   `json:"container"`
+	Items        []string `json:"items"`
+	Quantity     float64  `json:"quantity"`
+	MinQuantity  float64  `json:"min_quantity"`
+	Unit         string   `json:"unit"`
+	LocationHint string   `json:"location_hint"`
+	Photo        string   `json:"photo"`
 }
 
 type TemplateContext struct {
@@ -330,10 +352,28 @@ func BuildIsContainer(site *Site) func(string) bool {
 	}
 }
 func ExecuteTemplate(templateHtml string, frontmatter []byte, site *Site) ([]byte, error) {
+	return executeTemplate(templateHtml, frontmatter, site, nil)
+}
+
+func executeTemplate(templateHtml string, frontmatter []byte, site *Site, deps *renderDependencies) ([]byte, error) {
 	funcs := template.FuncMap{
 		"ShowInventoryContentsOf": BuildShowInventoryContentsOf(site),
 		"LinkTo":                  BuildLinkTo(site),
 		"IsContainer":             BuildIsContainer(site),
+		"ShowLowStock":            BuildShowLowStock(site),
+		"ShowOverdueLoans":        BuildShowOverdueLoans(site),
+		"ShowMaintenanceOf":       BuildShowMaintenanceOf(site),
+		"ShowMaintenanceReport":   BuildShowMaintenanceReport(site),
+		"ShowPopularPages":        BuildShowPopularPages(site),
+		"ShowRecentChanges":       BuildShowRecentChanges(site),
+		"ShowPinnedPages":         BuildShowPinnedPages(site),
+		"ShowOpenChecklists":      BuildShowOpenChecklists(site),
+		"ShowInventoryRoots":      BuildShowInventoryRoots(site),
+		"ShowJobStatus":           BuildShowJobStatus(site),
+		"ShowChecklist":           BuildShowChecklist(site),
+	}
+	if deps != nil {
+		deps.wrap(site, funcs)
 	}
 
 	tmpl, err := template.New("page").Funcs(funcs).Parse(templateHtml)
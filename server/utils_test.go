@@ -43,13 +43,13 @@ sample: "value"
 # Hello
 	`
 
-	html, _ := MarkdownToHtmlAndJsonFrontmatter(markdown, true)
+	html, _ := MarkdownToHtmlAndJsonFrontmatter(markdown, true, nil)
 
 	if strings.Contains(string(html), "sample:") {
 		t.Errorf("Did not remove frontmatter.")
 	}
 
-	if !strings.Contains(string(html), "<h1>Hello</h1") {
+	if !strings.Contains(string(html), `<h1 id="hello">Hello</h1`) {
 		t.Errorf("Did not include HTML")
 	}
 }
@@ -63,10 +63,10 @@ func TestExecuteTemplate(t *testing.T) {
 	`
 
 	templateHtml := `
-{{ .Basic.Identifier }}
+{{ .Identifier }}
 	`
 
-	rendered, err := ExecuteTemplate(templateHtml, []byte(frontmatter))
+	rendered, err := ExecuteTemplate(templateHtml, []byte(frontmatter), nil)
 
 	if err != nil {
 		t.Error(err)
@@ -90,7 +90,7 @@ func TestExecuteTemplateUnstructured(t *testing.T) {
 {{ index .Map "foobar" }}
 	`
 
-	rendered, err := ExecuteTemplate(templateHtml, []byte(frontmatter))
+	rendered, err := ExecuteTemplate(templateHtml, []byte(frontmatter), nil)
 
 	if err != nil {
 		t.Error(err)
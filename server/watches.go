@@ -0,0 +1,205 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// watchesFile holds every page's watchers, page identifier to watches, as
+// JSON.
+const watchesFile = "watches.table"
+
+// Watch asks for a page's changes to be sent to Target over Channel: a URL
+// for webhook, an address for email.
+type Watch struct {
+	ID        string    `json:"id"`
+	Page      string    `json:"page"`
+	Channel   string    `json:"channel"`
+	Target    string    `json:"target"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s *Site) watches() (map[string][]Watch, error) {
+	watches := map[string][]Watch{}
+	data, err := ioutil.ReadFile(path.Join(s.PathToData, watchesFile))
+	if os.IsNotExist(err) {
+		return watches, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &watches)
+	return watches, err
+}
+
+func (s *Site) updateWatches(fn func(watches map[string][]Watch) error) error {
+	s.watchesMut.Lock()
+	defer s.watchesMut.Unlock()
+	watches, err := s.watches()
+	if err != nil {
+		return err
+	}
+	if err := fn(watches); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(watches, "", " ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(s.PathToData, watchesFile), data, 0644)
+}
+
+// Watches returns the watches on a page.
+func (s *Site) Watches(page string) ([]Watch, error) {
+	watches, err := s.watches()
+	if err != nil {
+		return nil, err
+	}
+	if list := watches[strings.ToLower(page)]; list != nil {
+		return list, nil
+	}
+	return []Watch{}, nil
+}
+
+func (s *Site) checkWatchTarget(channel, target string) error {
+	switch channel {
+	case WebhookChannel:
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook %q should be an http or https URL", target)
+		}
+	case EmailChannel:
+		if s.SMTPURL == "" {
+			return errors.New("email needs the wiki to be started with --smtp")
+		}
+		if _, err := mail.ParseAddress(target); err != nil {
+			return fmt.Errorf("%q isn't an email address", target)
+		}
+	default:
+		return fmt.Errorf("channel should be %s or %s", WebhookChannel, EmailChannel)
+	}
+	return nil
+}
+
+// WatchPage sends the page's changes to target over channel from now on.
+func (s *Site) WatchPage(page, channel, target string) (Watch, error) {
+	page = strings.ToLower(strings.TrimSpace(page))
+	if !s.hasPageFile(page, ".json") {
+		return Watch{}, fmt.Errorf("there is no page %q", page)
+	}
+	if err := s.checkWatchTarget(channel, target); err != nil {
+		return Watch{}, err
+	}
+	watch := Watch{ID: RandStringBytesMaskImprSrc(10), Page: page, Channel: channel, Target: target, CreatedAt: time.Now()}
+	err := s.updateWatches(func(watches map[string][]Watch) error {
+		for _, existing := range watches[page] {
+			if existing.Channel == channel && existing.Target == target {
+				return fmt.Errorf("%s is already watching %s", target, page)
+			}
+		}
+		watches[page] = append(watches[page], watch)
+		return nil
+	})
+	return watch, err
+}
+
+func (s *Site) UnwatchPage(id string) error {
+	return s.updateWatches(func(watches map[string][]Watch) error {
+		for page, list := range watches {
+			for i, watch := range list {
+				if watch.ID != id {
+					continue
+				}
+				if watches[page] = append(list[:i], list[i+1:]...); len(watches[page]) == 0 {
+					delete(watches, page)
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("no watch %q", id)
+	})
+}
+
+// moveWatches keeps a page's watchers when it is renamed.
+func (s *Site) moveWatches(from, to string) error {
+	if list, _ := s.Watches(from); len(list) == 0 {
+		return nil
+	}
+	return s.updateWatches(func(watches map[string][]Watch) error {
+		for i := range watches[from] {
+			watches[from][i].Page = to
+		}
+		watches[to] = append(watches[to], watches[from]...)
+		delete(watches, from)
+		return nil
+	})
+}
+
+func (s *Site) handleWatchPage(c *gin.Context) {
+	type QueryJSON struct {
+		Page    string `json:"page"`
+		Channel string `json:"channel"`
+		Target  string `json:"target"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	watch, err := s.WatchPage(json.Page, json.Channel, json.Target)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Watching", "watch": watch})
+}
+
+func (s *Site) handleUnwatchPage(c *gin.Context) {
+	type QueryJSON struct {
+		ID string `json:"id"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	if err := s.UnwatchPage(json.ID); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Stopped watching"})
+}
+
+func (s *Site) handleListWatches(c *gin.Context) {
+	type QueryJSON struct {
+		Page string `json:"page"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	watches, err := s.Watches(json.Page)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "watches": watches})
+}
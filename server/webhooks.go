@@ -0,0 +1,333 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The events webhooks can be sent.
+const (
+	PageCreatedEvent  = "page.created"
+	PageUpdatedEvent  = "page.updated"
+	PageDeletedEvent  = "page.deleted"
+	JobCompletedEvent = "job.completed"
+)
+
+// The states of a webhook delivery.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is an external URL told about events, configured in the system
+// configuration page as
+//
+//	[webhooks.inventory_sync]
+//	url = "https://example.com/hooks/wiki"
+//	events = ["page.updated", "page.deleted"]
+//
+// Without events it is sent every event. With a secret, set by an admin
+// with /system/webhook_secret, each payload is signed: the X-Wiki-Signature
+// header is sha256= and the hex HMAC-SHA256 of the body. Secrets aren't
+// read from the page, whose frontmatter anyone who can read the wiki can.
+type Webhook struct {
+	Name   string   `json:"name"`
+	URL    string   `json:"url"`
+	Secret string   `json:"-"`
+	Events []string `json:"events"`
+}
+
+func (w Webhook) wants(event string) bool {
+	return len(w.Events) == 0 || stringInSlice(event, w.Events)
+}
+
+// WebhookDelivery is the sending of one event to one webhook.
+type WebhookDelivery struct {
+	ID          string    `json:"id"`
+	Webhook     string    `json:"webhook"`
+	Event       string    `json:"event"`
+	State       string    `json:"state"`
+	Attempts    int       `json:"attempts"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	NextAttempt time.Time `json:"next_attempt,omitempty"`
+	DeliveredAt time.Time `json:"delivered_at,omitempty"`
+}
+
+// deliveriesKept is how many deliveries keep their status around.
+const deliveriesKept = 200
+
+// defaultWebhookBackoff is how long to wait before each attempt at a
+// delivery; it is given up on after the last.
+var defaultWebhookBackoff = []time.Duration{0, 10 * time.Second, time.Minute, 10 * time.Minute, time.Hour}
+
+// WebhookDispatcher sends events to the configured webhooks, retrying failed
+// deliveries with backoff. It doesn't use the job queue, whose jobs
+// completing are themselves events.
+type WebhookDispatcher struct {
+	site       *Site
+	client     *http.Client
+	backoff    []time.Duration
+	mu         sync.Mutex
+	nextID     int
+	deliveries map[string]*WebhookDelivery
+	order      []string
+}
+
+func NewWebhookDispatcher(site *Site, backoff []time.Duration) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		site:       site,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		backoff:    backoff,
+		deliveries: map[string]*WebhookDelivery{},
+	}
+}
+
+func (s *Site) webhooks() *WebhookDispatcher {
+	s.webhooksOnce.Do(func() {
+		if s.Webhooks == nil {
+			s.Webhooks = NewWebhookDispatcher(s, defaultWebhookBackoff)
+		}
+	})
+	return s.Webhooks
+}
+
+// webhookSecretsFile holds the webhooks' secrets, by name, as JSON.
+const webhookSecretsFile = "webhook_secrets.table"
+
+// webhookSecrets are the webhooks' secrets, by name.
+func (s *Site) webhookSecrets() (map[string]string, error) {
+	secrets := map[string]string{}
+	data, err := ioutil.ReadFile(path.Join(s.PathToData, webhookSecretsFile))
+	if os.IsNotExist(err) {
+		return secrets, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &secrets)
+	return secrets, err
+}
+
+// SetWebhookSecret sets the secret the named webhook's payloads are signed
+// with; an empty one stops them being signed.
+func (s *Site) SetWebhookSecret(name, secret string) error {
+	if name == "" {
+		return fmt.Errorf("no webhook to set the secret of")
+	}
+	s.webhookSecretsMut.Lock()
+	defer s.webhookSecretsMut.Unlock()
+	secrets, err := s.webhookSecrets()
+	if err != nil {
+		return err
+	}
+	if secret == "" {
+		delete(secrets, name)
+	} else {
+		secrets[name] = secret
+	}
+	data, err := json.MarshalIndent(secrets, "", " ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(s.PathToData, webhookSecretsFile), data, 0600)
+}
+
+// ConfiguredWebhooks reads the webhooks from the system configuration page,
+// with their secrets.
+func (s *Site) ConfiguredWebhooks() []Webhook {
+	webhooks := []Webhook{}
+	if !s.hasPageFile(SystemConfigurationIdentifier, ".md") {
+		return webhooks
+	}
+	matter, err := s.ReadFrontMatter(SystemConfigurationIdentifier)
+	if err != nil {
+		return webhooks
+	}
+	normalizeFrontmatter(matter)
+	secrets, err := s.webhookSecrets()
+	if err != nil && s.Logger != nil {
+		s.Logger.Error("Could not read the webhook secrets, so payloads won't be signed: %v", err)
+	}
+	table, _ := frontmatterTable(matter, "webhooks", false)
+	for name, v := range table {
+		config, ok := v.(map[string]interface{})
+		if !ok || frontmatterString(config["url"]) == "" {
+			continue
+		}
+		if _, ok := config["secret"]; ok && s.Logger != nil {
+			s.Logger.Warn("Ignoring the secret of webhook %s in the system configuration page, where anyone can read it; set it with /system/webhook_secret", name)
+		}
+		webhooks = append(webhooks, Webhook{
+			Name:   name,
+			URL:    frontmatterString(config["url"]),
+			Secret: secrets[name],
+			Events: frontmatterStrings(config["events"]),
+		})
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].Name < webhooks[j].Name })
+	return webhooks
+}
+
+func signWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Publish sends an event, with data as its payload, to every webhook that
+// wants it.
+func (d *WebhookDispatcher) Publish(event string, data interface{}) {
+	for _, webhook := range d.site.ConfiguredWebhooks() {
+		if !webhook.wants(event) {
+			continue
+		}
+		d.mu.Lock()
+		d.nextID++
+		delivery := &WebhookDelivery{
+			ID:        fmt.Sprintf("%d", d.nextID),
+			Webhook:   webhook.Name,
+			Event:     event,
+			State:     DeliveryPending,
+			CreatedAt: time.Now(),
+		}
+		d.deliveries[delivery.ID] = delivery
+		d.order = append(d.order, delivery.ID)
+		if len(d.order) > deliveriesKept {
+			delete(d.deliveries, d.order[0])
+			d.order = d.order[1:]
+		}
+		d.mu.Unlock()
+
+		body, err := json.Marshal(map[string]interface{}{
+			"id":    delivery.ID,
+			"event": event,
+			"time":  delivery.CreatedAt,
+			"data":  data,
+		})
+		if err != nil {
+			d.finish(delivery, 0, err)
+			continue
+		}
+		d.attempt(webhook, delivery, body)
+	}
+}
+
+// attempt schedules the delivery's next attempt after its backoff.
+func (d *WebhookDispatcher) attempt(webhook Webhook, delivery *WebhookDelivery, body []byte) {
+	d.mu.Lock()
+	wait := d.backoff[delivery.Attempts]
+	delivery.NextAttempt = time.Now().Add(wait)
+	d.mu.Unlock()
+
+	time.AfterFunc(wait, func() {
+		status, err := d.send(webhook, delivery, body)
+		d.mu.Lock()
+		delivery.Attempts++
+		retry := err != nil && delivery.Attempts < len(d.backoff)
+		d.mu.Unlock()
+		if retry {
+			d.record(delivery, status, err)
+			d.attempt(webhook, delivery, body)
+			return
+		}
+		d.finish(delivery, status, err)
+	})
+}
+
+func (d *WebhookDispatcher) send(webhook Webhook, delivery *WebhookDelivery, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Wiki-Event", delivery.Event)
+	req.Header.Set("X-Wiki-Delivery", delivery.ID)
+	if webhook.Secret != "" {
+		req.Header.Set("X-Wiki-Signature", signWebhookPayload(webhook.Secret, body))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *WebhookDispatcher) record(delivery *WebhookDelivery, status int, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delivery.StatusCode = status
+	delivery.Error = ""
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+}
+
+func (d *WebhookDispatcher) finish(delivery *WebhookDelivery, status int, err error) {
+	d.record(delivery, status, err)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delivery.NextAttempt = time.Time{}
+	if err != nil {
+		delivery.State = DeliveryFailed
+		if d.site.Logger != nil {
+			d.site.Logger.Error("Gave up sending %s to webhook %s: %v", delivery.Event, delivery.Webhook, err)
+		}
+		return
+	}
+	delivery.State = DeliveryDelivered
+	delivery.DeliveredAt = time.Now()
+}
+
+// Deliveries lists the most recent deliveries, newest first.
+func (d *WebhookDispatcher) Deliveries() []WebhookDelivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	deliveries := []WebhookDelivery{}
+	for i := len(d.order) - 1; i >= 0; i-- {
+		deliveries = append(deliveries, *d.deliveries[d.order[i]])
+	}
+	return deliveries
+}
+
+func (s *Site) handleSetWebhookSecret(c *gin.Context) {
+	type QueryJSON struct {
+		Name   string `json:"name"`
+		Secret string `json:"secret"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	if err := s.SetWebhookSecret(json.Name, json.Secret); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Set the secret of webhook " + json.Name})
+}
+
+func (s *Site) handleWebhookDeliveries(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "webhooks": s.ConfiguredWebhooks(), "deliveries": s.webhooks().Deliveries()})
+}
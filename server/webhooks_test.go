@@ -0,0 +1,103 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookSecretsAreKeptOffThePage(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, SystemConfigurationIdentifier, "+++\n[webhooks.sync]\nurl = \"https://example.com/hooks/wiki\"\nsecret = \"anyone can read this\"\n+++\n")
+
+	webhooks := s.ConfiguredWebhooks()
+	if len(webhooks) != 1 || webhooks[0].Secret != "" {
+		t.Errorf("Expected the secret on the page to be ignored, got %+v", webhooks)
+	}
+	if err := s.SetWebhookSecret("sync", "shh"); err != nil {
+		t.Fatal(err)
+	}
+	if webhooks := s.ConfiguredWebhooks(); webhooks[0].Secret != "shh" {
+		t.Errorf("Expected the secret that was set, got %+v", webhooks)
+	}
+	if err := s.SetWebhookSecret("sync", ""); err != nil {
+		t.Fatal(err)
+	}
+	if webhooks := s.ConfiguredWebhooks(); webhooks[0].Secret != "" {
+		t.Errorf("Expected the secret to be cleared, got %+v", webhooks)
+	}
+	if err := s.SetWebhookSecret("", "shh"); err == nil {
+		t.Error("Expected a secret without a webhook to be refused")
+	}
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	// RFC 4231, test case 2
+	if signature := signWebhookPayload("Jefe", []byte("what do ya want for nothing?")); signature != "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843" {
+		t.Errorf("Unexpected signature %s", signature)
+	}
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	var mu sync.Mutex
+	hits := map[string]int{}
+	failures := map[string]int{"/flaky": 2, "/down": 100}
+	signatures := []string{}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		hits[r.URL.Path]++
+		if r.URL.Path == "/signed" && r.Header.Get("X-Wiki-Signature") != signWebhookPayload("shh", body) {
+			signatures = append(signatures, r.Header.Get("X-Wiki-Signature"))
+		}
+		if hits[r.URL.Path] <= failures[r.URL.Path] {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	s := &Site{PathToData: t.TempDir()}
+	s.Webhooks = NewWebhookDispatcher(s, []time.Duration{0, time.Millisecond, time.Millisecond})
+	s.SetWebhookSecret("signed", "shh")
+	newTestPage(s, SystemConfigurationIdentifier, "+++\n"+
+		"[webhooks.deletions]\nurl = \""+receiver.URL+"/deletions\"\nevents = [\"page.deleted\"]\n"+
+		"[webhooks.down]\nurl = \""+receiver.URL+"/down\"\nevents = [\"page.updated\"]\n"+
+		"[webhooks.flaky]\nurl = \""+receiver.URL+"/flaky\"\nevents = [\"page.updated\"]\n"+
+		"[webhooks.signed]\nurl = \""+receiver.URL+"/signed\"\n"+
+		"+++\n")
+
+	s.webhooks().Publish(PageUpdatedEvent, map[string]string{"page": "garden"})
+	states := map[string]WebhookDelivery{}
+	for i := 0; i < 1000; i++ {
+		done := true
+		for _, delivery := range s.webhooks().Deliveries() {
+			if delivery.Event == PageUpdatedEvent {
+				states[delivery.Webhook] = delivery
+			}
+			done = done && delivery.State != DeliveryPending
+		}
+		if done {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := states["deletions"]; ok || hits["/deletions"] != 0 {
+		t.Errorf("Expected a webhook not to be sent events it didn't ask for, got %+v", states["deletions"])
+	}
+	if delivery := states["flaky"]; delivery.State != DeliveryDelivered || delivery.Attempts != 3 {
+		t.Errorf("Expected the delivery to be retried until it got through, got %+v", delivery)
+	}
+	if delivery := states["down"]; delivery.State != DeliveryFailed || delivery.Attempts != 3 || delivery.StatusCode != http.StatusServiceUnavailable || hits["/down"] != 3 {
+		t.Errorf("Expected the delivery to be given up on after 3 attempts, got %+v after %d", delivery, hits["/down"])
+	}
+	if delivery := states["signed"]; delivery.State != DeliveryDelivered || len(signatures) != 0 {
+		t.Errorf("Expected the delivery to be signed with the secret, got %+v %q", delivery, signatures)
+	}
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImportedPage is a page converted from another wiki, ready to be written.
+type ImportedPage struct {
+	Identifier string
+	Title      string
+	Tags       []string
+	Markdown   string
+	// Warnings are things that could not be converted, e.g. missing files.
+	Warnings []string
+}
+
+// WikiImporter converts the export of another wiki into pages. Attachments
+// are stored with the upload function it is given, which returns the URL to
+// link to.
+type WikiImporter interface {
+	Pages(source string, upload func(filename string, data []byte) (string, error)) ([]ImportedPage, error)
+}
+
+// WikiImporters are the formats ImportWiki understands.
+var WikiImporters = map[string]WikiImporter{
+	"obsidian":  obsidianImporter{},
+	"notion":    notionImporter{},
+	"mediawiki": mediaWikiImporter{},
+}
+
+// escapeTemplates stops imported text from being run as a page template.
+func escapeTemplates(markdown string) string {
+	return strings.Replace(markdown, "{{", `{{"{{"}}`, -1)
+}
+
+// importsDir is the folder in the data folder exports of other wikis are put
+// in to be imported.
+const importsDir = "imports"
+
+// ImportWiki converts the export at source, a path in the imports folder of
+// the data folder, and writes the pages on the user job queue, one job
+// record per page. Pages that already exist are left alone and reported as
+// failures. trace is the id of the request asking for it.
+func (s *Site) ImportWiki(trace, format, source string) (string, error) {
+	importer, ok := WikiImporters[format]
+	if !ok {
+		return "", fmt.Errorf("don't know how to import %q", format)
+	}
+	source, err := s.confinedPath(importsDir, source)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(source); err != nil {
+		return "", err
+	}
+
+	return s.jobs().EnqueueTraced(trace, UserQueue, format+" import", func(progress *JobProgress) error {
+		started := time.Now()
+		pages, err := importer.Pages(source, s.saveUpload)
+		if err != nil {
+			return err
+		}
+		progress.SetTotal(len(pages))
+		for _, page := range pages {
+			err := s.writeImportedPage(page)
+			if err == nil && len(page.Warnings) > 0 {
+				err = errors.New("imported, but " + strings.Join(page.Warnings, "; "))
+			}
+			progress.Record(page.Identifier, started, err)
+			started = time.Now()
+		}
+		return nil
+	})
+}
+
+func (s *Site) writeImportedPage(page ImportedPage) error {
+	if page.Identifier == "" {
+		return errors.New("no identifier")
+	}
+	p := s.Open(page.Identifier)
+	if !p.IsNew() {
+		return errors.New("a page with this identifier already exists")
+	}
+	if err := s.checkIdentifierCollision(page.Identifier); err != nil {
+		return err
+	}
+
+	matter := map[string]interface{}{"identifier": page.Identifier}
+	if page.Title != "" {
+		matter["title"] = page.Title
+	}
+	if len(page.Tags) > 0 {
+		tags := []interface{}{}
+		for _, tag := range page.Tags {
+			tags = append(tags, tag)
+		}
+		matter["tags"] = tags
+	}
+	text, err := JoinFrontmatter(matter, "\n"+escapeTemplates(page.Markdown), false)
+	if err != nil {
+		return err
+	}
+	return p.Update(text)
+}
+
+// saveUpload stores an attachment the same way handleUpload does and returns
+// the URL it can be linked at.
+func (s *Site) saveUpload(filename string, data []byte) (string, error) {
+	if err := s.checkDiskQuota(int64(len(data))); err != nil {
+		return "", err
+	}
+	newName, err := s.storeUpload(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	if err := s.recordUpload(newName, filename); err != nil {
+		return "", err
+	}
+	s.metrics().Inc("wiki_uploads_total")
+	return "/uploads/" + newName + "?filename=" + url.QueryEscape(filename), nil
+}
+
+func (s *Site) handleImportWiki(c *gin.Context) {
+	type QueryJSON struct {
+		Format string `json:"format"`
+		Source string `json:"source"`
+	}
+	var json QueryJSON
+	err := c.BindJSON(&json)
+	if err != nil {
+		s.Logger.Trace(err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Wrong JSON"})
+		return
+	}
+	id, err := s.ImportWiki(requestTrace(c), json.Format, json.Source)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Importing", "job_id": id})
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/xml"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// mediaWikiImporter reads a MediaWiki XML dump (Special:Export or
+// dumpBackup.php), taking the latest revision of each article. Dumps don't
+// carry uploaded files, so images are reported rather than imported.
+type mediaWikiImporter struct{}
+
+type mediaWikiDump struct {
+	Pages []struct {
+		Title     string `xml:"title"`
+		Namespace int    `xml:"ns"`
+		Redirect  *struct {
+			Title string `xml:"title,attr"`
+		} `xml:"redirect"`
+		Revisions []struct {
+			Text string `xml:"text"`
+		} `xml:"revision"`
+	} `xml:"page"`
+}
+
+var (
+	rWikiCategory = regexp.MustCompile(`\[\[Category:([^\]|]+)(?:\|[^\]]*)?\]\]\n?`)
+	rWikiFile     = regexp.MustCompile(`\[\[(?:File|Image):([^\]|]+)(?:\|[^\]]*)?\]\]`)
+	rWikiLink     = regexp.MustCompile(`\[\[([^\]|#]+)(#[^\]|]*)?(?:\|([^\]]+))?\]\]`)
+	rWikiExtLink  = regexp.MustCompile(`\[(https?://[^\s\]]+)\s+([^\]]+)\]`)
+	rWikiHeading  = regexp.MustCompile(`(?m)^(={1,6})\s*(.+?)\s*={1,6}\s*$`)
+	rWikiBold     = regexp.MustCompile(`'''(.+?)'''`)
+	rWikiItalic   = regexp.MustCompile(`''(.+?)''`)
+	rWikiNumbered = regexp.MustCompile(`(?m)^(#+)\s*`)
+	rWikiBullet   = regexp.MustCompile(`(?m)^(\*+)\s*`)
+)
+
+func (mediaWikiImporter) Pages(source string, upload func(string, []byte) (string, error)) ([]ImportedPage, error) {
+	f, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dump := mediaWikiDump{}
+	if err := xml.NewDecoder(f).Decode(&dump); err != nil {
+		return nil, err
+	}
+
+	pages := []ImportedPage{}
+	for _, p := range dump.Pages {
+		if p.Namespace != 0 || len(p.Revisions) == 0 {
+			continue // only articles
+		}
+		page := ImportedPage{Identifier: MungeIdentifier(p.Title), Title: p.Title, Tags: []string{}}
+		if p.Redirect != nil {
+			page.Markdown = "Moved to [" + p.Redirect.Title + "](/" + MungeIdentifier(p.Redirect.Title) + "/view)\n"
+			pages = append(pages, page)
+			continue
+		}
+		page.Markdown = convertWikitext(p.Revisions[len(p.Revisions)-1].Text, &page)
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// convertWikitext handles the common wikitext markup. Templates, tables and
+// the like are left as they are.
+func convertWikitext(text string, page *ImportedPage) string {
+	text = rWikiCategory.ReplaceAllStringFunc(text, func(category string) string {
+		page.Tags = append(page.Tags, strings.TrimSpace(rWikiCategory.FindStringSubmatch(category)[1]))
+		return ""
+	})
+	text = rWikiFile.ReplaceAllStringFunc(text, func(file string) string {
+		page.Warnings = append(page.Warnings, "file "+strings.TrimSpace(rWikiFile.FindStringSubmatch(file)[1])+" is not in the dump")
+		return file
+	})
+	// lists go before headings and bold, whose markdown starts with # and *
+	text = rWikiNumbered.ReplaceAllStringFunc(text, func(marker string) string {
+		return strings.Repeat("   ", len(strings.TrimSpace(marker))-1) + "1. "
+	})
+	text = rWikiBullet.ReplaceAllStringFunc(text, func(marker string) string {
+		return strings.Repeat("  ", len(strings.TrimSpace(marker))-1) + "- "
+	})
+	text = rWikiHeading.ReplaceAllStringFunc(text, func(heading string) string {
+		match := rWikiHeading.FindStringSubmatch(heading)
+		return strings.Repeat("#", len(match[1])) + " " + match[2]
+	})
+	text = rWikiLink.ReplaceAllStringFunc(text, func(link string) string {
+		match := rWikiLink.FindStringSubmatch(link)
+		target := strings.TrimSpace(match[1])
+		if rWikiFile.MatchString(link) {
+			return link
+		}
+		label := target
+		if match[3] != "" {
+			label = match[3]
+		}
+		return "[" + label + "](/" + MungeIdentifier(target) + "/view)"
+	})
+	text = rWikiExtLink.ReplaceAllString(text, "[$2]($1)")
+	text = rWikiBold.ReplaceAllString(text, "**$1**")
+	text = rWikiItalic.ReplaceAllString(text, "*$1*")
+	return text
+}
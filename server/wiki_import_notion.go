@@ -0,0 +1,88 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// notionImporter reads an unzipped Notion "Markdown & CSV" export. Notion
+// names every file `Page Title <32 hex digit id>.md`, puts a page's files in
+// a folder of the same name, and links between them with relative paths.
+type notionImporter struct{}
+
+var rNotionID = regexp.MustCompile(`\s+[0-9a-f]{32}$`)
+var rMarkdownLink = regexp.MustCompile(`\[([^\]]*)\]\(([^)\s]+)\)`)
+var rNotionTags = regexp.MustCompile(`(?m)^Tags:\s*(.+)$`)
+
+func notionName(filename string) string {
+	return rNotionID.ReplaceAllString(strings.TrimSuffix(filename, filepath.Ext(filename)), "")
+}
+
+func (notionImporter) Pages(source string, upload func(string, []byte) (string, error)) ([]ImportedPage, error) {
+	notes := []string{}
+	err := filepath.Walk(source, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.EqualFold(filepath.Ext(p), ".md") {
+			notes = append(notes, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pages := []ImportedPage{}
+	for _, note := range notes {
+		content, err := ioutil.ReadFile(note)
+		if err != nil {
+			return nil, err
+		}
+		name := notionName(filepath.Base(note))
+		page := ImportedPage{Identifier: MungeIdentifier(name), Title: name, Tags: []string{}}
+		body := string(content)
+
+		if match := rNotionTags.FindStringSubmatch(body); match != nil {
+			for _, tag := range strings.Split(match[1], ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					page.Tags = append(page.Tags, tag)
+				}
+			}
+		}
+
+		body = rMarkdownLink.ReplaceAllStringFunc(body, func(link string) string {
+			match := rMarkdownLink.FindStringSubmatch(link)
+			text, target := match[1], match[2]
+			if strings.Contains(target, "://") || strings.HasPrefix(target, "mailto:") || strings.HasPrefix(target, "#") {
+				return link
+			}
+			target, err := url.PathUnescape(target)
+			if err != nil {
+				return link
+			}
+			if strings.EqualFold(filepath.Ext(target), ".md") {
+				return "[" + text + "](/" + MungeIdentifier(notionName(filepath.Base(target))) + "/view)"
+			}
+			data, err := ioutil.ReadFile(filepath.Join(filepath.Dir(note), target))
+			if err != nil {
+				page.Warnings = append(page.Warnings, "missing attachment "+target)
+				return link
+			}
+			uploaded, err := upload(filepath.Base(target), data)
+			if err != nil {
+				page.Warnings = append(page.Warnings, err.Error())
+				return link
+			}
+			return "[" + text + "](" + uploaded + ")"
+		})
+
+		page.Markdown = body
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
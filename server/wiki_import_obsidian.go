@@ -0,0 +1,106 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// obsidianImporter reads an Obsidian vault: a folder of markdown notes that
+// link with [[Note Name]] and embed files with ![[file.png]] from anywhere in
+// the vault.
+type obsidianImporter struct{}
+
+var rObsidianEmbed = regexp.MustCompile(`!\[\[([^\]|#]+)(?:[|#][^\]]*)?\]\]`)
+var rObsidianLink = regexp.MustCompile(`\[\[([^\]|#]+)(#[^\]|]*)?(?:\|([^\]]+))?\]\]`)
+
+func (obsidianImporter) Pages(source string, upload func(string, []byte) (string, error)) ([]ImportedPage, error) {
+	notes := []string{}
+	files := map[string]string{} // lowercased file name to path, as Obsidian resolves them
+	err := filepath.Walk(source, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") && p != source {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		files[strings.ToLower(info.Name())] = p
+		if strings.EqualFold(filepath.Ext(p), ".md") {
+			notes = append(notes, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pages := []ImportedPage{}
+	for _, note := range notes {
+		content, err := ioutil.ReadFile(note)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(filepath.Base(note), filepath.Ext(note))
+		page := ImportedPage{Identifier: MungeIdentifier(name), Title: name, Tags: []string{}}
+
+		matter, body, _, err := SplitFrontmatter(string(content))
+		if err != nil {
+			matter, body = map[string]interface{}{}, string(content)
+		}
+		if title := frontmatterString(matter["title"]); title != "" {
+			page.Title = title
+		}
+		page.Tags = append(page.Tags, frontmatterStrings(matter["tags"])...)
+		for _, tag := range rHashtag.FindAllStringSubmatch(body, -1) {
+			if !stringInSlice(tag[1], page.Tags) {
+				page.Tags = append(page.Tags, tag[1])
+			}
+		}
+
+		body = rObsidianEmbed.ReplaceAllStringFunc(body, func(embed string) string {
+			target := strings.TrimSpace(rObsidianEmbed.FindStringSubmatch(embed)[1])
+			ext := filepath.Ext(target)
+			if ext == "" || strings.EqualFold(ext, ".md") {
+				return "[" + target + "](/" + MungeIdentifier(strings.TrimSuffix(target, ext)) + "/view)"
+			}
+			file, ok := files[strings.ToLower(filepath.Base(target))]
+			if !ok {
+				page.Warnings = append(page.Warnings, "missing attachment "+target)
+				return embed
+			}
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				page.Warnings = append(page.Warnings, err.Error())
+				return embed
+			}
+			link, err := upload(filepath.Base(target), data)
+			if err != nil {
+				page.Warnings = append(page.Warnings, err.Error())
+				return embed
+			}
+			return "![" + filepath.Base(target) + "](" + link + ")"
+		})
+
+		body = rObsidianLink.ReplaceAllStringFunc(body, func(link string) string {
+			match := rObsidianLink.FindStringSubmatch(link)
+			target := strings.TrimSpace(match[1])
+			text := target
+			if match[3] != "" {
+				text = match[3]
+			}
+			return "[" + text + "](/" + MungeIdentifier(strings.TrimSuffix(target, ".md")) + "/view)"
+		})
+
+		page.Markdown = body
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
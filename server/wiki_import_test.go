@@ -0,0 +1,159 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fakeUpload(uploaded map[string]string) func(string, []byte) (string, error) {
+	return func(filename string, data []byte) (string, error) {
+		uploaded[filename] = string(data)
+		return "/uploads/" + filename, nil
+	}
+}
+
+func TestObsidianImport(t *testing.T) {
+	vault := t.TempDir()
+	os.MkdirAll(filepath.Join(vault, "attachments"), 0755)
+	os.MkdirAll(filepath.Join(vault, ".obsidian"), 0755)
+	ioutil.WriteFile(filepath.Join(vault, ".obsidian", "app.json"), []byte("{}"), 0644)
+	ioutil.WriteFile(filepath.Join(vault, "attachments", "drill.png"), []byte("png"), 0644)
+	ioutil.WriteFile(filepath.Join(vault, "Power Tools.md"), []byte("---\ntags: [garage]\n---\n"+
+		"See [[Cordless Drill|the drill]] and [[Workbench]]. #tools\n![[drill.png]]\n![[missing.jpg]]\n"), 0644)
+
+	uploaded := map[string]string{}
+	pages, err := obsidianImporter{}.Pages(vault, fakeUpload(uploaded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 {
+		t.Fatalf("Expected one page, got %v", pages)
+	}
+	page := pages[0]
+	if page.Identifier != "power_tools" || page.Title != "Power Tools" {
+		t.Errorf("Unexpected page: %+v", page)
+	}
+	if strings.Join(page.Tags, ",") != "garage,tools" {
+		t.Errorf("Unexpected tags: %v", page.Tags)
+	}
+	for _, expected := range []string{"[the drill](/cordless_drill/view)", "[Workbench](/workbench/view)", "![drill.png](/uploads/drill.png)"} {
+		if !strings.Contains(page.Markdown, expected) {
+			t.Errorf("Expected %q in %s", expected, page.Markdown)
+		}
+	}
+	if uploaded["drill.png"] != "png" {
+		t.Errorf("Did not upload the attachment: %v", uploaded)
+	}
+	if len(page.Warnings) != 1 || !strings.Contains(page.Warnings[0], "missing.jpg") {
+		t.Errorf("Expected a warning about the missing attachment: %v", page.Warnings)
+	}
+}
+
+func TestNotionImport(t *testing.T) {
+	export := t.TempDir()
+	hash := "0123456789abcdef0123456789abcdef"
+	os.MkdirAll(filepath.Join(export, "Garage "+hash), 0755)
+	ioutil.WriteFile(filepath.Join(export, "Garage "+hash, "receipt.pdf"), []byte("pdf"), 0644)
+	ioutil.WriteFile(filepath.Join(export, "Garage "+hash+".md"), []byte("# Garage\n\nTags: home, storage\n\n"+
+		"[Shelf](Garage%20"+hash+"/Shelf%20"+hash+".md) [receipt](Garage%20"+hash+"/receipt.pdf) [site](https://example.com)\n"), 0644)
+
+	uploaded := map[string]string{}
+	pages, err := notionImporter{}.Pages(export, fakeUpload(uploaded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 || pages[0].Identifier != "garage" {
+		t.Fatalf("Unexpected pages: %+v", pages)
+	}
+	if strings.Join(pages[0].Tags, ",") != "home,storage" {
+		t.Errorf("Unexpected tags: %v", pages[0].Tags)
+	}
+	for _, expected := range []string{"[Shelf](/shelf/view)", "[receipt](/uploads/receipt.pdf)", "[site](https://example.com)"} {
+		if !strings.Contains(pages[0].Markdown, expected) {
+			t.Errorf("Expected %q in %s", expected, pages[0].Markdown)
+		}
+	}
+}
+
+func TestMediaWikiImport(t *testing.T) {
+	dump := filepath.Join(t.TempDir(), "dump.xml")
+	ioutil.WriteFile(dump, []byte(`<mediawiki>
+  <page><title>Main Page</title><ns>0</ns>
+    <revision><text>old</text></revision>
+    <revision><text>== Tools ==
+'''Bold''' and ''italic'' [[Hand Saw|saws]] [https://example.com site]
+# first
+[[File:saw.jpg|thumb]]
+[[Category:Workshop]]</text></revision>
+  </page>
+  <page><title>Template:Box</title><ns>10</ns><revision><text>box</text></revision></page>
+  <page><title>Saw</title><ns>0</ns><redirect title="Hand Saw" /><revision><text>#REDIRECT [[Hand Saw]]</text></revision></page>
+</mediawiki>`), 0644)
+
+	pages, err := mediaWikiImporter{}.Pages(dump, fakeUpload(map[string]string{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("Expected two articles, got %+v", pages)
+	}
+	main := pages[0]
+	if main.Identifier != "main_page" || strings.Join(main.Tags, ",") != "Workshop" {
+		t.Errorf("Unexpected page: %+v", main)
+	}
+	for _, expected := range []string{"## Tools", "**Bold** and *italic*", "[saws](/hand_saw/view)", "[site](https://example.com)", "1. first"} {
+		if !strings.Contains(main.Markdown, expected) {
+			t.Errorf("Expected %q in %s", expected, main.Markdown)
+		}
+	}
+	if len(main.Warnings) != 1 {
+		t.Errorf("Expected a warning about the file: %v", main.Warnings)
+	}
+	if !strings.Contains(pages[1].Markdown, "(/hand_saw/view)") {
+		t.Errorf("Expected the redirect to link to its target: %s", pages[1].Markdown)
+	}
+}
+
+func TestWriteImportedPageKeepsExisting(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	newTestPage(s, "garage", "mine")
+	if err := s.writeImportedPage(ImportedPage{Identifier: "garage", Markdown: "theirs"}); err == nil {
+		t.Error("Expected an existing page to be left alone")
+	}
+	if err := s.writeImportedPage(ImportedPage{Identifier: "shed", Title: "Shed", Markdown: "{{.Title}}"}); err != nil {
+		t.Fatal(err)
+	}
+	if text := s.Open("shed").Text.GetCurrent(); !strings.Contains(text, `{{"{{"}}.Title}}`) {
+		t.Errorf("Expected templates to be escaped: %s", text)
+	}
+}
+
+func TestImportWikiConfinesSource(t *testing.T) {
+	s := &Site{PathToData: t.TempDir()}
+	outside := t.TempDir()
+	ioutil.WriteFile(filepath.Join(outside, "secret.md"), []byte("secret"), 0644)
+	for _, source := range []string{outside, "../" + filepath.Base(s.PathToData), "vault/../../etc", ""} {
+		if _, err := s.ImportWiki("", "obsidian", source); err == nil {
+			t.Errorf("Expected importing from %q to be refused", source)
+		}
+	}
+	os.MkdirAll(filepath.Join(s.PathToData, importsDir, "vault"), 0755)
+	ioutil.WriteFile(filepath.Join(s.PathToData, importsDir, "vault", "shed.md"), []byte("# Shed"), 0644)
+	id, err := s.ImportWiki("", "obsidian", "vault")
+	if err != nil {
+		t.Fatalf("Expected a vault in the imports folder to be imported, got %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		if details, _ := s.jobs().Details(id); details.State == JobSucceeded {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if s.Open("shed").IsNew() {
+		t.Error("Expected the vault's page to be imported")
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/brendanjerwin/simple_wiki/server"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// snapshotIndexFile is the search index in a snapshot directory, next to
+// the pages.
+const snapshotIndexFile = ".snapshot_index.json"
+
+// snapshotBatch is how many pages are pulled a request.
+const snapshotBatch = 100
+
+var snapshotDirFlag = cli.StringFlag{
+	Name:   "dir",
+	Value:  "wiki_snapshot",
+	EnvVar: envName("snapshot-dir"),
+	Usage:  "Directory the snapshot is kept in",
+}
+
+// snapshotPath is where a page's markdown goes in the snapshot, with
+// namespaces as directories. It is "" for identifiers that would land
+// outside the snapshot.
+func snapshotPath(dir, identifier string) string {
+	if identifier == "" || strings.Contains(identifier, "..") {
+		return ""
+	}
+	return filepath.Join(dir, filepath.FromSlash(identifier)+".md")
+}
+
+func readSnapshotIndex(dir string) (*server.SearchIndex, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, snapshotIndexFile))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no snapshot in %s; take one with simple_wiki snapshot --dir %s", dir, dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	index := server.NewSearchIndex()
+	return index, json.Unmarshal(data, index)
+}
+
+// takeSnapshot pulls every page into dir as markdown, indexes them, and
+// removes the pages the last snapshot had that are gone. It returns how
+// many pages it wrote.
+func takeSnapshot(w *wikiClient, dir string) (int, error) {
+	previous, _ := readSnapshotIndex(dir)
+	index := server.NewSearchIndex()
+	pulled := map[string]bool{}
+	for offset := 0; ; offset += snapshotBatch {
+		var response struct {
+			Pages []server.RawPage `json:"pages"`
+			Total int              `json:"total"`
+		}
+		if err := w.post("/export/pages", server.PageListOptions{Offset: offset, Limit: snapshotBatch}, &response); err != nil {
+			return len(pulled), err
+		}
+		for _, page := range response.Pages {
+			target := snapshotPath(dir, page.Identifier)
+			if target == "" {
+				continue
+			}
+			text := page.Markdown
+			if len(page.Frontmatter) > 0 {
+				var err error
+				if text, err = server.JoinFrontmatter(page.Frontmatter, page.Markdown, false); err != nil {
+					return len(pulled), err
+				}
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return len(pulled), err
+			}
+			if err := ioutil.WriteFile(target, []byte(text), 0644); err != nil {
+				return len(pulled), err
+			}
+			title, _ := page.Frontmatter["title"].(string)
+			index.Add(page.Identifier, title, page.Markdown)
+			pulled[page.Identifier] = true
+		}
+		if len(response.Pages) == 0 || offset+snapshotBatch >= response.Total {
+			break
+		}
+	}
+
+	if previous != nil {
+		for _, page := range previous.Pages {
+			if target := snapshotPath(dir, page.Identifier); target != "" && !pulled[page.Identifier] {
+				os.Remove(target)
+			}
+		}
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return len(pulled), err
+	}
+	return len(pulled), ioutil.WriteFile(filepath.Join(dir, snapshotIndexFile), data, 0644)
+}
+
+// snapshotCommand keeps a copy of the wiki to read, grep and search while
+// the server can't be reached.
+var snapshotCommand = cli.Command{
+	Name:  "snapshot",
+	Usage: "Copy every page into a local directory as markdown and index it, to grep or search with snapshot search while offline",
+	Flags: withClientFlags(snapshotDirFlag),
+	Action: clientAction(func(c *cli.Context, w *wikiClient) error {
+		dir := c.String("dir")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		pulled, err := takeSnapshot(w, dir)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Copied %d pages into %s\n", pulled, dir)
+		return nil
+	}),
+	Subcommands: []cli.Command{
+		{
+			Name:      "search",
+			Usage:     "Search the last snapshot, printing the best matching pages' files and titles",
+			ArgsUsage: "WORDS...",
+			Flags: []cli.Flag{snapshotDirFlag, cli.IntFlag{
+				Name:  "limit",
+				Value: 20,
+				Usage: "Most pages to print",
+			}},
+			Action: func(c *cli.Context) error {
+				dir := c.String("dir")
+				index, err := readSnapshotIndex(dir)
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+				for _, result := range index.Search(strings.Join(c.Args(), " "), c.Int("limit")) {
+					fmt.Printf("%s\t%s\n", snapshotPath(dir, result.Identifier), result.Title)
+				}
+				return nil
+			},
+		},
+	},
+}